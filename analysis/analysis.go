@@ -0,0 +1,262 @@
+// Package analysis finds likely mistakes in a parsed program that don't stop
+// it from running: names that are never used, code that can't run and
+// conditions that never change. It only reads the program.
+package analysis
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+// Warning is one likely mistake.
+type Warning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("warning at %d:%d: %s", w.Pos.Line, w.Pos.Column, w.Message)
+}
+
+// Program returns the warnings for program in source order:
+//
+//   - a let inside a function or switch arm, or a pattern binding, whose
+//     name is never read before it goes out of scope or is redeclared.
+//     Top-level lets are globals that later scripts and REPL lines may use,
+//     so they aren't reported. Assigning to a name doesn't read it.
+//   - a function parameter that is never read, unless it starts with _.
+//   - statements after a return, break or continue in the same block.
+//   - an if or while whose condition is true or false, except while (true),
+//     the usual way to loop until a break.
+//
+// A name is resolved as the engines resolve it, so a read counts only
+// toward the innermost binding it could mean.
+func Program(program *ast.Program) []Warning {
+	a := &analyzer{}
+	a.scope = &scope{names: map[string]*binding{}}
+	a.statements(program.Statements)
+	a.close()
+
+	sort.SliceStable(a.warnings, func(i, j int) bool {
+		pi, pj := a.warnings[i].Pos, a.warnings[j].Pos
+		return pi.Line < pj.Line || pi.Line == pj.Line && pi.Column < pj.Column
+	})
+	return a.warnings
+}
+
+type binding struct {
+	name   *ast.Identifier
+	param  bool
+	report bool
+	used   bool
+}
+
+type scope struct {
+	outer *scope
+	names map[string]*binding
+	// local is set for function bodies and switch arms, whose lets are
+	// reported; the top level's aren't.
+	local bool
+}
+
+type analyzer struct {
+	scope    *scope
+	warnings []Warning
+}
+
+func (a *analyzer) warn(pos token.Position, format string, args ...any) {
+	a.warnings = append(a.warnings, Warning{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (a *analyzer) open(local bool) {
+	a.scope = &scope{outer: a.scope, names: map[string]*binding{}, local: local}
+}
+
+// close reports the unused bindings of the innermost scope and leaves it.
+func (a *analyzer) close() {
+	for _, b := range a.scope.names {
+		a.unused(b)
+	}
+	a.scope = a.scope.outer
+}
+
+func (a *analyzer) unused(b *binding) {
+	if b.used || !b.report {
+		return
+	}
+	if b.param {
+		a.warn(b.name.Token.Pos, "parameter %q is never used", b.name.Value)
+	} else {
+		a.warn(b.name.Token.Pos, "%q is declared and not used", b.name.Value)
+	}
+}
+
+// declare binds name in the innermost scope. A binding it replaces there is
+// finished with, so it is reported now if it went unused.
+func (a *analyzer) declare(name *ast.Identifier, param bool) {
+	if previous, ok := a.scope.names[name.Value]; ok {
+		a.unused(previous)
+	}
+	report := name.Value != "_"
+	if param {
+		report = name.Value == "" || name.Value[0] != '_'
+	} else if !a.scope.local {
+		report = false
+	}
+	a.scope.names[name.Value] = &binding{name: name, param: param, report: report}
+}
+
+// use marks the binding name resolves to as read.
+func (a *analyzer) use(name string) {
+	for s := a.scope; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			b.used = true
+			return
+		}
+	}
+}
+
+// statements analyzes a block's statements, reporting the first one after a
+// return, break or continue.
+func (a *analyzer) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		a.statement(stmt)
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			if i+1 < len(stmts) {
+				a.warn(ast.Pos(stmts[i+1]), "unreachable code")
+			}
+			for _, rest := range stmts[i+1:] {
+				a.statement(rest)
+			}
+			return
+		}
+	}
+}
+
+func (a *analyzer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		// As in the engines, the value can't see the name it's bound to,
+		// except a function calling itself, which doesn't count as a use.
+		a.expression(stmt.Value)
+		a.declare(stmt.Name, false)
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue != nil {
+			a.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		a.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		a.statements(stmt.Statements)
+	}
+}
+
+func (a *analyzer) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		a.use(expr.Value)
+	case *ast.PrefixExpression:
+		a.expression(expr.Right)
+	case *ast.InfixExpression:
+		a.expression(expr.Left)
+		a.expression(expr.Right)
+	case *ast.AssignExpression:
+		if _, ok := expr.Target.(*ast.Identifier); !ok {
+			a.expression(expr.Target)
+		}
+		a.expression(expr.Value)
+	case *ast.IfExpression:
+		a.constantCondition(expr.Condition, "if")
+		a.expression(expr.Condition)
+		a.statements(expr.Consequence.Statements)
+		if expr.Alternative != nil {
+			a.statements(expr.Alternative.Statements)
+		}
+	case *ast.WhileExpression:
+		a.constantCondition(expr.Condition, "while")
+		a.expression(expr.Condition)
+		a.statements(expr.Body.Statements)
+	case *ast.SwitchExpression:
+		a.expression(expr.Subject)
+		for _, arm := range expr.Cases {
+			a.open(true)
+			if arm.Value != nil {
+				a.expression(arm.Value)
+			}
+			if arm.Pattern != nil {
+				a.pattern(arm.Pattern)
+			}
+			if arm.Guard != nil {
+				a.expression(arm.Guard)
+			}
+			a.statements(arm.Body.Statements)
+			a.close()
+		}
+	case *ast.FunctionLiteral:
+		a.open(true)
+		if expr.Name != "" {
+			// The function's own name refers to itself, not to anything
+			// outside.
+			a.scope.names[expr.Name] = &binding{name: &ast.Identifier{Value: expr.Name}}
+		}
+		for _, param := range expr.Parameters {
+			a.declare(param, true)
+		}
+		a.statements(expr.Body.Statements)
+		a.close()
+	case *ast.CallExpression:
+		if member, ok := expr.Function.(*ast.MemberExpression); ok {
+			// value.name(args) may call the function name in scope.
+			a.expression(member.Left)
+			a.use(member.Member.Value)
+		} else {
+			a.expression(expr.Function)
+		}
+		for _, arg := range expr.Arguments {
+			a.expression(arg)
+		}
+	case *ast.PipeExpression:
+		a.expression(expr.Left)
+		a.expression(expr.Right)
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			a.expression(el)
+		}
+	case *ast.HashLiteral:
+		for _, key := range expr.Keys() {
+			a.expression(key)
+			a.expression(expr.Pairs[key])
+		}
+	case *ast.IndexExpression:
+		a.expression(expr.Left)
+		a.expression(expr.Index)
+	case *ast.MemberExpression:
+		a.expression(expr.Left)
+	}
+}
+
+func (a *analyzer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		a.declare(pattern.Name, false)
+	case *ast.ArrayPattern:
+		for _, el := range pattern.Elements {
+			a.pattern(el)
+		}
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			a.pattern(value)
+		}
+	}
+}
+
+func (a *analyzer) constantCondition(cond ast.Expression, keyword string) {
+	b, ok := cond.(*ast.Boolean)
+	if !ok || keyword == "while" && b.Value {
+		return
+	}
+	a.warn(b.Token.Pos, "%s condition is always %t", keyword, b.Value)
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{"unused_let.mk", []string{
+			// only read by +=, then redeclared
+			`warning at 2:7: "sum" is declared and not used`,
+			`warning at 3:7: "unused" is declared and not used`,
+			`warning at 14:7: "count" is declared and not used`,
+			`warning at 18:16: "b" is declared and not used`,
+		}},
+		{"unused_param.mk", []string{
+			`warning at 1:18: parameter "b" is never used`,
+			// the inner x shadows it
+			`warning at 2:19: parameter "x" is never used`,
+		}},
+		{"unreachable.mk", []string{
+			`warning at 3:3: unreachable code`,
+			`warning at 11:5: unreachable code`,
+			`warning at 14:3: unreachable code`,
+			`warning at 17:1: unreachable code`,
+		}},
+		{"constant_condition.mk", []string{
+			`warning at 1:5: if condition is always true`,
+			`warning at 2:5: if condition is always false`,
+			`warning at 3:8: while condition is always false`,
+		}},
+		{"clean.mk", nil},
+	}
+
+	for _, tt := range tests {
+		source, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := parser.New(lexer.New(string(source))).ParseProgram()
+		if err != nil {
+			t.Fatalf("%s: %s", tt.file, err)
+		}
+
+		var got []string
+		for _, warning := range Program(program) {
+			got = append(got, warning.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: wrong warnings.\nwant=%q\ngot= %q", tt.file, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Everything here is used and reachable.
+let greet = fn(name, _unused) {
+  let message = "hello " + name;
+  if (len(name) > 3) {
+    return message + "!";
+  }
+  message
+};
+let counter = fn() {
+  let n = 0;
+  fn() { n += 1; n }
+};
+let next = counter();
+let double = fn(x) { x * 2 };
+let describe = fn(shape) {
+  switch (shape) {
+    case let {"r": r}: { r.double() }
+    case let [w, _]: { w }
+    default: { 0 }
+  }
+};
+let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+let i = 0;
+while (true) {
+  i += 1;
+  if (i > 2) { break }
+};
+[greet("ann", 1), next(), describe([1, 2]), fact(5)] |> puts
@@ -0,0 +1,5 @@
+if (true) { puts("always") }
+if (false) { puts("never") } else { puts("else") }
+while (false) { puts("never") }
+while (true) { break }
+if (!true) { puts("not literal") }
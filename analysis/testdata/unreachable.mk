@@ -0,0 +1,17 @@
+let f = fn(x) {
+  return x;
+  puts("never");
+  puts("still never");
+};
+let i = 0;
+while (i < 3) {
+  i += 1;
+  if (i == 2) {
+    break;
+    puts("gone");
+  }
+  continue;
+  i
+}
+return 1;
+puts("after the end");
@@ -0,0 +1,20 @@
+let total = fn(xs) {
+  let sum = 0;
+  let unused = len(xs);
+  let _ = puts("ignored");
+  let i = 0;
+  while (i < len(xs)) {
+    sum += xs[i];
+    i += 1;
+  }
+  let sum = 1;
+  sum
+};
+let assignedOnly = fn() {
+  let count = 0;
+  count = 1;
+};
+switch ([1, 2]) {
+  case let [a, b]: { a }
+}
+let global = 1;
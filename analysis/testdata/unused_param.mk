@@ -0,0 +1,6 @@
+let pick = fn(a, b, _c) { a };
+let shadowed = fn(x) {
+  let inner = fn(x) { x };
+  inner(1)
+};
+let self = fn(n) { self(n) };
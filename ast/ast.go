@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"monkey/token"
+	"sort"
 	"strings"
 )
 
@@ -41,7 +42,6 @@ func (p *Program) String() string {
 
 	for _, s := range p.Statements {
 		out.WriteString(s.String())
-		out.WriteString("\n")
 	}
 
 	return out.String()
@@ -84,14 +84,32 @@ func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(rs.TokenLiteral() + " ")
+	out.WriteString(rs.TokenLiteral())
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
 	}
 	out.WriteString(";")
 	return out.String()
 }
 
+// BREAK AND CONTINUE
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 // IDENTIFIER
 
 type Identifier struct {
@@ -114,6 +132,17 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.TokenLiteral() }
 
+// FLOAT LITERAL
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.TokenLiteral() }
+
 // PREFIX
 
 type PrefixExpression struct {
@@ -158,6 +187,32 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// ASSIGN EXPRESSION
+
+// AssignExpression is `target = value` or a compound form such as `+=`, in
+// which case Operator holds the whole token, e.g. "+=". Target is an
+// Identifier or an IndexExpression.
+type AssignExpression struct {
+	Token    token.Token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // BOOLEAN
 
 type Boolean struct {
@@ -169,11 +224,22 @@ func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.TokenLiteral() }
 
+// NULL
+
+type Null struct {
+	Token token.Token
+}
+
+func (n *Null) expressionNode()      {}
+func (n *Null) TokenLiteral() string { return n.Token.Literal }
+func (n *Null) String() string       { return n.TokenLiteral() }
+
 // EXPRESSION STATEMENT
 
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
+	Semicolon  bool // ended with an explicit ;
 }
 
 func (es *ExpressionStatement) statementNode()       {}
@@ -199,7 +265,6 @@ func (bs *BlockStatement) String() string {
 
 	for _, s := range bs.Statements {
 		out.WriteString(s.String())
-		out.WriteString("\n")
 	}
 
 	return out.String()
@@ -232,10 +297,163 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// WHILE EXPRESSION
+
+type WhileExpression struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (we *WhileExpression) expressionNode()      {}
+func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(we.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(we.Body.String())
+
+	return out.String()
+}
+
+// SWITCH EXPRESSION
+
+type SwitchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Cases   []*SwitchCase
+}
+
+func (se *SwitchExpression) expressionNode()      {}
+func (se *SwitchExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SwitchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("switch (")
+	out.WriteString(se.Subject.String())
+	out.WriteString(") {")
+	for _, c := range se.Cases {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// SwitchCase is a single arm of a switch. A `case let` arm has a Pattern
+// instead of a Value; both are nil for the default arm.
+type SwitchCase struct {
+	Token   token.Token
+	Value   Expression
+	Pattern Pattern
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (sc *SwitchCase) String() string {
+	var out bytes.Buffer
+
+	switch {
+	case sc.Pattern != nil:
+		out.WriteString("case let ")
+		out.WriteString(sc.Pattern.String())
+	case sc.Value != nil:
+		out.WriteString("case ")
+		out.WriteString(sc.Value.String())
+	default:
+		out.WriteString("default")
+	}
+	if sc.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(sc.Guard.String())
+	}
+	out.WriteString(": {")
+	out.WriteString(sc.Body.String())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// PATTERNS
+
+// Pattern is what a `case let` arm matches the switch subject against,
+// binding names to the parts it matches.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// WildcardPattern is _, which matches anything and binds nothing.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// BindingPattern matches anything and binds it to Name.
+type BindingPattern struct {
+	Name *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Name.TokenLiteral() }
+func (bp *BindingPattern) String() string       { return bp.Name.String() }
+
+// LiteralPattern matches a value equal to Value: an integer, float, string,
+// boolean or null literal, or a negated number.
+type LiteralPattern struct {
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Value.TokenLiteral() }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// ArrayPattern matches an array of exactly as many elements as it has, each
+// matching the pattern in its place.
+type ArrayPattern struct {
+	Token    token.Token // [
+	Elements []Pattern
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches a hash that has every one of Keys, each value matching
+// the pattern at the same index of Values. Other keys are ignored.
+type HashPattern struct {
+	Token  token.Token // {
+	Keys   []Expression
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+":"+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
 // FUNCTION LITERAL
 
 type FunctionLiteral struct {
 	Name       string
+	Doc        string // the comments above it, when parsed with them
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
@@ -290,6 +508,30 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// PIPE EXPRESSION
+
+// PipeExpression is `Left |> Right`. Right is called with Left as its first
+// argument; if Right is a call expression, its arguments follow Left.
+type PipeExpression struct {
+	Token token.Token // The |> token
+	Left  Expression
+	Right Expression
+}
+
+func (pe *PipeExpression) expressionNode()      {}
+func (pe *PipeExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PipeExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(pe.Left.String())
+	out.WriteString(" |> ")
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // STRING LITERAL
 
 type StringLiteral struct {
@@ -339,6 +581,20 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// MEMBER EXPRESSION
+
+type MemberExpression struct {
+	Token  token.Token // The . token
+	Left   Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return "(" + me.Left.String() + "." + me.Member.String() + ")"
+}
+
 // HASH
 
 type HashLiteral struct {
@@ -352,8 +608,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -362,3 +618,90 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// Keys returns the keys of hl in the order they appear in the source. Keys
+// without a position, as in hand-built trees, are ordered by String.
+func (hl *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := Pos(keys[i]), Pos(keys[j])
+		if a != b {
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// POSITIONS
+
+// Pos returns the source position of the first token of node. Infix-style
+// nodes store their operator token, so the position is taken from their
+// leftmost operand instead.
+func Pos(node Node) token.Position {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return Pos(node.Statements[0])
+		}
+		return token.Position{}
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			return Pos(node.Expression)
+		}
+		return node.Token.Pos
+	case *InfixExpression:
+		return Pos(node.Left)
+	case *CallExpression:
+		return Pos(node.Function)
+	case *IndexExpression:
+		return Pos(node.Left)
+	case *MemberExpression:
+		return Pos(node.Left)
+	case *LetStatement:
+		return node.Token.Pos
+	case *ReturnStatement:
+		return node.Token.Pos
+	case *BreakStatement:
+		return node.Token.Pos
+	case *ContinueStatement:
+		return node.Token.Pos
+	case *Identifier:
+		return node.Token.Pos
+	case *IntegerLiteral:
+		return node.Token.Pos
+	case *FloatLiteral:
+		return node.Token.Pos
+	case *StringLiteral:
+		return node.Token.Pos
+	case *Boolean:
+		return node.Token.Pos
+	case *Null:
+		return node.Token.Pos
+	case *PrefixExpression:
+		return node.Token.Pos
+	case *BlockStatement:
+		return node.Token.Pos
+	case *IfExpression:
+		return node.Token.Pos
+	case *WhileExpression:
+		return node.Token.Pos
+	case *SwitchExpression:
+		return node.Token.Pos
+	case *PipeExpression:
+		return Pos(node.Left)
+	case *AssignExpression:
+		return Pos(node.Target)
+	case *FunctionLiteral:
+		return node.Token.Pos
+	case *ArrayLiteral:
+		return node.Token.Pos
+	case *HashLiteral:
+		return node.Token.Pos
+	default:
+		return token.Position{}
+	}
+}
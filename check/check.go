@@ -0,0 +1,101 @@
+// Package check finds the problems in Monkey source without running it, as
+// the check command does.
+package check
+
+import (
+	"fmt"
+	"monkey/analysis"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"sort"
+)
+
+// Severities of a Diagnostic.
+const (
+	Error   = "error"
+	Warning = "warning"
+)
+
+// Diagnostic is one problem found in a file.
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String formats d as file:line:col: message, marking warnings.
+func (d Diagnostic) String() string {
+	if d.Severity == Warning {
+		return fmt.Sprintf("%s:%d:%d: warning: %s", d.File, d.Line, d.Col, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Col, d.Message)
+}
+
+// Source returns the problems in source, which is named file: every parse
+// error, or if it parses, what analysis warns of and, if compile is set, the
+// compiler's warnings and the error that stopped it.
+func Source(file, source string, compile bool) []Diagnostic {
+	var diags []Diagnostic
+
+	program, errs := parser.New(lexer.New(source)).ParseAll()
+	for _, err := range errs {
+		diags = append(diags, Diagnostic{file, err.Pos.Line, err.Pos.Column, Error, err.Error()})
+	}
+	if len(errs) > 0 {
+		return diags
+	}
+	for _, warning := range analysis.Program(program) {
+		diags = append(diags, Diagnostic{file, warning.Pos.Line, warning.Pos.Column, Warning, warning.Message})
+	}
+	if !compile {
+		return diags
+	}
+
+	// Scripts are run with their arguments in args.
+	comp := compiler.New()
+	comp.SymbolTable().Define("args")
+	err := comp.Compile(program)
+	for _, warning := range comp.Warnings {
+		diags = append(diags, Diagnostic{file, warning.Pos.Line, warning.Pos.Column, Warning, warning.Message})
+	}
+	if compileErr, ok := err.(*compiler.CompileError); ok {
+		diags = append(diags, Diagnostic{file, compileErr.Pos.Line, compileErr.Pos.Column, Error, compileErr.Message})
+	} else if err != nil {
+		diags = append(diags, Diagnostic{file, 1, 1, Error, err.Error()})
+	}
+	sortByPosition(diags)
+	return diags
+}
+
+func sortByPosition(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Line < diags[j].Line || diags[i].Line == diags[j].Line && diags[i].Col < diags[j].Col
+	})
+}
+
+// Files checks each file in order. It stops at a file it can't read.
+func Files(paths []string, compile bool) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return diags, err
+		}
+		diags = append(diags, Source(path, string(source), compile)...)
+	}
+	return diags, nil
+}
+
+// HasErrors reports whether any of diags is an error rather than a warning.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package check
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourceCollectsParseErrors(t *testing.T) {
+	diags := Source("a.mk", "let = 1;\nlet x = 2;\nlet y = (1 +;\n", false)
+
+	expected := []string{
+		`a.mk:1:5: Expected token type "IDENT", got "=" instead`,
+		`a.mk:3:13: No prefix expression found for ";" (";").`,
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d: %v", len(expected), len(diags), diags)
+	}
+	for i, want := range expected {
+		if got := diags[i].String(); got != want {
+			t.Errorf("diagnostic %d: want=%q, got=%q", i, want, got)
+		}
+	}
+}
+
+func TestSourceCompile(t *testing.T) {
+	source := "let len = 1;\nlet f = fn() { undefinedName };\n"
+
+	if diags := Source("a.mk", source, false); len(diags) != 0 {
+		t.Errorf("without compiling, expected nothing, got %v", diags)
+	}
+
+	diags := Source("a.mk", source, true)
+	expected := []Diagnostic{
+		{"a.mk", 1, 5, Warning, `"len" shadows a builtin`},
+		{"a.mk", 2, 16, Error, `undefined variable "undefinedName"`},
+	}
+	if !reflect.DeepEqual(diags, expected) {
+		t.Errorf("wrong diagnostics.\nwant=%v\ngot= %v", expected, diags)
+	}
+	if !HasErrors(diags) || HasErrors(diags[:1]) {
+		t.Error("only the undefined variable should count as an error")
+	}
+}
+
+func TestSourceAnalysis(t *testing.T) {
+	source := "let f = fn(x) {\n  let y = 1;\n  return 2;\n  x\n};\nlet len = f;\n"
+
+	expected := []Diagnostic{
+		{"a.mk", 2, 7, Warning, `"y" is declared and not used`},
+		{"a.mk", 4, 3, Warning, `unreachable code`},
+	}
+	if diags := Source("a.mk", source, false); !reflect.DeepEqual(diags, expected) {
+		t.Errorf("wrong diagnostics.\nwant=%v\ngot= %v", expected, diags)
+	}
+
+	// The compiler's warnings are merged in by position.
+	expected = append(expected, Diagnostic{"a.mk", 6, 5, Warning, `"len" shadows a builtin`})
+	if diags := Source("a.mk", source, true); !reflect.DeepEqual(diags, expected) {
+		t.Errorf("wrong diagnostics.\nwant=%v\ngot= %v", expected, diags)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"one.mk": "let x = ;", "two.mk": "1 +", "ok.mk": "let y = 2;"}
+	var paths []string
+	for _, name := range []string{"one.mk", "ok.mk", "two.mk"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	diags, err := Files(paths, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 2 || diags[0].File != paths[0] || diags[1].File != paths[2] {
+		t.Fatalf("expected one error from each broken file, got %v", diags)
+	}
+
+	if _, err := Files([]string{filepath.Join(dir, "missing.mk")}, false); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	data, err := json.Marshal(Source("a.mk", "let = 1", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]any{{
+		"file":     "a.mk",
+		"line":     float64(1),
+		"col":      float64(5),
+		"severity": "error",
+		"message":  `Expected token type "IDENT", got "=" instead`,
+	}}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("wrong JSON.\nwant=%v\ngot= %v", expected, decoded)
+	}
+}
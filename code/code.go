@@ -123,6 +123,8 @@ const (
 	OpPop
 	OpJumpNotTruthy
 	OpJump
+	OpJumpTruthy
+	OpDup
 	OpCall
 	OpReturn
 	OpReturnValue
@@ -137,6 +139,7 @@ const (
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterEqual
 
 	OpMinus
 	OpBang
@@ -146,6 +149,11 @@ const (
 	OpMul
 	OpDiv
 	OpMod
+	OpBitOr
+	OpBitAnd
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
 
 	OpGetGlobal
 	OpSetGlobal
@@ -155,6 +163,15 @@ const (
 	OpGetFree
 	OpCurrentClosure
 	OpIndex
+	OpSetIndex
+	OpDup2
+	OpLessThan
+	OpLessEqual
+	OpMember
+	OpCallMethod
+	OpGetLocalRef
+	OpGetFreeRef
+	OpSetFree
 )
 
 var definitions = map[Opcode]*Definition{
@@ -162,6 +179,8 @@ var definitions = map[Opcode]*Definition{
 	OpPop:           {"OpPop", []int{}},
 	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
 	OpJump:          {"OpJump", []int{2}},
+	OpJumpTruthy:    {"OpJumpTruthy", []int{2}},
+	OpDup:           {"OpDup", []int{}},
 	OpCall:          {"OpCall", []int{1}},
 	OpReturn:        {"OpReturn", []int{}},
 	OpReturnValue:   {"OpReturnValue", []int{}},
@@ -173,9 +192,10 @@ var definitions = map[Opcode]*Definition{
 	OpArray: {"OpArray", []int{2}},
 	OpHash:  {"OpHash", []int{2}},
 
-	OpEqual:       {"OpEq", []int{}},
-	OpNotEqual:    {"OpNeq", []int{}},
-	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpEqual:        {"OpEq", []int{}},
+	OpNotEqual:     {"OpNeq", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
 
 	OpMinus: {"OpMinus", []int{}},
 	OpBang:  {"OpBang", []int{}},
@@ -186,6 +206,12 @@ var definitions = map[Opcode]*Definition{
 	OpDiv: {"OpDiv", []int{}},
 	OpMod: {"OpMod", []int{}},
 
+	OpBitOr:      {"OpBitOr", []int{}},
+	OpBitAnd:     {"OpBitAnd", []int{}},
+	OpBitXor:     {"OpBitXor", []int{}},
+	OpShiftLeft:  {"OpShiftLeft", []int{}},
+	OpShiftRight: {"OpShiftRight", []int{}},
+
 	OpGetGlobal:      {"OpGetGlobal", []int{2}},
 	OpSetGlobal:      {"OpSetGlobal", []int{2}},
 	OpGetLocal:       {"OpGetLocal", []int{1}},
@@ -194,4 +220,13 @@ var definitions = map[Opcode]*Definition{
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
 	OpIndex:          {"OpIndex", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpDup2:           {"OpDup2", []int{}},
+	OpLessThan:       {"OpLessThan", []int{}},
+	OpLessEqual:      {"OpLessEqual", []int{}},
+	OpMember:         {"OpMember", []int{2}},
+	OpCallMethod:     {"OpCallMethod", []int{2, 1}},
+	OpGetLocalRef:    {"OpGetLocalRef", []int{1}},
+	OpGetFreeRef:     {"OpGetFreeRef", []int{1}},
+	OpSetFree:        {"OpSetFree", []int{1}},
 }
@@ -2,10 +2,12 @@ package compiler
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
-	"sort"
+	"monkey/suggest"
+	"monkey/token"
 )
 
 type Bytecode struct {
@@ -13,6 +15,27 @@ type Bytecode struct {
 	Constants    []object.Object
 }
 
+// CompileError is an error found while compiling, located at the token that
+// caused it.
+type CompileError struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("compile error at %d:%d: %s", e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+// CompileWarning is a problem that doesn't stop compilation.
+type CompileWarning struct {
+	Pos     token.Position
+	Message string
+}
+
+func (w *CompileWarning) String() string {
+	return fmt.Sprintf("warning at %d:%d: %s", w.Pos.Line, w.Pos.Column, w.Message)
+}
+
 type EmittedInstruction struct {
 	Opcode   code.Opcode
 	Position int
@@ -22,16 +45,35 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// loops holds the loops being compiled in this scope, innermost last.
+	loops []*loopRecord
+}
+
+// loopRecord tracks where continue jumps to and the break jumps waiting for
+// the loop's end to be known.
+type loopRecord struct {
+	continuePos int
+	breakJumps  []int
 }
 
 type Compiler struct {
 	instructions code.Instructions
 	constants    []object.Object
 
+	// constantIndex finds existing slots for immutable literal constants.
+	constantIndex map[constantKey]int
+
 	symbolTable *SymbolTable
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// Peephole makes Bytecode run the Optimize pass over its result.
+	Peephole bool
+
+	// Warnings collects problems such as a definition shadowing a builtin.
+	Warnings []*CompileWarning
 }
 
 func New() *Compiler {
@@ -47,8 +89,9 @@ func New() *Compiler {
 	}
 
 	return &Compiler{
-		instructions: code.Instructions{},
-		constants:    []object.Object{},
+		instructions:  code.Instructions{},
+		constants:     []object.Object{},
+		constantIndex: map[constantKey]int{},
 
 		scopes:     []CompilationScope{mainScope},
 		scopeIndex: 0,
@@ -57,16 +100,41 @@ func New() *Compiler {
 	}
 }
 
+// NewWithState continues compiling against the symbol table and constant pool
+// of an earlier compilation, as the REPL does line by line. The compiler
+// appends to both; the caller keeps them between compilations by reading them
+// back through SymbolTable and Constants after each Compile.
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
 	compiler.constants = constants
+	for i, obj := range constants {
+		if key, ok := keyForConstant(obj); ok {
+			compiler.constantIndex[key] = i
+		}
+	}
 	return compiler
 }
 
+// SymbolTable returns the global symbol table, including any definitions made
+// by Compile.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Constants returns the unoptimized constant pool to hand to the next
+// NewWithState.
+func (c *Compiler) Constants() []object.Object {
+	return c.constants
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		// Each program is its own block, so a REPL line may redefine a global.
+		c.symbolTable.EnterBlock()
+		defer c.symbolTable.LeaveBlock()
+
 		for _, s := range node.Statements {
 			if err := c.Compile(s); err != nil {
 				return err
@@ -78,17 +146,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			// Reverse operands if LEQ
-			if err := c.Compile(node.Right); err != nil {
-				return err
-			}
-			if err := c.Compile(node.Left); err != nil {
-				return err
-			}
-
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
 		}
 		if err := c.Compile(node.Left); err != nil {
 			return err
@@ -107,8 +166,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpDiv)
 		case "%":
 			c.emit(code.OpMod)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
@@ -117,14 +192,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
+		c.emit(code.OpConstant, c.addConstant(object.GetInteger(node.Value)))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.Null:
+		c.emit(code.OpNull)
 	case *ast.PrefixExpression:
 		if err := c.Compile(node.Right); err != nil {
 			return err
@@ -138,6 +214,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.emit(code.OpMember, c.addConstant(&object.String{Value: node.Member.Value}))
+	case *ast.PipeExpression:
+		return c.compilePipe(node)
+	case *ast.SwitchExpression:
+		return &CompileError{Pos: node.Token.Pos, Message: "switch expressions are not supported by the compiler, run with the eval engine"}
+	case *ast.WhileExpression:
+		return c.compileWhile(node)
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
 	case *ast.IfExpression:
 		if err := c.Compile(node.Condition); err != nil {
 			return err
@@ -147,10 +239,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err := c.Compile(node.Consequence); err != nil {
 			return err
 		}
-
-		if c.lastInstructionIsPop() {
-			c.removeLastPop()
-		}
+		c.leaveBlockValue()
 
 		jumpPos := c.emit(code.OpJump, 0xFFFF) // also bogus
 
@@ -163,25 +252,44 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err := c.Compile(node.Alternative); err != nil {
 				return err
 			}
-
-			if c.lastInstructionIsPop() {
-				c.removeLastPop()
-			}
+			c.leaveBlockValue()
 		}
 
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 	case *ast.BlockStatement:
+		c.symbolTable.EnterBlock()
+		defer c.symbolTable.LeaveBlock()
+
 		for _, s := range node.Statements {
 			if err := c.Compile(s); err != nil {
 				return err
 			}
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value) // up here to allow body to reference name
+		// Define after compiling the value so `let x = x + 1` reads the previous
+		// binding. Recursive functions find themselves through their own name.
+		// A function literal passed to a call, as in `let fib = memo(fn(n) {
+		// ... fib(n - 1) ... })`, can only find the name if it is defined
+		// first, which is safe when it hides no other binding.
+		var symbol Symbol
+		_, shadows := c.symbolTable.shadowed(node.Name.Value)
+		early := passesFunctionLiteral(node.Value) && !shadows
+		if early {
+			var err error
+			if symbol, err = c.define(node.Name); err != nil {
+				return err
+			}
+		}
 		if err := c.Compile(node.Value); err != nil {
 			return err
 		}
+		if !early {
+			var err error
+			if symbol, err = c.define(node.Name); err != nil {
+				return err
+			}
+		}
 		if symbol.Scope == GLOBALSCOPE {
 			c.emit(code.OpSetGlobal, symbol.Index)
 		} else {
@@ -190,7 +298,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return c.undefinedVariable(node)
 		}
 
 		c.loadSymbol(symbol)
@@ -198,24 +306,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 	case *ast.ArrayLiteral:
+		if len(node.Elements) > math.MaxUint16 {
+			return fmt.Errorf("too many elements in array literal: %d, max %d", len(node.Elements), math.MaxUint16)
+		}
+
 		for _, el := range node.Elements {
 			if err := c.Compile(el); err != nil {
-				return nil
+				return err
 			}
 		}
 
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
+		if len(node.Pairs)*2 > math.MaxUint16 {
+			return fmt.Errorf("too many pairs in hash literal: %d, max %d", len(node.Pairs), math.MaxUint16/2)
 		}
 
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
+		for _, k := range node.Keys() {
 			if err := c.Compile(k); err != nil {
 				return err
 			}
@@ -244,7 +351,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+			if _, err := c.define(p); err != nil {
+				return err
+			}
 		}
 
 		if err := c.Compile(node.Body); err != nil {
@@ -260,22 +369,43 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
+		numLocals := c.symbolTable.NumDefinitions()
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.loadRef(s)
 		}
 
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
+		params := make([]string, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = param.Value
+		}
+		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters), Parameters: params, Name: node.Name, Doc: node.Doc}
 		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
 	case *ast.ReturnStatement:
-		if err := c.Compile(node.ReturnValue); err != nil {
+		if node.ReturnValue == nil {
+			c.emit(code.OpNull)
+		} else if err := c.Compile(node.ReturnValue); err != nil {
 			return err
 		}
 
 		c.emit(code.OpReturnValue)
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return &CompileError{Pos: node.Token.Pos, Message: "break outside of a loop"}
+		}
+		loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJump, 0xFFFF))
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return &CompileError{Pos: node.Token.Pos, Message: "continue outside of a loop"}
+		}
+		c.emit(code.OpJump, loop.continuePos)
 	case *ast.CallExpression:
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			return c.compileMethodCall(member, node.Arguments)
+		}
 		if err := c.Compile(node.Function); err != nil {
 			return err
 		}
@@ -287,21 +417,60 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpCall, len(node.Arguments))
+	default:
+		return &CompileError{Pos: ast.Pos(node), Message: fmt.Sprintf("%T is not supported by the compiler", node)}
 	}
 
 	return nil
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
-	return &Bytecode{
+	bytecode := &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
 	}
+	if c.Peephole {
+		return Optimize(bytecode)
+	}
+	return bytecode
+}
+
+type constantKey struct {
+	Type  object.ObjectType
+	Value interface{}
+}
+
+// keyForConstant reports the dedup key of a literal constant. Compiled
+// functions have no key and always get a slot of their own.
+func keyForConstant(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.Float:
+		return constantKey{obj.Type(), math.Float64bits(obj.Value)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.Boolean:
+		return constantKey{obj.Type(), obj.Value}, true
+	default:
+		return constantKey{}, false
+	}
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := keyForConstant(obj)
+	if ok {
+		if index, ok := c.constantIndex[key]; ok {
+			return index
+		}
+	}
+
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	index := len(c.constants) - 1
+	if ok {
+		c.constantIndex[key] = index
+	}
+	return index
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
@@ -401,6 +570,295 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// define binds a let or parameter name, failing on a duplicate in the same
+// block and recording a warning when it shadows a builtin or outer variable.
+func (c *Compiler) define(name *ast.Identifier) (Symbol, error) {
+	shadowed, shadows := c.symbolTable.shadowed(name.Value)
+
+	symbol, err := c.symbolTable.DefineChecked(name.Value)
+	if err != nil {
+		return Symbol{}, &CompileError{Pos: name.Token.Pos, Message: err.Error()}
+	}
+
+	if shadows {
+		kind := "an outer variable"
+		switch shadowed.Scope {
+		case BUILTINSCOPE:
+			kind = "a builtin"
+		case GLOBALSCOPE:
+			kind = "a global"
+		}
+		c.Warnings = append(c.Warnings, &CompileWarning{
+			Pos:     name.Token.Pos,
+			Message: fmt.Sprintf("%q shadows %s", name.Value, kind),
+		})
+	}
+
+	return symbol, nil
+}
+
+// passesFunctionLiteral reports whether node is a call with a function literal
+// among its arguments.
+func passesFunctionLiteral(node ast.Expression) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.FunctionLiteral); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// undefinedVariable reports an unresolved identifier, suggesting a visible name
+// within two edits. Names are resolved as they are compiled, so a function body
+// can't refer to a global defined after it.
+func (c *Compiler) undefinedVariable(node *ast.Identifier) error {
+	message := fmt.Sprintf("undefined variable %q", node.Value)
+	if closest, ok := suggest.Closest(node.Value, c.symbolTable.Names(), 2); ok {
+		message += fmt.Sprintf(", did you mean %q?", closest)
+	}
+	return &CompileError{Pos: node.Token.Pos, Message: message}
+}
+
+// leaveBlockValue keeps the value of a just-compiled if branch on the stack: the
+// last expression's value, or null when the block ends in another statement.
+func (c *Compiler) leaveBlockValue() {
+	if c.lastInstructionIsPop() {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+// compoundOperators maps compound assignment operators to the opcode that
+// combines the old and new values.
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+	"%=": code.OpMod,
+	"^=": code.OpBitXor,
+	"|=": code.OpBitOr,
+	"&=": code.OpBitAnd,
+}
+
+// compileAssign stores into an existing global or local and then loads it
+// again, so the assignment leaves its value on the stack like any expression.
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return c.compileIndexAssign(node, target)
+	}
+
+	target, ok := node.Target.(*ast.Identifier)
+	if !ok {
+		return &CompileError{Pos: node.Token.Pos, Message: fmt.Sprintf("cannot assign to %s", node.Target)}
+	}
+
+	symbol, ok := c.symbolTable.Resolve(target.Value)
+	if !ok {
+		return &CompileError{Pos: target.Token.Pos, Message: fmt.Sprintf("cannot assign to undefined variable %q", target.Value)}
+	}
+
+	// A captured variable is assigned through the VM's cell for it, unless it
+	// was captured from a function's own name.
+	switch c.symbolTable.origin(symbol).Scope {
+	case BUILTINSCOPE:
+		return &CompileError{Pos: target.Token.Pos, Message: fmt.Sprintf("cannot assign to builtin %q", target.Value)}
+	case FUNCTIONSCOPE:
+		return &CompileError{Pos: target.Token.Pos, Message: fmt.Sprintf("cannot assign to function name %q", target.Value)}
+	}
+
+	if node.Operator != "=" {
+		op, ok := compoundOperators[node.Operator]
+		if !ok {
+			return &CompileError{Pos: node.Token.Pos, Message: fmt.Sprintf("unknown operator %s", node.Operator)}
+		}
+		c.loadSymbol(symbol)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(op)
+	} else if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	switch symbol.Scope {
+	case GLOBALSCOPE:
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case FREESCOPE:
+		c.emit(code.OpSetFree, symbol.Index)
+	default:
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+	c.loadSymbol(symbol)
+	return nil
+}
+
+// compileIndexAssign leaves the container and index on the stack for
+// OpSetIndex, which pushes the assigned value back. Compound forms duplicate
+// the pair to read the old value first.
+func (c *Compiler) compileIndexAssign(node *ast.AssignExpression, target *ast.IndexExpression) error {
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+	if err := c.Compile(target.Index); err != nil {
+		return err
+	}
+
+	if node.Operator != "=" {
+		op, ok := compoundOperators[node.Operator]
+		if !ok {
+			return &CompileError{Pos: node.Token.Pos, Message: fmt.Sprintf("unknown operator %s", node.Operator)}
+		}
+		c.emit(code.OpDup2)
+		c.emit(code.OpIndex)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(op)
+	} else if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+// compileWhile jumps back to the condition after each pass of the body and
+// leaves null on the stack once the condition is falsy or the body breaks.
+func (c *Compiler) compileWhile(node *ast.WhileExpression) error {
+	conditionPos := len(c.currentInstructions())
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	exitJumpPos := c.emit(code.OpJumpNotTruthy, 0xFFFF)
+
+	// Look the scope up again after the body, which may grow c.scopes.
+	scopeIndex := c.scopeIndex
+	loop := &loopRecord{continuePos: conditionPos}
+	c.scopes[scopeIndex].loops = append(c.scopes[scopeIndex].loops, loop)
+	err := c.Compile(node.Body)
+	loops := c.scopes[scopeIndex].loops
+	c.scopes[scopeIndex].loops = loops[:len(loops)-1]
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, conditionPos)
+
+	endPos := len(c.currentInstructions())
+	c.changeOperand(exitJumpPos, endPos)
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, endPos)
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// currentLoop returns the innermost loop of the function being compiled, or
+// nil when there is none.
+func (c *Compiler) currentLoop() *loopRecord {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// compileLogical leaves the left operand on the stack and jumps over the right
+// one when it already decides the result; otherwise it is popped and the right
+// operand becomes the value.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	c.emit(code.OpDup)
+	jump := code.OpJumpNotTruthy
+	if node.Operator == "||" {
+		jump = code.OpJumpTruthy
+	}
+	jumpPos := c.emit(jump, 0xFFFF)
+
+	c.emit(code.OpPop)
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compilePipe compiles `x |> f(a)` as the call f(x, a). Unlike the tree
+// walker, which evaluates the stage last, the stage is evaluated first; the
+// two only differ when the stage expression has side effects.
+func (c *Compiler) compilePipe(node *ast.PipeExpression) error {
+	stage := node.Right
+	var arguments []ast.Expression
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		stage = call.Function
+		arguments = call.Arguments
+	}
+
+	if err := c.Compile(stage); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	for _, a := range arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCall, len(arguments)+1)
+	return nil
+}
+
+// compileMethodCall compiles value.name(args). The function called is only
+// known at run time, so OpCallMethod gets the name, the function name
+// resolves to in scope or null, the receiver and the arguments, and picks
+// between them as the tree walker does.
+func (c *Compiler) compileMethodCall(member *ast.MemberExpression, arguments []ast.Expression) error {
+	name := member.Member.Value
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		c.loadSymbol(symbol)
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	if err := c.Compile(member.Left); err != nil {
+		return err
+	}
+	for _, a := range arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCallMethod, c.addConstant(&object.String{Value: name}), len(arguments))
+	return nil
+}
+
+// loadRef loads s for a closure to capture. A local or captured variable is
+// loaded as the VM's shared cell for it, so the closure sees later
+// assignments and its own are seen outside, as in the tree walker.
+func (c *Compiler) loadRef(s Symbol) {
+	switch s.Scope {
+	case LOCALSCOPE:
+		c.emit(code.OpGetLocalRef, s.Index)
+	case FREESCOPE:
+		c.emit(code.OpGetFreeRef, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	var op code.Opcode
 
@@ -2,11 +2,13 @@ package compiler
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/code"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -115,6 +117,23 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	}
 }
 
+// runCompilerErrorTests expects each input to fail to compile with the error
+// message held in expected.
+func runCompilerErrorTests(t *testing.T, tests []struct{ input, expected string }) {
+	t.Helper()
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected compiler error but resulted in none", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong compiler error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func testInstructions(
 	expected []code.Instructions,
 	actual code.Instructions,
@@ -164,6 +183,12 @@ func testConstants(
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s",
 					i, err)
 			}
+		case float64:
+			float, ok := actual[i].(*object.Float)
+			if !ok || float.Value != constant {
+				return fmt.Errorf("constant %d - not Float %g: %T (%+v)",
+					i, constant, actual[i], actual[i])
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -218,6 +243,33 @@ func testStringObject(expected string, actual object.Object) error {
 	return nil
 }
 
+func TestFloatLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 + 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "2.5; 2.5",
+			expectedConstants: []interface{}{2.5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -248,11 +300,31 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessEqual),
 				code.Make(code.OpPop),
 			},
 		},
@@ -360,6 +432,344 @@ func TestConditionals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input: `
+            if (1 > 2) { 10 } else { 20 }
+            `,
+			expectedConstants: []interface{}{1, 2, 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpGreaterThan),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0010
+				code.Make(code.OpConstant, 2),
+				// 0013
+				code.Make(code.OpJump, 19),
+				// 0016
+				code.Make(code.OpConstant, 3),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+            if (1 > 2) { 10 }
+            `,
+			expectedConstants: []interface{}{1, 2, 10},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpGreaterThan),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 16),
+				// 0010
+				code.Make(code.OpConstant, 2),
+				// 0013
+				code.Make(code.OpJump, 17),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a) { a *= 3 }",
+			expectedConstants: []interface{}{
+				3,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpMul),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1][0] = 2",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(n) { fn() { n += 1 } }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocalRef, 0),
+					code.Make(code.OpClosure, 1, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let h = {}; h["a"] += 1`,
+			expectedConstants: []interface{}{"a", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"x = 1", `compile error at 1:1: cannot assign to undefined variable "x"`},
+		{"let y = 1; y += z", `compile error at 1:17: undefined variable "z", did you mean "y"?`},
+		{"len = 1", `compile error at 1:1: cannot assign to builtin "len"`},
+		{"let f = fn() { f = 1 };", `compile error at 1:16: cannot assign to function name "f"`},
+		{"let f = fn() { fn() { f = 1 } };", `compile error at 1:23: cannot assign to function name "f"`},
+	})
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { 10 }; 3333;`,
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 0),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1; while (false) { }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpPop),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0008
+				code.Make(code.OpJump, 4),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `while (true) { if (false) { break }; continue; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 23),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 15),
+				// 0008
+				code.Make(code.OpJump, 23),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpJump, 16),
+				// 0015
+				code.Make(code.OpNull),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpJump, 0),
+				// 0020
+				code.Make(code.OpJump, 0),
+				// 0023
+				code.Make(code.OpNull),
+				// 0024
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `while (true) { while (false) { break }; break }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0008
+				code.Make(code.OpJump, 14),
+				// 0011
+				code.Make(code.OpJump, 4),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpJump, 22),
+				// 0019
+				code.Make(code.OpJump, 0),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBreakAndContinueOutsideLoop(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"break", "compile error at 1:1: break outside of a loop"},
+		{"let x = 1;\nif (x) { continue }", "compile error at 2:10: continue outside of a loop"},
+		{"while (true) { fn() { break } }", "compile error at 1:23: break outside of a loop"},
+	})
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpDup),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 7),
+				// 0005
+				code.Make(code.OpPop),
+				// 0006
+				code.Make(code.OpFalse),
+				// 0007
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 || 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpDup),
+				// 0004
+				code.Make(code.OpJumpTruthy, 11),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpConstant, 1),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -414,6 +824,36 @@ func TestGlobalLetStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestUndefinedVariable(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"x", `compile error at 1:1: undefined variable "x"`},
+		{"let y = x + 1;", `compile error at 1:9: undefined variable "x"`},
+		{"let x = x;", `compile error at 1:9: undefined variable "x"`},
+		{"fn() { z }", `compile error at 1:8: undefined variable "z"`},
+		{"let length = 1;\n\n\nlet n = lenght + 1;", `compile error at 4:9: undefined variable "lenght", did you mean "length"?`},
+		{"lenn([])", `compile error at 1:1: undefined variable "lenn", did you mean "len"?`},
+		{"let f = fn(count) { cuont + 1 };", `compile error at 1:21: undefined variable "cuont", did you mean "count"?`},
+		// Names resolve as they are compiled, so a function can't call a
+		// global defined after it.
+		{"let f = fn() { g() }; let g = fn() { 1 };", `compile error at 1:16: undefined variable "g", did you mean "f"?`},
+	})
+}
+
+func TestCompileErrorType(t *testing.T) {
+	err := New().Compile(parse("let a = 1;\n  missing"))
+
+	compileErr, ok := err.(*CompileError)
+	if !ok {
+		t.Fatalf("error is not *CompileError. got=%T (%v)", err, err)
+	}
+	if compileErr.Pos.Line != 2 || compileErr.Pos.Column != 3 {
+		t.Errorf("wrong position. got=%d:%d", compileErr.Pos.Line, compileErr.Pos.Column)
+	}
+	if compileErr.Message != `undefined variable "missing"` {
+		t.Errorf("wrong message. got=%q", compileErr.Message)
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -439,6 +879,41 @@ func TestStringExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestBitwiseOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"mon" << "key"`,
+			expectedConstants: []interface{}{"mon", "key"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 | 2 & 3 ^ 4 << 5 >> 6",
+			expectedConstants: []interface{}{1, 2, 3, 4, 5, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitAnd),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpBitXor),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 5),
+				code.Make(code.OpShiftRight),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -482,6 +957,13 @@ func TestArrayLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestArrayLiteralErrors(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"[1, 2 + true, x]", `compile error at 1:15: undefined variable "x"`},
+		{"[" + strings.Repeat("1, ", math.MaxUint16) + "1]", "too many elements in array literal: 65536, max 65535"},
+	})
+}
+
 func TestHashLiterals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -527,18 +1009,46 @@ func TestHashLiterals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestHashLiteralOrderIsDeterministic(t *testing.T) {
+	input := `{"b": 1, "a": 2, 3: 3, "c" + "d": 4, true: 5}`
+
+	first := New()
+	if err := first.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	expected := first.Bytecode().Instructions.String()
+
+	for i := 0; i < 20; i++ {
+		comp := New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		if got := comp.Bytecode().Instructions.String(); got != expected {
+			t.Fatalf("hash literal compiled differently between runs.\nfirst=%q\ngot  =%q", expected, got)
+		}
+	}
+
+	var pairs strings.Builder
+	for i := 0; i <= math.MaxUint16/2; i++ {
+		fmt.Fprintf(&pairs, "%d: 1, ", i)
+	}
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"{" + pairs.String() + "}", "too many pairs in hash literal: 32768, max 32767"},
+	})
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -546,13 +1056,13 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -624,7 +1134,7 @@ func TestFunctions(t *testing.T) {
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpClosure, 0, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -947,6 +1457,54 @@ func TestBuiltins(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestPipesAndMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `[] |> push(1)`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `[].len()`,
+			expectedConstants: []interface{}{"len"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCallMethod, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `[].nope(1)`,
+			expectedConstants: []interface{}{1, "nope"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCallMethod, 1, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{}.x`,
+			expectedConstants: []interface{}{"x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpMember, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -965,7 +1523,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalRef, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -995,13 +1553,13 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeRef, 0),
+					code.Make(code.OpGetLocalRef, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalRef, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1049,15 +1607,15 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetFreeRef, 0),
+					code.Make(code.OpGetLocalRef, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocalRef, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1091,13 +1649,12 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -1120,18 +1677,17 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 				[]code.Instructions{
 					code.Make(code.OpClosure, 1, 0),
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpConstant, 0),
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -1142,3 +1698,154 @@ func TestRecursiveFunctions(t *testing.T) {
 
 	runCompilerTests(t, tests)
 }
+
+func TestConstantDeduplication(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 1 + 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = "x"; 2; let b = "x"; 2`,
+			expectedConstants: []interface{}{"x", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { 1 }; fn() { 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantDeduplicationLargeProgram(t *testing.T) {
+	input := strings.Repeat(`""; 0; 0 + 1;`, 1000)
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	if got := len(compiler.Bytecode().Constants); got != 3 {
+		t.Errorf("wrong number of constants. want=3, got=%d", got)
+	}
+}
+
+func TestConstantDeduplicationWithState(t *testing.T) {
+	first := New()
+	if err := first.Compile(parse(`"a"; 1`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	second := NewWithState(first.symbolTable, first.Bytecode().Constants)
+	if err := second.Compile(parse(`1; "a"; "b"`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := testConstants(t, []interface{}{"a", 1, "b"}, second.Bytecode().Constants)
+	if err != nil {
+		t.Errorf("testConstants failed: %s", err)
+	}
+}
+
+func TestDuplicateDefinitions(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"let x = 1; let x = 2;", `compile error at 1:16: "x" is already defined in this scope`},
+		{"let f = fn() { let y = 1; let y = 2; y };", `compile error at 1:31: "y" is already defined in this scope`},
+		{"let f = fn(a, a) { a };", `compile error at 1:15: "a" is already defined in this scope`},
+	})
+}
+
+func TestRedefinitionInNestedBlockReusesSlot(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`let f = fn(n) { let i = 0; if (n) { let i = 1; let j = 2; }; i }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn := compiler.Bytecode().Constants[3].(*object.CompiledFunction)
+	if fn.NumLocals != 3 {
+		t.Errorf("wrong NumLocals. want=3, got=%d", fn.NumLocals)
+	}
+}
+
+func TestShadowingWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; let f = fn() { x };", nil},
+		{"let len = fn(x) { 0 };", []string{`warning at 1:5: "len" shadows a builtin`}},
+		{"let x = 1; let f = fn(x) { x };", []string{`warning at 1:23: "x" shadows a global`}},
+		{"let f = fn() { let first = 1; first };", []string{`warning at 1:20: "first" shadows a builtin`}},
+		{
+			"let f = fn(a) { fn() { let a = 2; a } };",
+			[]string{`warning at 1:28: "a" shadows an outer variable`},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		var got []string
+		for _, w := range compiler.Warnings {
+			got = append(got, w.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: wrong warnings. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestUnsupportedNodes(t *testing.T) {
+	runCompilerErrorTests(t, []struct{ input, expected string }{
+		{"switch (1) { default: { 2 } }", "compile error at 1:1: switch expressions are not supported by the compiler, run with the eval engine"},
+	})
+
+	err := New().Compile(&unknownNode{})
+	if err == nil || err.Error() != "compile error at 0:0: *compiler.unknownNode is not supported by the compiler" {
+		t.Errorf("wrong error for an unknown node. got=%v", err)
+	}
+}
+
+type unknownNode struct{}
+
+func (n *unknownNode) TokenLiteral() string { return "" }
+func (n *unknownNode) String() string       { return "" }
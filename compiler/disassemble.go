@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+)
+
+// Disassemble renders the main instructions followed by the constant pool,
+// with compiled function bodies listed under their constants.
+func (b *Bytecode) Disassemble() string {
+	return b.DisassembleWith(nil)
+}
+
+// DisassembleWith is Disassemble with global slots annotated by name from
+// symbols, which is usually the table the bytecode was compiled with.
+func (b *Bytecode) DisassembleWith(symbols *SymbolTable) string {
+	d := disassembler{constants: b.Constants, globals: map[int]string{}}
+	if symbols != nil {
+		for name, symbol := range symbols.store {
+			if symbol.Scope == GLOBALSCOPE {
+				d.globals[symbol.Index] = name
+			}
+		}
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("== instructions ==\n")
+	d.writeInstructions(&out, b.Instructions, "")
+
+	out.WriteString("== constants ==\n")
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(&out, "%04d %s locals=%d params=%d\n", i, constant.Type(), constant.NumLocals, constant.NumParameters)
+			d.writeInstructions(&out, constant.Instructions, "    ")
+		default:
+			fmt.Fprintf(&out, "%04d %s %s\n", i, constant.Type(), d.describe(constant))
+		}
+	}
+
+	return out.String()
+}
+
+type disassembler struct {
+	constants []object.Object
+	globals   map[int]string
+}
+
+// writeInstructions stops at the first instruction it can't read, marking it
+// with <bad opcode N> or <truncated OpName>.
+func (d *disassembler) writeInstructions(out *bytes.Buffer, ins code.Instructions, indent string) {
+	decoded, err := decodeInstructions(ins)
+	for _, in := range decoded {
+		def, _ := code.Lookup(byte(in.op))
+
+		line := def.Name
+		for _, operand := range in.operands {
+			line += fmt.Sprintf(" %d", operand)
+		}
+
+		if note := d.annotate(in); note != "" {
+			fmt.Fprintf(out, "%s%04d %-20s ; %s\n", indent, in.pos, line, note)
+		} else {
+			fmt.Fprintf(out, "%s%04d %s\n", indent, in.pos, line)
+		}
+	}
+
+	var bad *badInstruction
+	if errors.As(err, &bad) {
+		fmt.Fprintf(out, "%s%04d <%s>\n", indent, bad.pos, bad.reason)
+	}
+}
+
+func (d *disassembler) annotate(in *instruction) string {
+	switch in.op {
+	case code.OpConstant, code.OpClosure:
+		if in.operands[0] < len(d.constants) {
+			return d.describe(d.constants[in.operands[0]])
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return d.globals[in.operands[0]]
+	case code.OpGetBuiltin:
+		if in.operands[0] < len(object.Builtins) {
+			return object.Builtins[in.operands[0]].Name
+		}
+	}
+	return ""
+}
+
+func (d *disassembler) describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", obj.Value)
+	case *object.CompiledFunction:
+		for i, constant := range d.constants {
+			if constant == obj {
+				return fmt.Sprintf("fn #%d", i)
+			}
+		}
+		return "fn"
+	default:
+		return strings.TrimSpace(obj.Inspect())
+	}
+}
@@ -0,0 +1,91 @@
+package compiler
+
+import (
+	"bytes"
+	"flag"
+	"monkey/code"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		golden  string
+		input   string
+		symbols bool
+	}{
+		{
+			golden: "disassemble_plain.golden",
+			input:  `let names = ["ann", "bob"]; len(names) + 1`,
+		},
+		{
+			golden: "disassemble_nested.golden",
+			input: `
+			let greeting = "hello";
+			let makeAdder = fn(x) { fn(y) { x + y } };
+			let addTwo = makeAdder(2);
+			[addTwo(1), greeting, first([1, 2])]
+			`,
+			symbols: true,
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		var got string
+		if tt.symbols {
+			got = compiler.Bytecode().DisassembleWith(compiler.symbolTable)
+		} else {
+			got = compiler.Bytecode().Disassemble()
+		}
+
+		path := filepath.Join("testdata", tt.golden)
+		if *update {
+			if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading golden file: %s", err)
+		}
+		if got != string(want) {
+			t.Errorf("%s: disassembly differs.\nwant:\n%s\ngot:\n%s", tt.golden, want, got)
+		}
+	}
+}
+
+func TestDisassembleMalformed(t *testing.T) {
+	constant := code.Make(code.OpConstant, 0)
+	tests := []struct {
+		instructions code.Instructions
+		expected     string
+	}{
+		{
+			concatInstructions([]code.Instructions{code.Make(code.OpTrue), {200}, code.Make(code.OpPop)}),
+			"== instructions ==\n0000 OpTrue\n0001 <bad opcode 200>\n== constants ==\n",
+		},
+		{
+			concatInstructions([]code.Instructions{code.Make(code.OpTrue), constant[:2]}),
+			"== instructions ==\n0000 OpTrue\n0001 <truncated OpConstant>\n== constants ==\n",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := &Bytecode{Instructions: tt.instructions}
+		if got := bytecode.Disassemble(); got != tt.expected {
+			t.Errorf("wrong disassembly.\nwant:\n%s\ngot:\n%s", tt.expected, got)
+		}
+		if got := Optimize(bytecode).Instructions; !bytes.Equal(got, tt.instructions) {
+			t.Errorf("malformed instructions were rewritten. got=%v", got)
+		}
+	}
+}
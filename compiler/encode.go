@@ -0,0 +1,224 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monkey/code"
+	"monkey/object"
+)
+
+// BytecodeMagic starts every encoded bytecode file.
+const BytecodeMagic = "MKBC"
+
+// BytecodeVersion is bumped whenever the encoding, the instruction set or the
+// order of object.Builtins changes in a way older files can't be run with.
+const BytecodeVersion uint16 = 7
+
+// Tags identifying each encoded constant.
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagBoolean
+	tagCompiledFunction
+)
+
+// Encode writes the bytecode as: magic, version, the main instructions, then
+// the constant pool. All integers are big-endian.
+func (b *Bytecode) Encode(w io.Writer) error {
+	// bufio.Writer keeps the first write error and Flush reports it, so the
+	// individual writes are not checked.
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString(BytecodeMagic)
+	binary.Write(bw, binary.BigEndian, BytecodeVersion)
+	writeBytes(bw, b.Instructions)
+
+	binary.Write(bw, binary.BigEndian, uint32(len(b.Constants)))
+	for i, constant := range b.Constants {
+		if err := encodeConstant(bw, constant); err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func encodeConstant(w *bufio.Writer, constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		w.WriteByte(tagInteger)
+		binary.Write(w, binary.BigEndian, constant.Value)
+	case *object.Float:
+		w.WriteByte(tagFloat)
+		binary.Write(w, binary.BigEndian, math.Float64bits(constant.Value))
+	case *object.String:
+		w.WriteByte(tagString)
+		writeBytes(w, []byte(constant.Value))
+	case *object.Boolean:
+		w.WriteByte(tagBoolean)
+		binary.Write(w, binary.BigEndian, constant.Value)
+	case *object.CompiledFunction:
+		w.WriteByte(tagCompiledFunction)
+		binary.Write(w, binary.BigEndian, uint32(constant.NumLocals))
+		binary.Write(w, binary.BigEndian, uint32(constant.NumParameters))
+		for _, param := range constant.Parameters {
+			writeBytes(w, []byte(param))
+		}
+		writeBytes(w, []byte(constant.Name))
+		writeBytes(w, []byte(constant.Doc))
+		writeBytes(w, constant.Instructions)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", constant.Type())
+	}
+	return nil
+}
+
+func writeBytes(w *bufio.Writer, b []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(b)))
+	w.Write(b)
+}
+
+// DecodeBytecode reads bytecode written by Encode.
+func DecodeBytecode(r io.Reader) (*Bytecode, error) {
+	bytecode, err := decodeBytecode(bufio.NewReader(r))
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("truncated bytecode: %w", err)
+	}
+	return bytecode, err
+}
+
+func decodeBytecode(r *bufio.Reader) (*Bytecode, error) {
+	magic := make([]byte, len(BytecodeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != BytecodeMagic {
+		return nil, fmt.Errorf("not a bytecode file: bad magic %q", magic)
+	}
+
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != BytecodeVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, BytecodeVersion)
+	}
+
+	instructions, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+
+	// The count comes from the file, so grow as constants are read instead
+	// of trusting it for the allocation.
+	constants := []object.Object{}
+	for i := uint32(0); i < count; i++ {
+		constant, err := decodeConstant(r)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %w", i, err)
+		}
+		constants = append(constants, constant)
+	}
+
+	return &Bytecode{Instructions: instructions, Constants: constants}, nil
+}
+
+func decodeConstant(r *bufio.Reader) (object.Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case tagInteger:
+		var value int64
+		if err := binary.Read(r, binary.BigEndian, &value); err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: value}, nil
+	case tagFloat:
+		var bits uint64
+		if err := binary.Read(r, binary.BigEndian, &bits); err != nil {
+			return nil, err
+		}
+		return &object.Float{Value: math.Float64frombits(bits)}, nil
+	case tagString:
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(value)}, nil
+	case tagBoolean:
+		var value bool
+		if err := binary.Read(r, binary.BigEndian, &value); err != nil {
+			return nil, err
+		}
+		return object.NativeToBooleanObject(value), nil
+	case tagCompiledFunction:
+		var numLocals, numParameters uint32
+		if err := binary.Read(r, binary.BigEndian, &numLocals); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.BigEndian, &numParameters); err != nil {
+			return nil, err
+		}
+		var params []string
+		for i := uint32(0); i < numParameters; i++ {
+			param, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, string(param))
+		}
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions:  code.Instructions(instructions),
+			NumLocals:     int(numLocals),
+			NumParameters: int(numParameters),
+			Parameters:    params,
+			Name:          string(name),
+			Doc:           string(doc),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown constant tag %d", tag)
+	}
+}
+
+// readBytes reads a length-prefixed byte string without allocating more than
+// the input actually holds.
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != int(length) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
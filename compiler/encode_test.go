@@ -0,0 +1,126 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let greeting = "héllo";
+	let add = fn(a, b) { let sum = a + b; sum };
+	let outer = fn(x) { fn(y) { x + y } };
+	[add(1, 2), outer(3)(4), greeting, -5]
+	`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := compiler.Bytecode()
+	original.Constants = append(original.Constants,
+		&object.Float{Value: 2.5}, object.TRUE, object.FALSE,
+		&object.CompiledFunction{NumParameters: 1, Parameters: []string{"x"}, Doc: "Adds one.\nReally."})
+
+	var buf bytes.Buffer
+	if err := original.Encode(&buf); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+
+	decoded, err := DecodeBytecode(&buf)
+	if err != nil {
+		t.Fatalf("DecodeBytecode failed: %s", err)
+	}
+
+	if decoded.Instructions.String() != original.Instructions.String() {
+		t.Errorf("instructions differ.\nwant=%s\ngot=%s", original.Instructions, decoded.Instructions)
+	}
+	if len(decoded.Constants) != len(original.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(original.Constants), len(decoded.Constants))
+	}
+
+	for i, want := range original.Constants {
+		got := decoded.Constants[i]
+		if got.Type() != want.Type() {
+			t.Errorf("constant %d: wrong type. want=%s, got=%s", i, want.Type(), got.Type())
+			continue
+		}
+
+		switch want := want.(type) {
+		case *object.CompiledFunction:
+			got := got.(*object.CompiledFunction)
+			if got.Instructions.String() != want.Instructions.String() {
+				t.Errorf("constant %d: instructions differ.\nwant=%s\ngot=%s", i, want.Instructions, got.Instructions)
+			}
+			if got.NumLocals != want.NumLocals || got.NumParameters != want.NumParameters {
+				t.Errorf("constant %d: wrong locals/parameters. want=%d/%d, got=%d/%d",
+					i, want.NumLocals, want.NumParameters, got.NumLocals, got.NumParameters)
+			}
+			if got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d: wrong parameter names. want=%s, got=%s", i, want.Inspect(), got.Inspect())
+			}
+			if got.Doc != want.Doc {
+				t.Errorf("constant %d: wrong doc. want=%q, got=%q", i, want.Doc, got.Doc)
+			}
+		default:
+			if !object.Equals(got, want) {
+				t.Errorf("constant %d: want=%s, got=%s", i, want.Inspect(), got.Inspect())
+			}
+		}
+	}
+}
+
+func TestDecodeBytecodeErrors(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`let f = fn(x) { x * 2 }; f("a")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := compiler.Bytecode().Encode(&buf); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	encoded := buf.Bytes()
+
+	// Every proper prefix must be reported as truncated rather than panic.
+	for i := 0; i < len(encoded); i++ {
+		_, err := DecodeBytecode(bytes.NewReader(encoded[:i]))
+		if err == nil || !strings.HasPrefix(err.Error(), "truncated bytecode") {
+			t.Errorf("prefix of %d bytes: expected truncation error, got=%v", i, err)
+		}
+	}
+
+	badVersion := append([]byte{}, encoded...)
+	badVersion[len(BytecodeMagic)+1] = 99
+	if _, err := DecodeBytecode(bytes.NewReader(badVersion)); err == nil ||
+		err.Error() != fmt.Sprintf("unsupported bytecode version 99, want %d", BytecodeVersion) {
+		t.Errorf("wrong version error. got=%v", err)
+	}
+
+	if _, err := DecodeBytecode(strings.NewReader("let x = 1;")); err == nil ||
+		!strings.HasPrefix(err.Error(), "not a bytecode file") {
+		t.Errorf("wrong magic error. got=%v", err)
+	}
+}
+
+// TestBuiltinLayoutIsVersioned fails when object.Builtins changes, since
+// OpGetBuiltin operands in encoded files are indexes into it. Bump
+// BytecodeVersion and update both constants below when it does.
+func TestBuiltinLayoutIsVersioned(t *testing.T) {
+	const (
+		version = 7
+		layout  = "len puts first last rest push is_null memo format insert remove slice reverse unique exit env " +
+			"error is_error error_message error_kind bytes to_string byte_at read_file_bytes keys values delete merge " +
+			"freeze is_frozen help spawn channel send recv close range contains to_array"
+	)
+
+	names := []string{}
+	for _, def := range object.Builtins {
+		names = append(names, def.Name)
+	}
+	if got := strings.Join(names, " "); got != layout || BytecodeVersion != version {
+		t.Errorf("builtin layout or bytecode version changed; bump BytecodeVersion with the layout and update this test.\nversion %d, want %d\nlayout %s\nwant   %s", BytecodeVersion, version, got, layout)
+	}
+}
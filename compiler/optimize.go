@@ -0,0 +1,180 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+// Optimize returns a copy of bytecode with a peephole pass applied to the main
+// program and to every compiled function in the constant pool:
+//
+//   - OpTrue/OpFalse followed by OpBang becomes the opposite boolean
+//   - OpConstant followed by OpPop is dropped
+//   - OpJump to the very next instruction is dropped
+//
+// Jump targets are adjusted for the removed instructions. The final OpPop of
+// the main program is kept because it holds the program's result.
+func Optimize(bytecode *Bytecode) *Bytecode {
+	constants := make([]object.Object, len(bytecode.Constants))
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			constant = &object.CompiledFunction{
+				Instructions:  optimizeInstructions(fn.Instructions, false),
+				NumLocals:     fn.NumLocals,
+				NumParameters: fn.NumParameters,
+				Parameters:    fn.Parameters,
+				Name:          fn.Name,
+				Doc:           fn.Doc,
+			}
+		}
+		constants[i] = constant
+	}
+
+	return &Bytecode{
+		Instructions: optimizeInstructions(bytecode.Instructions, true),
+		Constants:    constants,
+	}
+}
+
+type instruction struct {
+	pos      int
+	op       code.Opcode
+	operands []int
+	removed  bool
+}
+
+var jumpOpcodes = map[code.Opcode]bool{
+	code.OpJump:          true,
+	code.OpJumpNotTruthy: true,
+	code.OpJumpTruthy:    true,
+}
+
+// optimizeInstructions repeats the peephole pass until nothing changes, since
+// one rewrite can expose another.
+func optimizeInstructions(ins code.Instructions, keepResult bool) code.Instructions {
+	for {
+		optimized, changed := peephole(ins, keepResult)
+		if !changed {
+			return optimized
+		}
+		ins = optimized
+	}
+}
+
+// peephole leaves instructions it can't decode as they are.
+func peephole(ins code.Instructions, keepResult bool) (code.Instructions, bool) {
+	decoded, err := decodeInstructions(ins)
+	if err != nil {
+		return ins, false
+	}
+
+	targets := map[int]bool{}
+	for _, in := range decoded {
+		if jumpOpcodes[in.op] {
+			targets[in.operands[0]] = true
+		}
+	}
+
+	changed := false
+	for i := 0; i < len(decoded); i++ {
+		cur := decoded[i]
+
+		if cur.op == code.OpJump && i+1 < len(decoded) && cur.operands[0] == decoded[i+1].pos {
+			cur.removed = true
+			changed = true
+			continue
+		}
+
+		// The second instruction of a pair can only go if nothing jumps to it.
+		if i+1 >= len(decoded) || targets[decoded[i+1].pos] {
+			continue
+		}
+		next := decoded[i+1]
+
+		switch {
+		case cur.op == code.OpTrue && next.op == code.OpBang:
+			cur.op = code.OpFalse
+		case cur.op == code.OpFalse && next.op == code.OpBang:
+			cur.op = code.OpTrue
+		case cur.op == code.OpConstant && next.op == code.OpPop:
+			if keepResult && i+2 == len(decoded) {
+				continue
+			}
+			cur.removed = true
+		default:
+			continue
+		}
+
+		next.removed = true
+		changed = true
+		i++
+	}
+
+	if !changed {
+		return ins, false
+	}
+
+	// Removed instructions map to wherever the next kept instruction lands,
+	// which is also where execution would have continued.
+	newPos := make(map[int]int, len(decoded)+1)
+	length := 0
+	for _, in := range decoded {
+		newPos[in.pos] = length
+		if !in.removed {
+			length += len(code.Make(in.op, in.operands...))
+		}
+	}
+	newPos[len(ins)] = length
+
+	out := make(code.Instructions, 0, length)
+	for _, in := range decoded {
+		if in.removed {
+			continue
+		}
+		if jumpOpcodes[in.op] {
+			in.operands[0] = newPos[in.operands[0]]
+		}
+		out = append(out, code.Make(in.op, in.operands...)...)
+	}
+
+	return out, true
+}
+
+// badInstruction is where decodeInstructions stopped reading.
+type badInstruction struct {
+	pos    int
+	reason string
+}
+
+func (b *badInstruction) Error() string {
+	return fmt.Sprintf("%s at %04d", b.reason, b.pos)
+}
+
+// decodeInstructions returns the instructions in ins up to the first one it
+// can't read, and a *badInstruction describing that one if there is one.
+func decodeInstructions(ins code.Instructions) ([]*instruction, error) {
+	var decoded []*instruction
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return decoded, &badInstruction{pos: i, reason: fmt.Sprintf("bad opcode %d", ins[i])}
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return decoded, &badInstruction{pos: i, reason: fmt.Sprintf("truncated %s", def.Name)}
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, &instruction{pos: i, op: code.Opcode(ins[i]), operands: operands})
+
+		i += 1 + read
+	}
+
+	return decoded, nil
+}
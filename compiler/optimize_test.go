@@ -0,0 +1,270 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"testing"
+)
+
+func TestOptimizeInstructions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			name: "true bang becomes false",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "false bang becomes true",
+			input: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "unused constant is dropped",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "program result is kept",
+			input: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "jump to next instruction is dropped",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpJump, 3),
+				// 0003
+				code.Make(code.OpNull),
+				// 0004
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "pop that is a jump target is kept",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpNull),
+				// 0009
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 7),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "jump target moves back over removed instructions",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpBang),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 6),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpPop),
+				// 0006
+				code.Make(code.OpNull),
+				// 0007
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "removal exposes a jump to the next instruction",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpJump, 7),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpPop),
+				// 0007
+				code.Make(code.OpNull),
+				// 0008
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "jump to the end is adjusted",
+			input: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+				// 0008
+				code.Make(code.OpJump, 0),
+				// 0011
+				code.Make(code.OpNull),
+			},
+			expected: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpJump, 0),
+				// 0007
+				code.Make(code.OpNull),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := Optimize(&Bytecode{Instructions: concatInstructions(tt.input)})
+
+		if err := testInstructions(tt.expected, bytecode.Instructions); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
+
+func TestOptimizeCompiledProgram(t *testing.T) {
+	input := `
+	let f = fn() { 1; !true };
+	2;
+	if (!false) { 3 };
+	f();
+	`
+
+	compiler := New()
+	compiler.Peephole = true
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	expected := []code.Instructions{
+		// 0000
+		code.Make(code.OpClosure, 1, 0),
+		// 0004
+		code.Make(code.OpSetGlobal, 0),
+		// 0007
+		code.Make(code.OpTrue),
+		// 0008
+		code.Make(code.OpJumpNotTruthy, 17),
+		// 0011
+		code.Make(code.OpConstant, 3),
+		// 0014
+		code.Make(code.OpJump, 18),
+		// 0017
+		code.Make(code.OpNull),
+		// 0018
+		code.Make(code.OpPop),
+		// 0019
+		code.Make(code.OpGetGlobal, 0),
+		// 0022
+		code.Make(code.OpCall, 0),
+		// 0024
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expected, bytecode.Instructions); err != nil {
+		t.Fatalf("main program: %s", err)
+	}
+
+	fn, ok := bytecode.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 is not a CompiledFunction. got=%T", bytecode.Constants[1])
+	}
+	expectedFn := []code.Instructions{
+		code.Make(code.OpFalse),
+		code.Make(code.OpReturnValue),
+	}
+	if err := testInstructions(expectedFn, fn.Instructions); err != nil {
+		t.Fatalf("function body: %s", err)
+	}
+}
+
+func TestOptimizeLeavesInputUntouched(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`fn() { 1; 2 }; 3; 4`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	original := compiler.Bytecode()
+	before := original.Instructions.String()
+	fnBefore := original.Constants[2].(*object.CompiledFunction).Instructions.String()
+
+	Optimize(original)
+
+	if original.Instructions.String() != before {
+		t.Errorf("Optimize changed the main program in place")
+	}
+	if original.Constants[2].(*object.CompiledFunction).Instructions.String() != fnBefore {
+		t.Errorf("Optimize changed a compiled function in place")
+	}
+}
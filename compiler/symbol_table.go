@@ -1,5 +1,10 @@
 package compiler
 
+import (
+	"fmt"
+	"sort"
+)
+
 type SymbolScope string
 
 const (
@@ -22,12 +27,17 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 
+	// blocks holds the names defined by DefineChecked in each open block, the
+	// innermost last.
+	blocks []map[string]bool
+
 	FreeSymbols []Symbol
 }
 
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
 		store:       make(map[string]Symbol),
+		blocks:      []map[string]bool{{}},
 		FreeSymbols: []Symbol{},
 	}
 }
@@ -38,7 +48,13 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// Define binds name in this scope. Redefining a name already bound here reuses
+// its slot, so a `let` inside a loop body updates the value the loop reads.
 func (s *SymbolTable) Define(name string) Symbol {
+	if existing, ok := s.store[name]; ok && (existing.Scope == GLOBALSCOPE || existing.Scope == LOCALSCOPE) {
+		return existing
+	}
+
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
 		symbol.Scope = GLOBALSCOPE
@@ -50,6 +66,75 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// DefineChecked is Define, except that defining a name twice in the same block
+// is an error. A nested block may still redefine it, which reuses the slot.
+func (s *SymbolTable) DefineChecked(name string) (Symbol, error) {
+	block := s.blocks[len(s.blocks)-1]
+	if block[name] {
+		return Symbol{}, fmt.Errorf("%q is already defined in this scope", name)
+	}
+	block[name] = true
+	return s.Define(name), nil
+}
+
+// Copy returns a table with the same definitions whose later definitions
+// don't affect s, for compiling a program without keeping its globals.
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+	for _, block := range s.blocks {
+		copied := make(map[string]bool, len(block))
+		for name := range block {
+			copied[name] = true
+		}
+		c.blocks = append(c.blocks, copied)
+	}
+	return c
+}
+
+// EnterBlock opens a block for DefineChecked's duplicate detection.
+func (s *SymbolTable) EnterBlock() {
+	s.blocks = append(s.blocks, map[string]bool{})
+}
+
+func (s *SymbolTable) LeaveBlock() {
+	s.blocks = s.blocks[:len(s.blocks)-1]
+}
+
+// NumDefinitions is the number of slots defined in this scope, which for a
+// function scope is the number of locals it needs.
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// shadowed returns the symbol a new definition of name would hide: a builtin,
+// or a variable of an enclosing scope. Redefining a name in its own scope is
+// not shadowing.
+func (s *SymbolTable) shadowed(name string) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok {
+		switch symbol.Scope {
+		case GLOBALSCOPE, LOCALSCOPE, FUNCTIONSCOPE:
+			return Symbol{}, false
+		case BUILTINSCOPE:
+			return symbol, true
+		}
+	}
+
+	for outer := s.Outer; outer != nil; outer = outer.Outer {
+		if symbol, ok := outer.store[name]; ok {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -68,6 +153,24 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return obj, ok
 }
 
+// Names returns the sorted names visible from this scope, including outer
+// scopes and builtins.
+func (s *SymbolTable) Names() []string {
+	seen := map[string]bool{}
+	for table := s; table != nil; table = table.Outer {
+		for name := range table.store {
+			seen[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BUILTINSCOPE}
 	s.store[name] = symbol
@@ -83,6 +186,16 @@ func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	return symbol
 }
 
+// origin returns the symbol a free symbol was captured from, following the
+// captures out through the enclosing functions. Other symbols are their own
+// origin.
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	for table := s; symbol.Scope == FREESCOPE && table.Outer != nil; table = table.Outer {
+		symbol = table.FreeSymbols[symbol.Index]
+	}
+	return symbol
+}
+
 func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	symbol := Symbol{Name: name, Index: 0, Scope: FUNCTIONSCOPE}
 	s.store[name] = symbol
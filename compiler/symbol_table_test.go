@@ -335,3 +335,54 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestRedefineReusesSlot(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.Define("b")
+	redefined := global.Define("a")
+
+	expected := Symbol{Name: "a", Scope: GLOBALSCOPE, Index: 0}
+	if redefined != expected {
+		t.Errorf("expected redefinition to be %+v, got=%+v", expected, redefined)
+	}
+	if global.numDefinitions != 2 {
+		t.Errorf("wrong numDefinitions. want=2, got=%d", global.numDefinitions)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if s := local.Define("a"); s.Scope != LOCALSCOPE || s.Index != 0 {
+		t.Errorf("local definition should shadow the global, got=%+v", s)
+	}
+}
+
+func TestDefineChecked(t *testing.T) {
+	global := NewSymbolTable()
+	if _, err := global.DefineChecked("a"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := global.DefineChecked("a"); err == nil || err.Error() != `"a" is already defined in this scope` {
+		t.Errorf("expected duplicate definition error, got=%v", err)
+	}
+
+	// A nested block may redefine the name and reuses its slot.
+	global.EnterBlock()
+	redefined, err := global.DefineChecked("a")
+	if err != nil {
+		t.Fatalf("unexpected error in nested block: %s", err)
+	}
+	b, _ := global.DefineChecked("b")
+	global.LeaveBlock()
+
+	if redefined.Index != 0 || b.Index != 1 {
+		t.Errorf("indexes not compact. a=%d, b=%d", redefined.Index, b.Index)
+	}
+	if global.NumDefinitions() != 2 {
+		t.Errorf("wrong NumDefinitions. want=2, got=%d", global.NumDefinitions())
+	}
+
+	// Leaving the block forgets what it defined.
+	if _, err := global.DefineChecked("b"); err != nil {
+		t.Errorf("unexpected error after leaving block: %s", err)
+	}
+}
@@ -0,0 +1,352 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/vm"
+	"strings"
+)
+
+// Engine runs programs, keeping globals between calls so successive programs
+// can build on each other the way REPL lines do.
+type Engine interface {
+	Run(program *ast.Program) (object.Object, error)
+
+	// RunContext is Run, stopping early with an error wrapping ctx.Err()
+	// once ctx is done. The engine stays usable afterwards.
+	RunContext(ctx context.Context, program *ast.Program) (object.Object, error)
+
+	// Define binds a global for later programs, as a let would.
+	Define(name string, value object.Object)
+}
+
+// Names lists the engines New accepts.
+var Names = []string{"eval", "vm"}
+
+// DefaultMaxDepth is the call depth the tree walker New returns stops at, so
+// runaway recursion is an error rather than a Go stack overflow that kills
+// the process. The VM has MaxFrames for the same.
+const DefaultMaxDepth = 10000
+
+// New returns a fresh engine by name: "eval" for the tree walker, limited to
+// DefaultMaxDepth, or "vm" for the bytecode VM.
+func New(name string) (Engine, error) {
+	switch name {
+	case "eval":
+		return NewTreeWalkerEngineWithOptions(nil, evaluator.Options{MaxDepth: DefaultMaxDepth}), nil
+	case "vm":
+		return NewVMEngine(nil, nil, nil), nil
+	}
+	return nil, fmt.Errorf("unknown engine %q, expected one of %s", name, strings.Join(Names, ", "))
+}
+
+// DefineArgs binds the global args to a script's command-line arguments, as
+// an Array of Strings.
+func DefineArgs(eng Engine, args []string) {
+	eng.Define("args", Args(args))
+}
+
+// Args returns args as the Array a script sees in its args global.
+func Args(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// SnapshotLimit caps the array elements and hash pairs a snapshot copies.
+const SnapshotLimit = 1 << 20
+
+// State is a checkpoint of an engine's globals, made by Snapshot. Arrays and
+// hashes are deep copied, so changes made to them after the snapshot don't
+// show once it is restored.
+type State struct {
+	engine Engine // the engine that made it
+	env    object.EnvironmentState
+
+	symbols   *compiler.SymbolTable
+	globals   []object.Object
+	constants []object.Object
+}
+
+var errForeignState = errors.New("cannot restore a state another engine made")
+
+// Snapshotter is an Engine whose globals can be checkpointed and restored.
+type Snapshotter interface {
+	// Snapshot captures the globals, failing when they hold more than
+	// SnapshotLimit array elements and hash pairs.
+	Snapshot() (*State, error)
+	// Restore puts back the globals state captured, discarding anything
+	// defined or changed since. It fails for a state another engine made. A
+	// state can be restored more than once.
+	Restore(state *State) error
+}
+
+// TREE WALKER
+
+type TreeWalkerEngine struct {
+	walker *evaluator.TreeWalker
+	env    *object.Environment
+
+	// LimitEachRun applies the step and memory limits to each run on its
+	// own, as the VM engine does, instead of to all runs together.
+	LimitEachRun bool
+}
+
+// NewTreeWalkerEngine evaluates programs in env. A nil env starts empty.
+func NewTreeWalkerEngine(env *object.Environment) *TreeWalkerEngine {
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+	return &TreeWalkerEngine{walker: &evaluator.TreeWalker{}, env: env}
+}
+
+// NewTreeWalkerEngineWithOptions is NewTreeWalkerEngine with the tree walker
+// restricted by options.
+func NewTreeWalkerEngineWithOptions(env *object.Environment, options evaluator.Options) *TreeWalkerEngine {
+	e := NewTreeWalkerEngine(env)
+	e.walker = evaluator.NewTreeWalker(options)
+	return e
+}
+
+func (e *TreeWalkerEngine) Run(program *ast.Program) (object.Object, error) {
+	return e.RunContext(context.Background(), program)
+}
+
+func (e *TreeWalkerEngine) RunContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	if e.LimitEachRun {
+		e.walker.ResetUsage()
+	}
+	result, err := e.walker.EvalContext(ctx, program, e.env)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
+
+func (e *TreeWalkerEngine) Define(name string, value object.Object) {
+	e.env.Set(name, value)
+}
+
+// Steps is the number of nodes evaluated by all runs so far, or by the last
+// run with LimitEachRun.
+func (e *TreeWalkerEngine) Steps() int {
+	return e.walker.Steps()
+}
+
+// Bindings returns the global bindings made by earlier runs.
+func (e *TreeWalkerEngine) Bindings() map[string]object.Object {
+	return e.env.All()
+}
+
+// Snapshot captures the bindings of the engine's environment and the
+// environments around it.
+func (e *TreeWalkerEngine) Snapshot() (*State, error) {
+	env, err := e.env.Checkpoint(&object.Copier{Limit: SnapshotLimit})
+	if err != nil {
+		return nil, err
+	}
+	return &State{engine: e, env: env}, nil
+}
+
+func (e *TreeWalkerEngine) Restore(state *State) error {
+	if state.engine != e {
+		return errForeignState
+	}
+	return state.env.Rollback(&object.Copier{Limit: SnapshotLimit})
+}
+
+// VM
+
+type VMEngine struct {
+	symbols   *compiler.SymbolTable
+	globals   []object.Object
+	constants []object.Object
+	warnings  []*compiler.CompileWarning
+
+	// machine is kept between runs and Reset for each program.
+	machine *vm.VM
+
+	// MaxInstructions, MaxFrames and MaxBytes limit each run as the VM
+	// fields of the same names do. Zero keeps the VM's default.
+	MaxInstructions int
+	MaxFrames       int
+	MaxBytes        int
+
+	// Hooks are passed to the VM for each run.
+	Hooks *object.EvalHooks
+
+	// Overflow is the VM's integer overflow policy.
+	Overflow object.Overflow
+
+	// AllowBuiltin is passed to the VM for each run. A symbol table that
+	// defines only some builtins should come with one allowing just those.
+	AllowBuiltin func(name string) bool
+}
+
+// NewVMEngine compiles and runs programs against the given state. A nil
+// symbol table starts with only the builtins defined, and nil globals get a
+// fresh store.
+func NewVMEngine(symbols *compiler.SymbolTable, globals []object.Object, constants []object.Object) *VMEngine {
+	if symbols == nil {
+		symbols = compiler.NewSymbolTable()
+		for i, v := range object.Builtins {
+			symbols.DefineBuiltin(i, v.Name)
+		}
+	}
+	if globals == nil {
+		globals = make([]object.Object, vm.GLOBALSSIZE)
+	}
+	if constants == nil {
+		constants = []object.Object{}
+	}
+	return &VMEngine{symbols: symbols, globals: globals, constants: constants}
+}
+
+func (e *VMEngine) Run(program *ast.Program) (object.Object, error) {
+	return e.RunContext(context.Background(), program)
+}
+
+func (e *VMEngine) RunContext(ctx context.Context, program *ast.Program) (object.Object, error) {
+	// A program that doesn't compile leaves no definitions behind, so it
+	// works on a copy of the symbol table and a pool it can't append to in
+	// place.
+	comp := compiler.NewWithState(e.symbols.Copy(), e.constants[:len(e.constants):len(e.constants)])
+	err := comp.Compile(program)
+	e.warnings = comp.Warnings
+	if err != nil {
+		return nil, fmt.Errorf("compilation failed: %w", err)
+	}
+
+	code := comp.Bytecode()
+	e.symbols = comp.SymbolTable()
+	e.constants = comp.Constants()
+
+	if e.machine == nil {
+		e.machine = vm.NewWithGlobalsStore(code, e.globals)
+	} else {
+		e.machine.Reset(code)
+	}
+	if e.MaxInstructions > 0 {
+		e.machine.MaxInstructions = e.MaxInstructions
+	}
+	if e.MaxFrames > 0 {
+		e.machine.MaxFrames = e.MaxFrames
+	}
+	if e.MaxBytes > 0 {
+		e.machine.MaxBytes = e.MaxBytes
+	}
+	e.machine.Hooks = e.Hooks
+	e.machine.Overflow = e.Overflow
+	e.machine.GlobalName = e.globalName
+	e.machine.AllowBuiltin = e.AllowBuiltin
+	if err := e.machine.RunContext(ctx); err != nil {
+		return nil, err
+	}
+
+	result := e.machine.LastPoppedStackElem()
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
+
+func (e *VMEngine) Define(name string, value object.Object) {
+	symbol := e.symbols.Define(name)
+	e.globals[symbol.Index] = value
+}
+
+// globalName returns the name bound to global slot index.
+func (e *VMEngine) globalName(index int) string {
+	for _, name := range e.symbols.Names() {
+		if symbol, _ := e.symbols.Resolve(name); symbol.Scope == compiler.GLOBALSCOPE && symbol.Index == index {
+			return name
+		}
+	}
+	return ""
+}
+
+// Compile compiles program against the engine's globals without running it or
+// keeping its definitions, returning the bytecode and the symbol table it was
+// compiled with.
+func (e *VMEngine) Compile(program *ast.Program) (*compiler.Bytecode, *compiler.SymbolTable, error) {
+	// Limiting the capacity makes the compiler copy the pool before it
+	// appends to it.
+	comp := compiler.NewWithState(e.symbols.Copy(), e.constants[:len(e.constants):len(e.constants)])
+	if err := comp.Compile(program); err != nil {
+		return nil, nil, err
+	}
+	return comp.Bytecode(), comp.SymbolTable(), nil
+}
+
+// Bindings returns the global bindings made by earlier runs.
+func (e *VMEngine) Bindings() map[string]object.Object {
+	bindings := map[string]object.Object{}
+	for _, name := range e.symbols.Names() {
+		symbol, _ := e.symbols.Resolve(name)
+		if symbol.Scope == compiler.GLOBALSCOPE && e.globals[symbol.Index] != nil {
+			bindings[name] = e.globals[symbol.Index]
+		}
+	}
+	return bindings
+}
+
+// Snapshot captures the globals along with the symbol table and constants
+// they were compiled with.
+func (e *VMEngine) Snapshot() (*State, error) {
+	globals, err := copyGlobals(e.globals)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		engine:    e,
+		symbols:   e.symbols.Copy(),
+		globals:   globals,
+		constants: e.constants[:len(e.constants):len(e.constants)],
+	}, nil
+}
+
+func (e *VMEngine) Restore(state *State) error {
+	if state.engine != e {
+		return errForeignState
+	}
+	globals, err := copyGlobals(state.globals)
+	if err != nil {
+		return err
+	}
+	// The machine shares the globals, so they are restored in place.
+	copy(e.globals, globals)
+	e.symbols = state.symbols.Copy()
+	e.constants = state.constants
+	return nil
+}
+
+func copyGlobals(globals []object.Object) ([]object.Object, error) {
+	c := &object.Copier{Limit: SnapshotLimit}
+	copied := make([]object.Object, len(globals))
+	for i, value := range globals {
+		if value == nil {
+			continue
+		}
+		value, err := c.Copy(value)
+		if err != nil {
+			return nil, err
+		}
+		copied[i] = value
+	}
+	return copied, nil
+}
+
+// Warnings returns the compiler warnings from the last Run.
+func (e *VMEngine) Warnings() []*compiler.CompileWarning {
+	return e.warnings
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+func engines() map[string]Engine {
+	return map[string]Engine{
+		"tree walker": NewTreeWalkerEngine(nil),
+		"vm":          NewVMEngine(nil, nil, nil),
+	}
+}
+
+func TestEnginesKeepState(t *testing.T) {
+	lines := []string{
+		`let x = 10;`,
+		`let double = fn(n) { n * 2 };`,
+		`double(x) + 1`,
+	}
+
+	for name, eng := range engines() {
+		var last string
+		for _, line := range lines {
+			program, err := parser.New(lexer.New(line)).ParseProgram()
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := eng.Run(program)
+			if err != nil {
+				t.Fatalf("%s: %q: %s", name, line, err)
+			}
+			last = result.Inspect()
+		}
+		if last != "21" {
+			t.Errorf("%s: state not kept between runs. got=%s", name, last)
+		}
+	}
+}
+
+func TestEnginesReportErrors(t *testing.T) {
+	for name, eng := range engines() {
+		program, _ := parser.New(lexer.New(`missing`)).ParseProgram()
+		if _, err := eng.Run(program); err == nil {
+			t.Errorf("%s: expected an error for an undefined identifier", name)
+		}
+	}
+}
+
+// TestHashOrder pins the order every way of enumerating a hash sees, in
+// every engine: the order keys were first set in.
+func TestHashOrder(t *testing.T) {
+	program, err := parser.New(lexer.New(`
+let h = {"b": 1, "a": 2, "c": 3};
+h["d"] = 4;
+h["a"] = 5;
+delete(h, "b");
+[h, keys(h), values(h), merge(h, {}), format("{}", h)]`)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"a": 5, "c": 3, "d": 4}`, `["a", "c", "d"]`, `[5, 3, 4]`, `{"a": 5, "c": 3, "d": 4}`, `{"a": 5, "c": 3, "d": 4}`}
+
+	for name, eng := range engines() {
+		result, err := eng.Run(program)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		surfaces := result.(*object.Array).Elements
+		for i, surface := range surfaces {
+			got := surface.Inspect()
+			if s, ok := surface.(*object.String); ok {
+				got = s.Value
+			}
+			if got != want[i] {
+				t.Errorf("%s: surface %d gave %s, want %s", name, i, got, want[i])
+			}
+		}
+
+		var keys []string
+		for _, pair := range surfaces[0].(*object.Hash).Pairs() {
+			keys = append(keys, pair.Key.Inspect())
+		}
+		if got := strings.Join(keys, ", "); got != "a, c, d" {
+			t.Errorf("%s: Pairs gave %s", name, got)
+		}
+	}
+}
+
+func TestEnginesReadModuleMembers(t *testing.T) {
+	tests := []struct{ input, expected string }{
+		{`m.double(4)`, "8"},
+		{`m.base`, "10"},
+		{`let f = m.double; f(m.base)`, "20"},
+		{`m.doubl(1)`, `error: module "m" has no member "doubl", did you mean "double"?`},
+		{`m.nope`, `error: module "m" has no member "nope"`},
+	}
+
+	for _, tt := range tests {
+		program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, eng := range engines() {
+			double := object.NewBuiltin("double", object.ArgSpec{Min: 1, Max: 1, Types: [][]object.ObjectType{{object.INTEGER_OBJ}}}, func(args []object.Object) object.Object {
+				return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+			})
+			eng.Define("m", object.NewModule("m", map[string]object.Object{"double": double, "base": &object.Integer{Value: 10}}))
+			if got := outcome(eng, program); got != tt.expected {
+				t.Errorf("%s: %q: got %s, want %s", name, tt.input, got, tt.expected)
+			}
+		}
+	}
+}
+
+func TestVMCannotSwitch(t *testing.T) {
+	program, _ := parser.New(lexer.New(`switch (1) { default: { 2 } }`)).ParseProgram()
+	_, err := NewVMEngine(nil, nil, nil).Run(program)
+	if err == nil || !strings.HasSuffix(err.Error(), "switch expressions are not supported by the compiler, run with the eval engine") {
+		t.Errorf("got %v, want switch to be unsupported", err)
+	}
+}
+
+func TestVMCannotSpawn(t *testing.T) {
+	program, _ := parser.New(lexer.New(`spawn(fn() { 1 })`)).ParseProgram()
+	_, err := NewVMEngine(nil, nil, nil).Run(program)
+	if err == nil || err.Error() != "spawn is not supported by the VM, run with the eval engine" {
+		t.Errorf("got %v, want spawn to be unsupported", err)
+	}
+}
+
+func TestVMFailedProgramsKeepNoDefinitions(t *testing.T) {
+	eng := NewVMEngine(nil, nil, nil)
+	parse := func(input string) *ast.Program {
+		program, err := parser.New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return program
+	}
+	if _, err := eng.Run(parse(`let a = 1; let b = nope`)); err == nil {
+		t.Fatal("expected a compile error")
+	}
+	if _, err := eng.Run(parse(`a`)); err == nil || !strings.Contains(err.Error(), `undefined variable "a"`) {
+		t.Errorf("a failed compile left a definition behind. got=%v", err)
+	}
+
+	// A program that compiles but fails keeps its definitions; reading one
+	// it never stored names it.
+	if _, err := eng.Run(parse(`let c = 1 / 0`)); err == nil {
+		t.Fatal("expected a runtime error")
+	}
+	_, err := eng.Run(parse(`c`))
+	var objErr *object.Error
+	if !errors.As(err, &objErr) || err.Error() != "identifier not found: c" || objErr.Kind != object.KindUndefinedIdentifier {
+		t.Errorf("wrong error for an unset global. got=%v", err)
+	}
+}
+
+func TestVMCompileKeepsNoState(t *testing.T) {
+	eng := NewVMEngine(nil, nil, nil)
+	parse := func(input string) *ast.Program {
+		program, err := parser.New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return program
+	}
+
+	if _, err := eng.Run(parse(`let x = 1;`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := eng.Compile(parse(`let y = x + 2;`)); err != nil {
+		t.Fatalf("compile should see earlier globals: %s", err)
+	}
+	if _, err := eng.Run(parse(`y`)); err == nil {
+		t.Errorf("compile kept the definition of y")
+	}
+	result, err := eng.Run(parse(`let z = 3; x + z`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inspect() != "4" {
+		t.Errorf("wrong result after compile. got=%s", result.Inspect())
+	}
+}
+
+func TestEnginesStopWhenCancelled(t *testing.T) {
+	for name, eng := range engines() {
+		program, _ := parser.New(lexer.New(`let n = 0; while (true) { n += 1 }`)).ParseProgram()
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		if _, err := eng.RunContext(ctx, program); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected a cancelled run, got %v", name, err)
+		}
+
+		program, _ = parser.New(lexer.New(`n > 0`)).ParseProgram()
+		result, err := eng.Run(program)
+		if err != nil || result != object.TRUE {
+			t.Errorf("%s: engine unusable after cancelling. got=%v (%v)", name, result, err)
+		}
+	}
+}
+
+func TestEnginesReportErrorKinds(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  string
+	}{
+		{`1 + true`, object.KindTypeMismatch},
+		{`-"a"`, object.KindTypeMismatch},
+		{`1 / 0`, object.KindDivisionByZero},
+		{`5 % 0`, object.KindDivisionByZero},
+		{`insert([1], 5, 0)`, object.KindIndexOutOfBounds},
+		{`slice([1, 2], 2, 1)`, object.KindIndexOutOfBounds},
+		{`len(1, 2)`, object.KindArgument},
+		{`push(1, 2)`, object.KindArgument},
+		{`fn(a) { a }()`, object.KindArgument},
+		{`5()`, object.KindNotCallable},
+		{`{[1]: 2}`, object.KindUnhashable},
+		{`1 << -1`, object.KindInvalidOperation},
+		{`exit(2)`, object.KindExit},
+	}
+
+	for _, tt := range tests {
+		for name, eng := range engines() {
+			program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = eng.Run(program)
+			if err == nil {
+				t.Errorf("%s: %q: expected an error", name, tt.input)
+				continue
+			}
+			if kind := object.ErrorKind(err); kind != tt.kind {
+				t.Errorf("%s: %q: wrong kind. want=%s, got=%s (%v)", name, tt.input, tt.kind, kind, err)
+			}
+		}
+	}
+
+	// An undefined identifier is a compile error in the VM.
+	program, _ := parser.New(lexer.New(`missing`)).ParseProgram()
+	_, err := NewTreeWalkerEngine(nil).Run(program)
+	if kind := object.ErrorKind(err); kind != object.KindUndefinedIdentifier {
+		t.Errorf("tree walker: wrong kind for an undefined identifier: %s", kind)
+	}
+}
@@ -0,0 +1,467 @@
+package engine
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// feature is something a program needs that an engine may not have yet.
+type feature string
+
+const (
+	switches feature = "switch"
+	spawning feature = "spawn"
+)
+
+// missing lists the features each engine lacks. Programs needing one are
+// skipped for that engine, and the skip is reported, instead of failing.
+var missing = map[string]map[feature]bool{
+	"vm": {switches: true, spawning: true},
+}
+
+type parityCase struct {
+	input string
+	// expected is the result's Inspect output, "error: " and the message when
+	// the program must fail with exactly that error, or "error" for any error.
+	expected string
+	needs    []feature
+}
+
+var parityCases = []parityCase{
+	// arithmetic and comparisons
+	{input: `1 + 2 * 3`, expected: "7"},
+	{input: `-5 == 10 - 15`, expected: "true"},
+	{input: `(5 + 10 * 2 + 15 / 3) * 2 + -10`, expected: "50"},
+	{input: `7 % 3`, expected: "1"},
+	{input: `!0`, expected: "true"},
+	{input: `!!5`, expected: "true"},
+	{input: `1 < 2 == true`, expected: "true"},
+	{input: `"a" == "a"`, expected: "true"},
+	{input: `let a = "x"; a + "y" != "xy"`, expected: "false"},
+	{input: `"a" < "b"`, expected: "error: unknown operator: STRING < STRING"},
+	{input: `"a" <= "b"`, expected: "error: unknown operator: STRING <= STRING"},
+	{input: `"a" > "b"`, expected: "error: unknown operator: STRING > STRING"},
+	{input: `let f = fn(x) { x < "b" }; f("a")`, expected: "error: unknown operator: STRING < STRING"},
+	{input: `10 / 0`, expected: "error: division by zero: 10 / 0"},
+	{input: `10 % 0`, expected: "error: division by zero: 10 % 0"},
+	{input: `let d = 0; let f = fn(x) { x / d }; f(-4)`, expected: "error: division by zero: -4 / 0"},
+
+	// bitwise operators
+	{input: `6 | 3`, expected: "7"},
+	{input: `6 & 3`, expected: "2"},
+	{input: `6 ^ 3`, expected: "5"},
+	{input: `1 << 10`, expected: "1024"},
+	{input: `-16 >> 2`, expected: "-4"},
+	{input: `1 << 64`, expected: "error: integer overflow: 1 << 64"},
+	{input: `9223372036854775807 + 1`, expected: "error: integer overflow: 9223372036854775807 + 1"},
+	{input: `-(-9223372036854775807 - 1)`, expected: "error: integer overflow: -(-9223372036854775808)"},
+	{input: `let flags = 0; flags = flags | 4; flags & 4 != 0`, expected: "true"},
+	{input: `let flags = 6; flags ^= 3; flags`, expected: "5"},
+	{input: `let flags = 6; flags |= 3; flags`, expected: "7"},
+	{input: `let flags = 6; flags &= 3; flags`, expected: "2"},
+	{input: `let masks = [6]; masks[0] |= 1; masks[0] &= 5; masks[0] ^= 1; masks`, expected: "[4]"},
+	{input: `"ab" << "cd"`, expected: "abcd"},
+	{input: `[1] << [2]`, expected: "[1, [2]]"},
+	{input: `1 << -1`, expected: "error: negative shift count: -1"},
+	{input: `8 >> -2`, expected: "error: negative shift count: -2"},
+	{input: `"a" | "b"`, expected: "error: unknown operator: STRING | STRING"},
+	{input: `[1] << 2`, expected: "[1, 2]"},
+	{input: `true & false`, expected: "error: operator & cannot operate with a BOOLEAN and BOOLEAN"},
+	{input: `1.5 | 1`, expected: "error"},
+
+	// floats
+	{input: `1.5`, expected: "1.5"},
+	{input: `2.0`, expected: "2.0"},
+	{input: `0.1 + 0.2`, expected: "0.30000000000000004"},
+	{input: `1 + 0.5`, expected: "1.5"},
+	{input: `0.5 + 1`, expected: "1.5"},
+	{input: `3 - 0.5`, expected: "2.5"},
+	{input: `1.5 * 2`, expected: "3.0"},
+	{input: `1 / 4.0`, expected: "0.25"},
+	{input: `1.0 / 0`, expected: "+Inf"},
+	{input: `-1.5`, expected: "-1.5"},
+	{input: `-(2 * 1.5)`, expected: "-3.0"},
+	{input: `1.5 < 2`, expected: "true"},
+	{input: `2 > 1.5`, expected: "true"},
+	{input: `1.5 <= 1.5`, expected: "true"},
+	{input: `1.5 >= 2`, expected: "false"},
+	{input: `1 == 1.0`, expected: "true"},
+	{input: `1.5 != 1.5`, expected: "false"},
+	{input: `[1.5, 2][0] + 1`, expected: "2.5"},
+	{input: `let half = fn(x) { x / 2.0 }; half(5)`, expected: "2.5"},
+	{input: `let x = 1.5; x += 1; x`, expected: "2.5"},
+	{input: `1.5 % 1`, expected: "error: operator % cannot operate with a FLOAT and INTEGER"},
+	{input: `1.5 << 1`, expected: "error: operator << cannot operate with a FLOAT and INTEGER"},
+	{input: `1.5 + "a"`, expected: "error: type mismatch: FLOAT + STRING"},
+
+	// strings, arrays, hashes and builtins
+	{input: `"foo" + "bar"`, expected: "foobar"},
+	{input: `[1, 2, 3][1]`, expected: "2"},
+	{input: `[1, 2, 3][3]`, expected: "error: index 3 out of range for length 3"},
+	{input: `{"a": 1, "b": 2}["b"]`, expected: "2"},
+	{input: `{"a": 1}["c"]`, expected: "null"},
+	{input: `len(push([1, 2], 3))`, expected: "3"},
+	{input: `len("hello")`, expected: "5"},
+	{input: `first([]) == null`, expected: "true"},
+	{input: `rest([1, 2, 3])`, expected: "[2, 3]"},
+	{input: `[first("hello"), last("hello"), rest("hello"), push("hell", "o")]`, expected: `["h", "o", "ello", "hello"]`},
+	{input: `[first("héllo wörld"), last("añ"), rest("日本語"), push("日本", "語")]`, expected: `["h", "ñ", "本語", "日本語"]`},
+	{input: `[first("é"), last("é"), rest("é")]`, expected: `["é", "é", ""]`},
+	{input: `[first(""), last(""), rest("")]`, expected: "[null, null, null]"},
+	{input: `push("a", 1)`, expected: "error: push: argument 2 must be STRING for a STRING, got INTEGER"},
+	{input: `let h = {}; h["k"] = 1; h["k"] += 2; h["k"]`, expected: "3"},
+	{input: `{}[fn() { 1 }]`, expected: "error: unusable as hash key: FUNCTION"},
+	{input: `let h = {}; h[fn() { 1 }] = 2`, expected: "error: unusable as HASH key: FUNCTION"},
+	{input: `first(fn() { 1 })`, expected: "error: first: argument 1 must be ARRAY or STRING, got FUNCTION"},
+	{input: `let a = [1]; a[0] = a; let b = [1]; b[0] = b; [len(unique([a, b, a])), contains([a], b)]`, expected: "[1, true]"},
+	{input: `let h = {}; h["h"] = h; let g = {}; g["h"] = g; [len(unique([h, g])), contains([h], g)]`, expected: "[1, true]"},
+
+	// operator errors
+	{input: `1 + "a"`, expected: "error: type mismatch: INTEGER + STRING"},
+	{input: `"a" < true`, expected: "error: type mismatch: STRING < BOOLEAN"},
+	{input: `[1] < 2`, expected: "error: type mismatch: ARRAY < INTEGER"},
+	{input: `{} * 2`, expected: "error: type mismatch: HASH * INTEGER"},
+	{input: `let f = fn(a) { a * true }; f(2)`, expected: "error: type mismatch: INTEGER * BOOLEAN"},
+	{input: `"a" - "b"`, expected: "error: unknown operator: STRING - STRING"},
+	{input: `bytes("a") - bytes("b")`, expected: "error: unknown operator: BYTES - BYTES"},
+	{input: `[1] + [2]`, expected: "error: operator + cannot operate with a ARRAY and ARRAY"},
+	{input: `true > false`, expected: "error: operator > cannot operate with a BOOLEAN and BOOLEAN"},
+	{input: `null + 1`, expected: "error: operator + cannot operate with a NULL and INTEGER"},
+	{input: `1 <= null`, expected: "error: operator <= cannot operate with a INTEGER and NULL"},
+	{input: `null < null`, expected: "error: operator < cannot operate with a NULL and NULL"},
+	{input: `-"a"`, expected: "error: unsupported type for negation: STRING"},
+
+	// conditionals and logical operators
+	{input: `if (1 < 2) { "yes" } else { "no" }`, expected: "yes"},
+	{input: `if (false) { 1 }`, expected: "null"},
+	{input: `0 || "fallback"`, expected: "fallback"},
+	{input: `1 && 2 > 3`, expected: "false"},
+
+	// functions and closures
+	{input: `let add = fn(a, b) { a + b }; add(2, 3)`, expected: "5"},
+	{input: `let makeAdder = fn(x) { fn(y) { x + y } }; makeAdder(1)(2)`, expected: "3"},
+	{input: `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`, expected: "610"},
+	{input: `let early = fn() { return 1; 2 }; early()`, expected: "1"},
+	{input: `let loop = fn(n, acc) { if (n == 0) { return acc; } return loop(n - 1, acc + n); }; loop(1000, 0)`, expected: "500500"},
+	{input: `let f = fn(a) { a }; let g = fn() { f(1, 2) }; g()`, expected: "error: wrong number of arguments: want=1, got=2"},
+	{input: `let f = fn(a) { a }; let g = fn() { 1 + f(1, 2) }; g()`, expected: "error: wrong number of arguments: want=1, got=2"},
+	{input: `let f = fn() { let x = 1; let g = fn() { x }; x = 2; g() }; f()`, expected: "2"},
+	{input: `let f = fn(a) { let g = fn() { a }; a = 5; g() }; f(1)`, expected: "5"},
+	{input: `let f = fn() { let x = 1; let g = fn() { fn() { x } }; x = 3; g()() }; f()`, expected: "3"},
+	{input: `let f = fn() { let fs = []; let i = 0; while (i < 5) { let j = i; fs = push(fs, fn() { j }); i += 1 }; [fs[0](), fs[4]()] }; f()`, expected: "[4, 4]"},
+	{input: `let f = fn() { let fs = []; let i = 0; while (i < 3) { fs = push(fs, fn() { i }); i += 1 }; [fs[0](), i] }; f()`, expected: "[3, 3]"},
+	{input: `let mk = fn() { let n = 0; fn() { n += 1; n } }; let c = mk(); c(); c()`, expected: "2"},
+	{input: `let f = fn() { let n = 1; let set = fn(v) { n = v }; set(5); n }; f()`, expected: "5"},
+
+	{input: `let total = memo(fn(a) { len(a) }); [total([1]), total([1, 2]), total([1])]`, expected: "[1, 2, 1]"},
+	{input: `let calls = [0]; let f = memo(fn(x) { calls[0] += 1; x * 2 }); [f(2), f(2), f(3), calls[0]]`, expected: "[4, 4, 6, 2]"},
+	{input: `let fib = null; fib = memo(fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }); fib(60)`, expected: "1548008755920"},
+	{input: `let fib = memo(fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }); fib(60)`, expected: "1548008755920"},
+	{input: `let f = fn() { let fib = memo(fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }); fib(60) }; f()`, expected: "1548008755920"},
+	{input: `let g = fn(x) { x }; let f = fn() { let g = g(fn() { 1 }); g() }; f()`, expected: "1"},
+	{input: `let size = memo(len); [size("ab"), size("ab")]`, expected: "[2, 2]"},
+
+	// break and continue
+	{input: `let f = fn() { break }; 1`, expected: "error"},
+	{input: `if (false) { continue }; 1`, expected: "error"},
+	{input: `while (true) { let f = fn() { continue }; break }`, expected: "error"},
+	{input: `let i = 0; while (i < 3) { i += 1; if (i == 2) { continue } }; i`, expected: "3"},
+
+	// definitions
+	{input: `let x = 1; let x = 2; x`, expected: "error"},
+	{input: `let f = fn(a, a) { a }; f(1, 2)`, expected: "error"},
+	{input: `let f = fn() { let y = 1; let y = 2; y }; 1`, expected: "error"},
+	{input: `if (false) { let z = 1; let z = 2 }`, expected: "error"},
+	{input: `let x = 1; let y = if (true) { let x = 2; x }; [x, y]`, expected: "[2, 2]"},
+	{input: `let f = fn(a) { let a = a + 1; a }; f(1)`, expected: "2"},
+
+	// assignment order
+	{input: `let x = 1; let f = fn() { x = 10; 1 }; x += f(); x`, expected: "2"},
+	{input: `let x = 1; let f = fn() { x = 10; 1 }; x = x + f(); x`, expected: "2"},
+	{input: `let x = 1; let f = fn() { x = 10; 1 }; x = f(); x`, expected: "1"},
+	{input: `let a = [1]; let g = fn() { a[0] = 10; 1 }; a[0] += g(); a[0]`, expected: "2"},
+	{input: `let h = {"n": 1}; let g = fn() { h["n"] = 10; 1 }; h["n"] += g(); h["n"]`, expected: "2"},
+
+	// loops
+	{input: `let i = 0; let acc = []; while (i < 5) { let acc = push(acc, i * i); let i = i + 1; }; acc`, expected: "[0, 1, 4, 9, 16]"},
+	{input: `while (false) { 1 }`, expected: "null"},
+	{input: `let n = 1; let i = 0; while (i < 10) { n *= 2; i += 1; }; n`, expected: "1024"},
+	{input: `let i = 0; let out = []; while (i < 3) { let j = 0; while (true) { j += 1; if (j > i) { break }; if (j == 1) { continue }; out = push(out, [i, j]) }; i += 1 }; out`, expected: "[[2, 2]]"},
+	{input: `let i = 0; while (i < 1000) { i += 1; if (true) { if (i > 0) { continue } } }; i`, expected: "1000"},
+	{input: `let i = 0; while (true) { i += 1; if (i == 5) { break } else { 0 } + 1 }; i`, expected: "5"},
+	{input: `let i = 0; let xs = [1, while (true) { break }, fn() { while (true) { i += 1; if (i == 3) { break } }; i }()]; xs`, expected: "[1, null, 3]"},
+
+	// inspect output
+	{input: `[1, "1", "a b", [true, null]]`, expected: `[1, "1", "a b", [true, null]]`},
+	{input: `{"b": 1, "a": [2], 10: 3, 2: 4, 1.5: 5, true: 6, false: 7}`, expected: `{"b": 1, "a": [2], 10: 3, 2: 4, 1.5: 5, true: 6, false: 7}`},
+	{input: `{"k": {"n": "v"}}`, expected: `{"k": {"n": "v"}}`},
+	{input: `fn(a, b) { a + b }`, expected: "fn(a, b) {...}"},
+	{input: `[fn() { 1 }, len]`, expected: "[fn() {...}, builtin function]"},
+	{input: `let a = [1, 2]; a[0] = a; a`, expected: "[[...], 2]"},
+	{input: `let h = {"self": 0}; h["self"] = h; h`, expected: `{"self": {...}}`},
+	{input: `let a = [0]; [a, a]`, expected: "[[0], [0]]"},
+	{input: `let a = []; let i = 0; while (i < 40) { a = [a]; i += 1 }; a`,
+		expected: strings.Repeat("[", object.MaxInspectDepth) + "[...]" + strings.Repeat("]", object.MaxInspectDepth)},
+
+	// error values
+	{input: `let e = error("bad"); [is_error(e), error_message(e), error_kind(e)]`, expected: `[true, "bad", "error"]`},
+	{input: `error_kind(error("no such user", "not_found"))`, expected: "not_found"},
+	{input: `[is_error(1), is_error(null), is_error("error")]`, expected: "[false, false, false]"},
+	{input: `let errs = [error("a"), error("b")]; error_message(last(errs))`, expected: "b"},
+	{input: `let check = fn(x) { if (x < 0) { return error("negative"); } x }; let r = check(-1); if (is_error(r)) { error_message(r) } else { r }`, expected: "negative"},
+	{input: `error("raised")`, expected: "ERROR: raised"},
+	{input: `error_message("not an error")`, expected: "error: error_message: argument 1 must be ERROR, got STRING"},
+
+	// hash order
+	{input: `let h = {"z": 1, "a": 2, "m": 3}; [keys(h), values(h)]`, expected: `[["z", "a", "m"], [1, 2, 3]]`},
+	{input: `let h = {"a": 1, "b": 2, "c": 3}; delete(h, "a"); h["a"] = 4; h`, expected: `{"b": 2, "c": 3, "a": 4}`},
+	{input: `let h = {"a": 1, "b": 2}; h["a"] = 3; keys(h)`, expected: `["a", "b"]`},
+	{input: `let h = {"a": 1}; [delete(h, "a"), delete(h, "a"), len(keys(h))]`, expected: "[1, null, 0]"},
+	{input: `merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, expected: `{"b": 4, "a": 2, "c": 3}`},
+	{input: `delete({}, [1])`, expected: "error: unusable as hash key: ARRAY"},
+
+	// frozen values
+	{input: `let a = freeze([1, 2]); a[0] = 5`, expected: "error: cannot modify frozen ARRAY"},
+	{input: `let a = freeze([1, 2]); a[0] += 5`, expected: "error: cannot modify frozen ARRAY"},
+	{input: `let h = freeze({"a": 1}); h["b"] = 2`, expected: "error: cannot modify frozen HASH"},
+	{input: `let h = freeze({"a": 1}); delete(h, "a")`, expected: "error: cannot modify frozen HASH"},
+	{input: `let h = freeze({"a": [1], "b": {"c": 2}}); h["b"]["c"] = 3`, expected: "error: cannot modify frozen HASH"},
+	{input: `let h = freeze({"a": [1], "b": {"c": 2}}); h["a"][0] = 3`, expected: "error: cannot modify frozen ARRAY"},
+	{input: `let h = freeze({"a": [1, 2]}); [h["a"][1], len(h["a"]), keys(h), is_frozen(h["a"])]`, expected: `[2, 2, ["a"], true]`},
+	{input: `let a = freeze([1]); let b = push(a, 2); b[0] = 9; [a, b, is_frozen(a), is_frozen(b)]`, expected: "[[1], [9, 2], true, false]"},
+	{input: `[is_frozen(slice(freeze([1, 2]), 0, 1)), is_frozen(merge(freeze({}), {})), is_frozen(rest(freeze([1, 2])))]`, expected: "[false, false, false]"},
+	{input: `let a = [0]; a[0] = a; freeze(a); is_frozen(a)`, expected: "true"},
+	{input: `[is_frozen(1), is_frozen("s"), is_frozen([1]), is_frozen({})]`, expected: "[true, true, false, false]"},
+
+	// bytes
+	{input: `let b = bytes("héllo"); [len(b), b[1], byte_at(b, -1)]`, expected: "[6, 195, 111]"},
+	{input: `to_string(bytes("ab") + bytes("cd"))`, expected: "abcd"},
+	{input: `[bytes("ab") == bytes("ab"), bytes("ab") != bytes("ab"), bytes("a") == "a"]`, expected: "[true, false, false]"},
+	{input: `slice(bytes("hello"), 1, 3)`, expected: "<2 bytes: 65 6c>"},
+	{input: `bytes("ab")[2]`, expected: "error: index 2 out of range for length 2"},
+
+	// channels
+	{input: `let ch = channel(2); send(ch, 1); send(ch, "two"); [recv(ch), recv(ch)]`, expected: `[1, "two"]`},
+	{input: `let ch = channel(1); send(ch, 1); close(ch); [recv(ch), recv(ch)]`, expected: "[1, null]"},
+	{input: `let ch = channel(); close(ch); send(ch, 1)`, expected: "error: send on closed channel"},
+	{input: `let ch = channel(); close(ch); close(ch)`, expected: "error: close of closed channel"},
+	{input: `channel(-1)`, expected: "error: channel: negative buffer size -1"},
+
+	// ranges
+	{input: `[range(3), range(1, 10), range(10, 0, -2)]`, expected: "[0..3, 1..10, 10..0 step -2]"},
+	{input: `[len(range(1, 10)), len(range(10, 1)), len(range(10, 0, -3)), len(range(5, 5))]`, expected: "[9, 0, 4, 0]"},
+	{input: `let r = range(10, 0, -3); [r[0], r[1], r[3]]`, expected: "[10, 7, 1]"},
+	{input: `range(3)[3]`, expected: "error: index 3 out of range for length 3"},
+	{input: `[contains(range(1, 10, 3), 7), contains(range(1, 10, 3), 8), contains(range(3), 2.0), contains([1, "a"], "a"), contains("hello", "ell")]`, expected: "[true, false, true, true, true]"},
+	{input: `[to_array(range(4, 0, -1)), to_array(range(0))]`, expected: "[[4, 3, 2, 1], []]"},
+	{input: `[contains([range(0, 3)], range(0, 3, 1)), contains([range(0, 1)], range(0, 1, 5)), contains([range(2, 2)], range(9, 0)), contains([range(3)], [0, 1, 2])]`, expected: "[true, true, true, false]"},
+	{input: `if (range(0)) { 1 } else { 2 }`, expected: "2"},
+	{input: `let r = range(10000000); let i = 0; let sum = 0; while (i < len(r)) { sum += r[i]; i += 100000 }; [sum, contains(r, 9999999)]`, expected: "[495000000, true]"},
+	{input: `range(1, 2, 0)`, expected: "error: range: step must not be zero"},
+
+	// pipes, members and method calls
+	{input: `let double = fn(x) { x * 2 }; 3 |> double`, expected: "6"},
+	{input: `[1] |> push(2) |> push(3) |> len`, expected: "3"},
+	{input: `let f = fn(x) { fn(y) { y |> push(x) } }; f(2)([1])`, expected: "[1, 2]"},
+	{input: `1 |> nope`, expected: "error"},
+	{input: `let double = fn(x) { x * 2 }; [1, 2].push(3).len().double()`, expected: "6"},
+	{input: `let h = {"len": fn() { 0 }}; [h.len(), h.keys().len()]`, expected: "[0, 1]"},
+	{input: `let h = {"add": fn(a, b) { a + b }, "n": 5}; [h.add(1, 2), h.n, h["n"]]`, expected: "[3, 5, 5]"},
+	{input: `let f = fn(xs) { let last = fn(ys) { ys[len(ys) - 1] }; xs.push(4).last() }; f([3])`, expected: "4"},
+	{input: `let len = 3; [1, 2].len() + len`, expected: "5"},
+	{input: `{"a": 1}.b`, expected: `error: hash has no member "b"`},
+	{input: `let x = 1; x.y`, expected: "error: INTEGER has no members"},
+	{input: `[1].nope()`, expected: "error"},
+
+	// features only the tree walker has so far; the VM tells users to run
+	// these with the eval engine
+	{input: `let ch = channel(); spawn(fn() { send(ch, 1); close(ch) }); [recv(ch), recv(ch)]`, expected: "[1, null]", needs: []feature{spawning}},
+	{input: `switch (2) { case 1: { "one" } case 2: { "two" } }`, expected: "two", needs: []feature{switches}},
+	{input: `switch ([1, 2]) { case let [a, b]: { a + b } }`, expected: "3", needs: []feature{switches}},
+}
+
+// comparisonCases checks every comparison operator on a few small integers
+// against Go's own answer.
+func comparisonCases() []parityCase {
+	operands := []int{-1, 0, 1, 2}
+	operators := map[string]func(l, r int) bool{
+		"<":  func(l, r int) bool { return l < r },
+		">":  func(l, r int) bool { return l > r },
+		"<=": func(l, r int) bool { return l <= r },
+		">=": func(l, r int) bool { return l >= r },
+		"==": func(l, r int) bool { return l == r },
+		"!=": func(l, r int) bool { return l != r },
+	}
+
+	var cases []parityCase
+	for _, l := range operands {
+		for op, compare := range operators {
+			for _, r := range operands {
+				cases = append(cases, parityCase{
+					input:    fmt.Sprintf("%d %s %d", l, op, r),
+					expected: fmt.Sprint(compare(l, r)),
+				})
+			}
+		}
+	}
+	return cases
+}
+
+// shiftCases applies << and >> to every pair of operand types, expecting
+// what object.Shift documents: integers shift, STRING << STRING
+// concatenates, ARRAY << anything appends, and every other pair fails.
+func shiftCases() []parityCase {
+	operands := []struct{ src, typ, element string }{
+		{`6`, "INTEGER", "6"},
+		{`1.5`, "FLOAT", "1.5"},
+		{`"ab"`, "STRING", `"ab"`},
+		{`[1]`, "ARRAY", "[1]"},
+		{`{1: 2}`, "HASH", "{1: 2}"},
+		{`true`, "BOOLEAN", "true"},
+		{`null`, "NULL", "null"},
+		{`bytes("hi")`, "BYTES", "<2 bytes: 68 69>"},
+		{`range(3)`, "RANGE", "0..3"},
+		{`len`, "BUILTIN", "builtin function"},
+	}
+
+	var cases []parityCase
+	for _, op := range []string{"<<", ">>"} {
+		for _, l := range operands {
+			for _, r := range operands {
+				expected := fmt.Sprintf("error: operator %s cannot operate with a %s and %s", op, l.typ, r.typ)
+				switch {
+				case l.typ == "INTEGER" && r.typ == "INTEGER" && op == "<<":
+					expected = "384"
+				case l.typ == "INTEGER" && r.typ == "INTEGER":
+					expected = "0"
+				case op == ">>":
+				case l.typ == "STRING" && r.typ == "STRING":
+					expected = "abab"
+				case l.typ == "ARRAY":
+					expected = "[1, " + r.element + "]"
+				}
+				cases = append(cases, parityCase{
+					input:    fmt.Sprintf("%s %s %s", l.src, op, r.src),
+					expected: expected,
+				})
+			}
+		}
+	}
+	return cases
+}
+
+func TestParity(t *testing.T) {
+	for _, tt := range append(append(parityCases, comparisonCases()...), shiftCases()...) {
+		t.Run(tt.input, func(t *testing.T) {
+			checkParity(t, tt)
+		})
+	}
+}
+
+// checkParity runs tt through every engine that has the features it needs and
+// reports all of their outcomes side by side if any is wrong.
+func checkParity(t *testing.T, tt parityCase) {
+	program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("parser error: %s", err)
+	}
+
+	outcomes := map[string]string{}
+	skipped := false
+	failed := false
+	for name, eng := range engines() {
+		if lacking := lacks(name, tt.needs); lacking != "" {
+			outcomes[name] = "skipped, needs " + lacking
+			skipped = true
+			continue
+		}
+		outcomes[name] = outcome(eng, program)
+		if !matches(tt.expected, outcomes[name]) {
+			failed = true
+		}
+	}
+
+	if failed {
+		t.Errorf("engines disagree with the expected result\n%s", sideBySide(tt.expected, outcomes))
+		return
+	}
+	if skipped {
+		t.Skipf("%s", sideBySide(tt.expected, outcomes))
+	}
+}
+
+func lacks(engine string, needs []feature) string {
+	for _, f := range needs {
+		if missing[engine][f] {
+			return string(f)
+		}
+	}
+	return ""
+}
+
+func outcome(eng Engine, program *ast.Program) string {
+	result, err := eng.Run(program)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result.Inspect()
+}
+
+func matches(expected, outcome string) bool {
+	if expected == "error" {
+		return strings.HasPrefix(outcome, "error: ")
+	}
+	return outcome == expected
+}
+
+func sideBySide(expected string, outcomes map[string]string) string {
+	names := []string{}
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "  %-12s %s\n", "expected", expected)
+	for _, name := range names {
+		fmt.Fprintf(&out, "  %-12s %s\n", name, outcomes[name])
+	}
+	return out.String()
+}
+
+var benchmarks = []struct {
+	name  string
+	input string
+}{
+	{"fib", `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(25)`},
+	{"array building", `let i = 0; let xs = []; while (i < 1000) { xs = push(xs, i); i += 1 }; len(xs)`},
+	{"string concat", `let i = 0; let s = ""; while (i < 1000) { s = s + "x"; i += 1 }; len(s)`},
+	{"hash lookups", `let h = {"a": 1, "b": 2, "c": 3}; let i = 0; let sum = 0; while (i < 10000) { sum += h["a"] + h["c"]; i += 1 }; sum`},
+}
+
+// BenchmarkEngines runs each program on a fresh engine per iteration, so the
+// VM's numbers include compiling.
+func BenchmarkEngines(b *testing.B) {
+	for _, bm := range benchmarks {
+		program, err := parser.New(lexer.New(bm.input)).ParseProgram()
+		if err != nil {
+			b.Fatalf("%s: %s", bm.name, err)
+		}
+		for _, name := range []string{"tree walker", "vm"} {
+			b.Run(bm.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := engines()[name].Run(program); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
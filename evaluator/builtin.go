@@ -2,13 +2,64 @@ package evaluator
 
 import (
 	"monkey/object"
+	"sort"
 )
 
+// BuiltinNames returns the names of the builtins scripts can call, sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
+	"len":     object.GetBuiltinByName("len"),
+	"puts":    object.GetBuiltinByName("puts"),
+	"first":   object.GetBuiltinByName("first"),
+	"last":    object.GetBuiltinByName("last"),
+	"rest":    object.GetBuiltinByName("rest"),
+	"push":    object.GetBuiltinByName("push"),
+	"is_null": object.GetBuiltinByName("is_null"),
+	"memo":    object.GetBuiltinByName("memo"),
+	"format":  object.GetBuiltinByName("format"),
+	"insert":  object.GetBuiltinByName("insert"),
+	"remove":  object.GetBuiltinByName("remove"),
+	"slice":   object.GetBuiltinByName("slice"),
+	"reverse": object.GetBuiltinByName("reverse"),
+	"unique":  object.GetBuiltinByName("unique"),
+	"exit":    object.GetBuiltinByName("exit"),
+	"env":     object.GetBuiltinByName("env"),
+
+	"error":         object.GetBuiltinByName("error"),
+	"is_error":      object.GetBuiltinByName("is_error"),
+	"error_message": object.GetBuiltinByName("error_message"),
+	"error_kind":    object.GetBuiltinByName("error_kind"),
+
+	"bytes":           object.GetBuiltinByName("bytes"),
+	"to_string":       object.GetBuiltinByName("to_string"),
+	"byte_at":         object.GetBuiltinByName("byte_at"),
+	"read_file_bytes": object.GetBuiltinByName("read_file_bytes"),
+
+	"keys":   object.GetBuiltinByName("keys"),
+	"values": object.GetBuiltinByName("values"),
+	"delete": object.GetBuiltinByName("delete"),
+	"merge":  object.GetBuiltinByName("merge"),
+
+	"freeze":    object.GetBuiltinByName("freeze"),
+	"is_frozen": object.GetBuiltinByName("is_frozen"),
+
+	"help": object.GetBuiltinByName("help"),
+
+	"spawn":   object.GetBuiltinByName("spawn"),
+	"channel": object.GetBuiltinByName("channel"),
+	"send":    object.GetBuiltinByName("send"),
+	"recv":    object.GetBuiltinByName("recv"),
+	"close":   object.GetBuiltinByName("close"),
+
+	"range":    object.GetBuiltinByName("range"),
+	"contains": object.GetBuiltinByName("contains"),
+	"to_array": object.GetBuiltinByName("to_array"),
 }
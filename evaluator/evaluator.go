@@ -2,22 +2,50 @@ package evaluator
 
 import (
 	"fmt"
-	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
 )
 
-type Evaluator interface {
-	Eval(ast.Node) (object.Object, error)
-}
-
 type EvalError struct {
-	msg string
+	Pos  token.Position // the node the error is about, when known
+	Kind string         // one of the object.Kind constants
+	msg  string
 }
 
 func (e *EvalError) Error() string {
 	return e.msg
 }
 
-func createEvalError(message string, args ...any) *EvalError {
-	return &EvalError{msg: fmt.Sprintf(message, args...)}
+func (e *EvalError) ErrorKind() string { return e.Kind }
+
+// LimitError reports that a script exceeded a limit set in Options, as
+// opposed to an error in the script itself.
+type LimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d exceeded", e.Limit, e.Max)
+}
+
+func (e *LimitError) ErrorKind() string { return object.KindLimitExceeded }
+
+func createEvalError(kind, message string, args ...any) *EvalError {
+	return &EvalError{Kind: kind, msg: fmt.Sprintf(message, args...)}
+}
+
+// createEvalErrorAt is createEvalError for an error about the node at pos.
+func createEvalErrorAt(pos token.Position, kind, message string, args ...any) *EvalError {
+	return &EvalError{Pos: pos, Kind: kind, msg: fmt.Sprintf(message, args...)}
+}
+
+// loopJump carries a break or continue out of the if or switch it was used
+// in, abandoning every enclosing expression on the way to the loop.
+type loopJump struct {
+	signal *object.LoopSignal
+}
+
+func (j *loopJump) Error() string {
+	return fmt.Sprintf("%s outside of a loop", j.signal.Inspect())
 }
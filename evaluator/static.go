@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// checkProgram fails on the first mistake in a program's statements that the
+// compiler rejects before running anything, so both engines reject it:
+//
+//   - a name defined twice in the same block, by two lets or as two
+//     parameters of a function. A nested block may define a name again, and
+//     so may a later program, so REPL lines can redefine globals.
+//   - a break or continue outside of a loop in the same function.
+func checkProgram(stmts []ast.Statement) error {
+	c := &checker{}
+	c.block(stmts)
+	return c.err
+}
+
+type checker struct {
+	err   error
+	loops int // loops around the current statement in its function
+}
+
+// block checks stmts as one block.
+func (c *checker) block(stmts []ast.Statement) {
+	names := map[string]bool{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			c.expression(stmt.Value)
+			c.define(names, stmt.Name)
+		case *ast.ReturnStatement:
+			c.expression(stmt.ReturnValue)
+		case *ast.ExpressionStatement:
+			c.expression(stmt.Expression)
+		case *ast.BlockStatement:
+			c.block(stmt.Statements)
+		case *ast.BreakStatement:
+			c.outsideLoop(stmt.Token.Pos, "break")
+		case *ast.ContinueStatement:
+			c.outsideLoop(stmt.Token.Pos, "continue")
+		}
+	}
+}
+
+func (c *checker) define(names map[string]bool, name *ast.Identifier) {
+	if names[name.Value] && c.err == nil {
+		c.err = createEvalErrorAt(name.Token.Pos, object.KindInvalidOperation, "%q is already defined in this scope", name.Value)
+	}
+	names[name.Value] = true
+}
+
+func (c *checker) outsideLoop(pos token.Position, keyword string) {
+	if c.loops == 0 && c.err == nil {
+		c.err = createEvalErrorAt(pos, object.KindInvalidOperation, "%s outside of a loop", keyword)
+	}
+}
+
+func (c *checker) expression(expr ast.Expression) {
+	if c.err != nil {
+		return
+	}
+	switch expr := expr.(type) {
+	case *ast.PrefixExpression:
+		c.expression(expr.Right)
+	case *ast.InfixExpression:
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+	case *ast.AssignExpression:
+		c.expression(expr.Target)
+		c.expression(expr.Value)
+	case *ast.IfExpression:
+		c.expression(expr.Condition)
+		c.block(expr.Consequence.Statements)
+		if expr.Alternative != nil {
+			c.block(expr.Alternative.Statements)
+		}
+	case *ast.WhileExpression:
+		c.expression(expr.Condition)
+		c.loops++
+		c.block(expr.Body.Statements)
+		c.loops--
+	case *ast.SwitchExpression:
+		c.expression(expr.Subject)
+		for _, arm := range expr.Cases {
+			c.expression(arm.Value)
+			c.expression(arm.Guard)
+			c.block(arm.Body.Statements)
+		}
+	case *ast.FunctionLiteral:
+		// The parameters are a block of their own around the body's.
+		params := map[string]bool{}
+		for _, param := range expr.Parameters {
+			c.define(params, param)
+		}
+		// A function's body can't break out of a loop around it.
+		loops := c.loops
+		c.loops = 0
+		c.block(expr.Body.Statements)
+		c.loops = loops
+	case *ast.CallExpression:
+		c.expression(expr.Function)
+		for _, arg := range expr.Arguments {
+			c.expression(arg)
+		}
+	case *ast.PipeExpression:
+		c.expression(expr.Left)
+		c.expression(expr.Right)
+	case *ast.ArrayLiteral:
+		for _, el := range expr.Elements {
+			c.expression(el)
+		}
+	case *ast.IndexExpression:
+		c.expression(expr.Left)
+		c.expression(expr.Index)
+	case *ast.MemberExpression:
+		c.expression(expr.Left)
+	case *ast.HashLiteral:
+		for _, key := range expr.Keys() {
+			c.expression(key)
+			c.expression(expr.Pairs[key])
+		}
+	}
+}
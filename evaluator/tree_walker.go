@@ -1,132 +1,325 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/suggest"
+	"monkey/token"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type TreeWalker struct{}
+// Options restricts what a TreeWalker created by NewTreeWalker may do. Zero
+// values mean no limit.
+type Options struct {
+	MaxSteps int       // nodes evaluated
+	MaxDepth int       // nested function calls
+	MaxBytes int       // string bytes and array elements allocated
+	Builtins []string  // builtins scripts can resolve; nil allows all
+	Out      io.Writer // where puts writes; nil means standard output
+	Hooks    *object.EvalHooks
+	Overflow object.Overflow // what integer arithmetic does on overflow
+}
+
+// TreeWalker evaluates an AST directly. The zero value has no limits and
+// sees every builtin.
+type TreeWalker struct {
+	// Debug enables warnings about misbehaving builtins, written to Log or,
+	// if that is nil, the log package's standard logger.
+	Debug bool
+	Log   *log.Logger
+
+	options  Options
+	builtins map[string]*object.Builtin
+
+	// Usage counted against options. Steps and bytes accumulate over the
+	// lifetime of the TreeWalker and are shared with the functions it
+	// spawns; depth is per goroutine.
+	usage *usage
+	depth int
+
+	// ticks counts this goroutine's steps, to look at ctx every
+	// contextCheckInterval of them.
+	ticks int
+
+	// deepest is the greatest depth reached in the program being run.
+	deepest int
+
+	// ctx belongs to the running EvalContext call and is nil outside one.
+	ctx context.Context
+
+	// tasks are the functions spawned by the running program, nil outside
+	// one.
+	tasks *tasks
+}
+
+// usage is what a TreeWalker and the functions it spawns have used.
+type usage struct {
+	steps atomic.Int64
+	bytes atomic.Int64
+}
+
+// tasks tracks the functions spawned while a program runs. Their context is
+// cancelled when the program returns, which waits for them to stop.
+type tasks struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// contextCheckInterval is how many steps EvalContext takes between looking at
+// its context.
+const contextCheckInterval = 1024
+
+func NewTreeWalker(options Options) *TreeWalker {
+	t := &TreeWalker{options: options, builtins: make(map[string]*object.Builtin)}
+
+	if options.Builtins == nil {
+		for name, builtin := range builtins {
+			t.builtins[name] = builtin
+		}
+	} else {
+		for _, name := range options.Builtins {
+			if builtin, ok := builtins[name]; ok {
+				t.builtins[name] = builtin
+			}
+		}
+	}
+
+	if _, ok := t.builtins["puts"]; ok && options.Out != nil {
+		t.builtins["puts"] = object.PutsTo(options.Out)
+	}
+
+	return t
+}
+
+// Steps is the number of nodes evaluated over the TreeWalker's lifetime.
+func (t *TreeWalker) Steps() int {
+	if t.usage == nil {
+		return 0
+	}
+	return int(t.usage.steps.Load())
+}
+
+// ResetUsage forgets the steps and bytes used so far, so MaxSteps and
+// MaxBytes apply afresh to what is evaluated next.
+func (t *TreeWalker) ResetUsage() {
+	t.usage = &usage{}
+}
 
+// EvalContext is Eval, stopping early with an error wrapping ctx.Err() once
+// ctx is done. The context is checked every contextCheckInterval steps.
+func (t *TreeWalker) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) (object.Object, error) {
+	t.ctx = ctx
+	defer func() { t.ctx = nil }()
+	return t.Eval(node, env)
+}
+
+// Eval evaluates node in env. Errors are reported only through the returned
+// error; an *object.Error value is produced solely at the program boundary so
+// callers that print results have something to show.
 func (t *TreeWalker) Eval(node ast.Node, env *object.Environment) (object.Object, error) {
+	if t.usage == nil {
+		t.usage = &usage{}
+	}
+	if steps := t.usage.steps.Add(1); t.options.MaxSteps > 0 && steps > int64(t.options.MaxSteps) {
+		return nil, &LimitError{Limit: "step", Max: t.options.MaxSteps}
+	}
+	t.ticks++
+	if t.ctx != nil && t.ticks%contextCheckInterval == 0 {
+		if err := t.ctx.Err(); err != nil {
+			return nil, fmt.Errorf("evaluation stopped: %w", err)
+		}
+	}
+
 	switch node := node.(type) {
 	// Statmements
 	case *ast.Program:
+		if t.tasks == nil {
+			t.startTasks()
+			defer t.stopTasks()
+		}
+		if t.options.Hooks != nil {
+			return t.evalProgramWithHooks(node.Statements, env)
+		}
 		return t.evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement:
 		return t.Eval(node.Expression, env)
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}, nil
+		return object.GetInteger(node.Value), nil
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}, nil
 	case *ast.Boolean:
 		return object.NativeToBooleanObject(node.Value), nil
+	case *ast.Null:
+		return object.NULL, nil
 	case *ast.PrefixExpression:
-		if right, err := t.Eval(node.Right, env); err == nil {
-			if isError(right) {
-				return right, right.(*object.Error).Message
-			}
-			return t.evalPrefix(node.Operator, right)
-		} else {
-			return &object.Error{Message: err}, err
+		right, err := t.Eval(node.Right, env)
+		if err != nil {
+			return nil, err
 		}
+		return t.evalPrefix(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return t.evalLogicalExpression(node, env)
+		}
 		left, err := t.Eval(node.Left, env)
 		if err != nil {
-			return &object.Error{Message: err}, err
-		}
-		if isError(left) {
-			return left, left.(*object.Error).Message
+			return nil, err
 		}
 		right, err := t.Eval(node.Right, env)
 		if err != nil {
-			return &object.Error{Message: err}, err
-		}
-		if isError(right) {
-			return right, right.(*object.Error).Message
+			return nil, err
 		}
 		return t.evalInfix(node.Operator, left, right)
 	case *ast.BlockStatement:
 		return t.evalBlock(node, env)
 	case *ast.IfExpression:
 		return t.evalIfExpression(node, env)
+	case *ast.SwitchExpression:
+		return t.evalSwitchExpression(node, env)
+	case *ast.WhileExpression:
+		return t.evalWhileExpression(node, env)
+	case *ast.AssignExpression:
+		return t.evalAssignExpression(node, env)
 	case *ast.ReturnStatement:
-		if val, err := t.Eval(node.ReturnValue, env); err == nil {
-			return &object.ReturnValue{Value: val}, nil
-		} else {
-			return &object.Error{Message: err}, err
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: object.NULL}, nil
+		}
+		val, err := t.Eval(node.ReturnValue, env)
+		if err != nil {
+			return nil, err
 		}
+		return &object.ReturnValue{Value: val}, nil
+	case *ast.BreakStatement:
+		return object.BREAK, nil
+	case *ast.ContinueStatement:
+		return object.CONTINUE, nil
 	case *ast.LetStatement:
-		if val, err := t.Eval(node.Value, env); err == nil {
-			env.Set(node.Name.Value, val)
-			return val, nil
-		} else {
-			return object.ErrorPair(err)
+		val, err := t.Eval(node.Value, env)
+		if err != nil {
+			return nil, err
 		}
+		env.Set(node.Name.Value, val)
+		return val, nil
 	case *ast.Identifier:
 		return t.evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}, nil
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, Name: node.Name, Doc: node.Doc}, nil
 	case *ast.CallExpression:
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			return t.evalMethodCall(member, node.Arguments, env)
+		}
 		function, err := t.Eval(node.Function, env)
 		if err != nil {
-			return function, err
+			return nil, err
 		}
 
 		args, err := t.evalExpressions(node.Arguments, env)
 		if err != nil {
-			return object.ErrorPair(err)
-		}
-		if len(args) == 1 && isError(args[0]) {
-			return args[0], nil
+			return nil, err
 		}
 
 		return t.applyFunction(function, args)
+	case *ast.PipeExpression:
+		return t.evalPipeExpression(node, env)
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}, nil
+		return t.allocate(&object.String{Value: node.Value})
 	case *ast.ArrayLiteral:
 		elements, err := t.evalExpressions(node.Elements, env)
-		if len(elements) == 1 && err != nil {
-			return elements[0], err
+		if err != nil {
+			return nil, err
 		}
-		return &object.Array{Elements: elements}, nil
+		return t.allocate(&object.Array{Elements: elements})
 	case *ast.IndexExpression:
 		left, err := t.Eval(node.Left, env)
 		if err != nil {
-			return left, err
+			return nil, err
 		}
 		index, err := t.Eval(node.Index, env)
 		if err != nil {
-			return index, err
+			return nil, err
 		}
-		return t.evalIndexExpression(left, index)
+		return object.Index(left, index)
+	case *ast.MemberExpression:
+		left, err := t.Eval(node.Left, env)
+		if err != nil {
+			return nil, err
+		}
+		return t.member(left, node.Member)
 	case *ast.HashLiteral:
 		return t.evalHashLiteral(node, env)
 	// Else
 	default:
-		return object.NULL, createEvalError("Unimplemented.")
+		return nil, createEvalError(object.KindInternal, "Unimplemented.")
 	}
 }
 
 func (t *TreeWalker) evalProgram(stmts []ast.Statement, env *object.Environment) (object.Object, error) {
+	if err := checkProgram(stmts); err != nil {
+		return &object.Error{Message: err}, err
+	}
+
 	var result object.Object
 
 	for _, statement := range stmts {
-		if res, err := t.Eval(statement, env); err == nil {
-			result = res
-		} else {
+		res, err := t.Eval(statement, env)
+		if err != nil {
 			return &object.Error{Message: err}, err
 		}
+		result = res
 
-		switch result := result.(type) {
-		case *object.ReturnValue:
-			return result.Value, nil
-		case *object.Error:
-			return result, result.Message
+		if ret, ok := result.(*object.ReturnValue); ok {
+			return ret.Value, nil
+		}
+		if signal, ok := result.(*object.LoopSignal); ok {
+			err := createEvalError(object.KindInvalidOperation, "%s outside of a loop", signal.Inspect())
+			return &object.Error{Message: err}, err
 		}
 	}
 
 	return result, nil
 }
 
+// evalProgramWithHooks is evalProgram, reporting to the hooks in the options
+// as the program fails and completes.
+func (t *TreeWalker) evalProgramWithHooks(stmts []ast.Statement, env *object.Environment) (object.Object, error) {
+	hooks := t.options.Hooks
+	start, steps, bytes := time.Now(), t.usage.steps.Load(), t.usage.bytes.Load()
+	t.deepest = t.depth
+
+	result, err := t.evalProgram(stmts, env)
+
+	if err != nil && hooks.OnError != nil {
+		var pos token.Position
+		var evalErr *EvalError
+		if errors.As(err, &evalErr) {
+			pos = evalErr.Pos
+		}
+		hooks.OnError(err, pos)
+	}
+	if hooks.OnComplete != nil {
+		hooks.OnComplete(object.Stats{
+			Steps:    int(t.usage.steps.Load() - steps),
+			MaxDepth: t.deepest,
+			Bytes:    int(t.usage.bytes.Load() - bytes),
+			Duration: time.Since(start),
+		})
+	}
+	return result, err
+}
+
 func (t *TreeWalker) evalPrefix(op string, right object.Object) (object.Object, error) {
 	switch op {
 	case "!":
@@ -134,90 +327,199 @@ func (t *TreeWalker) evalPrefix(op string, right object.Object) (object.Object,
 	case "-":
 		return t.evalNegOperator(right)
 	default:
-		err := createEvalError("unknown operator: %s%s", op, right.Type())
-		return &object.Error{Message: err}, err
+		return nil, createEvalError(object.KindTypeMismatch, "unknown operator: %s%s", op, right.Type())
 	}
 }
 
 func (t *TreeWalker) evalBangOperator(right object.Object) (object.Object, error) {
-	switch right {
-	case object.TRUE:
-		return object.FALSE, nil
-	case object.FALSE:
-		return object.TRUE, nil
-	case object.NULL:
-		return object.TRUE, nil
-	default:
-		err := createEvalError("cannot apply ! operator to %s", right.Type())
-		return &object.Error{Message: err}, err
-	}
+	return object.NativeToBooleanObject(!object.IsTruthy(right)), nil
 }
 
 func (t *TreeWalker) evalNegOperator(right object.Object) (object.Object, error) {
-	if right.Type() != object.INTEGER_OBJ {
-		err := createEvalError("cannot apply - operator to %s", right.Type())
-		return &object.Error{Message: err}, err
+	switch right := right.(type) {
+	case *object.Integer:
+		negated, ok := object.NegInt(right.Value)
+		if ok || t.options.Overflow == object.OverflowWrap {
+			return object.GetInteger(negated), nil
+		}
+		result, err := object.OverflowedNeg(t.options.Overflow, right.Value)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case *object.BigInteger:
+		return object.NewBigInteger(new(big.Int).Neg(right.Value)), nil
+	case *object.Float:
+		return &object.Float{Value: -right.Value}, nil
+	default:
+		return nil, createEvalError(object.KindTypeMismatch, "unsupported type for negation: %s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}, nil
 }
 
 func (t *TreeWalker) evalInfix(op string, left, right object.Object) (object.Object, error) {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return t.evalIntegerInfix(op, left, right)
+	case object.IsBigOperation(left, right):
+		result, err := object.BigInfix(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	case op == "<<" || op == ">>":
+		shifted, err := object.Shift(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+		return t.allocate(shifted)
+	case isNumber(left) && isNumber(right):
+		return t.evalFloatInfix(op, left, right)
+	case left.Type() == object.NULL_OBJ || right.Type() == object.NULL_OBJ:
+		return t.evalNullInfix(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return t.evalStringInfix(op, left, right)
+	case left.Type() == object.BYTES_OBJ && right.Type() == object.BYTES_OBJ:
+		return t.evalBytesInfix(op, left, right)
 	case op == "==":
 		return object.NativeToBooleanObject(left == right), nil
 	case op == "!=":
 		return object.NativeToBooleanObject(left != right), nil
-	case left.Type() != right.Type():
-		err := createEvalError("type mismatch: %s %s %s", left.Type(), op, right.Type())
-		return &object.Error{Message: err}, err
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return t.evalStringInfix(op, left, right)
-	case left.Type() == object.ARRAY_OBJ:
-		return t.evalArrayInfix(op, left, right)
 	default:
-		return object.ErrorPair(createEvalError("operator %s cannot operate with a %s and %s", op, left.Type(), right.Type()))
+		return nil, object.OperatorError(op, left, right)
 	}
 }
 
+// evalLogicalExpression short-circuits && and ||. The result is the operand
+// that decided the outcome, not a coerced boolean: `0 || "a"` is "a".
+func (t *TreeWalker) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) (object.Object, error) {
+	left, err := t.Eval(node.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	if object.IsTruthy(left) == (node.Operator == "||") {
+		return left, nil
+	}
+	return t.Eval(node.Right, env)
+}
+
 func (t *TreeWalker) evalIntegerInfix(op string, left, right object.Object) (object.Object, error) {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	var result int64
+	ok := true
 	switch op {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}, nil
+		result, ok = object.AddInt(leftVal, rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}, nil
+		result, ok = object.SubInt(leftVal, rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}, nil
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}, nil
-	case "%":
-		return &object.Integer{Value: leftVal % rightVal}, nil
+		result, ok = object.MulInt(leftVal, rightVal)
+	case "/", "%":
+		if rightVal == 0 {
+			return nil, createEvalError(object.KindDivisionByZero, "division by zero: %d %s 0", leftVal, op)
+		}
+		if op == "/" {
+			result, ok = object.DivInt(leftVal, rightVal)
+		} else {
+			result = leftVal % rightVal
+		}
 	case "|":
-		return &object.Integer{Value: leftVal | rightVal}, nil
+		return object.GetInteger(leftVal | rightVal), nil
 	case "&":
-		return &object.Integer{Value: leftVal & rightVal}, nil
+		return object.GetInteger(leftVal & rightVal), nil
 	case "^":
-		return &object.Integer{Value: leftVal ^ rightVal}, nil
-	case "<<":
-		return &object.Integer{Value: leftVal << rightVal}, nil
-	case ">>":
-		return &object.Integer{Value: leftVal >> rightVal}, nil
+		return object.GetInteger(leftVal ^ rightVal), nil
+	case "<<", ">>":
+		if rightVal < 0 {
+			return nil, createEvalError(object.KindInvalidOperation, "negative shift count: %d", rightVal)
+		}
+		if op == "<<" {
+			result, ok = object.ShlInt(leftVal, rightVal)
+		} else {
+			result = leftVal >> rightVal
+		}
+	case "<":
+		return object.NativeToBooleanObject(leftVal < rightVal), nil
+	case ">":
+		return object.NativeToBooleanObject(leftVal > rightVal), nil
+	case "<=":
+		return object.NativeToBooleanObject(leftVal <= rightVal), nil
+	case ">=":
+		return object.NativeToBooleanObject(leftVal >= rightVal), nil
+	case "==":
+		return object.NativeToBooleanObject(leftVal == rightVal), nil
+	case "!=":
+		return object.NativeToBooleanObject(leftVal != rightVal), nil
+	default:
+		return nil, createEvalError(object.KindTypeMismatch, "operator %s cannot operate with a %s and %s", op, left.Type(), right.Type())
+	}
+
+	if !ok && t.options.Overflow != object.OverflowWrap {
+		overflowed, err := object.Overflowed(t.options.Overflow, op, leftVal, rightVal)
+		if err != nil {
+			return nil, err
+		}
+		return overflowed, nil
+	}
+	return object.GetInteger(result), nil
+}
+
+// evalFloatInfix handles arithmetic where at least one operand is a Float;
+// an Integer operand is promoted.
+func (t *TreeWalker) evalFloatInfix(op string, left, right object.Object) (object.Object, error) {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}, nil
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}, nil
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}, nil
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}, nil
 	case "<":
 		return object.NativeToBooleanObject(leftVal < rightVal), nil
 	case ">":
 		return object.NativeToBooleanObject(leftVal > rightVal), nil
+	case "<=":
+		return object.NativeToBooleanObject(leftVal <= rightVal), nil
+	case ">=":
+		return object.NativeToBooleanObject(leftVal >= rightVal), nil
 	case "==":
 		return object.NativeToBooleanObject(leftVal == rightVal), nil
 	case "!=":
 		return object.NativeToBooleanObject(leftVal != rightVal), nil
 	default:
-		return object.ErrorPair(createEvalError("operator %s cannot operate with a %s and %s", op, left.Type(), right.Type()))
+		return nil, createEvalError(object.KindTypeMismatch, "operator %s cannot operate with a %s and %s", op, left.Type(), right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// evalNullInfix defines comparisons against null for every type: null is equal
+// only to null, and no other operator accepts it.
+func (t *TreeWalker) evalNullInfix(op string, left, right object.Object) (object.Object, error) {
+	bothNull := left.Type() == object.NULL_OBJ && right.Type() == object.NULL_OBJ
+
+	switch op {
+	case "==":
+		return object.NativeToBooleanObject(bothNull), nil
+	case "!=":
+		return object.NativeToBooleanObject(!bothNull), nil
+	default:
+		return nil, object.OperatorError(op, left, right)
 	}
 }
 
@@ -226,70 +528,320 @@ func (t *TreeWalker) evalStringInfix(op string, left, right object.Object) (obje
 	rightVal := right.(*object.String).Value
 
 	switch op {
-	case "+", "<<":
-		return &object.String{Value: leftVal + rightVal}, nil
+	case "+":
+		return t.allocate(&object.String{Value: leftVal + rightVal})
+	case "==":
+		return object.NativeToBooleanObject(leftVal == rightVal), nil
+	case "!=":
+		return object.NativeToBooleanObject(leftVal != rightVal), nil
 	default:
-		return object.ErrorPair(createEvalError("operator %s cannot operate with a %s and %s", op, left.Type(), right.Type()))
+		return nil, object.OperatorError(op, left, right)
 	}
 }
 
-func (t *TreeWalker) evalArrayInfix(op string, left, right object.Object) (object.Object, error) {
+func (t *TreeWalker) evalBytesInfix(op string, left, right object.Object) (object.Object, error) {
+	leftVal := left.(*object.Bytes).Value
+	rightVal := right.(*object.Bytes).Value
+
 	switch op {
-	case "<<":
-		val := builtins["push"].Fn(left, right)
-		if isError(val) {
-			return val, val.(*object.Error).Message
-		} else {
-			return val, nil
-		}
+	case "+":
+		return t.allocate(&object.Bytes{Value: append(bytes.Clone(leftVal), rightVal...)})
+	case "==":
+		return object.NativeToBooleanObject(bytes.Equal(leftVal, rightVal)), nil
+	case "!=":
+		return object.NativeToBooleanObject(!bytes.Equal(leftVal, rightVal)), nil
 	default:
-		return object.ErrorPair(createEvalError("operator %s cannot operate with a %s and %s", op, left.Type(), right.Type()))
+		return nil, object.OperatorError(op, left, right)
 	}
 }
 
+// evalSwitchExpression runs the body of the first arm whose value equals, or
+// whose pattern matches, the subject and whose guard is truthy. There is no
+// fallthrough; if no arm matches the result is null.
+func (t *TreeWalker) evalSwitchExpression(se *ast.SwitchExpression, env *object.Environment) (object.Object, error) {
+	subject, err := t.Eval(se.Subject, env)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arm := range se.Cases {
+		// The pattern's bindings, and so the guard and body, get a fresh
+		// scope of their own.
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		if arm.Value != nil {
+			value, err := t.Eval(arm.Value, env)
+			if err != nil {
+				return nil, err
+			}
+			if !object.Equals(subject, value) {
+				continue
+			}
+		}
+		if arm.Pattern != nil {
+			matched, err := t.matchPattern(arm.Pattern, subject, armEnv)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if arm.Guard != nil {
+			guard, err := t.Eval(arm.Guard, armEnv)
+			if err != nil {
+				return nil, err
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+
+		return t.evalBranch(arm.Body, armEnv)
+	}
+
+	return object.NULL, nil
+}
+
+// matchPattern reports whether value matches pattern, setting the names the
+// pattern binds in env as it goes. A value of the wrong type doesn't match.
+func (t *TreeWalker) matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+		return true, nil
+	case *ast.LiteralPattern:
+		literal, err := t.Eval(pattern.Value, env)
+		if err != nil {
+			return false, err
+		}
+		return object.Equals(value, literal), nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok || len(array.Elements) != len(pattern.Elements) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			if matched, err := t.matchPattern(element, array.Elements[i], env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key, err := t.Eval(keyNode, env)
+			if err != nil {
+				return false, err
+			}
+			v, ok := hash.Get(key.(object.Hashable))
+			if !ok {
+				return false, nil
+			}
+			if matched, err := t.matchPattern(pattern.Values[i], v, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, createEvalError(object.KindInternal, "unknown pattern %T", pattern)
+}
+
+// evalPipeExpression calls the right-hand stage with the left value as its
+// first argument. Errors raised by the stage are annotated with its position.
+func (t *TreeWalker) evalPipeExpression(pe *ast.PipeExpression, env *object.Environment) (object.Object, error) {
+	left, err := t.Eval(pe.Left, env)
+	if err != nil {
+		return nil, err
+	}
+
+	stage := pe.Right
+	args := []object.Object{left}
+	if call, ok := pe.Right.(*ast.CallExpression); ok {
+		stage = call.Function
+		rest, err := t.evalExpressions(call.Arguments, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, rest...)
+	}
+
+	function, err := t.Eval(stage, env)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := t.applyFunction(function, args)
+	var limit *LimitError
+	if errors.As(err, &limit) || (t.ctx != nil && t.ctx.Err() != nil) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, createEvalErrorAt(ast.Pos(pe.Right), object.ErrorKind(err), "%s (pipeline stage `%s` at %s)", err, pe.Right, ast.Pos(pe.Right))
+	}
+	return result, nil
+}
+
+// member reads name from a module, or from a hash holding it as a string
+// key. Other values have no members.
+func (t *TreeWalker) member(left object.Object, name *ast.Identifier) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Module:
+		return left.Member(name.Value)
+	case *object.Hash:
+		if value, ok := left.Get(&object.String{Value: name.Value}); ok {
+			return value, nil
+		}
+		return nil, createEvalErrorAt(name.Token.Pos, object.KindTypeMismatch, "hash has no member %q", name.Value)
+	}
+	return nil, createEvalError(object.KindTypeMismatch, "%s has no members", left.Type())
+}
+
+// evalMethodCall calls value.name(args). A module's member, or a hash's
+// member if it has one, is called with args as they are. Otherwise name is
+// looked up as a function in scope or a builtin and called with value
+// first, so `xs.push(3)` is `push(xs, 3)` and calls chain left to right.
+func (t *TreeWalker) evalMethodCall(node *ast.MemberExpression, arguments []ast.Expression, env *object.Environment) (object.Object, error) {
+	receiver, err := t.Eval(node.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	name := node.Member.Value
+
+	var function object.Object
+	switch receiver := receiver.(type) {
+	case *object.Module:
+		if function, err = receiver.Member(name); err != nil {
+			return nil, err
+		}
+	case *object.Hash:
+		function, _ = receiver.Get(&object.String{Value: name})
+	}
+
+	args, err := t.evalExpressions(arguments, env)
+	if err != nil {
+		return nil, err
+	}
+	if function != nil {
+		return t.applyFunction(function, args)
+	}
+
+	if function, ok := env.Get(name); ok && isCallable(function) {
+		return t.applyFunction(function, append([]object.Object{receiver}, args...))
+	}
+	if builtin, ok := t.lookupBuiltin(name); ok {
+		return t.applyFunction(builtin, append([]object.Object{receiver}, args...))
+	}
+
+	pos := node.Member.Token.Pos
+	if closest, ok := suggest.Closest(name, t.functionNames(env), 2); ok {
+		return nil, createEvalErrorAt(pos, object.KindUndefinedIdentifier, "no function %q applicable to %s, did you mean %q?", name, receiver.Type(), closest)
+	}
+	return nil, createEvalErrorAt(pos, object.KindUndefinedIdentifier, "no function %q applicable to %s", name, receiver.Type())
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	}
+	return false
+}
+
+// functionNames lists the functions a method call in env could reach.
+func (t *TreeWalker) functionNames(env *object.Environment) []string {
+	var names []string
+	for scope := env; scope != nil; scope = scope.Outer() {
+		for name, value := range scope.All() {
+			if isCallable(value) {
+				names = append(names, name)
+			}
+		}
+	}
+	table := t.builtins
+	if table == nil {
+		table = builtins
+	}
+	for name := range table {
+		names = append(names, name)
+	}
+	// Closest breaks ties by order, so keep it stable.
+	sort.Strings(names)
+	return names
+}
+
 func (t *TreeWalker) evalIfExpression(ie *ast.IfExpression, env *object.Environment) (object.Object, error) {
 	condition, err := t.Eval(ie.Condition, env)
 	if err != nil {
-		return &object.Error{Message: err}, err
-	}
-	if isError(condition) {
-		return condition, condition.(*object.Error).Message
+		return nil, err
 	}
 
-	if t.isTruthy(condition) {
-		return t.Eval(ie.Consequence, env)
+	if object.IsTruthy(condition) {
+		return t.evalBranch(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return t.Eval(ie.Alternative, env)
+		return t.evalBranch(ie.Alternative, env)
 	} else {
 		return object.NULL, nil
 	}
 }
 
-func (t *TreeWalker) isTruthy(obj object.Object) bool {
-	switch obj {
-	case object.NULL:
-		return false
-	case object.TRUE:
-		return true
-	case object.FALSE:
-		return false
-	default:
-		return true
+// evalBranch evaluates the block of an if or switch, turning a break or
+// continue in it into a loopJump.
+func (t *TreeWalker) evalBranch(block *ast.BlockStatement, env *object.Environment) (object.Object, error) {
+	result, err := t.Eval(block, env)
+	if signal, ok := result.(*object.LoopSignal); ok && err == nil {
+		return nil, &loopJump{signal: signal}
+	}
+	return result, err
+}
+
+// evalWhileExpression runs the body until the condition is falsy or it breaks.
+// The body shares the enclosing scope, and the loop itself evaluates to null.
+func (t *TreeWalker) evalWhileExpression(we *ast.WhileExpression, env *object.Environment) (object.Object, error) {
+	for {
+		condition, err := t.Eval(we.Condition, env)
+		if err != nil {
+			return nil, err
+		}
+		if !object.IsTruthy(condition) {
+			return object.NULL, nil
+		}
+
+		result, err := t.Eval(we.Body, env)
+		var jump *loopJump
+		if errors.As(err, &jump) {
+			result, err = jump.signal, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result.Type() == object.RETURN_VALUE_OBJ {
+			return result, nil
+		}
+		if result == object.BREAK {
+			return object.NULL, nil
+		}
 	}
 }
 
 func (t *TreeWalker) evalBlock(block *ast.BlockStatement, env *object.Environment) (object.Object, error) {
-	var res object.Object
+	var res object.Object = object.NULL
 
 	for _, statement := range block.Statements {
-		if result, err := t.Eval(statement, env); err == nil {
-			res = result
+		result, err := t.Eval(statement, env)
+		if err != nil {
+			return nil, err
+		}
+		res = result
 
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result, nil
-			}
-		} else {
-			return &object.Error{Message: err}, err
+		if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.LOOP_SIGNAL_OBJ {
+			return result, nil
 		}
 	}
 
@@ -300,11 +852,11 @@ func (t *TreeWalker) evalExpressions(exps []ast.Expression, env *object.Environm
 	var result []object.Object
 
 	for _, exp := range exps {
-		if evaluated, err := t.Eval(exp, env); err == nil {
-			result = append(result, evaluated)
-		} else {
-			return []object.Object{evaluated}, err
+		evaluated, err := t.Eval(exp, env)
+		if err != nil {
+			return nil, err
 		}
+		result = append(result, evaluated)
 	}
 
 	return result, nil
@@ -313,21 +865,193 @@ func (t *TreeWalker) evalExpressions(exps []ast.Expression, env *object.Environm
 func (t *TreeWalker) applyFunction(fn object.Object, args []object.Object) (object.Object, error) {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return nil, createEvalError(object.KindArgument, "wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+
+		t.depth++
+		defer func() { t.depth-- }()
+		if t.options.MaxDepth > 0 && t.depth > t.options.MaxDepth {
+			return nil, &LimitError{Limit: "call depth", Max: t.options.MaxDepth}
+		}
+		if t.depth > t.deepest {
+			t.deepest = t.depth
+		}
+		if hooks := t.options.Hooks; hooks != nil && hooks.OnCall != nil {
+			hooks.OnCall(fn.Name, len(args))
+		}
+
 		extendedEnv := t.extendFunctionEnv(fn, args)
 		evaluated, err := t.Eval(fn.Body, extendedEnv)
+		var jump *loopJump
+		if errors.As(err, &jump) {
+			return nil, createEvalError(object.KindInvalidOperation, "%s", jump)
+		}
 		if err != nil {
-			return object.ErrorPair(err)
+			return nil, err
+		}
+		if signal, ok := evaluated.(*object.LoopSignal); ok {
+			return nil, createEvalError(object.KindInvalidOperation, "%s outside of a loop", signal.Inspect())
 		}
 
 		return t.unwrapReturnValue(evaluated), nil
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
-			return result, nil
+		if fn == spawnBuiltin {
+			return t.spawn(args)
 		}
-		return object.NULL, nil
+		if hooks := t.options.Hooks; hooks != nil && hooks.OnCall != nil {
+			name := fn.Name
+			if name == "" {
+				name = t.builtinName(fn)
+			}
+			hooks.OnCall(name, len(args))
+		}
+		if fn == sendBuiltin || fn == recvBuiltin {
+			return t.channelOp(fn, args)
+		}
+		result := fn.Fn(args...)
+		if errObj, ok := result.(*object.Error); ok && !errObj.Value {
+			return nil, errObj
+		}
+		if result == nil {
+			t.warnf("warning: builtin %q returned nil, using null", t.builtinName(fn))
+			return object.NULL, nil
+		}
+		if fn.Allocates {
+			return t.allocate(result)
+		}
+		return result, nil
+	case *object.Memoized:
+		key, cacheable := fn.CacheKey(args)
+		if cacheable {
+			if result, ok := fn.Lookup(key); ok {
+				return result, nil
+			}
+		}
+
+		result, err := t.applyFunction(fn.Fn, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if cacheable {
+			fn.Store(key, result)
+		}
+		return result, nil
 	default:
-		return object.ErrorPair(createEvalError("not a function: %s", fn.Type()))
+		return nil, createEvalError(object.KindNotCallable, "not a function: %s", fn.Type())
+	}
+}
+
+var (
+	spawnBuiltin = builtins["spawn"]
+	sendBuiltin  = builtins["send"]
+	recvBuiltin  = builtins["recv"]
+)
+
+// startTasks begins tracking what the program about to run spawns.
+func (t *TreeWalker) startTasks() {
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t.tasks = &tasks{}
+	t.tasks.ctx, t.tasks.cancel = context.WithCancel(ctx)
+}
+
+// stopTasks cancels the functions the program spawned and waits for them.
+func (t *TreeWalker) stopTasks() {
+	t.tasks.cancel()
+	t.tasks.wg.Wait()
+	t.tasks = nil
+}
+
+// spawn runs a function taking no arguments on a new goroutine, returning a
+// channel that receives its result, or the error it failed with as an error
+// value, and is then closed. The goroutine has a TreeWalker of its own, with
+// the same options but no hooks, and its steps and bytes count against the
+// same limits. It shares only the environment the function closes over,
+// which is made safe for concurrent use. Arrays and hashes reachable from
+// both goroutines aren't; freeze them or send them over a channel instead.
+// The function is stopped when the program that spawned it returns, or its
+// evaluation is cancelled.
+func (t *TreeWalker) spawn(args []object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, createEvalError(object.KindArgument, "spawn: expected 1 argument, got %d", len(args))
+	}
+	fn, ok := args[0].(*object.Function)
+	if !ok {
+		return nil, createEvalError(object.KindArgument, "spawn: argument 1 must be FUNCTION, got %s", args[0].Type())
+	}
+	if len(fn.Parameters) != 0 {
+		return nil, createEvalError(object.KindArgument, "spawn: the function must take no arguments, got %d", len(fn.Parameters))
+	}
+
+	tasks := t.tasks
+	if tasks == nil {
+		return nil, createEvalError(object.KindInvalidOperation, "spawn: no program is running")
+	}
+
+	fn.Env.Share()
+	child := &TreeWalker{
+		options:  t.options,
+		builtins: t.builtins,
+		Debug:    t.Debug,
+		Log:      t.Log,
+		usage:    t.usage,
+		ctx:      tasks.ctx,
+		tasks:    tasks,
+	}
+	child.options.Hooks = nil
+	result := object.NewChannel(1)
+	tasks.wg.Add(1)
+	go func() {
+		defer tasks.wg.Done()
+		value, err := child.applyFunction(fn, nil)
+		if err != nil {
+			value = &object.Error{Message: err, Kind: object.ErrorKind(err), Value: true}
+		}
+		// The buffered result never waits for a receiver.
+		result.Send(context.Background(), value)
+		result.Close()
+	}()
+	return result, nil
+}
+
+// channelOp carries out send or recv, giving up once the running program's
+// spawned functions are stopped.
+func (t *TreeWalker) channelOp(fn *object.Builtin, args []object.Object) (object.Object, error) {
+	if err := fn.CheckArgs(args); err != nil {
+		return nil, err
 	}
+	ctx := context.Background()
+	if t.tasks != nil {
+		ctx = t.tasks.ctx
+	}
+	ch := args[0].(*object.Channel)
+
+	if fn == sendBuiltin {
+		if err := ch.Send(ctx, args[1]); err != nil {
+			return nil, t.channelError(ctx, err)
+		}
+		return object.NULL, nil
+	}
+	obj, ok, err := ch.Recv(ctx)
+	if err != nil {
+		return nil, t.channelError(ctx, err)
+	}
+	if !ok {
+		return object.NULL, nil
+	}
+	return obj, nil
+}
+
+// channelError reports a failed send or recv, as Eval does if ctx ended it.
+func (t *TreeWalker) channelError(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("evaluation stopped: %w", err)
+	}
+	return err
 }
 
 func (t *TreeWalker) extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
@@ -347,85 +1071,178 @@ func (t *TreeWalker) unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
-	}
-	return false
-}
-
 func (t *TreeWalker) evalIdentifier(node *ast.Identifier, env *object.Environment) (object.Object, error) {
 	if val, ok := env.Get(node.Value); ok {
 		return val, nil
-	} else {
-		if builtin, ok := builtins[node.Value]; ok {
-			return builtin, nil
-		}
-		err := createEvalError("identifier not found: %s", node.Value)
-		return &object.Error{Message: err}, err
 	}
+	if builtin, ok := t.lookupBuiltin(node.Value); ok {
+		return builtin, nil
+	}
+	return nil, createEvalErrorAt(node.Token.Pos, object.KindUndefinedIdentifier, "identifier not found: %s", node.Value)
 }
 
-func (t *TreeWalker) evalIndexExpression(left, index object.Object) (object.Object, error) {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return t.evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return t.evalHashIndex(left, index)
-	default:
-		return object.ErrorPair(createEvalError("Cannot index array with type %s", left.Type()))
+// evalAssignExpression rebinds an existing variable where it was defined and
+// evaluates to the assigned value. Compound forms read the current value
+// before evaluating the right-hand side, the same order the compiled code uses.
+func (t *TreeWalker) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) (object.Object, error) {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return t.evalIndexAssignment(node, target, env)
 	}
+	target := node.Target.(*ast.Identifier)
+
+	var current object.Object
+	if node.Operator != "=" {
+		var ok bool
+		current, ok = env.Get(target.Value)
+		if !ok {
+			return nil, t.assignmentError(target.Value)
+		}
+	}
+
+	value, err := t.Eval(node.Value, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil {
+		value, err = t.evalInfix(strings.TrimSuffix(node.Operator, "="), current, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !env.Assign(target.Value, value) {
+		return nil, t.assignmentError(target.Value)
+	}
+	return value, nil
 }
 
-func (t *TreeWalker) evalArrayIndexExpression(array, index object.Object) (object.Object, error) {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+// evalIndexAssignment evaluates the container, then the index, then reads a
+// compound target's current value before evaluating the right-hand side, the
+// same order the compiled code uses.
+func (t *TreeWalker) evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) (object.Object, error) {
+	left, err := t.Eval(target.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := t.Eval(target.Index, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		current, err = object.Index(left, index)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if idx < 0 || idx > max {
-		return object.ErrorPair(createEvalError("index out of bounds"))
+	value, err := t.Eval(node.Value, env)
+	if err != nil {
+		return nil, err
 	}
-	return arrayObject.Elements[idx], nil
+
+	if current != nil {
+		value, err = t.evalInfix(strings.TrimSuffix(node.Operator, "="), current, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A new hash key grows the hash in place.
+	size := object.SizeOf(left)
+	if err := object.SetIndex(left, index, value); err != nil {
+		return nil, err
+	}
+	if err := t.charge(object.SizeOf(left) - size); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (t *TreeWalker) assignmentError(name string) error {
+	if _, ok := t.lookupBuiltin(name); ok {
+		return createEvalError(object.KindInvalidOperation, "cannot assign to builtin %q", name)
+	}
+	return createEvalError(object.KindUndefinedIdentifier, "cannot assign to undefined variable %q", name)
 }
 
 func (t *TreeWalker) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) (object.Object, error) {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash(len(node.Pairs))
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys() {
+		valueNode := node.Pairs[keyNode]
 		key, err := t.Eval(keyNode, env)
 		if err != nil {
-			return key, err
+			return nil, err
 		}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return object.ErrorPair(createEvalError("unusable as hash key: %s", key.Type()))
+			return nil, createEvalErrorAt(ast.Pos(keyNode), object.KindUnhashable, "unusable as hash key: %s (%s) at %s", key.Inspect(), key.Type(), ast.Pos(keyNode))
 		}
 
 		value, err := t.Eval(valueNode, env)
 		if err != nil {
-			return value, err
+			return nil, err
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}, nil
+	return t.allocate(hash)
 }
 
-func (t *TreeWalker) evalHashIndex(hash, index object.Object) (object.Object, error) {
-	hashObject := hash.(*object.Hash)
+func (t *TreeWalker) lookupBuiltin(name string) (*object.Builtin, bool) {
+	if t.builtins == nil {
+		builtin, ok := builtins[name]
+		return builtin, ok
+	}
+	builtin, ok := t.builtins[name]
+	return builtin, ok
+}
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return object.ErrorPair(createEvalError("unusable as hash key: %s", key))
+// builtinName is the name fn is visible to scripts under, if any.
+func (t *TreeWalker) builtinName(fn *object.Builtin) string {
+	table := t.builtins
+	if table == nil {
+		table = builtins
+	}
+	for name, builtin := range table {
+		if builtin == fn {
+			return name
+		}
 	}
+	return ""
+}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
-		return object.NULL, nil
+func (t *TreeWalker) warnf(format string, a ...interface{}) {
+	if !t.Debug {
+		return
 	}
+	if t.Log != nil {
+		t.Log.Printf(format, a...)
+	} else {
+		log.Printf(format, a...)
+	}
+}
 
-	return pair.Value, nil
+// allocate charges obj against MaxBytes by object.SizeOf.
+func (t *TreeWalker) allocate(obj object.Object) (object.Object, error) {
+	if err := t.charge(object.SizeOf(obj)); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// charge counts n more bytes against MaxBytes.
+func (t *TreeWalker) charge(n int) error {
+	if t.usage == nil {
+		t.usage = &usage{}
+	}
+	if bytes := t.usage.bytes.Add(int64(n)); t.options.MaxBytes > 0 && bytes > int64(t.options.MaxBytes) {
+		return &LimitError{Limit: "memory", Max: t.options.MaxBytes}
+	}
+	return nil
 }
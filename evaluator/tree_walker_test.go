@@ -1,10 +1,18 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -28,6 +36,10 @@ func TestEvalIntegerExpression(t *testing.T) {
 }
 
 func testEval(input string) (object.Object, error) {
+	return testEvalWith(&TreeWalker{}, input)
+}
+
+func testEvalWith(t *TreeWalker, input string) (object.Object, error) {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program, err := p.ParseProgram()
@@ -35,7 +47,6 @@ func testEval(input string) (object.Object, error) {
 		return nil, err
 	}
 
-	t := &TreeWalker{}
 	env := object.NewEnvironment()
 
 	return t.Eval(program, env)
@@ -67,6 +78,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 >= 1", true},
+		{"1 <= 0", false},
+		{"1.5 >= 1", true},
+		{"1.5 <= 1", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -117,6 +132,14 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!0", true},
+		{`!""`, true},
+		{`!"a"`, false},
+		{"![]", true},
+		{"![0]", false},
+		{"!{}", true},
+		{"!null", true},
+		{"!-5", false},
 	}
 
 	for _, tt := range tests {
@@ -128,6 +151,226 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && false", false},
+		{"false || true", true},
+		{"1 && 2", 2},
+		{"0 && 2", 0},
+		{"0 || 2", 2},
+		{"null || 3", 3},
+		{"1 < 2 && 2 < 3", true},
+		{"false && first(1)", false},
+		{"true || first(1)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 0; y = x = 3; x + y", 6},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let x = 7; x %= 4", 3},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i; }; sum", 15},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c()", 2},
+		{"let x = 1; let f = fn(x) { x = 5; x }; f(0) + x", 6},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", `cannot assign to undefined variable "x"`},
+		{"x += 1", `cannot assign to undefined variable "x"`},
+		{"len = 1", `cannot assign to builtin "len"`},
+		{`let x = 1; x += "a"`, "type mismatch: INTEGER + STRING"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a", []int{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[2] = a[0] + a[1]; a", []int{1, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] = 5", 5},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1]", 7},
+		{"let a = [[1], [2]]; a[1][0] = 9; a[1][0]", 9},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] *= 10; h["a"]`, 10},
+		{"let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]", 3},
+		{"let a = [0, 0]; let f = fn(arr) { arr[0] = 1 }; f(a); a[0]", 1},
+		{"let a = [0, 0, 0]; let i = 0; while (i < 3) { a[i] = i * i; i += 1; }; a[2]", 4},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok || len(array.Elements) != len(expected) {
+				t.Errorf("%q: wrong array. got=%s", tt.input, evaluated.Inspect())
+				continue
+			}
+			for i, want := range expected {
+				testIntegerObject(t, array.Elements[i], int64(want))
+			}
+		}
+	}
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[1] = 2", "ARRAY index 1 out of range for length 1"},
+		{"let a = [1]; a[-1] = 2", "ARRAY index -1 out of range for length 1"},
+		{`let a = [1]; a["x"] = 2`, "index assignment not supported: ARRAY[STRING]"},
+		{"let h = {}; h[[1]] = 2", "unusable as HASH key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING[INTEGER]"},
+		{"let a = [1]; a[3] += 1", "index 3 out of range for length 1"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { let i = i + 1; }; i", 10},
+		{"let i = 0; while (false) { let i = i + 1; }; i", 0},
+		{"while (false) { 1 }", nil},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i; }; let i = i + 1; } }; f()", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (true) { if (i == 5) { break }; i += 1 }; i", 5},
+		{"let i = 0; let sum = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue }; sum += i }; sum", 25},
+		{"let i = 0; while (i < 3) { i += 1; break; i = 100 }; i", 1},
+		{"while (true) { break }", nil},
+		{`let i = 0; let pairs = 0;
+		  while (i < 4) {
+		    let j = 0;
+		    while (true) {
+		      if (j >= i) { break }
+		      j += 1;
+		      if (j == 2) { continue }
+		      pairs += 1;
+		    }
+		    i += 1;
+		  };
+		  pairs`, 4},
+		{"let f = fn(n) { let i = 0; while (true) { if (i == n) { break }; i += 1 }; i * 10 }; f(3) + f(4)", 70},
+		{"let i = 0; while (i < 5) { i += 1; let f = fn() { i }; if (f() == 2) { break } }; i", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBreakAndContinueOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break", "break outside of a loop"},
+		{"if (true) { continue }", "continue outside of a loop"},
+		{"while (true) { fn() { break }() }", "break outside of a loop"},
+		{"let f = fn() { break }; 1", "break outside of a loop"},
+		{"if (false) { continue }; 1", "continue outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -140,130 +383,972 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (0) { 10 }", nil},
+		{`if ("") { 10 }`, nil},
+		{`if ("0") { 10 }`, 10},
+		{"if ([]) { 10 }", nil},
+		{"if ({}) { 10 } else { 20 }", 20},
+		{"if (fn() {}) { 10 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != object.NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Error(err)
+		}
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unsupported type for negation: BOOLEAN",
+		},
+		{
+			"true + false;",
+			"operator + cannot operate with a BOOLEAN and BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"operator + cannot operate with a BOOLEAN and BOOLEAN",
+		},
+		{
+			"if (10 > 1) { true + false; }",
+			"operator + cannot operate with a BOOLEAN and BOOLEAN",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"operator + cannot operate with a BOOLEAN and BOOLEAN",
+		},
+		{
+			`{"name": "Monkey"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated, _ := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message.Error() != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorPropagation(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		unbound         []string
+	}{
+		{
+			"let a = 1 + true; let b = 2;",
+			"type mismatch: INTEGER + BOOLEAN",
+			[]string{"a", "b"},
+		},
+		{
+			"let a = if (missing) { 1 } else { 2 }; a",
+			"identifier not found: missing",
+			[]string{"a"},
+		},
+		{
+			"let f = fn(x) { x }; let r = f(1, -true);",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"r"},
+		},
+		{
+			"let f = fn(x, y) { x }; let r = f(len(1), nope);",
+			"len: argument 1 must be STRING, ARRAY, BYTES or RANGE, got INTEGER",
+			[]string{"r"},
+		},
+		{
+			"let inner = fn() { 1 + true }; let outer = fn() { let v = inner(); v + 1 }; let r = outer();",
+			"type mismatch: INTEGER + BOOLEAN",
+			[]string{"r", "v"},
+		},
+		{
+			"let f = fn() { return -true; 5 }; let r = f();",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"r"},
+		},
+		{
+			"if (true) { let x = 1; -true; let y = 2; }",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"y"},
+		},
+		{
+			"let arr = [1, 2, -true];",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"arr"},
+		},
+		{
+			"let h = {1: -true};",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"h"},
+		},
+		{
+			"let v = [1, 2][-true];",
+			"unsupported type for negation: BOOLEAN",
+			[]string{"v"},
+		},
+		{
+			"let f = fn(x) { x }; let r = f();",
+			"wrong number of arguments: want=1, got=0",
+			[]string{"r"},
+		},
+		{
+			"let r = 5(1);",
+			"not a function: INTEGER",
+			[]string{"r"},
+		},
+	}
+
+	for _, tt := range tests {
+		program, err := parser.New(lexer.New(tt.input)).ParseProgram()
+		if err != nil {
+			t.Fatalf("parse error for %q: %s", tt.input, err)
+		}
+
+		env := object.NewEnvironment()
+		evaluated, err := (&TreeWalker{}).Eval(program, env)
+		if err == nil {
+			t.Errorf("%q: expected an error, got %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, err.Error())
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned at the boundary. got=%T", tt.input, evaluated)
+		} else if errObj.Message != err {
+			t.Errorf("%q: error object and error differ. object=%q, error=%q", tt.input, errObj.Message, err)
+		}
+
+		for _, name := range tt.unbound {
+			if _, ok := env.Get(name); ok {
+				t.Errorf("%q: %s was bound despite the error", tt.input, name)
+			}
+		}
+	}
+}
+
+func TestNullComparisons(t *testing.T) {
+	values := []string{
+		`1`, `"str"`, `true`, `false`, `[1]`, `{1: 2}`, `fn(x) { x }`, `len`,
+	}
+
+	for _, v := range values {
+		for _, form := range []string{"%s == null", "null == %s"} {
+			input := fmt.Sprintf(form, v)
+			evaluated, err := testEval(input)
+			if err != nil {
+				t.Fatalf("%q: %s", input, err)
+			}
+			testBooleanObject(t, evaluated, false)
+		}
+		for _, form := range []string{"%s != null", "null != %s"} {
+			input := fmt.Sprintf(form, v)
+			evaluated, err := testEval(input)
+			if err != nil {
+				t.Fatalf("%q: %s", input, err)
+			}
+			testBooleanObject(t, evaluated, true)
+		}
+	}
+
+	nullProducers := []string{
+		`null`,
+		`if (false) { 1 }`,
+		`fn() { return; }()`,
+		`fn() { return }()`,
+		`first([])`,
+		`last([])`,
+		`rest([])`,
+		`{"a": 1}["b"]`,
+		`puts()`,
+	}
+
+	for _, producer := range nullProducers {
+		input := fmt.Sprintf("let v = %s; [v == null, null == v, v != null, is_null(v)]", producer)
+		evaluated, err := testEval(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Fatalf("%q: not an array. got=%T", input, evaluated)
+		}
+		testBooleanObject(t, arr.Elements[0], true)
+		testBooleanObject(t, arr.Elements[1], true)
+		testBooleanObject(t, arr.Elements[2], false)
+		testBooleanObject(t, arr.Elements[3], true)
+
+		value, _ := testEval(producer)
+		testNullObject(t, value)
+	}
+
+	evaluated, _ := testEval("null + 1")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("null + 1 did not error. got=%T", evaluated)
+	}
+	if errObj.Message.Error() != "operator + cannot operate with a NULL and INTEGER" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestNilBuiltinResult(t *testing.T) {
+	var out bytes.Buffer
+	nilBuiltin := &object.Builtin{Fn: func(args ...object.Object) object.Object { return nil }}
+	table := map[string]*object.Builtin{"returns_nil": nilBuiltin}
+
+	walker := &TreeWalker{Debug: true, Log: log.New(&out, "", 0), builtins: table}
+	result, err := testEvalWith(walker, "returns_nil()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNullObject(t, result)
+	if out.String() != "warning: builtin \"returns_nil\" returned nil, using null\n" {
+		t.Errorf("warning does not name the builtin. got=%q", out.String())
+	}
+
+	out.Reset()
+	walker = &TreeWalker{Log: log.New(&out, "", 0), builtins: table}
+	if _, err := testEvalWith(walker, "returns_nil()"); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("warning logged outside debug mode. got=%q", out.String())
+	}
+}
+
+func TestSwitchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// arms are tried in order and the first match wins
+		{`switch (2) { case 1: { "one" } case 2: { "two" } case 2: { "again" } }`, "two"},
+		// no arm matches
+		{`switch (3) { case 1: { "one" } }`, nil},
+		// default matches anything
+		{`switch (3) { case 1: { "one" } default: { "other" } }`, "other"},
+		// deep equality on arrays and hashes
+		{`switch ([1, [2]]) { case [1, 2]: { 1 } case [1, [2]]: { 2 } }`, 2},
+		{`let h = {"a": 1, "b": [2]}; switch (h) { case {"a": 1}: { 1 } case {"b": [2], "a": 1}: { 2 } }`, 2},
+		// integers and floats compare numerically
+		{`switch (1.0) { case 1: { "int" } }`, "int"},
+		// guards
+		{`let x = 5; switch (x) { case 5 if x > 10: { "big" } case 5 if x > 3: { "medium" } }`, "medium"},
+		{`let x = 1; switch (x) { default if x > 3: { "big" } default: { "small" } }`, "small"},
+		// no fallthrough
+		{`switch (1) { case 1: { } case 1: { "next" } }`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSwitchPatterns(t *testing.T) {
+	shapes := `let area = fn(shape) {
+		switch (shape) {
+			case let [x, y]: { x + y }
+			case let {"type": "circle", "r": r}: { r * r }
+			case let {"type": "rect", "size": [w, h]}: { w * h }
+			default: { 0 }
+		}
+	};`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// array patterns bind by position and need the exact length
+		{shapes + `area([3, 4])`, 7},
+		{shapes + `area([3, 4, 5])`, 0},
+		// hash patterns need the listed keys and ignore the others
+		{shapes + `area({"type": "circle", "r": 3, "color": "red"})`, 9},
+		{shapes + `area({"type": "circle"})`, 0},
+		{shapes + `area({"type": "square", "r": 3})`, 0},
+		// nested patterns
+		{shapes + `area({"type": "rect", "size": [2, 5]})`, 10},
+		{shapes + `area({"type": "rect", "size": [2]})`, 0},
+		{`switch ([1, [2, [3]]]) { case let [a, [b, [c]]]: { a * 100 + b * 10 + c } }`, 123},
+		// literals inside patterns must be equal, deeply and numerically
+		{`switch (["add", 1, 2]) { case let ["sub", a, b]: { a - b } case let ["add", a, b]: { a + b } }`, 3},
+		{`switch ([1.0, -2]) { case let [1, -2]: { "numbers" } }`, "numbers"},
+		{`switch ([null, true]) { case let [null, false]: { 1 } case let [null, true]: { 2 } }`, 2},
+		// _ matches anything and binds nothing
+		{`let _ = "outer"; switch ([1, 2]) { case let [_, _]: { _ } }`, "outer"},
+		// a value of another type falls through to the next arm
+		{`switch ("ab") { case let [a, b]: { a } case let {"a": a}: { a } case let s: { s } }`, "ab"},
+		// guards see the bindings
+		{`switch ([5, 3]) { case let [a, b] if a < b: { "up" } case let [a, b] if a > b: { "down" } }`, "down"},
+		// no arm matches
+		{`switch (1) { case let [x]: { x } }`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%q: wrong result. want=%q, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+
+	// bindings live in the arm's own scope, even from an arm that failed
+	// part way or whose guard was false
+	evaluated, err := testEval(`let a = 1; let r = switch ([2, 3]) { case let [a, 4]: { 0 } case let [a, b] if b > 5: { 0 } case let [x, b]: { a + b } }; [r, a]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := evaluated.Inspect(); got != "[4, 1]" {
+		t.Errorf("wrong result. want=[4, 1], got=%s", got)
+	}
+	if _, err := testEval(`switch ([1]) { case let [y]: { y } }; y`); err == nil {
+		t.Errorf("a pattern binding leaked out of the switch")
+	}
+}
+
+func TestSwitchArmScopeAndReturn(t *testing.T) {
+	// each arm runs in its own enclosed environment
+	evaluated, err := testEval(`let x = 1; switch (x) { case 1: { let x = 2; let y = 3; } }; x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, evaluated, 1)
+
+	if _, err := testEval(`switch (1) { case 1: { let y = 3; } }; y`); err == nil {
+		t.Errorf("binding made inside an arm leaked out of the switch")
+	}
+
+	// return inside an arm returns from the enclosing function
+	evaluated, err = testEval(`let f = fn(x) { switch (x) { case 1: { return 10; } }; 20 }; [f(1), f(2)]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := evaluated.(*object.Array)
+	testIntegerObject(t, arr.Elements[0], 10)
+	testIntegerObject(t, arr.Elements[1], 20)
+}
+
+func TestSwitchErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`switch (1 + true) { default: { 1 } }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`switch (1) { case 1 if missing: { 1 } default: { 2 } }`, "identifier not found: missing"},
+		{`switch (1) { case 2 if missing: { 1 } case 1 + true: { 2 } }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`[1, 2, 3, 4] |> rest |> push(5) |> len`, 4},
+		{`let add = fn(a, b) { a + b }; 1 |> add(2) |> add(3)`, 6},
+		{`let double = fn(x) { x * 2 }; 5 |> double`, 10},
+		{`2 |> fn(x) { x * x }`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestPipeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1] |> first |> 5`, "not a function: INTEGER (pipeline stage `5` at 1:17)"},
+		{"let f = 5;\n1 |> f(2)", "not a function: INTEGER (pipeline stage `f(2)` at 2:6)"},
+		{`[1] |> len |> first`, "first: argument 1 must be ARRAY or STRING, got INTEGER (pipeline stage `first` at 1:15)"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("no placeholders")`, "no placeholders"},
+		{`format("user {} has {} points", "ann", 12)`, "user ann has 12 points"},
+		{`format("{}", 1.5)`, "1.5"},
+		{`format("{} {}", true, null)`, "true null"},
+		{`format("{}", [1, "a"])`, `[1, "a"]`},
+		{`format("{}", {"a": 1})`, `{"a": 1}`},
+		{`format("{}{}", "a", "b")`, "ab"},
+		{`format("{{}} is literal, {} is not", 1)`, "{} is literal, 1 is not"},
+		{`format("{{{}}}", "x")`, "{x}"},
+		{`format("a } or { alone")`, "a } or { alone"},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("%q: not a String. got=%T", tt.input, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`format("{} and {}", 1)`, "wrong number of arguments to `format`: 2 placeholders, 1 arguments"},
+		{`format("{}", 1, 2)`, "wrong number of arguments to `format`: 1 placeholders, 2 arguments"},
+		{`format(1)`, "format: argument 1 must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range errors {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestArrayEditingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`insert([1, 2, 3], 0, 9)`, "[9, 1, 2, 3]"},
+		{`insert([1, 2, 3], 3, 9)`, "[1, 2, 3, 9]"},
+		{`insert([1, 2, 3], 1, 9)`, "[1, 9, 2, 3]"},
+		{`insert([1, 2, 3], -1, 9)`, "[1, 2, 9, 3]"},
+		{`insert([], 0, 9)`, "[9]"},
+		{`remove([1, 2, 3], 2)`, "[1, 2]"},
+		{`remove([1, 2, 3], -1)`, "[1, 2]"},
+		{`remove([1, 2, 3], 0)`, "[2, 3]"},
+		{`remove([1, 2, 3, 4], 1, 2)`, "[1, 4]"},
+		{`remove([1, 2, 3], 1, 0)`, "[1, 2, 3]"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], 0, 4)`, "[1, 2, 3, 4]"},
+		{`slice([1, 2, 3, 4], -2, 4)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], 1, -1)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], 2, 2)`, "[]"},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`insert([1, 2], 3, 9)`, "index 3 out of range for length 2"},
+		{`insert([1, 2], -3, 9)`, "index -3 out of range for length 2"},
+		{`remove([1, 2], 2)`, "index 2 out of range for length 2"},
+		{`remove([], 0)`, "index 0 out of range for length 0"},
+		{`remove([1, 2, 3], 1, 3)`, "count 3 from index 1 out of range for length 3"},
+		{`remove([1, 2, 3], 1, -1)`, "count -1 from index 1 out of range for length 3"},
+		{`remove([1, 2, 3], 1, 9223372036854775807)`, "count 9223372036854775807 from index 1 out of range for length 3"},
+		{`slice([1, 2], 0, 3)`, "slice [0:3] out of range for length 2"},
+		{`slice([1, 2], 2, 1)`, "slice [2:1] out of range for length 2"},
+		{`insert(1, 0, 9)`, "insert: argument 1 must be ARRAY, got INTEGER"},
+		{`remove([1], "a")`, "remove: argument 2 must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range errors {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	evaluated, err := testEval(`
+let a = [1, 2, 3];
+let b = insert(a, 1, 9);
+let c = remove(a, 0, 2);
+let d = slice(a, 0, 2);
+[a, b, c, d]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluated.Inspect() != "[[1, 2, 3], [1, 9, 2, 3], [3], [1, 2]]" {
+		t.Errorf("input array was mutated. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestReverseAndUnique(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`reverse([1, 2, 3, 4])`, "[4, 3, 2, 1]"},
+		{`reverse([])`, "[]"},
+		{`reverse("héllo, 世界")`, "界世 ,olléh"},
+		{`unique(["a", "b", "a", "c", "b"])`, `["a", "b", "c"]`},
+		{`unique([1, 1.0, 2, true, true])`, "[1, 2, true]"},
+		{`unique([[1, 2], [3], [1, 2], [3, 4], [3]])`, "[[1, 2], [3], [3, 4]]"},
+		{`unique([{"a": 1}, 1, {"a": 1}, 1])`, `[{"a": 1}, 1]`},
+		{`unique([10000000000000000000.0, 10000000000000000000.0, -9223372036854775807 - 1, -9223372036854775808.0])`, "[1e+19, -9223372036854775808]"},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated, err := testEval(`let a = [1, 2, 1]; let b = reverse(a); let c = unique(a); [a, b, c]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluated.Inspect() != "[[1, 2, 1], [1, 2, 1], [1, 2]]" {
+		t.Errorf("input array was mutated. got=%s", evaluated.Inspect())
+	}
+
+	if _, err := testEval(`reverse(1)`); err == nil || err.Error() != "reverse: argument 1 must be ARRAY or STRING, got INTEGER" {
+		t.Errorf("wrong error for reverse(1): %v", err)
+	}
+}
+
+func TestSandboxLimits(t *testing.T) {
+	loop := `let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(50)`
+	grow := `let grow = fn(s, n) { if (n == 0) { s } else { grow(s + "xxxxxxxxxx", n - 1) } }; len(grow("", 20))`
+
+	tests := []struct {
+		name     string
+		options  Options
+		input    string
+		expected string
+	}{
+		{"steps", Options{MaxSteps: 100}, loop, "step limit of 100 exceeded"},
+		{"depth", Options{MaxDepth: 10}, loop, "call depth limit of 10 exceeded"},
+		{"bytes", Options{MaxBytes: 100}, grow, "memory limit of 100 exceeded"},
+		{"array bytes", Options{MaxBytes: 100}, `[1, 2, 3, 4, 5, 6, 7]`, "memory limit of 100 exceeded"},
+		{"pushed bytes", Options{MaxBytes: 100}, `push([1, 2, 3, 4, 5, 6], 7)`, "memory limit of 100 exceeded"},
+		{"hash bytes", Options{MaxBytes: 100}, `{1: 1, 2: 2, 3: 3, 4: 4}`, "memory limit of 100 exceeded"},
+		{"hash growth", Options{MaxBytes: 1024 * 1024}, `let h = {}; let i = 0; while (i < 2000000) { h[i] = i; i += 1 }`, "memory limit of 1048576 exceeded"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEvalWith(NewTreeWalker(tt.options), tt.input)
+		var limit *LimitError
+		if !errors.As(err, &limit) {
+			t.Errorf("%s: expected a LimitError. got=%v", tt.name, err)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err.Error())
+		}
+	}
+
+	// Each limit only triggers on its own resource.
+	generous := Options{MaxSteps: 10000, MaxDepth: 100, MaxBytes: 5000}
+	for _, input := range []string{loop, grow} {
+		if _, err := testEvalWith(NewTreeWalker(generous), input); err != nil {
+			t.Errorf("%q: unexpected error under generous limits: %s", input, err)
+		}
+	}
+
+	// Builtins that hand back an existing value don't charge for it again.
+	long := `let a = ["` + strings.Repeat("x", 60) + `"]; first(a); last(a); len(first(a))`
+	if _, err := testEvalWith(NewTreeWalker(Options{MaxBytes: 100}), long); err != nil {
+		t.Errorf("first and last were charged for existing values: %s", err)
+	}
+
+	// Limits surface through pipelines unchanged.
+	_, err := testEvalWith(NewTreeWalker(Options{MaxDepth: 1}), `let f = fn(x) { fn(y) { y }(x) }; 1 |> f`)
+	var limit *LimitError
+	if !errors.As(err, &limit) {
+		t.Errorf("limit inside a pipeline was not a LimitError. got=%v", err)
+	}
+
+	// Ordinary script errors are not LimitErrors.
+	_, err = testEvalWith(NewTreeWalker(generous), `1 + true`)
+	if err == nil || errors.As(err, &limit) {
+		t.Errorf("script error reported as a LimitError. got=%v", err)
+	}
+}
+
+func TestSandboxBuiltins(t *testing.T) {
+	walker := NewTreeWalker(Options{Builtins: []string{"len"}})
+
+	evaluated, err := testEvalWith(walker, `len("abc")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, evaluated, 3)
+
+	_, err = testEvalWith(walker, `puts("hi")`)
+	if err == nil || err.Error() != "identifier not found: puts" {
+		t.Errorf("whitelist did not hide puts. got=%v", err)
+	}
+
+	// << appends without going through the hidden push builtin.
+	evaluated, err = testEvalWith(walker, `len([1, 2] << [3])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, evaluated, 3)
+
+	var out bytes.Buffer
+	walker = NewTreeWalker(Options{Out: &out})
+	if _, err := testEvalWith(walker, `puts("hi", 1)`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi\n1\n" {
+		t.Errorf("puts output not captured. got=%q", out.String())
+	}
+}
+
+func TestIntegerCache(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1000 == 1000", true},
+		{"500 + 500 == 1000", true},
+		{"5000 == 5000", true},
+		{"2500 * 2 == 5000", true},
+		{"-128 == 0 - 128", true},
+		{"1024 == 1025", false},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	// Nothing may write through a shared integer.
+	testEval("let a = 1; let b = a + 1; let c = -b; [a, b, c, len([1, 2])]")
+	for v := int64(-128); v <= 1024; v++ {
+		if got := object.GetInteger(v).Value; got != v {
+			t.Fatalf("cached integer %d was mutated to %d", v, got)
+		}
+	}
+}
+
+func BenchmarkIntegerArithmetic(b *testing.B) {
+	input := `
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n % 7) } };
+sum(1000, 0);
+`
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		(&TreeWalker{}).Eval(program, object.NewEnvironment())
+	}
+}
+
+const sumLoop = "let i = 0; let sum = 0; while (i <= 1000000) { sum += i; i += 1 }; sum"
+
+func BenchmarkSumLoop(b *testing.B) {
+	program, err := parser.New(lexer.New(sumLoop)).ParseProgram()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		(&TreeWalker{}).Eval(program, object.NewEnvironment())
+	}
+}
+
+func TestConcurrentEvaluationSharedGlobals(t *testing.T) {
+	globals := object.NewSyncEnvironment()
+	globals.Set("base", object.GetInteger(10))
+	globals.Set("names", object.NewHash(0))
+
+	program, err := parser.New(lexer.New(`let x = base * 2; let y = x + base; {"y": y}["y"]`)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := (&TreeWalker{}).Eval(program, object.NewEnclosedEnvironment(globals))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result.(*object.Integer).Value != 30 {
+				t.Errorf("wrong result. got=%s", result.Inspect())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestModules(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("math", object.NewModule("math", map[string]object.Object{
+		"pi": &object.Float{Value: 3.14},
+		"floor": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			return object.GetInteger(int64(args[0].(*object.Float).Value))
+		}},
+	}))
+
+	eval := func(input string) (object.Object, error) {
+		program, err := parser.New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return (&TreeWalker{}).Eval(program, env)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`math`, "module math"},
+		{`math.pi`, "3.14"},
+		{`math["pi"]`, "3.14"},
+		{`math.floor(2.5)`, "2"},
+		{`math.floor(math.pi) + 1`, "4"},
 	}
 
 	for _, tt := range tests {
-		evaluated, err := testEval(tt.input)
+		evaluated, err := eval(tt.input)
 		if err != nil {
-			t.Fatal(err)
+			t.Fatalf("%q: %s", tt.input, err)
 		}
-		integer, ok := tt.expected.(int)
-		if ok {
-			testIntegerObject(t, evaluated, int64(integer))
-		} else {
-			testNullObject(t, evaluated)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
 		}
 	}
-}
 
-func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != object.NULL {
-		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
-		return false
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`math.flor(1.5)`, `module "math" has no member "flor", did you mean "floor"?`},
+		{`math["fooo"]`, `module "math" has no member "fooo"`},
+		{`math.p`, `module "math" has no member "p", did you mean "pi"?`},
+		{`1.pi`, `INTEGER has no members`},
+	}
+
+	for _, tt := range errors {
+		_, err := eval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
 	}
-	return true
 }
 
-func TestReturnStatements(t *testing.T) {
+func TestMethodCalls(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected int64
+		expected string
 	}{
-		{"return 10;", 10},
-		{"return 10; 9;", 10},
-		{"return 2 * 5; 9;", 10},
-		{"9; return 2 * 5; 9;", 10},
-		{
-			`
-if (10 > 1) {
-  if (10 > 1) {
-    return 10;
-  }
-
-  return 1;
-}
-`,
-			10,
-		},
+		// value.name(args) is name(value, args)
+		{`[1, 2].push(3)`, "[1, 2, 3]"},
+		{`"héllo".first()`, "h"},
+		{`[3, 1, 2].len()`, "3"},
+		// calls chain left to right, binding tighter than operators
+		{`[1, 2, 2].push(3).unique().reverse().first()`, "3"},
+		{`"  a".rest().rest().len() + 1`, "2"},
+		{`-[1, 2].len()`, "-2"},
+		// functions in scope work as methods, closest scope first
+		{`let double = fn(x) { x * 2 }; 21.double()`, "42"},
+		{`let wrap = fn(s, l, r) { l + s + r }; "b".wrap("[", "]").len()`, "3"},
+		{`let len = fn(x) { "mine" }; [1].len()`, "mine"},
+		{`let len = 5; [1].len()`, "1"},
+		{`let f = fn() { let double = fn(x) { x * 2 }; 4.double() }; f()`, "8"},
+		// a hash's own member wins and is called without the receiver
+		{`let h = {"n": 1, "len": fn() { "own" }}; [h.len(), h.keys().len()]`, `["own", 2]`},
+		{`let h = {"double": fn(x) { x * 3 }}; let double = fn(x) { x * 2 }; h.double(2)`, "6"},
+		{`let h = {"name": "ann", 1: 2}; h.name`, "ann"},
+		// a hash member that isn't a string key doesn't count
+		{`let h = {1: 2}; h.keys()`, "[1]"},
 	}
 
 	for _, tt := range tests {
 		evaluated, err := testEval(tt.input)
 		if err != nil {
-			t.Error(err)
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
 		}
-		testIntegerObject(t, evaluated, tt.expected)
 	}
-}
 
-func TestErrorHandling(t *testing.T) {
-	tests := []struct {
-		input           string
-		expectedMessage string
+	errors := []struct {
+		input    string
+		expected string
 	}{
-		{
-			"5 + true;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"5 + true; 5;",
-			"type mismatch: INTEGER + BOOLEAN",
-		},
-		{
-			"-true",
-			"cannot apply - operator to BOOLEAN",
-		},
-		{
-			"true + false;",
-			"operator + cannot operate with a BOOLEAN and BOOLEAN",
-		},
-		{
-			"5; true + false; 5",
-			"operator + cannot operate with a BOOLEAN and BOOLEAN",
-		},
-		{
-			"if (10 > 1) { true + false; }",
-			"operator + cannot operate with a BOOLEAN and BOOLEAN",
-		},
-		{
-			"foobar",
-			"identifier not found: foobar",
-		},
-		{
-			`"Hello" - "World"`,
-			"unknown operator: STRING - STRING",
-		},
-		{
-			`
-if (10 > 1) {
-  if (10 > 1) {
-    return true + false;
-  }
-
-  return 1;
-}
-`,
-			"operator + cannot operate with a BOOLEAN and BOOLEAN",
-		},
-		{
-			`{"name": "Monkey"}[fn(x) { x }];`,
-			"unusable as hash key: FUNCTION",
-		},
+		{`"a".upperr()`, `no function "upperr" applicable to STRING`},
+		{`[1].lenn()`, `no function "lenn" applicable to ARRAY, did you mean "len"?`},
+		{`let double = fn(x) { x * 2 }; 1.doubel()`, `no function "doubel" applicable to INTEGER, did you mean "double"?`},
+		{`let count = 1; [1].count()`, `no function "count" applicable to ARRAY`},
+		{`let h = {"a": 1}; h.b`, `hash has no member "b"`},
+		{`let h = {"a": 1}; h.a()`, `not a function: INTEGER`},
+		{`[1].push()`, `push: expected 2 arguments, got 1`},
 	}
 
-	for _, tt := range tests {
-		evaluated, _ := testEval(tt.input)
-
-		errObj, ok := evaluated.(*object.Error)
-		if !ok {
-			t.Errorf("no error object returned. got=%T(%+v)",
-				evaluated, evaluated)
-			continue
-		}
-
-		if errObj.Message.Error() != tt.expectedMessage {
-			t.Errorf("wrong error message. expected=%q, got=%q",
-				tt.expectedMessage, errObj.Message)
+	for _, tt := range errors {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
 		}
 	}
 }
@@ -288,6 +1373,39 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDuplicateDefinitions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the error's position and message, or empty to succeed
+	}{
+		{"let x = 1; let x = 2;", `1:16: "x" is already defined in this scope`},
+		{"let f = fn() { let y = 1; let y = 2; y };", `1:31: "y" is already defined in this scope`},
+		{"let f = fn(a, a) { a };", `1:15: "a" is already defined in this scope`},
+		{"if (false) { let z = 1; let z = 2 }", `1:29: "z" is already defined in this scope`},
+		{"let x = 1; if (true) { let x = 2; x }", ""},
+		{"let f = fn(a) { let a = 2; a }; f(1)", ""},
+		{"let i = 0; while (i < 2) { let j = i; i += 1 }; i", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s", tt.input, err)
+			}
+			continue
+		}
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) {
+			t.Errorf("%q: expected an EvalError, got %v", tt.input, err)
+			continue
+		}
+		if got := fmt.Sprintf("%d:%d: %s", evalErr.Pos.Line, evalErr.Pos.Column, evalErr); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -380,8 +1498,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
-		{`len(1)`, "cannot take the length of INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments to 'len': 2"},
+		{`len(1)`, "len: argument 1 must be STRING, ARRAY, BYTES or RANGE, got INTEGER"},
+		{`len("one", "two")`, "len: expected 1 argument, got 2"},
 	}
 
 	for _, tt := range tests {
@@ -405,6 +1523,84 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestMemo(t *testing.T) {
+	input := `
+let fib = memo(fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+});
+fib(30);
+`
+	env := object.NewEnvironment()
+	program, err := parser.New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluated, err := (&TreeWalker{}).Eval(program, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, evaluated, 832040)
+
+	fib, _ := env.Get("fib")
+	memoized, ok := fib.(*object.Memoized)
+	if !ok {
+		t.Fatalf("fib is not Memoized. got=%T", fib)
+	}
+	hits, misses := memoized.Stats()
+	if misses != 31 {
+		t.Errorf("wrong number of cache misses. got=%d, want=31", misses)
+	}
+	if hits != 28 {
+		t.Errorf("wrong number of cache hits. got=%d, want=28", hits)
+	}
+	if memoized.Inspect() != memoized.Fn.Inspect() {
+		t.Errorf("memoized function does not inspect as its function. got=%q", memoized.Inspect())
+	}
+}
+
+func TestMemoSeparateCaches(t *testing.T) {
+	input := `
+let double = memo(fn(x) { x * 2 });
+let triple = memo(fn(x) { x * 3 });
+[double(2), triple(2), double(2), triple(2)]
+`
+	evaluated, err := testEval(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := evaluated.(*object.Array)
+	for i, expected := range []int64{4, 6, 4, 6} {
+		testIntegerObject(t, arr.Elements[i], expected)
+	}
+}
+
+func TestMemoUnhashableArguments(t *testing.T) {
+	input := `
+let total = memo(fn(arr) { len(arr) });
+[total([1, 2]), total([1, 2, 3]), total([1, 2])]
+`
+	env := object.NewEnvironment()
+	program, _ := parser.New(lexer.New(input)).ParseProgram()
+	evaluated, err := (&TreeWalker{}).Eval(program, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := evaluated.(*object.Array)
+	for i, expected := range []int64{2, 3, 2} {
+		testIntegerObject(t, arr.Elements[i], expected)
+	}
+
+	total, _ := env.Get("total")
+	if hits, misses := total.(*object.Memoized).Stats(); hits != 0 || misses != 0 {
+		t.Errorf("unhashable arguments touched the cache. hits=%d, misses=%d", hits, misses)
+	}
+
+	if _, err := testEval("memo(1)"); err == nil || err.Error() != "memo: argument 1 must be FUNCTION or BUILTIN, got INTEGER" {
+		t.Errorf("wrong error for memo(1): %v", err)
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -472,6 +1668,10 @@ func TestArrayIndexExpressions(t *testing.T) {
 			"[1, 2, 3][-1]",
 			nil,
 		},
+		{
+			"[][0]",
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -488,6 +1688,26 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestIndexErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][3]", "index 3 out of range for length 3"},
+		{"[1][-1]", "index -1 out of range for length 1"},
+		{`[1]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{`1["a"]`, "index operator not supported: INTEGER[STRING]"},
+		{`{}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
     {
@@ -517,12 +1737,16 @@ func TestHashLiterals(t *testing.T) {
 		object.FALSE.HashKey():                     6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
+	pairs := map[object.HashKey]object.HashPair{}
+	for _, pair := range result.Pairs() {
+		pairs[pair.Key.(object.Hashable).HashKey()] = pair
+	}
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := pairs[expectedKey]
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -531,6 +1755,91 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashLiteralUnusableKey(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			`{"a": 1, [1, 2]: 2}`,
+			"unusable as hash key: [1, 2] (ARRAY) at 1:10",
+		},
+		{
+			"let f = fn(x) { x };\n{\n  f: 1\n}",
+			"unusable as hash key: fn(x) {...} (FUNCTION) at 3:3",
+		},
+		{
+			`{{}: 1}`,
+			"unusable as hash key: {} (HASH) at 1:2",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := testEval(tt.input)
+		if err == nil {
+			t.Fatalf("%q: expected error", tt.input)
+		}
+		if err.Error() != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, err.Error())
+		}
+	}
+}
+
+func TestFloatHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{1.5: 5}[1.5]`, 5},
+		{`let k = 0.5 + 1; {1.5: 5}[k]`, 5},
+		{`{1.0: 5}[1]`, nil},
+		{`{1: 5}[1.0]`, nil},
+		{`let h = {1: 5, 1.0: 6}; h[1.0]`, 6},
+		{`let h = {1: 5, 1.0: 6}; h[1]`, 5},
+		{`{0.0: 5}[-0.0]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"-1.5", "-1.5"},
+		{"1.5 + 1.5", "3.0"},
+		{"1 + 0.5", "1.5"},
+		{"0.5 * 4", "2.0"},
+		{"1 / 4.0", "0.25"},
+		{"2.5 > 2", "true"},
+		{"2 < 1.5", "false"},
+		{"1 == 1.0", "true"},
+		{"1.5 != 1.5", "false"},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -579,3 +1888,96 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let ch = channel();
+let producer = fn() { let i = 1; while (i <= 5) { send(ch, i); i += 1 }; close(ch) };
+let consumer = fn() { let total = 0; let v = recv(ch); while (!is_null(v)) { total += v; v = recv(ch) }; total };
+spawn(producer);
+recv(spawn(consumer))`, "15"},
+		{`let r = spawn(fn() { "done" }); [recv(r), recv(r)]`, `["done", null]`},
+		{`let r = recv(spawn(fn() { 1 / 0 })); [is_error(r), error_kind(r)]`, `[true, "division_by_zero"]`},
+		{`let n = 2; let r = spawn(fn() { n * 21 }); recv(r)`, "42"},
+	}
+
+	for _, tt := range tests {
+		evaluated, err := testEval(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: got %s, want %s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+
+	for _, input := range []string{`spawn(fn(x) { x })`, `spawn(1)`, `spawn()`} {
+		if _, err := testEval(input); object.ErrorKind(err) != object.KindArgument {
+			t.Errorf("%q: got %v, want an argument error", input, err)
+		}
+	}
+}
+
+func TestSpawnSharesTheStepLimit(t *testing.T) {
+	// Each function takes well under the limit, but together they exceed it.
+	input := `let work = fn() { let i = 0; while (i < 200) { i += 1 } };
+let done = [spawn(work), spawn(work), spawn(work), spawn(work)];
+[recv(done[0]), recv(done[1]), recv(done[2]), recv(done[3])]`
+
+	walker := NewTreeWalker(Options{MaxSteps: 3000})
+	evaluated, err := testEvalWith(walker, input)
+	var limit *LimitError
+	switch {
+	case err != nil && !errors.As(err, &limit):
+		t.Fatal(err)
+	case err == nil && !strings.Contains(evaluated.Inspect(), "step limit"):
+		t.Errorf("spawned functions ran past the shared step limit: %s", evaluated.Inspect())
+	}
+	if walker.Steps() <= 3000 {
+		t.Errorf("steps of spawned functions weren't counted, got %d", walker.Steps())
+	}
+}
+
+func TestSpawnedFunctionsStopWithTheProgram(t *testing.T) {
+	// The spawned function waits on a channel nothing sends on; the program
+	// returning has to stop it for Eval to return.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := testEval(`let c = channel(); spawn(fn() { recv(c) }); 1`); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Eval waited on a blocked spawned function")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	program, _ := parser.New(lexer.New(`recv(channel())`)).ParseProgram()
+	_, err := (&TreeWalker{}).EvalContext(ctx, program, object.NewEnvironment())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("recv wasn't cancelled with the evaluation, got %v", err)
+	}
+}
+
+func TestSpawnedPutsShareTheWriter(t *testing.T) {
+	var out bytes.Buffer
+	walker := NewTreeWalker(Options{Out: &out})
+	input := `let say = fn() { puts("a", "b") };
+let done = [spawn(say), spawn(say), spawn(say)];
+recv(done[0]); recv(done[1]); recv(done[2])`
+
+	if _, err := testEvalWith(walker, input); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != strings.Repeat("a\nb\n", 3) {
+		t.Errorf("puts from spawned functions interleaved: %q", got)
+	}
+}
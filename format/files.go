@@ -0,0 +1,220 @@
+package format
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options choose what Files does with the files it formats. With none set,
+// the formatted source is written out.
+type Options struct {
+	Write bool // rewrite files whose formatting differs
+	List  bool // write the names of files whose formatting differs
+	Diff  bool // write a diff of the changes
+}
+
+// Files formats the given files and the .mk files under the given
+// directories, and reports whether any of them differed from its formatted
+// source. A file that doesn't parse is left alone; the errors, prefixed with
+// the file and position, are returned once the others are done.
+func Files(paths []string, opts Options, out io.Writer) (bool, error) {
+	var changed bool
+	var errs []error
+	for _, path := range paths {
+		files, err := sourceFiles(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, file := range files {
+			differs, err := formatFile(file, opts, out)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			changed = changed || differs
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+// sourceFiles returns path itself, or the .mk files under it if it is a
+// directory.
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".mk" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func formatFile(path string, opts Options, out io.Writer) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	source := string(data)
+
+	formatted, err := Source(source)
+	if err != nil {
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			return false, fmt.Errorf("%s:%s: %w", path, parseErr.Pos, err)
+		}
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	changed := formatted != source
+	if changed && opts.List {
+		fmt.Fprintln(out, path)
+	}
+	if changed && opts.Diff {
+		io.WriteString(out, diff(path, source, formatted))
+	}
+	if changed && opts.Write {
+		if err := writeFile(path, formatted); err != nil {
+			return changed, err
+		}
+	}
+	if !opts.List && !opts.Diff && !opts.Write {
+		io.WriteString(out, formatted)
+	}
+	return changed, nil
+}
+
+// writeFile replaces path with data through a temporary file in the same
+// directory, so that it never holds half of either.
+func writeFile(path, data string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(data)
+	if err == nil {
+		err = f.Chmod(info.Mode().Perm())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// diff returns the changes from a to b as a unified diff with three lines of
+// context.
+func diff(name, a, b string) string {
+	const context = 3
+
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Each edit is a line prefixed with ' ', '-' or '+'. xAt and yAt count
+	// the lines of a and b before it.
+	var edits []string
+	var xAt, yAt []int
+	for i, j := 0, 0; i < len(x) || j < len(y); {
+		xAt, yAt = append(xAt, i), append(yAt, j)
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, " "+x[i])
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, "-"+x[i])
+			i++
+		default:
+			edits = append(edits, "+"+y[j])
+			j++
+		}
+	}
+	xAt, yAt = append(xAt, len(x)), append(yAt, len(y))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	for start := 0; start < len(edits); start++ {
+		if edits[start][0] == ' ' {
+			continue
+		}
+
+		// Changes closer together than twice the context share a hunk.
+		end := start
+		for k := start; k < len(edits) && k-end <= 2*context; k++ {
+			if edits[k][0] != ' ' {
+				end = k
+			}
+		}
+		lo, hi := max(start-context, 0), min(end+context+1, len(edits))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(xAt[lo], xAt[hi]), hunkRange(yAt[lo], yAt[hi]))
+		for _, edit := range edits[lo:hi] {
+			out.WriteString(edit)
+			if !strings.HasSuffix(edit, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = hi
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines from, up to to, as a unified diff does.
+func hunkRange(from, to int) string {
+	if to-from == 1 {
+		return fmt.Sprint(from + 1)
+	}
+	if to == from {
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,128 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFilesList(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"tidy.mk":        "let x = 1;\n",
+		"messy.mk":       "let x=1",
+		"nested/deep.mk": "1+1",
+		"notes.txt":      "not monkey",
+	})
+
+	var out bytes.Buffer
+	changed, err := Files([]string{dir}, Options{List: true}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("expected changes to be reported")
+	}
+	want := filepath.Join(dir, "messy.mk") + "\n" + filepath.Join(dir, "nested", "deep.mk") + "\n"
+	if out.String() != want {
+		t.Errorf("wrong list. want=%q, got=%q", want, out.String())
+	}
+
+	out.Reset()
+	changed, err = Files([]string{filepath.Join(dir, "tidy.mk")}, Options{List: true}, &out)
+	if err != nil || changed || out.Len() != 0 {
+		t.Errorf("a formatted file should not be listed. changed=%t, out=%q (%v)", changed, out.String(), err)
+	}
+}
+
+func TestFilesWrite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.mk": "let x=1\nx"})
+	path := filepath.Join(dir, "a.mk")
+
+	var out bytes.Buffer
+	if _, err := Files([]string{dir}, Options{Write: true}, &out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "let x = 1;\nx;\n"; string(data) != want {
+		t.Errorf("wrong rewrite. want=%q, got=%q", want, data)
+	}
+	if out.Len() != 0 {
+		t.Errorf("-w should write nothing out, got %q", out.String())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	changed, err := Files([]string{path}, Options{Write: true}, &out)
+	if err != nil || changed {
+		t.Errorf("second run should change nothing. changed=%t (%v)", changed, err)
+	}
+}
+
+func TestFilesRefuseUnparseable(t *testing.T) {
+	source := "let x = 1\nlet = 2\n"
+	dir := writeFiles(t, map[string]string{"bad.mk": source, "good.mk": "1+1"})
+
+	var out bytes.Buffer
+	changed, err := Files([]string{dir}, Options{Write: true}, &out)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if want := filepath.Join(dir, "bad.mk") + ":2:5: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("error should start with %q, got %q", want, err)
+	}
+	if !changed {
+		t.Error("the good file should still have been formatted")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "bad.mk"))
+	if string(data) != source {
+		t.Errorf("unparseable file was changed to %q", data)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "good.mk"))
+	if string(data) != "1 + 1;\n" {
+		t.Errorf("good file not rewritten, got %q", data)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\ntwo\n4\n5\n6\n7\n8\n9\n10\n11\neleven\n12\n"
+
+	expected := "--- f.mk\n+++ f.mk\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+two\n 4\n 5\n 6\n" +
+		"@@ -9,4 +9,5 @@\n 9\n 10\n 11\n+eleven\n 12\n"
+	if got := diff("f.mk", a, b); got != expected {
+		t.Errorf("wrong diff.\nwant=%q\ngot= %q", expected, got)
+	}
+
+	// Changes within twice the context of each other share a hunk.
+	b = "1\n2\ntwo\n4\n5\n6\n7\n8\nnine\n10\n11\n12\n"
+	expected = "--- f.mk\n+++ f.mk\n" +
+		"@@ -1,12 +1,12 @@\n 1\n 2\n-3\n+two\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n 11\n 12\n"
+	if got := diff("f.mk", a, b); got != expected {
+		t.Errorf("wrong diff.\nwant=%q\ngot= %q", expected, got)
+	}
+}
@@ -0,0 +1,419 @@
+// Package format prints Monkey programs in one canonical layout, as the fmt
+// command does.
+package format
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const indent = "    "
+
+// Source parses source and returns it formatted. Blank lines between
+// statements are kept, collapsed to one, as are the doc comments above lets
+// of functions. If source doesn't parse, the *parser.ParseError is returned,
+// and source with any other comment, which would be lost, is refused.
+func Source(source string) (string, error) {
+	l := lexer.New(source)
+	program, err := parser.NewWithMode(l, parser.ParseComments).ParseProgram()
+	if err != nil {
+		return "", err
+	}
+
+	p := &printer{lines: strings.Split(source, "\n"), docLines: new(int)}
+	p.program(program)
+	if comments := l.Comments(); len(comments) > *p.docLines {
+		return "", fmt.Errorf("%d of %d comments aren't doc comments, and formatting would drop them", len(comments)-*p.docLines, len(comments))
+	}
+	if p.out.Len() == 0 {
+		return "", nil
+	}
+	return p.out.String() + "\n", nil
+}
+
+// Node returns node formatted, without a trailing newline.
+func Node(node ast.Node) string {
+	p := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		p.program(node)
+	case *ast.BlockStatement:
+		p.block(node)
+	case ast.Statement:
+		p.statements([]ast.Statement{node}, false)
+	case ast.Expression:
+		p.expression(node)
+	}
+	return p.out.String()
+}
+
+type printer struct {
+	out   strings.Builder
+	depth int
+	// lines holds the source being formatted, if there is one, so blank
+	// lines between statements can be kept.
+	lines []string
+	// docLines counts the doc comment lines written, if it is set.
+	docLines *int
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, false)
+}
+
+// statements writes stmts one per line. A block's last expression is its
+// value, so it goes without a semicolon; so do ifs, whiles and switches,
+// unless the next statement would otherwise continue them.
+func (p *printer) statements(stmts []ast.Statement, inBlock bool) {
+	texts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		sub := &printer{depth: p.depth, lines: p.lines, docLines: p.docLines}
+		sub.statement(stmt)
+		texts[i] = sub.out.String()
+	}
+
+	for i, stmt := range stmts {
+		doc := docOf(stmt)
+		if i > 0 {
+			p.out.WriteString("\n")
+			if p.blankBefore(stmt, len(doc)) {
+				p.out.WriteString("\n")
+			}
+		}
+		for _, line := range doc {
+			p.indent()
+			p.out.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+		}
+		if p.docLines != nil {
+			*p.docLines += len(doc)
+		}
+		p.indent()
+		p.out.WriteString(texts[i])
+
+		expr, ok := stmt.(*ast.ExpressionStatement)
+		switch {
+		case !ok:
+			p.out.WriteString(";")
+		case inBlock && i == len(stmts)-1:
+		case blockLike(expr.Expression) && (i == len(stmts)-1 || !continues(texts[i+1])):
+		default:
+			p.out.WriteString(";")
+		}
+	}
+}
+
+// docOf returns the lines of the doc comment above stmt, if it has one.
+func docOf(stmt ast.Statement) []string {
+	let, ok := stmt.(*ast.LetStatement)
+	if !ok {
+		return nil
+	}
+	fn, ok := let.Value.(*ast.FunctionLiteral)
+	if !ok || fn.Doc == "" {
+		return nil
+	}
+	return strings.Split(fn.Doc, "\n")
+}
+
+// blankBefore reports whether stmt starts its line in the source and the
+// line above it, or above the doc lines over it, is blank.
+func (p *printer) blankBefore(stmt ast.Statement, doc int) bool {
+	pos := ast.Pos(stmt)
+	if pos.Line-doc < 2 || pos.Line > len(p.lines) {
+		return false
+	}
+
+	line := []rune(p.lines[pos.Line-1])
+	if pos.Column-1 > len(line) {
+		return false
+	}
+	for _, r := range line[:pos.Column-1] {
+		if !unicode.IsSpace(r) && r != '(' {
+			return false
+		}
+	}
+	return strings.TrimSpace(p.lines[pos.Line-2-doc]) == ""
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if stmt.ReturnValue != nil {
+			p.out.WriteString(" ")
+			p.expression(stmt.ReturnValue)
+		}
+	case *ast.BreakStatement:
+		p.out.WriteString("break")
+	case *ast.ContinueStatement:
+		p.out.WriteString("continue")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.out.WriteString("{}")
+		return
+	}
+
+	// A block that is just a short value stays on one line.
+	if stmt, ok := block.Statements[0].(*ast.ExpressionStatement); ok && len(block.Statements) == 1 && !blockLike(stmt.Expression) {
+		sub := &printer{depth: p.depth, lines: p.lines, docLines: p.docLines}
+		sub.expression(stmt.Expression)
+		if text := sub.out.String(); !strings.Contains(text, "\n") {
+			p.out.WriteString("{ " + text + " }")
+			return
+		}
+	}
+
+	p.out.WriteString("{\n")
+	p.depth++
+	p.statements(block.Statements, true)
+	p.depth--
+	p.out.WriteString("\n")
+	p.indent()
+	p.out.WriteString("}")
+}
+
+func (p *printer) indent() {
+	p.out.WriteString(strings.Repeat(indent, p.depth))
+}
+
+func (p *printer) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(expr.Value)
+	case *ast.IntegerLiteral:
+		if expr.Token.Literal != "" {
+			p.out.WriteString(expr.Token.Literal)
+		} else {
+			p.out.WriteString(strconv.FormatInt(expr.Value, 10))
+		}
+	case *ast.FloatLiteral:
+		if expr.Token.Literal != "" {
+			p.out.WriteString(expr.Token.Literal)
+		} else {
+			text := strconv.FormatFloat(expr.Value, 'f', -1, 64)
+			if !strings.Contains(text, ".") {
+				text += ".0"
+			}
+			p.out.WriteString(text)
+		}
+	case *ast.StringLiteral:
+		p.out.WriteString(`"` + expr.Value + `"`)
+	case *ast.Boolean:
+		p.out.WriteString(strconv.FormatBool(expr.Value))
+	case *ast.Null:
+		p.out.WriteString("null")
+	case *ast.PrefixExpression:
+		p.out.WriteString(expr.Operator)
+		p.operand(expr.Right, precedence(expr.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(expr)
+		p.operand(expr.Left, precedence(expr.Left) < prec)
+		p.out.WriteString(" " + expr.Operator + " ")
+		p.operand(expr.Right, precedence(expr.Right) <= prec)
+	case *ast.PipeExpression:
+		p.operand(expr.Left, precedence(expr.Left) < parser.PIPELINE)
+		p.out.WriteString(" |> ")
+		p.operand(expr.Right, precedence(expr.Right) <= parser.PIPELINE)
+	case *ast.AssignExpression:
+		p.expression(expr.Target)
+		p.out.WriteString(" " + expr.Operator + " ")
+		p.expression(expr.Value)
+	case *ast.CallExpression:
+		p.operand(expr.Function, precedence(expr.Function) < parser.CALL)
+		p.out.WriteString("(")
+		p.list(expr.Arguments)
+		p.out.WriteString(")")
+	case *ast.IndexExpression:
+		p.operand(expr.Left, precedence(expr.Left) < parser.INDEX)
+		p.out.WriteString("[")
+		p.expression(expr.Index)
+		p.out.WriteString("]")
+	case *ast.MemberExpression:
+		p.operand(expr.Left, precedence(expr.Left) < parser.INDEX)
+		p.out.WriteString("." + expr.Member.Value)
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(expr.Elements)
+		p.out.WriteString("]")
+	case *ast.HashLiteral:
+		p.hash(expr)
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn(")
+		for i, param := range expr.Parameters {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.out.WriteString(param.Value)
+		}
+		p.out.WriteString(") ")
+		p.block(expr.Body)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(expr.Condition)
+		p.out.WriteString(") ")
+		p.block(expr.Consequence)
+		if expr.Alternative != nil {
+			p.out.WriteString(" else ")
+			p.block(expr.Alternative)
+		}
+	case *ast.WhileExpression:
+		p.out.WriteString("while (")
+		p.expression(expr.Condition)
+		p.out.WriteString(") ")
+		p.block(expr.Body)
+	case *ast.SwitchExpression:
+		p.switchExpression(expr)
+	}
+}
+
+// operand writes expr, in parentheses if the operator around it binds
+// tighter than it does.
+func (p *printer) operand(expr ast.Expression, paren bool) {
+	if paren {
+		p.out.WriteString("(")
+	}
+	p.expression(expr)
+	if paren {
+		p.out.WriteString(")")
+	}
+}
+
+func (p *printer) list(exprs []ast.Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(expr)
+	}
+}
+
+// hash writes the pairs of a hash literal in the order they appear in the
+// source.
+func (p *printer) hash(hash *ast.HashLiteral) {
+	p.out.WriteString("{")
+	for i, key := range hash.Keys() {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(key)
+		p.out.WriteString(": ")
+		p.expression(hash.Pairs[key])
+	}
+	p.out.WriteString("}")
+}
+
+func (p *printer) switchExpression(expr *ast.SwitchExpression) {
+	p.out.WriteString("switch (")
+	p.expression(expr.Subject)
+	p.out.WriteString(") {")
+	if len(expr.Cases) == 0 {
+		p.out.WriteString("}")
+		return
+	}
+
+	p.depth++
+	for _, arm := range expr.Cases {
+		p.out.WriteString("\n")
+		p.indent()
+		switch {
+		case arm.Pattern != nil:
+			p.out.WriteString("case let ")
+			p.pattern(arm.Pattern)
+		case arm.Value != nil:
+			p.out.WriteString("case ")
+			p.expression(arm.Value)
+		default:
+			p.out.WriteString("default")
+		}
+		if arm.Guard != nil {
+			p.out.WriteString(" if ")
+			p.expression(arm.Guard)
+		}
+		p.out.WriteString(": ")
+		p.block(arm.Body)
+	}
+	p.depth--
+	p.out.WriteString("\n")
+	p.indent()
+	p.out.WriteString("}")
+}
+
+func (p *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		p.out.WriteString("_")
+	case *ast.BindingPattern:
+		p.out.WriteString(pattern.Name.Value)
+	case *ast.LiteralPattern:
+		p.expression(pattern.Value)
+	case *ast.ArrayPattern:
+		p.out.WriteString("[")
+		for i, element := range pattern.Elements {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.pattern(element)
+		}
+		p.out.WriteString("]")
+	case *ast.HashPattern:
+		p.out.WriteString("{")
+		for i, key := range pattern.Keys {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.expression(key)
+			p.out.WriteString(": ")
+			p.pattern(pattern.Values[i])
+		}
+		p.out.WriteString("}")
+	}
+}
+
+// precedence returns how tightly expr holds together: the precedence of its
+// operator, or above any operator for everything else.
+func precedence(expr ast.Expression) int {
+	switch expr := expr.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(expr.Operator))
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.PipeExpression:
+		return parser.PIPELINE
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+// blockLike reports whether expr ends with a block that already closes its
+// statement.
+func blockLike(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IfExpression, *ast.WhileExpression, *ast.SwitchExpression:
+		return true
+	}
+	return false
+}
+
+// continues reports whether a statement written as text would be read as
+// carrying on the expression before it: a call, an index or a subtraction.
+func continues(text string) bool {
+	return text != "" && strings.ContainsRune("([-", rune(text[0]))
+}
@@ -0,0 +1,148 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let   x=1", "let x = 1;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(1+2)", "-(1 + 2);\n"},
+		{"-a & b", "-a & b;\n"},
+		{"(-a) & b", "(-a) & b;\n"},
+		{"!-x", "!-x;\n"},
+		{"a = b = 1", "a = b = 1;\n"},
+		{"(a = 1) + 2", "(a = 1) + 2;\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"f(x)[1].y", "f(x)[1].y;\n"},
+		{"x |> f |> g(1)", "x |> f |> g(1);\n"},
+		{"x |> (f |> g)", "x |> (f |> g);\n"},
+		{`{"b":1,"a":[1,2.5,"s"],true:null}`, `{"b": 1, "a": [1, 2.5, "s"], true: null};` + "\n"},
+		{"return", "return;\n"},
+		{"let f = fn(a,b){a+b}", "let f = fn(a, b) { a + b };\n"},
+		{"fn(){}", "fn() {};\n"},
+		{
+			"let f = fn(x) { let y = x * 2; return y }",
+			"let f = fn(x) {\n    let y = x * 2;\n    return y;\n};\n",
+		},
+		{
+			"if (x) { 1 } else { 2 }; 3",
+			"if (x) { 1 } else { 2 }\n3;\n",
+		},
+		{
+			"if (x) { 1 }; [2]",
+			"if (x) { 1 };\n[2];\n",
+		},
+		{
+			"if (x) { 1 }; -2",
+			"if (x) { 1 };\n-2;\n",
+		},
+		{
+			"while (i < 3) { i += 1; if (i == 2) { break } }",
+			"while (i < 3) {\n    i += 1;\n    if (i == 2) {\n        break;\n    }\n}\n",
+		},
+		{
+			"switch (x) { case 1 if y: { \"one\" } default: { } }",
+			"switch (x) {\n    case 1 if y: { \"one\" }\n    default: {}\n}\n",
+		},
+		{
+			"switch (p) { case let [x, {\"r\": -1, \"k\": _}] if x: { x } }",
+			"switch (p) {\n    case let [x, {\"r\": -1, \"k\": _}] if x: { x }\n}\n",
+		},
+		{
+			"let a = 1\n\n\n\nlet b = 2\nlet c = 3",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			"fn() {\n  a;\n\n  (b)\n}",
+			"fn() {\n    a;\n\n    b\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	inputs := []string{
+		"let add=fn(a,b){a+b};let x = (1 + 2) * 3 - (4 - 5) ; let y = -(1+2)",
+		`let h = {"b": 1, "a": fn(x){ x }}` + "\n\n\n" + `if (x > 1) { puts("big") } else { puts("small") }`,
+		"let i = 0; while (i < 10) { i += 1; if (i == 5) { continue } }",
+		"switch (x) { case 1 if y > 2: { let z = 1; z } default: { if (a) { b } } }",
+		"switch (p) { case let [x,[_,2.5]]: { x } case let {1:y,true:null}: { y } }",
+		"[1,2,3] |> map(fn(x){x*2}) |> puts; a = b = -x & 1",
+		"if (a) { if (b) { c } }; [1][0]",
+	}
+
+	for _, input := range inputs {
+		once, err := Source(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("%q: formatted source doesn't parse: %s\n%s", input, err, once)
+		}
+		if once != twice {
+			t.Errorf("%q: formatting twice changed it.\nonce:\n%s\ntwice:\n%s", input, once, twice)
+		}
+
+		// The formatted program means the same as the original.
+		if want, got := parse(t, input).String(), parse(t, once).String(); want != got {
+			t.Errorf("%q: formatting changed the program.\nwant=%s\ngot= %s", input, want, got)
+		}
+	}
+}
+
+func TestSourceDocComments(t *testing.T) {
+	input := "let a = 1;\n\n//Adds one.\n//\n// Really.\nlet inc = fn(x) {\n// Nested.\nlet id = fn(y) { y }; id(x) + 1 }"
+	expected := "let a = 1;\n\n// Adds one.\n//\n// Really.\nlet inc = fn(x) {\n    // Nested.\n    let id = fn(y) { y };\n    id(x) + 1\n};\n"
+	got, err := Source(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", expected, got)
+	}
+
+	if _, err := Source("let x = 1; // would be lost\n"); err == nil {
+		t.Error("expected formatting to refuse a comment it would drop")
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let x = (1 +\n2")
+	parseErr, ok := err.(*parser.ParseError)
+	if !ok {
+		t.Fatalf("expected a parse error, got %T (%v)", err, err)
+	}
+	if parseErr.Pos.Line != 2 {
+		t.Errorf("wrong position. got=%s", parseErr.Pos)
+	}
+}
+
+func parse(t *testing.T, source string) interface{ String() string } {
+	t.Helper()
+	program, err := parser.New(lexer.New(source)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
@@ -0,0 +1,38 @@
+package interp_test
+
+import (
+	"fmt"
+	"monkey/interp"
+	"os"
+)
+
+func ExampleRun() {
+	result, err := interp.Run("let sq = fn(x) { x * x }; sq(n)", interp.WithGlobal("n", 7))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Inspect())
+	// Output: 49
+}
+
+func ExampleInterpreter_Eval() {
+	i, err := interp.New(interp.WithOutput(os.Stdout))
+	if err != nil {
+		panic(err)
+	}
+	i.Eval(`let greet = fn(name) { puts("hello, " + name) };`)
+	i.Eval(`greet("monkey")`)
+	// Output: hello, monkey
+}
+
+func ExampleError() {
+	_, err := interp.Run("let x = 1 +;")
+	fmt.Println(err)
+	if err, ok := err.(*interp.Error); ok {
+		fmt.Println(err.Stage, err.Pos)
+	}
+	// Output:
+	// parse error at 1:12: No prefix expression found for ";" (";").
+	// parse 1:12
+}
@@ -0,0 +1,294 @@
+// Package interp embeds Monkey in Go programs: Run evaluates a script in one
+// call, and an Interpreter keeps its globals from one Eval to the next.
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/engine"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// Stage is the step of running a script an Error came from.
+type Stage int
+
+const (
+	ParseStage Stage = iota + 1
+	CompileStage
+	RuntimeStage
+)
+
+func (s Stage) String() string {
+	switch s {
+	case ParseStage:
+		return "parse"
+	case CompileStage:
+		return "compile"
+	default:
+		return "runtime"
+	}
+}
+
+// Error is any error from running a script. Pos is zero when the engine
+// doesn't know where the error happened.
+type Error struct {
+	Stage Stage
+	Pos   token.Position
+	Kind  string // for runtime errors, one of the object.Kind constants
+	Msg   string
+	Err   error // the engine's own error
+}
+
+func (e *Error) Error() string {
+	if e.Pos.Line > 0 {
+		return fmt.Sprintf("%s error at %s: %s", e.Stage, e.Pos, e.Msg)
+	}
+	return fmt.Sprintf("%s error: %s", e.Stage, e.Msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Limits bound what each Eval may use. Zero values mean no limit.
+type Limits struct {
+	// MaxSteps caps the nodes the tree walker evaluates, or the
+	// instructions the VM runs.
+	MaxSteps int
+	MaxDepth int // nested function calls
+	MaxBytes int // memory allocated for strings, arrays and hashes
+}
+
+// Option configures an Interpreter.
+type Option func(*config)
+
+type config struct {
+	engine   string
+	globals  map[string]any
+	builtins map[string]object.BuiltinFunction
+	allowed  []string // nil allows every builtin
+	out      io.Writer
+	env      func(name string) (string, bool)
+	envSet   bool
+	limits   Limits
+	hooks    *object.EvalHooks
+	overflow object.Overflow
+}
+
+// WithEngine chooses the engine by the names engine.New accepts: "vm", the
+// default, or "eval". Only "eval" runs switch and spawn.
+func WithEngine(name string) Option {
+	return func(c *config) { c.engine = name }
+}
+
+// WithGlobal defines a global for scripts, converting value with
+// object.FromGo.
+func WithGlobal(name string, value any) Option {
+	return func(c *config) { c.globals[name] = value }
+}
+
+// WithBuiltin defines a global function implemented in Go.
+func WithBuiltin(name string, fn object.BuiltinFunction) Option {
+	return func(c *config) { c.builtins[name] = fn }
+}
+
+// WithBuiltins lets scripts use only the named standard builtins, such as
+// "len" and "puts". Names that aren't builtins are ignored, and functions
+// added with WithBuiltin are always available.
+func WithBuiltins(names ...string) Option {
+	return func(c *config) { c.allowed = append([]string{}, names...) }
+}
+
+// WithOutput sends what puts prints to w instead of standard output.
+func WithOutput(w io.Writer) Option {
+	return func(c *config) { c.out = w }
+}
+
+// WithEnv makes the env builtin read variables with lookup instead of from
+// the process environment. A nil lookup hides the environment, so every
+// variable reads as unset.
+func WithEnv(lookup func(name string) (string, bool)) Option {
+	return func(c *config) { c.env, c.envSet = lookup, true }
+}
+
+// WithLimits applies limits to every script the Interpreter runs.
+func WithLimits(limits Limits) Option {
+	return func(c *config) { c.limits = limits }
+}
+
+// WithHooks reports calls, errors and the statistics of each script the
+// Interpreter runs to hooks.
+func WithHooks(hooks *object.EvalHooks) Option {
+	return func(c *config) { c.hooks = hooks }
+}
+
+// WithOverflow sets what integer arithmetic does when a result doesn't fit
+// in an int64. The default is object.OverflowError.
+func WithOverflow(overflow object.Overflow) Option {
+	return func(c *config) { c.overflow = overflow }
+}
+
+// allows reports whether scripts may use the standard builtin name.
+func (c *config) allows(name string) bool {
+	if c.allowed == nil {
+		return true
+	}
+	for _, allowed := range c.allowed {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Interpreter runs scripts one after another, each seeing the globals the
+// earlier ones defined.
+type Interpreter struct {
+	eng engine.Engine
+}
+
+// New returns an Interpreter configured by opts. It fails on an unknown
+// engine or a global FromGo can't convert.
+func New(opts ...Option) (*Interpreter, error) {
+	c := &config{engine: "vm", globals: map[string]any{}, builtins: map[string]object.BuiltinFunction{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var eng engine.Engine
+	switch c.engine {
+	case "eval":
+		evalEngine := engine.NewTreeWalkerEngineWithOptions(nil, evaluator.Options{
+			MaxSteps: c.limits.MaxSteps,
+			MaxDepth: c.limits.MaxDepth,
+			MaxBytes: c.limits.MaxBytes,
+			Builtins: c.allowed,
+			Hooks:    c.hooks,
+			Overflow: c.overflow,
+		})
+		evalEngine.LimitEachRun = true
+		eng = evalEngine
+	case "vm":
+		var symbols *compiler.SymbolTable
+		if c.allowed != nil {
+			symbols = compiler.NewSymbolTable()
+			for i, v := range object.Builtins {
+				if c.allows(v.Name) {
+					symbols.DefineBuiltin(i, v.Name)
+				}
+			}
+		}
+		vmEngine := engine.NewVMEngine(symbols, nil, nil)
+		if c.allowed != nil {
+			vmEngine.AllowBuiltin = c.allows
+		}
+		vmEngine.MaxInstructions = c.limits.MaxSteps
+		if c.limits.MaxDepth > 0 {
+			// The VM counts the main frame too.
+			vmEngine.MaxFrames = c.limits.MaxDepth + 1
+		}
+		vmEngine.MaxBytes = c.limits.MaxBytes
+		vmEngine.Hooks = c.hooks
+		vmEngine.Overflow = c.overflow
+		eng = vmEngine
+	default:
+		_, err := engine.New(c.engine)
+		return nil, err
+	}
+
+	if c.out != nil && c.allows("puts") {
+		eng.Define("puts", object.PutsTo(c.out))
+	}
+	if c.envSet && c.allows("env") {
+		eng.Define("env", object.EnvFrom(c.env))
+	}
+	for name, fn := range c.builtins {
+		eng.Define(name, &object.Builtin{Fn: fn})
+	}
+	for name, value := range c.globals {
+		obj, err := object.FromGo(value)
+		if err != nil {
+			return nil, fmt.Errorf("global %s: %w", name, err)
+		}
+		eng.Define(name, obj)
+	}
+
+	return &Interpreter{eng: eng}, nil
+}
+
+// Eval runs src and returns its value.
+func (i *Interpreter) Eval(src string) (object.Object, error) {
+	return i.EvalContext(context.Background(), src)
+}
+
+// EvalContext is Eval, stopping with a runtime error once ctx is done.
+func (i *Interpreter) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	program, err := parser.NewWithMode(lexer.New(src), parser.ParseComments).ParseProgram()
+	if err != nil {
+		return nil, wrap(err)
+	}
+	result, err := i.eng.RunContext(ctx, program)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	return result, nil
+}
+
+// State is a checkpoint of an Interpreter's globals, made by Snapshot.
+type State struct {
+	state *engine.State
+}
+
+// Snapshot captures the globals scripts have defined so far, so Restore can
+// roll back to them. Arrays and hashes are deep copied, which costs time and
+// memory in proportion to their size, and fails beyond
+// engine.SnapshotLimit elements and pairs.
+func (i *Interpreter) Snapshot() (State, error) {
+	state, err := i.eng.(engine.Snapshotter).Snapshot()
+	if err != nil {
+		return State{}, err
+	}
+	return State{state: state}, nil
+}
+
+// Restore rolls the globals back to state, which this Interpreter's Snapshot
+// made, discarding what scripts have defined or changed since.
+func (i *Interpreter) Restore(state State) error {
+	if state.state == nil {
+		return errors.New("restoring an empty state")
+	}
+	return i.eng.(engine.Snapshotter).Restore(state.state)
+}
+
+// Run evaluates src in a new Interpreter configured by opts.
+func Run(src string, opts ...Option) (object.Object, error) {
+	interp, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return interp.Eval(src)
+}
+
+// wrap turns an error from the parser or an engine into an *Error.
+func wrap(err error) *Error {
+	var parseErr *parser.ParseError
+	var compileErr *compiler.CompileError
+	var evalErr *evaluator.EvalError
+	switch {
+	case errors.As(err, &parseErr):
+		return &Error{Stage: ParseStage, Pos: parseErr.Pos, Msg: parseErr.Error(), Err: err}
+	case errors.As(err, &compileErr):
+		return &Error{Stage: CompileStage, Pos: compileErr.Pos, Msg: compileErr.Message, Err: err}
+	case errors.As(err, &evalErr):
+		return &Error{Stage: RuntimeStage, Pos: evalErr.Pos, Kind: object.ErrorKind(err), Msg: err.Error(), Err: err}
+	default:
+		return &Error{Stage: RuntimeStage, Kind: object.ErrorKind(err), Msg: err.Error(), Err: err}
+	}
+}
@@ -0,0 +1,398 @@
+package interp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+var engines = []string{"vm", "eval"}
+
+func TestRun(t *testing.T) {
+	for _, name := range engines {
+		result, err := Run("let add = fn(a, b) { a + b }; add(2, 3)", WithEngine(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Inspect() != "5" {
+			t.Errorf("%s: got %s, want 5", name, result.Inspect())
+		}
+	}
+}
+
+func TestInterpreterKeepsState(t *testing.T) {
+	for _, name := range engines {
+		i, err := New(WithEngine(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := i.Eval("let x = 40; let inc = fn(n) { n + 1 };"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		result, err := i.Eval("inc(x) + 1")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Inspect() != "42" {
+			t.Errorf("%s: got %s, want 42", name, result.Inspect())
+		}
+	}
+}
+
+func TestWithGlobal(t *testing.T) {
+	for _, name := range engines {
+		result, err := Run(`[n * 2, names[1], config["debug"], ratio]`,
+			WithEngine(name),
+			WithGlobal("n", 21),
+			WithGlobal("names", []string{"a", "b"}),
+			WithGlobal("config", map[string]bool{"debug": true}),
+			WithGlobal("ratio", 0.5),
+		)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := result.Inspect(); got != `[42, "b", true, 0.5]` {
+			t.Errorf("%s: got %s", name, got)
+		}
+	}
+
+	_, err := New(WithGlobal("f", func() {}))
+	if err == nil || !strings.Contains(err.Error(), "global f") {
+		t.Errorf("expected an error for an unconvertible global, got %v", err)
+	}
+}
+
+func TestWithBuiltin(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return object.GetInteger(args[0].(*object.Integer).Value * 2)
+	}
+	for _, name := range engines {
+		result, err := Run("double(double(3))", WithEngine(name), WithBuiltin("double", double))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.Inspect() != "12" {
+			t.Errorf("%s: got %s, want 12", name, result.Inspect())
+		}
+	}
+}
+
+func TestWithOutput(t *testing.T) {
+	for _, name := range engines {
+		var out bytes.Buffer
+		if _, err := Run(`puts("hello", 1); puts([2])`, WithEngine(name), WithOutput(&out)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != "hello\n1\n[2]\n" {
+			t.Errorf("%s: got %q", name, out.String())
+		}
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+	lookup := func(name string) (string, bool) { return "apple", name == "MONKEY_TEST_VAR" }
+
+	for _, name := range engines {
+		tests := []struct {
+			opts []Option
+			want string
+		}{
+			{[]Option{WithEngine(name), WithEnv(lookup)}, "apple"},
+			{[]Option{WithEngine(name), WithEnv(nil)}, "null"},
+			{[]Option{WithEngine(name)}, "banana"},
+		}
+		for i, tt := range tests {
+			result, err := Run(`env("MONKEY_TEST_VAR")`, tt.opts...)
+			if err != nil {
+				t.Fatalf("%s: %d: %v", name, i, err)
+			}
+			if result.Inspect() != tt.want {
+				t.Errorf("%s: %d: got %s, want %s", name, i, result.Inspect(), tt.want)
+			}
+		}
+	}
+}
+
+func TestWithLimits(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		src    string
+	}{
+		{Limits{MaxSteps: 1000}, "while (true) {}"},
+		{Limits{MaxDepth: 10}, "let f = fn(n) { 1 + f(n + 1) }; f(0)"},
+		{Limits{MaxBytes: 1000}, `let s = "x"; while (true) { s = s + s }`},
+	}
+	for _, name := range engines {
+		for _, tt := range tests {
+			_, err := Run(tt.src, WithEngine(name), WithLimits(tt.limits))
+			var interpErr *Error
+			if !errors.As(err, &interpErr) || interpErr.Stage != RuntimeStage {
+				t.Errorf("%s: %s: expected a runtime error, got %v", name, tt.src, err)
+			}
+		}
+	}
+
+	var limitErr *evaluator.LimitError
+	_, err := Run("while (true) {}", WithEngine("eval"), WithLimits(Limits{MaxSteps: 1000}))
+	if !errors.As(err, &limitErr) {
+		t.Errorf("expected the LimitError to be reachable, got %v", err)
+	}
+}
+
+func TestLimitsApplyToEachEval(t *testing.T) {
+	// A run fits the limit on either engine, but two together don't.
+	src := "let i = 0; while (i < 30) { i += 1 }; i"
+	for _, name := range engines {
+		interp, err := New(WithEngine(name), WithLimits(Limits{MaxSteps: 400}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for run := 0; run < 5; run++ {
+			if _, err := interp.Eval(src); err != nil {
+				t.Fatalf("%s: run %d: %v", name, run, err)
+			}
+		}
+	}
+}
+
+func TestWithBuiltins(t *testing.T) {
+	for _, name := range engines {
+		var out bytes.Buffer
+		interp, err := New(WithEngine(name), WithBuiltins("len"), WithOutput(&out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := interp.Eval(`[len("abc"), [1, 2].len()]`); err != nil || result.Inspect() != "[3, 2]" {
+			t.Errorf("%s: allowed builtins: got %v, %v", name, result, err)
+		}
+		for _, src := range []string{`puts("hi")`, `"hi".puts()`, `first([1])`} {
+			if _, err := interp.Eval(src); err == nil {
+				t.Errorf("%s: %s: expected an error for a builtin that isn't allowed", name, src)
+			}
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: a disallowed puts printed %q", name, out.String())
+		}
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	src := `let add = fn(a, b) { a + b };
+let twice = fn(x) { add(x, x) * 1 };
+let h = {[twice(len([1, 2]))]: true}`
+
+	for _, name := range engines {
+		var calls []string
+		var errs []error
+		var positions []token.Position
+		var stats []object.Stats
+		hooks := &object.EvalHooks{
+			OnCall:     func(name string, argc int) { calls = append(calls, fmt.Sprintf("%s/%d", name, argc)) },
+			OnError:    func(err error, pos token.Position) { errs, positions = append(errs, err), append(positions, pos) },
+			OnComplete: func(s object.Stats) { stats = append(stats, s) },
+		}
+
+		_, err := Run(src, WithEngine(name), WithHooks(hooks))
+		if err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+		if got, want := strings.Join(calls, " "), "len/1 twice/1 add/2"; got != want {
+			t.Errorf("%s: calls = %s, want %s", name, got, want)
+		}
+		if len(errs) != 1 || object.ErrorKind(errs[0]) != object.KindUnhashable {
+			t.Errorf("%s: errors = %v, want one unhashable key", name, errs)
+		}
+		// Only the tree walker knows where an error happened.
+		if name == "eval" && (len(positions) != 1 || positions[0].Line != 3) {
+			t.Errorf("%s: positions = %v, want line 3", name, positions)
+		}
+		if name == "vm" && (len(positions) != 1 || positions[0] != (token.Position{})) {
+			t.Errorf("%s: positions = %v, want one zero position", name, positions)
+		}
+		if len(stats) != 1 {
+			t.Fatalf("%s: OnComplete called %d times, want 1", name, len(stats))
+		}
+		if stats[0].MaxDepth != 2 || stats[0].Steps == 0 || stats[0].Bytes == 0 {
+			t.Errorf("%s: stats = %+v, want depth 2 and some steps and bytes", name, stats[0])
+		}
+	}
+}
+
+func TestWithHooksWithoutCalls(t *testing.T) {
+	for _, name := range engines {
+		var stats []object.Stats
+		hooks := &object.EvalHooks{OnComplete: func(s object.Stats) { stats = append(stats, s) }}
+
+		if _, err := Run("1 + 2", WithEngine(name), WithHooks(hooks)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(stats) != 1 || stats[0].MaxDepth != 0 {
+			t.Errorf("%s: stats = %+v, want one run with depth 0", name, stats)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, name := range engines {
+		i, err := New(WithEngine(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := i.Eval("let a = [1, [2]]; let h = {\"k\": a}"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		state, err := i.Snapshot()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		for round := 0; round < 2; round++ {
+			if _, err := i.Eval("a[0] = 10; a[1][0] = 20; h[\"k\"][1] = 30; let b = 1"); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err := i.Restore(state); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			result, err := i.Eval("[a, h, a == h[\"k\"]]")
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got, want := result.Inspect(), `[[1, [2]], {"k": [1, [2]]}, true]`; got != want {
+				t.Errorf("%s: round %d: got %s, want %s", name, round, got, want)
+			}
+			if _, err := i.Eval("b"); err == nil {
+				t.Errorf("%s: round %d: b survived the restore", name, round)
+			}
+		}
+
+		other, _ := New(WithEngine(name))
+		if err := other.Restore(state); err == nil {
+			t.Errorf("%s: restored another interpreter's state", name)
+		}
+	}
+}
+
+func TestWithOverflow(t *testing.T) {
+	tests := []struct {
+		src                 string
+		errorMsg, wrap, big string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2", "9223372036854775807", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2", "-9223372036854775808", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)", "-9223372036854775808", "9223372036854775808"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1", "-9223372036854775808", "9223372036854775808"},
+		{"1 << 63", "integer overflow: 1 << 63", "-9223372036854775808", "9223372036854775808"},
+		{"3 << 64", "integer overflow: 3 << 64", "0", "55340232221128654848"},
+		{"(-1) << 63", "-9223372036854775808", "-9223372036854775808", "-9223372036854775808"},
+	}
+	bigOnly := []struct{ src, want string }{
+		{"let b = 9223372036854775807 + 1; [b - 1, b * b, b / 2, b % 10, -b]", "[9223372036854775807, 85070591730234615865843651857942052864, 4611686018427387904, 8, -9223372036854775808]"},
+		{"let b = 1 << 100; [b > 1, 1 < b, b == b + 0, b != 1, b >> 99, b & 1]", "[true, true, true, true, 2, 0]"},
+		{"(1 << 100) / 0", "error: division by zero: 1267650600228229401496703205376 / 0"},
+	}
+	for _, name := range engines {
+		for _, tt := range tests {
+			policies := []struct {
+				overflow object.Overflow
+				want     string
+			}{
+				{object.OverflowError, tt.errorMsg},
+				{object.OverflowWrap, tt.wrap},
+				{object.OverflowBig, tt.big},
+			}
+			for _, p := range policies {
+				got := inspectRun(tt.src, WithEngine(name), WithOverflow(p.overflow))
+				want := p.want
+				if strings.HasPrefix(want, "integer overflow") {
+					want = "error: " + want
+				}
+				if got != want {
+					t.Errorf("%s: %s: %q: got %s, want %s", name, p.overflow, tt.src, got, want)
+				}
+			}
+		}
+		for _, tt := range bigOnly {
+			if got := inspectRun(tt.src, WithEngine(name), WithOverflow(object.OverflowBig)); got != tt.want {
+				t.Errorf("%s: %q: got %s, want %s", name, tt.src, got, tt.want)
+			}
+		}
+		if got := inspectRun("9223372036854775807 + 1", WithEngine(name)); got != "error: integer overflow: 9223372036854775807 + 1" {
+			t.Errorf("%s: the default policy gave %s", name, got)
+		}
+	}
+}
+
+// inspectRun runs src and returns its result's Inspect, or "error: " and
+// the error's message.
+func inspectRun(src string, opts ...Option) string {
+	result, err := Run(src, opts...)
+	if err != nil {
+		var interpErr *Error
+		if errors.As(err, &interpErr) {
+			return "error: " + interpErr.Msg
+		}
+		return "error: " + err.Error()
+	}
+	return result.Inspect()
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		engine string
+		src    string
+		stage  Stage
+		kind   string
+		want   string
+	}{
+		{"vm", "let x = ;", ParseStage, "", "parse error at 1:9: "},
+		{"eval", "let x = ;", ParseStage, "", "parse error at 1:9: "},
+		{"vm", "1 + y", CompileStage, "", `compile error at 1:5: undefined variable "y"`},
+		{"eval", "1 + y", RuntimeStage, object.KindUndefinedIdentifier, "runtime error at 1:5: "},
+		{"vm", `1 + "a"`, RuntimeStage, object.KindTypeMismatch, "runtime error: "},
+	}
+	for _, tt := range tests {
+		_, err := Run(tt.src, WithEngine(tt.engine))
+		var interpErr *Error
+		if !errors.As(err, &interpErr) {
+			t.Fatalf("%s: %q: expected an *Error, got %v", tt.engine, tt.src, err)
+		}
+		if interpErr.Stage != tt.stage {
+			t.Errorf("%s: %q: got stage %s, want %s", tt.engine, tt.src, interpErr.Stage, tt.stage)
+		}
+		if interpErr.Kind != tt.kind {
+			t.Errorf("%s: %q: got kind %q, want %q", tt.engine, tt.src, interpErr.Kind, tt.kind)
+		}
+		if !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%s: %q: got %q, want prefix %q", tt.engine, tt.src, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, name := range engines {
+		i, err := New(WithEngine(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := i.EvalContext(ctx, "while (true) {}"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, err)
+		}
+	}
+}
+
+func TestUnknownEngine(t *testing.T) {
+	if _, err := New(WithEngine("jit")); err == nil {
+		t.Error("expected an error for an unknown engine")
+	}
+}
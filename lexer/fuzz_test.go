@@ -0,0 +1,35 @@
+package lexer
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func FuzzLex(f *testing.F) {
+	for _, seed := range []string{
+		"let five = 5;\nlet add = fn(x, y) { x + y; };",
+		`!-/*5; 5 < 10 >= 5 != "foo bar" |> x.y`,
+		"3.14 1. .5 a[0] {\"k\": v} <<= >>",
+		"\"unterminated",
+		"é ü 世界 \x00 \xff",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		last := token.Position{Line: 1}
+		// Every token but EOF consumes at least one byte.
+		for i := 0; i <= len(input)+1; i++ {
+			tok := l.NextToken()
+			if tok.Pos.Line < last.Line || tok.Pos.Line == last.Line && tok.Pos.Column < last.Column {
+				t.Fatalf("token %q at %s comes before the previous one at %s", tok.Literal, tok.Pos, last)
+			}
+			last = tok.Pos
+			if tok.Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens", len(input)+1)
+	})
+}
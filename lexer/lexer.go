@@ -27,36 +27,28 @@ var singleCharMatch = map[rune]token.TokenType{
 	'[': token.LBRACKET,
 	']': token.RBRACKET,
 	':': token.COLON,
+	'.': token.DOT,
 	'!': token.BANG,
 }
 
 var doubleCharMatch = map[string]token.TokenType{
-	token.EQ:      token.EQ,
-	token.NEQ:     token.NEQ,
-	token.GEQ:     token.GEQ,
-	token.LEQ:     token.LEQ,
-	token.XOR_EQ:  token.XOR_EQ,
-	token.OR_EQ:   token.OR_EQ,
-	token.AND_EQ:  token.AND_EQ,
-	token.MIN_EQ:  token.MIN_EQ,
-	token.MUL_EQ:  token.MUL_EQ,
-	token.DIV_EQ:  token.DIV_EQ,
-	token.PERC_EQ: token.PERC_EQ,
-	token.AND:     token.AND,
-	token.OR:      token.OR,
-	token.SHOVL:   token.SHOVL,
-	token.SHOVR:   token.SHOVR,
-}
-
-var keywordMatch = map[string]token.TokenType{
-	"fn":     token.FUNCTION,
-	"let":    token.LET,
-	"if":     token.IF,
-	"else":   token.ELSE,
-	"return": token.RETURN,
-	"true":   token.TRUE,
-	"false":  token.FALSE,
-	"!":      token.BANG, // putting bang here for convenience
+	token.EQ:       token.EQ,
+	token.NEQ:      token.NEQ,
+	token.GEQ:      token.GEQ,
+	token.LEQ:      token.LEQ,
+	token.XOR_EQ:   token.XOR_EQ,
+	token.OR_EQ:    token.OR_EQ,
+	token.AND_EQ:   token.AND_EQ,
+	token.PLUS_EQ:  token.PLUS_EQ,
+	token.MIN_EQ:   token.MIN_EQ,
+	token.MUL_EQ:   token.MUL_EQ,
+	token.DIV_EQ:   token.DIV_EQ,
+	token.PERC_EQ:  token.PERC_EQ,
+	token.AND:      token.AND,
+	token.OR:       token.OR,
+	token.SHOVL:    token.SHOVL,
+	token.SHOVR:    token.SHOVR,
+	token.PIPELINE: token.PIPELINE,
 }
 
 type Lexer struct {
@@ -64,10 +56,26 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           rune
+
+	line   int
+	column int
+
+	// lastLine is the line the last token ended on, to tell comments that
+	// follow code from ones on lines of their own.
+	lastLine int
+	comments []Comment
+}
+
+// Comment is a // comment, which runs to the end of its line.
+type Comment struct {
+	Pos  token.Position
+	Text string // without the //
+	// Trailing is set for a comment that follows code on the same line.
+	Trailing bool
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -75,6 +83,11 @@ func New(input string) *Lexer {
 func (l *Lexer) readChar() {
 	width := 1
 
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -83,6 +96,7 @@ func (l *Lexer) readChar() {
 
 	l.position = l.readPosition
 	l.readPosition += width
+	l.column++
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -90,7 +104,11 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.eatWhitespace()
 
-	if l.ch == 0 {
+	pos := token.Position{Line: l.line, Column: l.column}
+
+	// A NUL byte is only the end of input when there is no more input; one
+	// inside it is illegal.
+	if l.ch == 0 && l.position >= len(l.input) {
 		tok = token.New(token.EOF, "")
 	} else if val, ok := doubleCharMatch[string(l.ch)+string(l.peekChar())]; ok {
 		tok = token.New(val, string(l.ch)+string(l.peekChar()))
@@ -102,7 +120,7 @@ func (l *Lexer) NextToken() token.Token {
 	} else if isLetter(l.ch) {
 		tok = token.New(l.handleIdentifier())
 	} else if isDigit(l.ch) {
-		tok = token.New(token.INT, l.readNumber())
+		tok = token.New(l.readNumber())
 	} else {
 		switch l.ch {
 		case '"':
@@ -110,18 +128,35 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 		default:
 			tok = token.New(token.ILLEGAL, string(l.ch))
+			l.readChar()
 		}
 	}
 
+	tok.Pos = pos
+	l.lastLine = l.line
 	return tok
 }
 
-func (l *Lexer) readNumber() string {
+// Comments returns the comments read so far, in order.
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	pos := l.position
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[pos:l.position]
+
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.INT, l.input[pos:l.position]
+	}
+
+	l.readChar()
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+	return token.FLOAT, l.input[pos:l.position]
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -134,11 +169,14 @@ func (l *Lexer) readIdentifier() string {
 
 func (l *Lexer) handleIdentifier() (token.TokenType, string) {
 	val := l.readIdentifier()
-	if match, ok := keywordMatch[val]; ok {
+	if val == "!" {
+		// '!' is also an identifier character, so a lone one lexes here.
+		return token.BANG, val
+	}
+	if match, ok := token.LookupKeyword(val); ok {
 		return match, val
-	} else {
-		return token.IDENT, val
 	}
+	return token.IDENT, val
 }
 
 func isLetter(r rune) bool {
@@ -149,10 +187,31 @@ func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// eatWhitespace skips whitespace and comments.
 func (l *Lexer) eatWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	comment := Comment{
+		Pos:      token.Position{Line: l.line, Column: l.column},
+		Trailing: l.lastLine == l.line,
+	}
+	start := l.position + 2
+	for l.ch != '\n' && l.position < len(l.input) {
 		l.readChar()
 	}
+	comment.Text = l.input[start:min(l.position, len(l.input))]
+	l.comments = append(l.comments, comment)
 }
 
 func (l *Lexer) peekChar() rune {
@@ -168,7 +227,7 @@ func (l *Lexer) readString() string {
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		if l.ch == '"' || l.position >= len(l.input) {
 			break
 		}
 	}
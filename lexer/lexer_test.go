@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"slices"
 	"testing"
 
 	"monkey/token"
@@ -31,6 +32,8 @@ func TestNextToken(t *testing.T) {
 	[1, 2];
 	{"foo": "bar"}
 	!x
+	x |> f | y
+	x += 1 -= 2
 	`
 
 	tests := []struct {
@@ -125,6 +128,16 @@ func TestNextToken(t *testing.T) {
 		{token.RBRACE, "}"},
 		{token.BANG, "!"},
 		{token.IDENT, "x"},
+		{token.IDENT, "x"},
+		{token.PIPELINE, "|>"},
+		{token.IDENT, "f"},
+		{token.PIPE, "|"},
+		{token.IDENT, "y"},
+		{token.IDENT, "x"},
+		{token.PLUS_EQ, "+="},
+		{token.INT, "1"},
+		{token.MIN_EQ, "-="},
+		{token.INT, "2"},
 		{token.EOF, ""},
 	}
 
@@ -142,3 +155,80 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenFloatsAndPositions(t *testing.T) {
+	input := "let x = 1.5;\n  x + 10.25\n\"é\" 3.x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.LET, "let", token.Position{Line: 1, Column: 1}},
+		{token.IDENT, "x", token.Position{Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Line: 1, Column: 7}},
+		{token.FLOAT, "1.5", token.Position{Line: 1, Column: 9}},
+		{token.SEMICOLON, ";", token.Position{Line: 1, Column: 12}},
+		{token.IDENT, "x", token.Position{Line: 2, Column: 3}},
+		{token.PLUS, "+", token.Position{Line: 2, Column: 5}},
+		{token.FLOAT, "10.25", token.Position{Line: 2, Column: 7}},
+		{token.STRING, "é", token.Position{Line: 3, Column: 1}},
+		{token.INT, "3", token.Position{Line: 3, Column: 5}},
+		{token.DOT, ".", token.Position{Line: 3, Column: 6}},
+		{token.IDENT, "x", token.Position{Line: 3, Column: 7}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - wrong position. expected=%s, got=%s",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	l := New("a é\x00b")
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.ILLEGAL, Literal: "é"},
+		{Type: token.ILLEGAL, Literal: "\x00"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.EOF, Literal: ""},
+	}
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want.Type || tok.Literal != want.Literal {
+			t.Fatalf("token %d: want %s %q, got %s %q", i, want.Type, want.Literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	l := New("// one\n//two\nlet x = 1; // three\n// four")
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	if want := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON}; !slices.Equal(types, want) {
+		t.Errorf("wrong tokens. want=%v, got=%v", want, types)
+	}
+
+	expected := []Comment{
+		{Pos: token.Position{Line: 1, Column: 1}, Text: " one"},
+		{Pos: token.Position{Line: 2, Column: 1}, Text: "two"},
+		{Pos: token.Position{Line: 3, Column: 12}, Text: " three", Trailing: true},
+		{Pos: token.Position{Line: 4, Column: 1}, Text: " four"},
+	}
+	if got := l.Comments(); !slices.Equal(got, expected) {
+		t.Errorf("wrong comments.\nwant=%+v\ngot= %+v", expected, got)
+	}
+}
@@ -1,18 +1,296 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"monkey/check"
+	"monkey/compiler"
+	"monkey/engine"
+	"monkey/format"
+	"monkey/object"
+	"monkey/render"
 	"monkey/repl"
+	"monkey/runner"
+	"monkey/vm"
 	"os"
 	"os/user"
+	"slices"
+	"strings"
+	"time"
 )
 
+const usage = `usage:
+  monkey [flags]                  start the REPL, or run stdin if it isn't a terminal
+  monkey [flags] <file.mk>... [-- <arg>...]
+                                  run scripts in order, sharing globals, with
+                                  the arguments after -- in args
+  monkey [flags] -e <program>     run a program and print its result
+  monkey build <file.mk> -o <out> compile a script to bytecode
+  monkey check [--compile] [--json] <file.mk>...
+                                  report errors without running anything
+  monkey fmt [-w|-l|-d] <path>... format scripts and the .mk files under directories
+  monkey run <file> [<arg>...]    run a script or compiled bytecode with args
+
+flags:
+  --engine=eval|vm   evaluate with the tree walker or the VM (default vm); only
+                     the tree walker runs switch and spawn
+  --stdin            run stdin as one program even from a terminal
+  --print            with stdin, print the program's result
+  --slow=<duration>  in the REPL, report lines that take longer, e.g. --slow=1s
+  --color=auto|always|never
+                     color errors and REPL results; auto colors terminals
+                     unless NO_COLOR is set (default auto)
+  --cache=<dir>      with run, keep compiled scripts in dir and reuse them
+                     while the source is unchanged; MONKEY_CACHE sets the
+                     default`
+
 func main() {
+	args := os.Args[1:]
+	engineName := "vm"
+	var stdin, printResult bool
+	var slow time.Duration
+	colorMode := render.Auto
+	cacheDir := os.Getenv("MONKEY_CACHE")
+	for ; len(args) > 0 && strings.HasPrefix(args[0], "--"); args = args[1:] {
+		switch {
+		case strings.HasPrefix(args[0], "--engine="):
+			engineName = strings.TrimPrefix(args[0], "--engine=")
+		case args[0] == "--stdin":
+			stdin = true
+		case args[0] == "--print":
+			printResult = true
+		case strings.HasPrefix(args[0], "--slow="):
+			var err error
+			if slow, err = time.ParseDuration(strings.TrimPrefix(args[0], "--slow=")); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n%s\n", err, usage)
+				os.Exit(2)
+			}
+		case strings.HasPrefix(args[0], "--cache="):
+			cacheDir = strings.TrimPrefix(args[0], "--cache=")
+		case strings.HasPrefix(args[0], "--color="):
+			var err error
+			if colorMode, err = render.ParseMode(strings.TrimPrefix(args[0], "--color=")); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n%s\n", err, usage)
+				os.Exit(2)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown flag %s\n%s\n", args[0], usage)
+			os.Exit(2)
+		}
+	}
+	eng, err := engine.New(engineName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n%s\n", err, usage)
+		os.Exit(2)
+	}
+	engine.DefineArgs(eng, nil)
+
+	switch {
+	case len(args) == 0 && (stdin || !repl.IsTerminal(os.Stdin)):
+		// Piped input is a program, not REPL lines: no prompts, and the
+		// exit status tells whether it worked.
+		err = runner.Reader(eng, "<stdin>", os.Stdin, os.Stdout, printResult)
+	case len(args) == 0:
+		startRepl(repl.Options{Out: os.Stdout, Err: os.Stderr, EchoResults: true, Engine: engineName, SlowEval: slow,
+			Color: colorMode.Colors(repl.IsTerminal(os.Stdout)).On})
+		return
+	case args[0] == "build":
+		err = build(args[1:])
+	case args[0] == "check":
+		err = checkFiles(args[1:])
+	case args[0] == "fmt":
+		err = reformat(args[1:])
+	case args[0] == "run":
+		err = run(args[1:], cacheDir)
+	case args[0] == "-e":
+		err = eval(eng, args[1:])
+	default:
+		// Arguments after -- are for the scripts.
+		paths := args
+		if i := slices.Index(args, "--"); i >= 0 {
+			paths = args[:i]
+			engine.DefineArgs(eng, args[i+1:])
+		}
+		err = runner.Files(eng, paths)
+	}
+
+	var exit *object.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		colors := colorMode.Colors(repl.IsTerminal(os.Stderr))
+		fmt.Fprintln(os.Stderr, colors.Error(err.Error(), ""))
+	}
+	os.Exit(runner.ExitCode(err))
+}
+
+func startRepl(opts repl.Options) {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the Monkey programming language REPL!\n", user.Username)
-	fmt.Printf("Feel free to type in commands. \n")
-	repl.Start(os.Stdin, os.Stdout)
+	opts.Banner = fmt.Sprintf("Hello %s! This is the Monkey programming language REPL!\n"+
+		"Feel free to type in commands. \n", user.Username)
+	repl.StartWithOptions(os.Stdin, opts)
+}
+
+func build(args []string) error {
+	var in, out string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-o" && i+1 < len(args) {
+			out = args[i+1]
+			i++
+		} else {
+			in = args[i]
+		}
+	}
+	if in == "" {
+		return fmt.Errorf("build: no input file\n%s", usage)
+	}
+	if out == "" {
+		out = strings.TrimSuffix(in, ".mk") + ".mkc"
+	}
+
+	source, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	bytecode, err := runner.Compile(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := bytecode.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkFiles reports the parse errors in scripts, and with --compile their
+// compile errors and warnings, one per line or as JSON with --json. Nothing
+// is run. Any error makes the exit status 1.
+func checkFiles(args []string) error {
+	var compile, asJSON bool
+	var paths []string
+	for _, arg := range args {
+		switch arg {
+		case "--compile":
+			compile = true
+		case "--json":
+			asJSON = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("check: no files\n%s", usage)
+	}
+
+	diags, err := check.Files(paths, compile)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if diags == nil {
+			diags = []check.Diagnostic{}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(diags); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+	}
+	if check.HasErrors(diags) {
+		return &object.ExitError{Code: 1}
+	}
+	return nil
+}
+
+// reformat prints scripts formatted, or with -w rewrites them. Under -l,
+// which lists the files that would change, and -d, which prints the changes,
+// any difference makes the exit status 1.
+func reformat(args []string) error {
+	var opts format.Options
+	var paths []string
+	for _, arg := range args {
+		switch arg {
+		case "-w":
+			opts.Write = true
+		case "-l":
+			opts.List = true
+		case "-d":
+			opts.Diff = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("fmt: no files\n%s", usage)
+	}
+
+	changed, err := format.Files(paths, opts, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if changed && (opts.List || opts.Diff) {
+		return &object.ExitError{Code: 1}
+	}
+	return nil
+}
+
+// run executes either a compiled file, recognised by its header, or source,
+// which is compiled through the cache in cacheDir if it isn't empty. The
+// arguments after the file are the script's args.
+func run(args []string, cacheDir string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("run: expected a file\n%s", usage)
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var bytecode *compiler.Bytecode
+	switch {
+	case bytes.HasPrefix(data, []byte(compiler.BytecodeMagic)):
+		bytecode, err = compiler.DecodeBytecode(bytes.NewReader(data))
+	case cacheDir != "":
+		cache := &runner.Cache{Dir: cacheDir}
+		bytecode, err = cache.Compile(string(data))
+	default:
+		bytecode, err = runner.Compile(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	// Compile defines args first, so it is always global 0.
+	globals := make([]object.Object, vm.GLOBALSSIZE)
+	globals[0] = engine.Args(args[1:])
+	return vm.NewWithGlobalsStore(bytecode, globals).Run()
+}
+
+// eval runs a program given on the command line and prints its result.
+func eval(eng engine.Engine, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("-e: expected one program\n%s", usage)
+	}
+
+	result, err := runner.Source(eng, "-e", args[0])
+	if err != nil {
+		return err
+	}
+	if result != object.NULL {
+		fmt.Println(result.Inspect())
+	}
+	return nil
 }
@@ -0,0 +1,129 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variadic as an ArgSpec's Max lets a builtin take any number of arguments
+// from Min on.
+const Variadic = -1
+
+// ArgSpec declares the arguments a builtin accepts.
+type ArgSpec struct {
+	Min, Max int
+	// Types lists the types allowed at each position. A nil entry, or a
+	// position past the end of Types, allows any type.
+	Types [][]ObjectType
+}
+
+// NewBuiltin returns a builtin that checks its arguments against spec and
+// then calls fn, which can rely on them having the declared count and types.
+func NewBuiltin(name string, spec ArgSpec, fn func(args []Object) Object) *Builtin {
+	return &Builtin{Name: name, Spec: &spec, Fn: func(args ...Object) Object {
+		if err := spec.check(name, args); err != nil {
+			return &Error{Message: err, Kind: KindArgument}
+		}
+		return fn(args)
+	}}
+}
+
+// CheckArgs is the argument check a builtin made by NewBuiltin runs, for
+// engines that carry out the builtin themselves. A builtin without a Spec
+// accepts anything.
+func (b *Builtin) CheckArgs(args []Object) *Error {
+	if b.Spec == nil {
+		return nil
+	}
+	if err := b.Spec.check(b.Name, args); err != nil {
+		return &Error{Message: err, Kind: KindArgument}
+	}
+	return nil
+}
+
+// check reports the first way args don't match s, in the builtin's name.
+func (s ArgSpec) check(name string, args []Object) error {
+	if len(args) < s.Min || s.Max != Variadic && len(args) > s.Max {
+		return newError("%s: expected %s, got %d", name, s.count(), len(args))
+	}
+	for i, arg := range args {
+		if i >= len(s.Types) || s.Types[i] == nil {
+			continue
+		}
+		if !allows(s.Types[i], arg.Type()) {
+			return newError("%s: argument %d must be %s, got %s", name, i+1, typeList(s.Types[i]), arg.Type())
+		}
+	}
+	return nil
+}
+
+// count describes how many arguments s takes: "1 argument", "2 or 3
+// arguments", "at least 1 argument".
+func (s ArgSpec) count() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case s.Max == Variadic:
+		return "at least " + plural(s.Min)
+	case s.Min == s.Max:
+		return plural(s.Min)
+	case s.Max == s.Min+1:
+		return fmt.Sprintf("%d or %d arguments", s.Min, s.Max)
+	default:
+		return fmt.Sprintf("%d to %d arguments", s.Min, s.Max)
+	}
+}
+
+// Signature renders how name is called under s: optional arguments are in
+// brackets, any number more is "any...", and a position that takes several
+// types lists them, as in len(STRING|ARRAY|BYTES|RANGE) or format(STRING, any...).
+func (s ArgSpec) Signature(name string) string {
+	n := s.Max
+	if s.Max == Variadic {
+		n = max(s.Min, len(s.Types))
+	}
+	params := make([]string, 0, n+1)
+	for i := 0; i < n; i++ {
+		param := "any"
+		if i < len(s.Types) && s.Types[i] != nil {
+			names := make([]string, len(s.Types[i]))
+			for j, t := range s.Types[i] {
+				names[j] = string(t)
+			}
+			param = strings.Join(names, "|")
+		}
+		if i >= s.Min {
+			param = "[" + param + "]"
+		}
+		params = append(params, param)
+	}
+	if s.Max == Variadic {
+		params = append(params, "any...")
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func allows(types []ObjectType, t ObjectType) bool {
+	for _, allowed := range types {
+		if allowed == t {
+			return true
+		}
+	}
+	return false
+}
+
+// typeList joins types as "ARRAY", "ARRAY or STRING", "ARRAY, STRING or HASH".
+func typeList(types []ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
@@ -0,0 +1,154 @@
+package object
+
+import "testing"
+
+func TestArgSpec(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := &String{Value: "s"}
+
+	tests := []struct {
+		spec ArgSpec
+		args []Object
+		want string // "" for no error
+	}{
+		{ArgSpec{Min: 1, Max: 1}, []Object{one}, ""},
+		{ArgSpec{Min: 1, Max: 1}, []Object{}, "f: expected 1 argument, got 0"},
+		{ArgSpec{Min: 2, Max: 2}, []Object{one}, "f: expected 2 arguments, got 1"},
+		{ArgSpec{Min: 2, Max: 3}, []Object{one, one, one, one}, "f: expected 2 or 3 arguments, got 4"},
+		{ArgSpec{Min: 0, Max: 1}, []Object{one, one}, "f: expected 0 or 1 arguments, got 2"},
+		{ArgSpec{Min: 1, Max: 4}, []Object{}, "f: expected 1 to 4 arguments, got 0"},
+		{ArgSpec{Min: 1, Max: Variadic}, []Object{}, "f: expected at least 1 argument, got 0"},
+		{ArgSpec{Min: 1, Max: Variadic}, []Object{one, one, one}, ""},
+		{ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{ARRAY_OBJ}}}, []Object{str, one}, "f: argument 1 must be ARRAY, got STRING"},
+		{ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{nil, {INTEGER_OBJ}}}, []Object{str, str}, "f: argument 2 must be INTEGER, got STRING"},
+		{ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, []Object{one}, "f: argument 1 must be ARRAY or STRING, got INTEGER"},
+		{ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ, HASH_OBJ}}}, []Object{one}, "f: argument 1 must be ARRAY, STRING or HASH, got INTEGER"},
+		{ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, []Object{str}, ""},
+		// The count is checked before the types.
+		{ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ}}}, []Object{one, one}, "f: expected 1 argument, got 2"},
+		// Positions past Types take anything.
+		{ArgSpec{Min: 1, Max: Variadic, Types: [][]ObjectType{{STRING_OBJ}}}, []Object{str, one, NULL}, ""},
+	}
+
+	for _, tt := range tests {
+		called := false
+		b := NewBuiltin("f", tt.spec, func(args []Object) Object {
+			called = true
+			return NULL
+		})
+		result := b.Fn(tt.args...)
+
+		if tt.want == "" {
+			if !called || result != NULL {
+				t.Errorf("%+v with %d args: expected fn to be called, got %s", tt.spec, len(tt.args), result.Inspect())
+			}
+			continue
+		}
+		errObj, ok := result.(*Error)
+		if !ok {
+			t.Errorf("%+v with %d args: expected an error, got %s", tt.spec, len(tt.args), result.Inspect())
+			continue
+		}
+		if called {
+			t.Errorf("%+v with %d args: fn called despite the error", tt.spec, len(tt.args))
+		}
+		if errObj.Message.Error() != tt.want {
+			t.Errorf("%+v with %d args: got %q, want %q", tt.spec, len(tt.args), errObj.Message.Error(), tt.want)
+		}
+	}
+}
+
+// TestBuiltinsBehaviour pins what each builtin returns, so moving them onto
+// ArgSpec changes nothing but the wording of argument errors.
+func TestBuiltinsBehaviour(t *testing.T) {
+	arr := func(values ...int64) *Array {
+		elements := make([]Object, len(values))
+		for i, v := range values {
+			elements[i] = GetInteger(v)
+		}
+		return &Array{Elements: elements}
+	}
+	i := func(v int64) Object { return GetInteger(v) }
+	s := func(v string) Object { return &String{Value: v} }
+
+	tests := []struct {
+		name string
+		args []Object
+		want string
+	}{
+		{"len", []Object{s("four")}, "4"},
+		{"len", []Object{arr(1, 2)}, "2"},
+		{"len", []Object{i(1)}, "error: len: argument 1 must be STRING, ARRAY, BYTES or RANGE, got INTEGER"},
+		{"first", []Object{arr(1, 2)}, "1"},
+		{"first", []Object{arr()}, "null"},
+		{"last", []Object{arr(1, 2)}, "2"},
+		{"last", []Object{arr()}, "null"},
+		{"rest", []Object{arr(1, 2, 3)}, "[2, 3]"},
+		{"rest", []Object{arr()}, "null"},
+		{"push", []Object{arr(1), i(2)}, "[1, 2]"},
+		{"push", []Object{arr(1)}, "error: push: expected 2 arguments, got 1"},
+		{"is_null", []Object{NULL}, "true"},
+		{"is_null", []Object{i(0)}, "false"},
+		{"format", []Object{s("{} and {}"), s("a"), i(1)}, "a and 1"},
+		{"format", []Object{s("{}")}, "error: wrong number of arguments to `format`: 1 placeholders, 0 arguments"},
+		{"insert", []Object{arr(1, 3), i(1), i(2)}, "[1, 2, 3]"},
+		{"insert", []Object{arr(1), i(-1), i(0)}, "[0, 1]"},
+		{"insert", []Object{arr(1), i(5), i(0)}, "error: index 5 out of range for length 1"},
+		{"remove", []Object{arr(1, 2, 3), i(0)}, "[2, 3]"},
+		{"remove", []Object{arr(1, 2, 3), i(-2), i(2)}, "[1]"},
+		{"remove", []Object{arr(1, 2, 3), i(1), i(5)}, "error: count 5 from index 1 out of range for length 3"},
+		{"remove", []Object{arr(1), i(0), s("1")}, "error: remove: argument 3 must be INTEGER, got STRING"},
+		{"slice", []Object{arr(1, 2, 3, 4), i(1), i(-1)}, "[2, 3]"},
+		{"slice", []Object{arr(1, 2), i(2), i(1)}, "error: slice [2:1] out of range for length 2"},
+		{"slice", []Object{arr(1, 2), i(0), NULL}, "error: slice: argument 3 must be INTEGER, got NULL"},
+		{"reverse", []Object{arr(1, 2, 3)}, "[3, 2, 1]"},
+		{"reverse", []Object{s("héllo")}, "olléh"},
+		{"unique", []Object{arr(1, 2, 1, 3, 2)}, "[1, 2, 3]"},
+		{"exit", []Object{}, "error: exit status 0"},
+		{"exit", []Object{i(3)}, "error: exit status 3"},
+		{"exit", []Object{s("3")}, "error: exit: argument 1 must be INTEGER, got STRING"},
+		{"exit", []Object{i(1), i(2)}, "error: exit: expected 0 or 1 arguments, got 2"},
+		{"env", []Object{i(1)}, "error: env: argument 1 must be STRING, got INTEGER"},
+		{"memo", []Object{i(1)}, "error: memo: argument 1 must be FUNCTION or BUILTIN, got INTEGER"},
+		{"bytes", []Object{s("héllo")}, "<6 bytes: 68 c3 a9 6c 6c 6f>"},
+		{"to_string", []Object{&Bytes{Value: []byte("ok")}}, "ok"},
+		{"byte_at", []Object{&Bytes{Value: []byte("ab")}, i(-1)}, "98"},
+		{"byte_at", []Object{&Bytes{Value: []byte("ab")}, i(2)}, "error: index 2 out of range for length 2"},
+		{"len", []Object{&Bytes{Value: []byte("abc")}}, "3"},
+		{"slice", []Object{&Bytes{Value: []byte("abcd")}, i(1), i(3)}, "<2 bytes: 62 63>"},
+	}
+
+	for _, tt := range tests {
+		result := GetBuiltinByName(tt.name).Fn(tt.args...)
+		got := result.Inspect()
+		if errObj, ok := result.(*Error); ok {
+			got = "error: " + errObj.Message.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s(%d args) = %s, want %s", tt.name, len(tt.args), got, tt.want)
+		}
+	}
+
+	memoized := GetBuiltinByName("memo").Fn(GetBuiltinByName("len"))
+	if _, ok := memoized.(*Memoized); !ok {
+		t.Errorf("memo(len) = %s, want a memoized function", memoized.Type())
+	}
+}
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"len", "len(STRING|ARRAY|BYTES|RANGE)"},
+		{"push", "push(ARRAY|STRING, any)"},
+		{"exit", "exit([INTEGER])"},
+		{"remove", "remove(ARRAY, INTEGER, [INTEGER])"},
+		{"puts", "puts(any...)"},
+	}
+	for _, tt := range tests {
+		if got := Help(GetBuiltinByName(tt.name)); got != tt.want {
+			t.Errorf("Help(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package object
+
+import "math/big"
+
+// MaxBigShift is the largest count a BigInteger can be shifted left by, so a
+// stray << can't ask for more memory than there is.
+const MaxBigShift = 1 << 16
+
+// BigInteger is an integer too large for an Integer, which arithmetic makes
+// under OverflowBig. Results that fit in an Integer become one again, so
+// each value has one representation.
+type BigInteger struct {
+	Value *big.Int
+}
+
+// NewBigInteger returns v as an Integer if it fits in one, and as a
+// BigInteger otherwise.
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return GetInteger(v.Int64())
+	}
+	return &BigInteger{Value: v}
+}
+
+func (b *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+
+// IsBigOperation reports whether l and r are integers with at least one of
+// them a BigInteger, which BigInfix works out.
+func IsBigOperation(l, r Object) bool {
+	_, lbig := l.(*BigInteger)
+	_, rbig := r.(*BigInteger)
+	return (lbig || rbig) && isInteger(l) && isInteger(r)
+}
+
+func isInteger(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == BIG_INTEGER_OBJ
+}
+
+func toBig(obj Object) *big.Int {
+	if b, ok := obj.(*BigInteger); ok {
+		return b.Value
+	}
+	return big.NewInt(obj.(*Integer).Value)
+}
+
+// BigInfix applies op to integers l and r, either of which may be a
+// BigInteger, for both engines.
+func BigInfix(op string, l, r Object) (Object, *Error) {
+	return BigOp(op, toBig(l), toBig(r))
+}
+
+// BigOp applies the arithmetic, bitwise or comparison operator op to l and
+// r. Division truncates towards zero, as it does for Integers.
+func BigOp(op string, l, r *big.Int) (Object, *Error) {
+	switch op {
+	case "+":
+		return NewBigInteger(new(big.Int).Add(l, r)), nil
+	case "-":
+		return NewBigInteger(new(big.Int).Sub(l, r)), nil
+	case "*":
+		return NewBigInteger(new(big.Int).Mul(l, r)), nil
+	case "/", "%":
+		if r.Sign() == 0 {
+			return nil, NewError(KindDivisionByZero, "division by zero: %s %s 0", l, op)
+		}
+		if op == "/" {
+			return NewBigInteger(new(big.Int).Quo(l, r)), nil
+		}
+		return NewBigInteger(new(big.Int).Rem(l, r)), nil
+	case "|":
+		return NewBigInteger(new(big.Int).Or(l, r)), nil
+	case "&":
+		return NewBigInteger(new(big.Int).And(l, r)), nil
+	case "^":
+		return NewBigInteger(new(big.Int).Xor(l, r)), nil
+	case "<<", ">>":
+		if r.Sign() < 0 {
+			return nil, NewError(KindInvalidOperation, "negative shift count: %s", r)
+		}
+		if op == ">>" {
+			if !r.IsUint64() {
+				// Everything is shifted out, leaving the sign.
+				return GetInteger(int64(min(l.Sign(), 0))), nil
+			}
+			return NewBigInteger(new(big.Int).Rsh(l, uint(r.Uint64()))), nil
+		}
+		if l.Sign() == 0 {
+			return GetInteger(0), nil
+		}
+		if !r.IsInt64() || r.Int64() > MaxBigShift {
+			return nil, NewError(KindOverflow, "integer overflow: shift count %s is over the limit of %d", r, MaxBigShift)
+		}
+		return NewBigInteger(new(big.Int).Lsh(l, uint(r.Int64()))), nil
+	case "<":
+		return NativeToBooleanObject(l.Cmp(r) < 0), nil
+	case ">":
+		return NativeToBooleanObject(l.Cmp(r) > 0), nil
+	case "<=":
+		return NativeToBooleanObject(l.Cmp(r) <= 0), nil
+	case ">=":
+		return NativeToBooleanObject(l.Cmp(r) >= 0), nil
+	case "==":
+		return NativeToBooleanObject(l.Cmp(r) == 0), nil
+	case "!=":
+		return NativeToBooleanObject(l.Cmp(r) != 0), nil
+	}
+	return nil, NewError(KindInternal, "unknown integer operator: %s", op)
+}
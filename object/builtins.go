@@ -1,93 +1,98 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
 
+// Builtins lists every builtin function. Compiled code refers to them by
+// index, so new builtins go at the end and any change to the list needs a new
+// compiler.BytecodeVersion.
 var Builtins = []struct {
 	Name    string
 	Builtin *Builtin
 }{
 	{
-		"len", &Builtin{
-			Fn: func(args ...Object) Object {
-				if len(args) != 1 {
-					return &Error{Message: newError("wrong number of arguments. got=%d, want=1", len(args))}
-				}
-				switch arg := args[0].(type) {
-				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
-				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}
-				default:
-					return &Error{Message: newError("argument to `len` not supported, got %s", args[0].Type())}
-				}
-			},
-		},
+		"len",
+		NewBuiltin("len", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{STRING_OBJ, ARRAY_OBJ, BYTES_OBJ, RANGE_OBJ}}}, func(args []Object) Object {
+			switch arg := args[0].(type) {
+			case *String:
+				return GetInteger(int64(len(arg.Value)))
+			case *Bytes:
+				return GetInteger(int64(len(arg.Value)))
+			case *Range:
+				return GetInteger(arg.Len())
+			default:
+				return GetInteger(int64(len(arg.(*Array).Elements)))
+			}
+		}),
 	},
 	{
-		"puts", &Builtin{
-			Fn: func(args ...Object) Object {
-				for _, arg := range args {
-					fmt.Println(arg.Inspect())
-				}
-				return NULL
-			},
-		},
+		"puts",
+		NewBuiltin("puts", ArgSpec{Max: Variadic}, func(args []Object) Object {
+			putsMu.Lock()
+			defer putsMu.Unlock()
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+			return NULL
+		}),
 	},
 	{
 		"first",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return &Error{Message: newError("wrong number of arguments. got=%d, want=1",
-					len(args))}
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return &Error{Message: newError("argument to `first` must be ARRAY, got %s",
-					args[0].Type())}
+		NewBuiltin("first", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			if str, ok := args[0].(*String); ok {
+				if str.Value == "" {
+					return NULL
+				}
+				_, size := utf8.DecodeRuneInString(str.Value)
+				return &String{Value: str.Value[:size]}
 			}
-
 			arr := args[0].(*Array)
 			if len(arr.Elements) > 0 {
 				return arr.Elements[0]
 			}
 
-			return nil
-		},
-		},
+			return NULL
+		}),
 	},
 	{
 		"last",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return &Error{Message: newError("wrong number of arguments. got=%d, want=1",
-					len(args))}
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return &Error{Message: newError("argument to `last` must be ARRAY, got %s",
-					args[0].Type())}
+		NewBuiltin("last", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			if str, ok := args[0].(*String); ok {
+				if str.Value == "" {
+					return NULL
+				}
+				_, size := utf8.DecodeLastRuneInString(str.Value)
+				return &String{Value: str.Value[len(str.Value)-size:]}
 			}
-
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
 				return arr.Elements[length-1]
 			}
 
-			return nil
-		},
-		},
+			return NULL
+		}),
 	},
 	{
 		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return &Error{Message: newError("wrong number of arguments. got=%d, want=1",
-					len(args))}
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return &Error{Message: newError("argument to `rest` must be ARRAY, got %s",
-					args[0].Type())}
+		allocating(NewBuiltin("rest", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			if str, ok := args[0].(*String); ok {
+				if str.Value == "" {
+					return NULL
+				}
+				_, size := utf8.DecodeRuneInString(str.Value)
+				return &String{Value: str.Value[size:]}
 			}
-
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 			if length > 0 {
@@ -96,22 +101,20 @@ var Builtins = []struct {
 				return &Array{Elements: newElements}
 			}
 
-			return nil
-		},
-		},
+			return NULL
+		})),
 	},
 	{
 		"push",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return &Error{Message: newError("wrong number of arguments. got=%d, want=2",
-					len(args))}
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return &Error{Message: newError("argument to `push` must be ARRAY, got %s",
-					args[0].Type())}
+		allocating(NewBuiltin("push", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			// Pushing onto a string concatenates, as + does.
+			if str, ok := args[0].(*String); ok {
+				tail, ok := args[1].(*String)
+				if !ok {
+					return NewError(KindArgument, "push: argument 2 must be STRING for a STRING, got %s", args[1].Type())
+				}
+				return &String{Value: str.Value + tail.Value}
 			}
-
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 
@@ -120,15 +123,553 @@ var Builtins = []struct {
 			newElements[length] = args[1]
 
 			return &Array{Elements: newElements}
-		},
-		},
+		})),
+	},
+	{
+		"is_null",
+		NewBuiltin("is_null", ArgSpec{Min: 1, Max: 1}, func(args []Object) Object {
+			return NativeToBooleanObject(args[0].Type() == NULL_OBJ)
+		}),
+	},
+	{
+		"memo",
+		NewBuiltin("memo", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{FUNCTION_OBJ, BUILTIN_OBJ}}}, func(args []Object) Object {
+			return NewMemoized(args[0])
+		}),
+	},
+	{
+		"format",
+		allocating(NewBuiltin("format", ArgSpec{Min: 1, Max: Variadic, Types: [][]ObjectType{{STRING_OBJ}}}, func(args []Object) Object {
+			formatted, err := formatString(args[0].(*String).Value, args[1:])
+			if err != nil {
+				return &Error{Message: err, Kind: KindArgument}
+			}
+			return &String{Value: formatted}
+		})),
+	},
+	{
+		"insert",
+		allocating(NewBuiltin("insert", ArgSpec{Min: 3, Max: 3, Types: [][]ObjectType{{ARRAY_OBJ}, {INTEGER_OBJ}}}, func(args []Object) Object {
+			arr, idx := args[0].(*Array), args[1].(*Integer).Value
+
+			length := int64(len(arr.Elements))
+			i := normalizeIndex(idx, length)
+			if i < 0 || i > length {
+				return NewError(KindIndexOutOfBounds, "index %d out of range for length %d", idx, length)
+			}
+
+			newElements := make([]Object, 0, length+1)
+			newElements = append(newElements, arr.Elements[:i]...)
+			newElements = append(newElements, args[2])
+			newElements = append(newElements, arr.Elements[i:]...)
+
+			return &Array{Elements: newElements}
+		})),
+	},
+	{
+		"remove",
+		allocating(NewBuiltin("remove", ArgSpec{Min: 2, Max: 3, Types: [][]ObjectType{{ARRAY_OBJ}, {INTEGER_OBJ}, {INTEGER_OBJ}}}, func(args []Object) Object {
+			arr, idx := args[0].(*Array), args[1].(*Integer).Value
+
+			count := int64(1)
+			if len(args) == 3 {
+				count = args[2].(*Integer).Value
+			}
+
+			length := int64(len(arr.Elements))
+			i := normalizeIndex(idx, length)
+			if i < 0 || i >= length {
+				return NewError(KindIndexOutOfBounds, "index %d out of range for length %d", idx, length)
+			}
+			if count < 0 || count > length-i {
+				return NewError(KindIndexOutOfBounds, "count %d from index %d out of range for length %d",
+					count, idx, length)
+			}
+
+			newElements := make([]Object, 0, length-count)
+			newElements = append(newElements, arr.Elements[:i]...)
+			newElements = append(newElements, arr.Elements[i+count:]...)
+
+			return &Array{Elements: newElements}
+		})),
+	},
+	{
+		"slice",
+		allocating(NewBuiltin("slice", ArgSpec{Min: 3, Max: 3, Types: [][]ObjectType{{ARRAY_OBJ, BYTES_OBJ}, {INTEGER_OBJ}, {INTEGER_OBJ}}}, func(args []Object) Object {
+			start, end := args[1].(*Integer).Value, args[2].(*Integer).Value
+
+			b, isBytes := args[0].(*Bytes)
+			var length int64
+			if isBytes {
+				length = int64(len(b.Value))
+			} else {
+				length = int64(len(args[0].(*Array).Elements))
+			}
+			i, j := normalizeIndex(start, length), normalizeIndex(end, length)
+			if i < 0 || j > length || i > j {
+				return NewError(KindIndexOutOfBounds, "slice [%d:%d] out of range for length %d",
+					start, end, length)
+			}
+
+			if isBytes {
+				return &Bytes{Value: bytes.Clone(b.Value[i:j])}
+			}
+			newElements := make([]Object, j-i)
+			copy(newElements, args[0].(*Array).Elements[i:j])
+
+			return &Array{Elements: newElements}
+		})),
+	},
+	{
+		"reverse",
+		allocating(NewBuiltin("reverse", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			if arg, ok := args[0].(*String); ok {
+				runes := []rune(arg.Value)
+				for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+					runes[i], runes[j] = runes[j], runes[i]
+				}
+				return &String{Value: string(runes)}
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			newElements := make([]Object, length)
+			for i, el := range arr.Elements {
+				newElements[length-1-i] = el
+			}
+			return &Array{Elements: newElements}
+		})),
+	},
+	{
+		"unique",
+		allocating(NewBuiltin("unique", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ARRAY_OBJ}}}, func(args []Object) Object {
+			return &Array{Elements: uniqueElements(args[0].(*Array).Elements)}
+		})),
+	},
+	{
+		"exit",
+		NewBuiltin("exit", ArgSpec{Max: 1, Types: [][]ObjectType{{INTEGER_OBJ}}}, func(args []Object) Object {
+			status := &ExitError{}
+			if len(args) == 1 {
+				status.Code = int(args[0].(*Integer).Value)
+			}
+			return &Error{Message: status, Kind: KindExit}
+		}),
+	},
+	{
+		"env",
+		EnvFrom(os.LookupEnv),
+	},
+	{
+		"error",
+		NewBuiltin("error", ArgSpec{Min: 1, Max: 2, Types: [][]ObjectType{{STRING_OBJ}, {STRING_OBJ}}}, func(args []Object) Object {
+			err := &Error{Message: errors.New(args[0].(*String).Value), Kind: KindError, Value: true}
+			if len(args) == 2 {
+				err.Kind = args[1].(*String).Value
+			}
+			return err
+		}),
+	},
+	{
+		"is_error",
+		NewBuiltin("is_error", ArgSpec{Min: 1, Max: 1}, func(args []Object) Object {
+			return NativeToBooleanObject(args[0].Type() == ERROR_OBJ)
+		}),
+	},
+	{
+		"error_message",
+		NewBuiltin("error_message", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ERROR_OBJ}}}, func(args []Object) Object {
+			return &String{Value: args[0].(*Error).Message.Error()}
+		}),
+	},
+	{
+		"error_kind",
+		NewBuiltin("error_kind", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{ERROR_OBJ}}}, func(args []Object) Object {
+			return &String{Value: args[0].(*Error).ErrorKind()}
+		}),
+	},
+	{
+		"bytes",
+		allocating(NewBuiltin("bytes", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{STRING_OBJ}}}, func(args []Object) Object {
+			return &Bytes{Value: []byte(args[0].(*String).Value)}
+		})),
+	},
+	{
+		"to_string",
+		allocating(NewBuiltin("to_string", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{BYTES_OBJ}}}, func(args []Object) Object {
+			return &String{Value: string(args[0].(*Bytes).Value)}
+		})),
+	},
+	{
+		"byte_at",
+		NewBuiltin("byte_at", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{BYTES_OBJ}, {INTEGER_OBJ}}}, func(args []Object) Object {
+			b, idx := args[0].(*Bytes).Value, args[1].(*Integer).Value
+			length := int64(len(b))
+			i := normalizeIndex(idx, length)
+			if i < 0 || i >= length {
+				return NewError(KindIndexOutOfBounds, "index %d out of range for length %d", idx, length)
+			}
+			return GetInteger(int64(b[i]))
+		}),
+	},
+	{
+		"read_file_bytes",
+		allocating(NewBuiltin("read_file_bytes", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{STRING_OBJ}}}, func(args []Object) Object {
+			if ReadFile == nil {
+				return NewError(KindInvalidOperation, "read_file_bytes: reading files is disabled")
+			}
+			data, err := ReadFile(args[0].(*String).Value)
+			if err != nil {
+				return NewError(KindError, "read_file_bytes: %w", err)
+			}
+			return &Bytes{Value: data}
+		})),
+	},
+	{
+		"keys",
+		allocating(NewBuiltin("keys", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{HASH_OBJ}}}, func(args []Object) Object {
+			pairs := args[0].(*Hash).Pairs()
+			keys := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				keys[i] = pair.Key
+			}
+			return &Array{Elements: keys}
+		})),
+	},
+	{
+		"values",
+		allocating(NewBuiltin("values", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{HASH_OBJ}}}, func(args []Object) Object {
+			pairs := args[0].(*Hash).Pairs()
+			values := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				values[i] = pair.Value
+			}
+			return &Array{Elements: values}
+		})),
 	},
+	{
+		"delete",
+		NewBuiltin("delete", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{HASH_OBJ}}}, func(args []Object) Object {
+			hash := args[0].(*Hash)
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return NewError(KindUnhashable, "unusable as hash key: %s", args[1].Type())
+			}
+			if hash.Frozen {
+				return frozenError(hash)
+			}
+			value, ok := hash.Get(key)
+			if !ok {
+				return NULL
+			}
+			hash.Delete(key)
+			return value
+		}),
+	},
+	{
+		"merge",
+		allocating(NewBuiltin("merge", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{HASH_OBJ}, {HASH_OBJ}}}, func(args []Object) Object {
+			a, b := args[0].(*Hash), args[1].(*Hash)
+			merged := NewHash(a.Len() + b.Len())
+			for _, pair := range append(a.Pairs(), b.Pairs()...) {
+				merged.Set(pair.Key.(Hashable), pair.Value)
+			}
+			return merged
+		})),
+	},
+	{
+		"freeze",
+		NewBuiltin("freeze", ArgSpec{Min: 1, Max: 1}, func(args []Object) Object {
+			return Freeze(args[0])
+		}),
+	},
+	{
+		"is_frozen",
+		NewBuiltin("is_frozen", ArgSpec{Min: 1, Max: 1}, func(args []Object) Object {
+			return NativeToBooleanObject(IsFrozen(args[0]))
+		}),
+	},
+	{
+		"help",
+		NewBuiltin("help", ArgSpec{Min: 1, Max: 1}, func(args []Object) Object {
+			fmt.Println(Help(args[0]))
+			return NULL
+		}),
+	},
+	{
+		// Engines that can run a function on another goroutine handle spawn
+		// themselves; this is what the rest see.
+		"spawn",
+		NewBuiltin("spawn", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{FUNCTION_OBJ}}}, func(args []Object) Object {
+			return NewError(KindInvalidOperation, "spawn is not supported by the VM, run with the eval engine")
+		}),
+	},
+	{
+		"channel",
+		NewBuiltin("channel", ArgSpec{Max: 1, Types: [][]ObjectType{{INTEGER_OBJ}}}, func(args []Object) Object {
+			size := int64(0)
+			if len(args) == 1 {
+				size = args[0].(*Integer).Value
+			}
+			if size < 0 {
+				return NewError(KindArgument, "channel: negative buffer size %d", size)
+			}
+			return NewChannel(int(size))
+		}),
+	},
+	{
+		"send",
+		NewBuiltin("send", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{CHANNEL_OBJ}}}, func(args []Object) Object {
+			// The tree walker sends and receives under its evaluation's
+			// context itself; the VM, with no other goroutines, waits here.
+			if err := args[0].(*Channel).Send(context.Background(), args[1]); err != nil {
+				return &Error{Message: err, Kind: ErrorKind(err)}
+			}
+			return NULL
+		}),
+	},
+	{
+		"recv",
+		NewBuiltin("recv", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{CHANNEL_OBJ}}}, func(args []Object) Object {
+			// A background context is never done, so Recv can't fail.
+			if obj, ok, _ := args[0].(*Channel).Recv(context.Background()); ok {
+				return obj
+			}
+			return NULL
+		}),
+	},
+	{
+		"close",
+		NewBuiltin("close", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{CHANNEL_OBJ}}}, func(args []Object) Object {
+			if err := args[0].(*Channel).Close(); err != nil {
+				return err
+			}
+			return NULL
+		}),
+	},
+	{
+		"range",
+		NewBuiltin("range", ArgSpec{Min: 1, Max: 3, Types: [][]ObjectType{{INTEGER_OBJ}, {INTEGER_OBJ}, {INTEGER_OBJ}}}, func(args []Object) Object {
+			// range(end) counts from 0, and range(start, end) in steps of 1.
+			start, end, step := int64(0), args[0].(*Integer).Value, int64(1)
+			if len(args) > 1 {
+				start, end = end, args[1].(*Integer).Value
+			}
+			if len(args) > 2 {
+				step = args[2].(*Integer).Value
+			}
+			r, err := NewRange(start, end, step)
+			if err != nil {
+				return err
+			}
+			return r
+		}),
+	},
+	{
+		"contains",
+		NewBuiltin("contains", ArgSpec{Min: 2, Max: 2, Types: [][]ObjectType{{ARRAY_OBJ, RANGE_OBJ, STRING_OBJ}}}, func(args []Object) Object {
+			switch container := args[0].(type) {
+			case *Array:
+				for _, el := range container.Elements {
+					if Equals(el, args[1]) {
+						return TRUE
+					}
+				}
+				return FALSE
+			case *Range:
+				switch n := args[1].(type) {
+				case *Integer:
+					return NativeToBooleanObject(container.Contains(n.Value))
+				case *Float:
+					return NativeToBooleanObject(n.Value == math.Trunc(n.Value) && math.Abs(n.Value) < math.MaxInt64 && container.Contains(int64(n.Value)))
+				}
+				return FALSE
+			default:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return NewError(KindArgument, "contains: argument 2 must be STRING for a STRING, got %s", args[1].Type())
+				}
+				return NativeToBooleanObject(strings.Contains(container.(*String).Value, sub.Value))
+			}
+		}),
+	},
+	{
+		"to_array",
+		allocating(NewBuiltin("to_array", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{RANGE_OBJ}}}, func(args []Object) Object {
+			r := args[0].(*Range)
+			n := r.Len()
+			if n > MaxRangeArray {
+				return NewError(KindLimitExceeded, "to_array: %s has %d elements, more than the %d an array can take", r.Inspect(), n, MaxRangeArray)
+			}
+			elements := make([]Object, n)
+			for i := range elements {
+				elements[i] = GetInteger(r.At(int64(i)))
+			}
+			return &Array{Elements: elements}
+		})),
+	},
+}
+
+// MaxRangeArray is the most elements to_array makes an array of, since an
+// array, unlike a range, holds every element in memory.
+const MaxRangeArray = 1 << 24
+
+// putsMu keeps what goroutines print with puts from interleaving.
+var putsMu sync.Mutex
+
+// PutsTo returns a puts that prints to w instead of standard output. Calls
+// from different goroutines print one after another.
+func PutsTo(w io.Writer) *Builtin {
+	var mu sync.Mutex
+	return NewBuiltin("puts", ArgSpec{Max: Variadic}, func(args []Object) Object {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, arg := range args {
+			fmt.Fprintln(w, arg.Inspect())
+		}
+		return NULL
+	})
+}
+
+// allocating marks b as returning a new string, array or hash.
+func allocating(b *Builtin) *Builtin {
+	b.Allocates = true
+	return b
+}
+
+// EnvFrom returns an env that reads variables with lookup instead of from
+// the process environment. With a nil lookup every variable reads as unset,
+// for embedders that shouldn't expose the environment to scripts.
+func EnvFrom(lookup func(name string) (string, bool)) *Builtin {
+	return NewBuiltin("env", ArgSpec{Min: 1, Max: 1, Types: [][]ObjectType{{STRING_OBJ}}}, func(args []Object) Object {
+		if lookup == nil {
+			return NULL
+		}
+		if value, ok := lookup(args[0].(*String).Value); ok {
+			return &String{Value: value}
+		}
+		return NULL
+	})
+}
+
+// ReadFile is how read_file_bytes reads files. Embedders can set it to nil
+// to stop scripts reading files, or to a function that confines them.
+var ReadFile = os.ReadFile
+
+// uniqueElements keeps the first occurrence of each element under Equals.
+// Hashable elements are deduplicated by HashKey; the rest fall back to
+// pairwise comparison.
+func uniqueElements(elements []Object) []Object {
+	result := []Object{}
+	seen := make(map[HashKey]bool)
+	var unhashable []Object
+
+	for _, el := range elements {
+		if hashable, ok := el.(Hashable); ok {
+			key := hashable.HashKey()
+			// Equals treats 1 and 1.0 as the same value, so integral floats in
+			// int64 range share the integer key.
+			if f, ok := el.(*Float); ok && f.Value == math.Trunc(f.Value) && f.Value >= -(1<<63) && f.Value < 1<<63 {
+				key = GetInteger(int64(f.Value)).HashKey()
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		} else {
+			duplicate := false
+			for _, other := range unhashable {
+				if Equals(el, other) {
+					duplicate = true
+					break
+				}
+			}
+			if duplicate {
+				continue
+			}
+			unhashable = append(unhashable, el)
+		}
+		result = append(result, el)
+	}
+
+	return result
+}
+
+// normalizeIndex maps a negative index to one counted from the end of a
+// sequence of the given length. The result still needs a bounds check.
+func normalizeIndex(idx, length int64) int64 {
+	if idx < 0 {
+		return idx + length
+	}
+	return idx
 }
 
+// formatString replaces each {} in template with the next argument. Strings
+// are inserted as is, anything else via Inspect. {{ and }} produce literal
+// braces; any other brace is copied unchanged.
+func formatString(template string, args []Object) (string, error) {
+	var out strings.Builder
+	placeholders := 0
+
+	for i := 0; i < len(template); i++ {
+		ch := template[i]
+		var next byte
+		if i+1 < len(template) {
+			next = template[i+1]
+		}
+
+		switch {
+		case ch == '{' && next == '{', ch == '}' && next == '}':
+			out.WriteByte(ch)
+			i++
+		case ch == '{' && next == '}':
+			if placeholders < len(args) {
+				if str, ok := args[placeholders].(*String); ok {
+					out.WriteString(str.Value)
+				} else {
+					out.WriteString(args[placeholders].Inspect())
+				}
+			}
+			placeholders++
+			i++
+		default:
+			out.WriteByte(ch)
+		}
+	}
+
+	if placeholders != len(args) {
+		return "", newError("wrong number of arguments to `format`: %d placeholders, %d arguments",
+			placeholders, len(args))
+	}
+	return out.String(), nil
+}
+
+// ExitError is the error the exit builtin stops a program with. Whoever runs
+// the program decides what exiting means.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ErrorKind() string { return KindExit }
+
 func newError(format string, a ...interface{}) error {
 	return fmt.Errorf(format, a...)
 }
 
+// GetBuiltinName returns the name b is registered under, or "" if it is not in Builtins.
+func GetBuiltinName(b *Builtin) string {
+	for _, def := range Builtins {
+		if def.Builtin == b {
+			return def.Name
+		}
+	}
+	return ""
+}
+
 func GetBuiltinByName(name string) *Builtin {
 	for _, def := range Builtins {
 		if def.Name == name {
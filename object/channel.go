@@ -0,0 +1,59 @@
+package object
+
+import "context"
+
+// Channel carries values between the goroutines spawn runs functions on, as
+// a Go channel does.
+type Channel struct {
+	ch chan Object
+}
+
+// NewChannel returns a channel buffering size values; zero makes each send
+// wait for a receiver.
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "<channel>" }
+
+// Send waits until obj is received or buffered, returning ctx.Err() if ctx is
+// done first. It fails on a closed channel.
+func (c *Channel) Send(ctx context.Context, obj Object) (err error) {
+	// A Go channel panics when sent on once closed, which can't be checked
+	// beforehand without racing the close.
+	defer func() {
+		if recover() != nil {
+			err = NewError(KindInvalidOperation, "send on closed channel")
+		}
+	}()
+	select {
+	case c.ch <- obj:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Recv waits for a value, returning false once the channel is closed and
+// what was sent before has been received, or ctx.Err() if ctx is done first.
+func (c *Channel) Recv(ctx context.Context) (Object, bool, error) {
+	select {
+	case obj, ok := <-c.ch:
+		return obj, ok, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// Close ends the channel: receivers get what was already sent and then
+// nothing. It fails on a channel that is already closed.
+func (c *Channel) Close() (err *Error) {
+	defer func() {
+		if recover() != nil {
+			err = NewError(KindInvalidOperation, "close of closed channel")
+		}
+	}()
+	close(c.ch)
+	return nil
+}
@@ -0,0 +1,150 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ConvertOptions changes how FromGoWith converts a value.
+type ConvertOptions struct {
+	// Freeze freezes the result, so scripts can read it but not modify it.
+	Freeze bool
+}
+
+// FromGoWith is FromGo adjusted by opts.
+func FromGoWith(v any, opts ConvertOptions) (Object, error) {
+	obj, err := FromGo(v)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Freeze {
+		Freeze(obj)
+	}
+	return obj, nil
+}
+
+// FromGo converts a Go value to the object scripts see: nil to null, bools,
+// integers, floats and strings to their own kinds, slices and arrays to
+// arrays, []byte to bytes, and maps to hashes. An Object is returned as it is.
+func FromGo(v any) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	if obj, ok := v.(Object); ok {
+		return obj, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return NativeToBooleanObject(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return GetInteger(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d does not fit in an integer", rv.Uint())
+		}
+		return GetInteger(int64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: rv.Float()}, nil
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return NULL, nil
+		}
+		return FromGo(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return NULL, nil
+		}
+		if b, ok := v.([]byte); ok {
+			return &Bytes{Value: bytes.Clone(b)}, nil
+		}
+		elements := make([]Object, rv.Len())
+		for i := range elements {
+			el, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return NULL, nil
+		}
+		pairs := make([]HashPair, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := FromGo(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := FromGo(iter.Value().Interface())
+			if err != nil {
+				return nil, fmt.Errorf("value of %s: %w", key.Inspect(), err)
+			}
+			pairs = append(pairs, HashPair{Key: hashable, Value: value})
+		}
+		// Go maps have no order, so the hash takes its keys in sorted order.
+		sort.Slice(pairs, func(i, j int) bool {
+			return keyLess(pairs[i].Key, pairs[j].Key)
+		})
+		hash := NewHash(len(pairs))
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(Hashable), pair.Value)
+		}
+		return hash, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T to a Monkey object", v)
+}
+
+// keyLess orders hash keys: booleans, then numbers by value, then strings,
+// then anything else by type and Inspect.
+func keyLess(a, b Object) bool {
+	if ra, rb := keyRank(a), keyRank(b); ra != rb {
+		return ra < rb
+	}
+	switch a := a.(type) {
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+		return float64(a.Value) <= b.(*Float).Value
+	case *Float:
+		// 1 and 1.0 are different keys; the integer goes first.
+		if b, ok := b.(*Integer); ok {
+			return a.Value < float64(b.Value)
+		}
+		return a.Value < b.(*Float).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+func keyRank(key Object) int {
+	switch key.(type) {
+	case *Boolean:
+		return 0
+	case *Integer, *Float:
+		return 1
+	case *String:
+		return 2
+	default:
+		return 3
+	}
+}
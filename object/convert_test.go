@@ -0,0 +1,43 @@
+package object
+
+import "testing"
+
+func TestFromGo(t *testing.T) {
+	type celsius float64
+	n := 3
+	tests := []struct {
+		input any
+		want  string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-4), "-4"},
+		{uint16(7), "7"},
+		{celsius(21.5), "21.5"},
+		{"hi", "hi"},
+		{&n, "3"},
+		{[]any{1, "a", nil}, `[1, "a", null]`},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]int{"a": 1}, `{"a": 1}`},
+		{map[any]bool{"x": true, true: true, 0: true, false: true, -3.5: true}, `{false: true, true: true, -3.5: true, 0: true, "x": true}`},
+		{[]int(nil), "null"},
+		{[]byte("hi"), "<2 bytes: 68 69>"},
+		{&String{Value: "obj"}, "obj"},
+	}
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v): %v", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.want {
+			t.Errorf("FromGo(%#v) = %s, want %s", tt.input, obj.Inspect(), tt.want)
+		}
+	}
+
+	for _, input := range []any{uint64(1 << 63), struct{}{}, map[[1]int]int{{1}: 1}, []any{make(chan int)}} {
+		if _, err := FromGo(input); err == nil {
+			t.Errorf("FromGo(%#v): expected an error", input)
+		}
+	}
+}
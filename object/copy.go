@@ -0,0 +1,70 @@
+package object
+
+// A Copier makes deep copies of values, so that later changes to the
+// originals don't show in the copies. It copies arrays and hashes and shares
+// everything else, which can't be modified; frozen arrays and hashes are
+// shared too. A value reached twice is copied once, so copies made by the
+// same Copier alias each other as the originals did.
+//
+// Copying costs time and memory in proportion to the elements and pairs
+// copied. Limit, when positive, caps how many a Copier copies in all.
+type Copier struct {
+	Limit int
+
+	copied int
+	seen   map[Object]Object
+}
+
+// Copy returns a deep copy of obj, failing once the Copier has copied more
+// than Limit elements and pairs.
+func (c *Copier) Copy(obj Object) (Object, error) {
+	if IsFrozen(obj) {
+		return obj, nil
+	}
+	if copied, ok := c.seen[obj]; ok {
+		return copied, nil
+	}
+	if c.seen == nil {
+		c.seen = map[Object]Object{}
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		if err := c.count(len(obj.Elements)); err != nil {
+			return nil, err
+		}
+		copied := &Array{Elements: make([]Object, len(obj.Elements))}
+		c.seen[obj] = copied
+		for i, el := range obj.Elements {
+			el, err := c.Copy(el)
+			if err != nil {
+				return nil, err
+			}
+			copied.Elements[i] = el
+		}
+		return copied, nil
+	case *Hash:
+		if err := c.count(obj.Len()); err != nil {
+			return nil, err
+		}
+		copied := NewHash(obj.Len())
+		c.seen[obj] = copied
+		for _, pair := range obj.Pairs() {
+			value, err := c.Copy(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			copied.Set(pair.Key.(Hashable), value)
+		}
+		return copied, nil
+	}
+	return obj, nil
+}
+
+func (c *Copier) count(n int) error {
+	c.copied += n
+	if c.Limit > 0 && c.copied > c.Limit {
+		return NewError(KindLimitExceeded, "too large to copy: more than %d elements and pairs", c.Limit)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package object
+
+import "testing"
+
+func TestCopier(t *testing.T) {
+	inner := &Array{Elements: []Object{GetInteger(1)}}
+	frozen := Freeze(&Array{Elements: []Object{GetInteger(2)}})
+	hash := NewHash(1)
+	hash.Set(&String{Value: "inner"}, inner)
+	outer := &Array{Elements: []Object{inner, hash, frozen}}
+
+	c := &Copier{}
+	copied, err := c.Copy(outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.Elements[0] = GetInteger(9)
+
+	elements := copied.(*Array).Elements
+	if got := copied.Inspect(); got != `[[1], {"inner": [1]}, [2]]` {
+		t.Errorf("copy changed with the original: %s", got)
+	}
+	if value, _ := elements[1].(*Hash).Get(&String{Value: "inner"}); value != elements[0] {
+		t.Error("the copies of inner don't alias each other")
+	}
+	if elements[2] != frozen {
+		t.Error("the frozen array was copied")
+	}
+
+	if _, err := (&Copier{Limit: 4}).Copy(outer); err == nil {
+		t.Error("expected copying 5 elements and pairs to fail with a limit of 4")
+	}
+}
@@ -1,8 +1,16 @@
 package object
 
+import (
+	"sort"
+	"sync"
+)
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// mu is only set by NewSyncEnvironment; plain environments skip locking.
+	mu *sync.RWMutex
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -15,8 +23,54 @@ func NewEnvironment() *Environment {
 	return &Environment{store: make(map[string]Object)}
 }
 
+// NewSyncEnvironment returns an environment that is safe for concurrent use,
+// such as globals shared by several evaluations. Environments enclosing it are
+// still plain and must each be used by a single goroutine.
+func NewSyncEnvironment() *Environment {
+	env := NewEnvironment()
+	env.mu = &sync.RWMutex{}
+	return env
+}
+
+// Share makes e and the environments around it safe for concurrent use, as
+// NewSyncEnvironment's are, so a function closing over them can run on
+// another goroutine. Call it before any other goroutine uses them.
+func (e *Environment) Share() {
+	for env := e; env != nil; env = env.outer {
+		if env.mu == nil {
+			env.mu = &sync.RWMutex{}
+		}
+	}
+}
+
+func (e *Environment) rlock() {
+	if e.mu != nil {
+		e.mu.RLock()
+	}
+}
+
+func (e *Environment) runlock() {
+	if e.mu != nil {
+		e.mu.RUnlock()
+	}
+}
+
+func (e *Environment) lock() {
+	if e.mu != nil {
+		e.mu.Lock()
+	}
+}
+
+func (e *Environment) unlock() {
+	if e.mu != nil {
+		e.mu.Unlock()
+	}
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
+	e.rlock()
 	obj, ok := e.store[name]
+	e.runlock()
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -24,6 +78,138 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, value Object) Object {
+	e.lock()
+	defer e.unlock()
 	e.store[name] = value
 	return value
 }
+
+// Assign rebinds name in the innermost scope that defines it, reporting false
+// when no scope does.
+func (e *Environment) Assign(name string, value Object) bool {
+	e.lock()
+	_, ok := e.store[name]
+	if ok {
+		e.store[name] = value
+	}
+	e.unlock()
+
+	if !ok && e.outer != nil {
+		return e.outer.Assign(name, value)
+	}
+	return ok
+}
+
+// Names returns the sorted names bound in this scope. Outer scopes are not included.
+func (e *Environment) Names() []string {
+	e.rlock()
+	defer e.runlock()
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// All returns a copy of the bindings in this scope. Outer scopes are not included.
+func (e *Environment) All() map[string]Object {
+	e.rlock()
+	defer e.runlock()
+	all := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		all[name] = value
+	}
+	return all
+}
+
+// Delete removes a binding from this scope only, reporting whether it existed.
+func (e *Environment) Delete(name string) bool {
+	e.lock()
+	defer e.unlock()
+	if _, ok := e.store[name]; !ok {
+		return false
+	}
+	delete(e.store, name)
+	return true
+}
+
+// Outer returns the enclosing scope, or nil for the outermost one.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// EnvironmentSnapshot is a checkpoint of a single scope, created by Snapshot.
+type EnvironmentSnapshot struct {
+	store map[string]Object
+}
+
+// Snapshot captures the bindings of this scope only; outer scopes are not captured.
+// The copy is shallow: bound objects are shared, only the set of bindings is saved.
+func (e *Environment) Snapshot() EnvironmentSnapshot {
+	return EnvironmentSnapshot{store: e.All()}
+}
+
+// Restore replaces the bindings of this scope with those captured by Snapshot,
+// discarding anything added or changed since.
+func (e *Environment) Restore(s EnvironmentSnapshot) {
+	e.lock()
+	defer e.unlock()
+	e.store = make(map[string]Object, len(s.store))
+	for name, value := range s.store {
+		e.store[name] = value
+	}
+}
+
+// EnvironmentState is a deep checkpoint of a scope and every scope around it,
+// created by Checkpoint.
+type EnvironmentState struct {
+	scopes []*Environment
+	stores []map[string]Object
+}
+
+// Checkpoint captures the bindings of this scope and its outer scopes, with
+// the bound values deep copied by c, so that changes made afterwards to
+// arrays and hashes they hold don't show when the checkpoint is restored.
+func (e *Environment) Checkpoint(c *Copier) (EnvironmentState, error) {
+	var state EnvironmentState
+	for scope := e; scope != nil; scope = scope.outer {
+		store, err := copyStore(scope.All(), c)
+		if err != nil {
+			return EnvironmentState{}, err
+		}
+		state.scopes = append(state.scopes, scope)
+		state.stores = append(state.stores, store)
+	}
+	return state, nil
+}
+
+// Rollback puts back the bindings Checkpoint captured in each scope,
+// discarding anything added or changed since. The values are copied again by
+// c, so the checkpoint can be rolled back to more than once.
+func (s EnvironmentState) Rollback(c *Copier) error {
+	stores := make([]map[string]Object, len(s.stores))
+	for i, store := range s.stores {
+		copied, err := copyStore(store, c)
+		if err != nil {
+			return err
+		}
+		stores[i] = copied
+	}
+	for i, scope := range s.scopes {
+		scope.Restore(EnvironmentSnapshot{store: stores[i]})
+	}
+	return nil
+}
+
+func copyStore(store map[string]Object, c *Copier) (map[string]Object, error) {
+	copied := make(map[string]Object, len(store))
+	for name, value := range store {
+		value, err := c.Copy(value)
+		if err != nil {
+			return nil, err
+		}
+		copied[name] = value
+	}
+	return copied, nil
+}
@@ -0,0 +1,128 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEnvironmentNamesShadowed(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	outer.Set("a", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 3})
+	inner.Set("b", &Integer{Value: 4})
+
+	if got := outer.Names(); !reflect.DeepEqual(got, []string{"a", "x"}) {
+		t.Errorf("outer.Names() wrong. got=%v", got)
+	}
+	if got := inner.Names(); !reflect.DeepEqual(got, []string{"b", "x"}) {
+		t.Errorf("inner.Names() wrong. got=%v", got)
+	}
+	if inner.Outer() != outer {
+		t.Errorf("inner.Outer() is not outer")
+	}
+}
+
+func TestEnvironmentAllIsCopy(t *testing.T) {
+	env := NewEnvironment()
+	env.Set("x", &Integer{Value: 1})
+
+	all := env.All()
+	all["y"] = &Integer{Value: 2}
+
+	if _, ok := env.Get("y"); ok {
+		t.Errorf("mutating All() result changed the environment")
+	}
+	if len(all) != 2 {
+		t.Errorf("All() wrong length. got=%d", len(all))
+	}
+}
+
+func TestEnvironmentDelete(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("x", &Integer{Value: 2})
+
+	if !inner.Delete("x") {
+		t.Fatalf("Delete of existing name returned false")
+	}
+	if inner.Delete("x") {
+		t.Fatalf("Delete of name only bound in outer scope returned true")
+	}
+
+	val, ok := inner.Get("x")
+	if !ok {
+		t.Fatalf("outer binding was removed")
+	}
+	if val.(*Integer).Value != 1 {
+		t.Errorf("wrong value after delete. got=%d", val.(*Integer).Value)
+	}
+}
+
+func TestEnvironmentSnapshotRestore(t *testing.T) {
+	outer := NewEnvironment()
+	env := NewEnclosedEnvironment(outer)
+	env.Set("x", &Integer{Value: 1})
+
+	snap := env.Snapshot()
+
+	env.Set("x", &Integer{Value: 2})
+	env.Set("y", &Integer{Value: 3})
+	outer.Set("z", &Integer{Value: 4})
+
+	env.Restore(snap)
+
+	if got := env.Names(); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("Names() after Restore wrong. got=%v", got)
+	}
+	if val, _ := env.Get("x"); val.(*Integer).Value != 1 {
+		t.Errorf("x not restored. got=%d", val.(*Integer).Value)
+	}
+	if _, ok := env.Get("z"); !ok {
+		t.Errorf("outer scope was affected by Restore")
+	}
+
+	// The snapshot must stay usable after being restored once.
+	env.Set("w", &Integer{Value: 5})
+	env.Restore(snap)
+	if _, ok := env.Get("w"); ok {
+		t.Errorf("second Restore kept binding added after the snapshot")
+	}
+}
+
+func TestSyncEnvironmentConcurrentUse(t *testing.T) {
+	globals := NewSyncEnvironment()
+	globals.Set("limit", &Integer{Value: 100})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			local := NewEnclosedEnvironment(globals)
+			for j := 0; j < 100; j++ {
+				limit, ok := local.Get("limit")
+				if !ok || limit.(*Integer).Value != 100 {
+					t.Errorf("shared global not visible from goroutine %d", i)
+					return
+				}
+				local.Set("j", &Integer{Value: int64(j)})
+				local.Names()
+			}
+			globals.Names()
+			globals.Set(fmt.Sprintf("done%d", i), TRUE)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(globals.Names()); got != 101 {
+		t.Errorf("wrong number of globals after concurrent writes. got=%d", got)
+	}
+}
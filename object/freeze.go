@@ -0,0 +1,45 @@
+package object
+
+// Freeze marks obj, and every array and hash reachable from it, as frozen,
+// and returns obj. Index assignment and builtins that would modify a frozen
+// value fail instead; operations that build a new value, such as push, merge
+// and +, still work and give an unfrozen result.
+func Freeze(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Array:
+		if obj.Frozen {
+			return obj
+		}
+		obj.Frozen = true
+		for _, el := range obj.Elements {
+			Freeze(el)
+		}
+	case *Hash:
+		if obj.Frozen {
+			return obj
+		}
+		obj.Frozen = true
+		for _, pair := range obj.pairs {
+			Freeze(pair.Key)
+			Freeze(pair.Value)
+		}
+	}
+	return obj
+}
+
+// IsFrozen reports whether obj can't be modified: arrays and hashes once
+// frozen, and every other value, since none of them can be modified at all.
+func IsFrozen(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Frozen
+	case *Hash:
+		return obj.Frozen
+	default:
+		return true
+	}
+}
+
+func frozenError(obj Object) *Error {
+	return NewError(KindInvalidOperation, "cannot modify frozen %s", obj.Type())
+}
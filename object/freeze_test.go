@@ -0,0 +1,55 @@
+package object
+
+import "testing"
+
+func TestFreeze(t *testing.T) {
+	inner := &Array{Elements: []Object{GetInteger(1)}}
+	key := &String{Value: "list"}
+	hash := NewHash(1)
+	hash.Set(key, inner)
+
+	if Freeze(hash) != hash {
+		t.Fatal("Freeze didn't return its argument")
+	}
+	if !hash.Frozen || !inner.Frozen {
+		t.Fatalf("nested values not frozen: hash %t, array %t", hash.Frozen, inner.Frozen)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"array index", SetIndex(inner, GetInteger(0), NULL)},
+		{"hash key", SetIndex(hash, key, NULL)},
+	}
+	for _, tt := range tests {
+		if ErrorKind(tt.err) != KindInvalidOperation {
+			t.Errorf("%s: got %v, want an invalid_operation error", tt.name, tt.err)
+		}
+	}
+	if got := GetBuiltinByName("delete").Fn(hash, key); got.Type() != ERROR_OBJ {
+		t.Errorf("delete: got %s, want an error", got.Inspect())
+	}
+	if got := hash.Inspect(); got != `{"list": [1]}` {
+		t.Errorf("frozen hash changed: %s", got)
+	}
+}
+
+func TestFromGoFrozen(t *testing.T) {
+	obj, err := FromGoWith(map[string][]int{"a": {1}}, ConvertOptions{Freeze: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ := obj.(*Hash).Get(&String{Value: "a"})
+	if !IsFrozen(obj) || !IsFrozen(list) {
+		t.Errorf("FromGoWith with Freeze gave %s, frozen %t and %t", obj.Inspect(), IsFrozen(obj), IsFrozen(list))
+	}
+
+	obj, err = FromGo([]int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsFrozen(obj) {
+		t.Error("FromGo froze its result")
+	}
+}
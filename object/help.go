@@ -0,0 +1,34 @@
+package object
+
+// Help describes obj for the help builtin: a function's signature followed by
+// its doc comment, a builtin's signature, or any other value's type.
+func Help(obj Object) string {
+	switch obj := obj.(type) {
+	case *Function:
+		params := make([]string, len(obj.Parameters))
+		for i, param := range obj.Parameters {
+			params[i] = param.Value
+		}
+		return withDoc(signature(params), obj.Doc)
+	case *CompiledFunction:
+		return withDoc(signature(obj.Parameters), obj.Doc)
+	case *Closure:
+		return Help(obj.Fn)
+	case *Memoized:
+		return Help(obj.Fn)
+	case *Builtin:
+		if obj.Spec == nil {
+			return "builtin function"
+		}
+		return obj.Spec.Signature(obj.Name)
+	default:
+		return string(obj.Type())
+	}
+}
+
+func withDoc(sig, doc string) string {
+	if doc == "" {
+		return sig + "\nno documentation"
+	}
+	return sig + "\n" + doc
+}
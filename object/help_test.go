@@ -0,0 +1,28 @@
+package object
+
+import (
+	"monkey/ast"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	params := []*ast.Identifier{{Value: "a"}, {Value: "b"}}
+	documented := &Function{Parameters: params, Doc: "Adds a and b."}
+
+	tests := []struct {
+		obj  Object
+		want string
+	}{
+		{documented, "fn(a, b)\nAdds a and b."},
+		{&Function{Parameters: params}, "fn(a, b)\nno documentation"},
+		{&Closure{Fn: &CompiledFunction{Parameters: []string{"x"}, Doc: "Doubles x."}}, "fn(x)\nDoubles x."},
+		{&Memoized{Fn: documented}, "fn(a, b)\nAdds a and b."},
+		{&Builtin{}, "builtin function"},
+		{GetInteger(1), "INTEGER"},
+	}
+	for _, tt := range tests {
+		if got := Help(tt.obj); got != tt.want {
+			t.Errorf("Help(%s) = %q, want %q", tt.obj.Inspect(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package object
+
+import (
+	"monkey/token"
+	"time"
+)
+
+// EvalHooks let a program embedding Monkey observe evaluation, such as to log
+// it. Each hook is optional; engines check for nil before calling one, so
+// leaving them unset costs nothing.
+type EvalHooks struct {
+	// OnCall is called as a function or builtin is called, with its name,
+	// empty for an anonymous function, and the number of arguments.
+	OnCall func(name string, argc int)
+	// OnError is called with the error a program fails with and where it
+	// happened, or a zero Position when the engine doesn't know.
+	OnError func(err error, pos token.Position)
+	// OnComplete is called when a program finishes, whether or not it failed.
+	OnComplete func(stats Stats)
+}
+
+// Stats describe one run of a program.
+type Stats struct {
+	// Steps is the nodes the tree walker evaluated or the instructions the
+	// VM ran.
+	Steps int
+	// MaxDepth is the deepest nesting of function calls. The VM doesn't
+	// count tail calls, which reuse their caller's frame.
+	MaxDepth int
+	Bytes    int // allocated by strings, arrays and hashes, by SizeOf
+	Duration time.Duration
+}
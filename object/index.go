@@ -0,0 +1,90 @@
+package object
+
+// Index is the indexing rule shared by both engines. Arrays take an integer
+// and error when it is out of range, as do bytes, which give the byte as an
+// integer, and ranges, which work the element out. Hashes take any Hashable
+// key and give NULL when it is missing, and modules take a member name.
+func Index(left, index Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		length := int64(len(left.Elements))
+		if i.Value < 0 || i.Value >= length {
+			return nil, NewError(KindIndexOutOfBounds, "index %d out of range for length %d", i.Value, length)
+		}
+		return left.Elements[i.Value], nil
+	case *Bytes:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		length := int64(len(left.Value))
+		if i.Value < 0 || i.Value >= length {
+			return nil, NewError(KindIndexOutOfBounds, "index %d out of range for length %d", i.Value, length)
+		}
+		return GetInteger(int64(left.Value[i.Value])), nil
+	case *Range:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		length := left.Len()
+		if i.Value < 0 || i.Value >= length {
+			return nil, NewError(KindIndexOutOfBounds, "index %d out of range for length %d", i.Value, length)
+		}
+		return GetInteger(left.At(i.Value)), nil
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return nil, NewError(KindUnhashable, "unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.Get(key)
+		if !ok {
+			return NULL, nil
+		}
+		return value, nil
+	case *Module:
+		if name, ok := index.(*String); ok {
+			return left.Member(name.Value)
+		}
+	}
+
+	return nil, NewError(KindTypeMismatch, "index operator not supported: %s[%s]", left.Type(), index.Type())
+}
+
+// SetIndex is the index assignment rule shared by both engines. It mutates an
+// array element in place, erroring when the index is out of range, or adds or
+// replaces a hash pair. Frozen arrays and hashes can't be assigned to.
+func SetIndex(left, index, value Object) error {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		if left.Frozen {
+			return frozenError(left)
+		}
+		length := int64(len(left.Elements))
+		if i.Value < 0 || i.Value >= length {
+			return NewError(KindIndexOutOfBounds, "%s index %d out of range for length %d", left.Type(), i.Value, length)
+		}
+		left.Elements[i.Value] = value
+		return nil
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError(KindUnhashable, "unusable as %s key: %s", left.Type(), index.Type())
+		}
+		if left.Frozen {
+			return frozenError(left)
+		}
+		left.Set(key, value)
+		return nil
+	}
+
+	return NewError(KindTypeMismatch, "index assignment not supported: %s[%s]", left.Type(), index.Type())
+}
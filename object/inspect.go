@@ -0,0 +1,130 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxInspectDepth is how many arrays and hashes deep Inspect descends before
+// printing [...] or {...} in place of the rest.
+const MaxInspectDepth = 32
+
+// InspectOptions changes how InspectWith renders a value.
+type InspectOptions struct {
+	// Verbose prints the whole body of a function rather than fn(a) {...}.
+	Verbose bool
+	// Limit is how many elements of an array or pairs of a hash are printed
+	// before the rest are summed up. Zero prints them all.
+	Limit int
+	// Quote quotes a string on its own, as strings inside arrays and hashes
+	// always are.
+	Quote bool
+	// Decorate, if set, is given the text of each value other than an array,
+	// hash or function, and returns what to print instead. Renderers use it
+	// to mark values up, such as with colors.
+	Decorate func(obj Object, text string) string
+}
+
+// InspectWith renders obj as Inspect does, adjusted by opts. Strings inside
+// arrays and hashes are quoted, hash pairs are printed in insertion order, and an
+// array or hash that contains itself prints as [...] or {...} where it
+// recurs.
+func InspectWith(obj Object, opts InspectOptions) string {
+	p := &inspector{opts: opts, open: make(map[Object]bool)}
+	if str, ok := obj.(*String); ok && !opts.Quote {
+		return p.decorate(str, str.Value)
+	}
+	p.write(obj)
+	return p.out.String()
+}
+
+// InspectVerbose is Inspect with function bodies printed in full.
+func InspectVerbose(obj Object) string {
+	return InspectWith(obj, InspectOptions{Verbose: true})
+}
+
+type inspector struct {
+	out  bytes.Buffer
+	opts InspectOptions
+	// open holds the arrays and hashes being printed, to catch cycles.
+	open map[Object]bool
+}
+
+func (p *inspector) write(obj Object) {
+	switch obj := obj.(type) {
+	case *String:
+		p.out.WriteString(p.decorate(obj, strconv.Quote(obj.Value)))
+	case *Array:
+		if p.open[obj] || len(p.open) >= MaxInspectDepth {
+			p.out.WriteString("[...]")
+			return
+		}
+		p.open[obj] = true
+		defer delete(p.open, obj)
+
+		p.out.WriteString("[")
+		for i, el := range obj.Elements {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			if i == p.opts.Limit && p.opts.Limit > 0 {
+				fmt.Fprintf(&p.out, "... (%d more elements)", len(obj.Elements)-i)
+				break
+			}
+			p.write(el)
+		}
+		p.out.WriteString("]")
+	case *Hash:
+		if p.open[obj] || len(p.open) >= MaxInspectDepth {
+			p.out.WriteString("{...}")
+			return
+		}
+		p.open[obj] = true
+		defer delete(p.open, obj)
+
+		p.out.WriteString("{")
+		pairs := obj.Pairs()
+		for i, pair := range pairs {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			if i == p.opts.Limit && p.opts.Limit > 0 {
+				fmt.Fprintf(&p.out, "... (%d more pairs)", len(pairs)-i)
+				break
+			}
+			p.write(pair.Key)
+			p.out.WriteString(": ")
+			p.write(pair.Value)
+		}
+		p.out.WriteString("}")
+	case *Function:
+		params := make([]string, len(obj.Parameters))
+		for i, param := range obj.Parameters {
+			params[i] = param.Value
+		}
+		p.out.WriteString(signature(params))
+		if p.opts.Verbose {
+			p.out.WriteString(" {" + obj.Body.String() + "\n}")
+		} else {
+			p.out.WriteString(" {...}")
+		}
+	case *Memoized:
+		p.write(obj.Fn)
+	default:
+		p.out.WriteString(p.decorate(obj, obj.Inspect()))
+	}
+}
+
+func (p *inspector) decorate(obj Object, text string) string {
+	if p.opts.Decorate == nil {
+		return text
+	}
+	return p.opts.Decorate(obj, text)
+}
+
+// signature renders a function's parameters as fn(a, b).
+func signature(params []string) string {
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
@@ -0,0 +1,90 @@
+package object
+
+import (
+	"monkey/ast"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	str := func(v string) Object { return &String{Value: v} }
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return h
+	}
+
+	cyclic := &Array{Elements: []Object{GetInteger(1), nil}}
+	cyclic.Elements[1] = cyclic
+	me := &String{Value: "me"}
+	selfHash := hash(me, NULL)
+	selfHash.Set(me, selfHash)
+	shared := &Array{Elements: []Object{GetInteger(0)}}
+	nested := Object(&Array{})
+	for i := 0; i < MaxInspectDepth+5; i++ {
+		nested = &Array{Elements: []Object{nested}}
+	}
+
+	tests := []struct {
+		obj  Object
+		want string
+	}{
+		{str("plain"), "plain"},
+		{&Array{Elements: []Object{GetInteger(1), str("1")}}, `[1, "1"]`},
+		{&Array{Elements: []Object{str("tab\there"), str(`q"uote`), str("new\nline")}}, `["tab\there", "q\"uote", "new\nline"]`},
+		{hash(str("b"), GetInteger(1), str("a"), GetInteger(2)), `{"b": 1, "a": 2}`},
+		{hash(GetInteger(10), NULL, &Float{Value: 1}, NULL, GetInteger(1), NULL, GetInteger(-3), NULL), `{10: null, 1.0: null, 1: null, -3: null}`},
+		{cyclic, "[1, [...]]"},
+		{selfHash, `{"me": {...}}`},
+		{&Array{Elements: []Object{shared, shared}}, "[[0], [0]]"},
+		{nested, strings.Repeat("[", MaxInspectDepth) + "[...]" + strings.Repeat("]", MaxInspectDepth)},
+		{&CompiledFunction{Parameters: []string{"a", "b"}}, "fn(a, b) {...}"},
+		{&Closure{Fn: &CompiledFunction{}}, "fn() {...}"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.want {
+			t.Errorf("Inspect() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestInspectFunctions(t *testing.T) {
+	fn := &Function{
+		Parameters: []*ast.Identifier{{Value: "a"}, {Value: "b"}},
+		Body:       &ast.BlockStatement{},
+	}
+	if got := fn.Inspect(); got != "fn(a, b) {...}" {
+		t.Errorf("Inspect() = %s", got)
+	}
+	if got := NewMemoized(fn).Inspect(); got != "fn(a, b) {...}" {
+		t.Errorf("memoized Inspect() = %s", got)
+	}
+	if got := InspectVerbose(&Array{Elements: []Object{fn}}); got != "[fn(a, b) {\n}]" {
+		t.Errorf("InspectVerbose() = %q", got)
+	}
+}
+
+func TestInspectWith(t *testing.T) {
+	arr := &Array{Elements: []Object{GetInteger(1), GetInteger(2), GetInteger(3)}}
+	hash := NewHash(2)
+	hash.Set(GetInteger(1), TRUE)
+	hash.Set(GetInteger(2), TRUE)
+	tests := []struct {
+		obj  Object
+		opts InspectOptions
+		want string
+	}{
+		{&String{Value: "5"}, InspectOptions{Quote: true}, `"5"`},
+		{arr, InspectOptions{Limit: 2}, "[1, 2, ... (1 more elements)]"},
+		{arr, InspectOptions{Limit: 3}, "[1, 2, 3]"},
+		{hash, InspectOptions{Limit: 1}, "{1: true, ... (1 more pairs)}"},
+	}
+	for _, tt := range tests {
+		if got := InspectWith(tt.obj, tt.opts); got != tt.want {
+			t.Errorf("InspectWith(%+v) = %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+}
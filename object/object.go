@@ -2,18 +2,25 @@ package object
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/suggest"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	LOOP_SIGNAL_OBJ       = "LOOP_SIGNAL"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -21,7 +28,11 @@ const (
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
-	CLOSURE_OBJ           = "CLOSURE"
+	MODULE_OBJ            = "MODULE"
+	BYTES_OBJ             = "BYTES"
+	CHANNEL_OBJ           = "CHANNEL"
+	RANGE_OBJ             = "RANGE"
+	BIG_INTEGER_OBJ       = "BIG_INTEGER"
 )
 
 var (
@@ -40,6 +51,8 @@ type (
 
 // INTEGER
 
+// Integer values are immutable: small integers are shared through GetInteger,
+// so Value must never be assigned after construction.
 type Integer struct {
 	Value int64
 }
@@ -47,6 +60,43 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1024
+)
+
+var cachedIntegers = func() []*Integer {
+	integers := make([]*Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range integers {
+		integers[i] = &Integer{Value: int64(i + minCachedInteger)}
+	}
+	return integers
+}()
+
+// GetInteger returns an Integer for v, sharing one instance per value in the
+// range -128..1024 to avoid allocating for common results.
+func GetInteger(v int64) *Integer {
+	if v >= minCachedInteger && v <= maxCachedInteger {
+		return cachedIntegers[v-minCachedInteger]
+	}
+	return &Integer{Value: v}
+}
+
+// FLOAT
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") { // Keep 1.0 distinguishable from 1
+		s += ".0"
+	}
+	return s
+}
+
 // BOOLEAN
 
 type Boolean struct {
@@ -72,79 +122,259 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// LOOP SIGNAL
+
+// LoopSignal unwinds a loop body to its enclosing loop on break or continue.
+type LoopSignal struct {
+	Break bool
+}
+
+func (ls *LoopSignal) Type() ObjectType { return LOOP_SIGNAL_OBJ }
+func (ls *LoopSignal) Inspect() string {
+	if ls.Break {
+		return "break"
+	}
+	return "continue"
+}
+
+var (
+	BREAK    = &LoopSignal{Break: true}
+	CONTINUE = &LoopSignal{Break: false}
+)
+
 // ERROR
 
+// Kinds of error, as error_kind reports them.
+const (
+	KindError               = "error" // made by error(), or not classified
+	KindTypeMismatch        = "type_mismatch"
+	KindUndefinedIdentifier = "undefined_identifier"
+	KindIndexOutOfBounds    = "index_out_of_bounds"
+	KindDivisionByZero      = "division_by_zero"
+	KindArgument            = "argument"
+	KindNotCallable         = "not_callable"
+	KindUnhashable          = "unhashable"
+	KindInvalidOperation    = "invalid_operation"
+	KindLimitExceeded       = "limit_exceeded"
+	KindOverflow            = "overflow"
+	KindExit                = "exit"
+	KindInternal            = "internal"
+)
+
+// Error is what a builtin returns to fail, which the engine raises, and the
+// error values scripts handle, which have Value set.
 type Error struct {
 	Message error
+	Kind    string // "" means KindError
+	Value   bool
+}
+
+// NewError returns a failure of the given kind.
+func NewError(kind, format string, a ...any) *Error {
+	return &Error{Message: fmt.Errorf(format, a...), Kind: kind}
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message.Error() }
 
+// Error makes a failure a Go error, so engines can return it as it is.
+func (e *Error) Error() string { return e.Message.Error() }
+func (e *Error) Unwrap() error { return e.Message }
+
+func (e *Error) ErrorKind() string {
+	if e.Kind == "" {
+		return KindError
+	}
+	return e.Kind
+}
+
+// ErrorKind returns the kind of err: that of the first error in its chain
+// with an ErrorKind method, or KindError if none has one.
+func ErrorKind(err error) string {
+	var kinded interface{ ErrorKind() string }
+	if errors.As(err, &kinded) {
+		return kinded.ErrorKind()
+	}
+	return KindError
+}
+
 // FUNCTION
 
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // the name it was let to, if any
+	Doc        string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
-func (f *Function) Inspect() string {
+func (f *Function) Inspect() string  { return InspectWith(f, InspectOptions{}) }
+
+// MEMOIZED FUNCTION
+
+// Memoized wraps a callable with a result cache keyed on its arguments. Calls
+// are routed through the engine, which calls Fn on a miss: a Function or
+// Builtin in the tree walker, a Closure or Builtin in the VM. Calls whose
+// arguments are not all Hashable bypass the cache. Each wrapper owns its own
+// cache, which is safe to share with spawned tasks.
+type Memoized struct {
+	Fn     Object
+	mu     sync.Mutex
+	cache  map[string]Object
+	hits   int
+	misses int
+}
+
+func NewMemoized(fn Object) *Memoized {
+	return &Memoized{Fn: fn, cache: make(map[string]Object)}
+}
+
+func (m *Memoized) Type() ObjectType { return FUNCTION_OBJ }
+func (m *Memoized) Inspect() string  { return m.Fn.Inspect() }
+
+// CacheKey builds the cache key for args, reporting false if any argument is unhashable.
+func (m *Memoized) CacheKey(args []Object) (string, bool) {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for _, arg := range args {
+		hashable, ok := arg.(Hashable)
+		if !ok {
+			return "", false
+		}
+		key := hashable.HashKey()
+		fmt.Fprintf(&out, "%s:%d;", key.Type, key.Value)
 	}
 
-	out.WriteString("fn(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {" + f.Body.String() + "\n}")
+	return out.String(), true
+}
 
-	return out.String()
+func (m *Memoized) Lookup(key string) (Object, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.cache[key]
+	if ok {
+		m.hits++
+	} else {
+		m.misses++
+	}
+	return value, ok
+}
+
+func (m *Memoized) Store(key string, value Object) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cache[key] = value
+}
+
+// Stats reports how many lookups hit and missed the cache.
+func (m *Memoized) Stats() (hits, misses int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hits, m.misses
+}
+
+// MODULE
+
+// Module is a named namespace. Every binding in Env is a member.
+type Module struct {
+	Name string
+	Env  *Environment
+}
+
+// NewModule groups bindings under name, for example to expose host builtins.
+func NewModule(name string, bindings map[string]Object) *Module {
+	env := NewEnvironment()
+	for k, v := range bindings {
+		env.Set(k, v)
+	}
+	return &Module{Name: name, Env: env}
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// Member looks up name, suggesting a member within one edit if it is missing.
+func (m *Module) Member(name string) (Object, error) {
+	if value, ok := m.Env.Get(name); ok {
+		return value, nil
+	}
+	if closest, ok := suggest.Closest(name, m.Env.Names(), 1); ok {
+		return nil, fmt.Errorf("module %q has no member %q, did you mean %q?", m.Name, name, closest)
+	}
+	return nil, fmt.Errorf("module %q has no member %q", m.Name, name)
 }
 
 // STRING
 
+// String values are immutable, which lets HashKey be computed once.
 type String struct {
 	Value string
+
+	hashOnce sync.Once
+	hashKey  HashKey
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// BYTES
+
+// Bytes is binary data, which unlike a String is never treated as text.
+// Like strings, Bytes values are never modified.
+type Bytes struct {
+	Value []byte
+}
+
+// bytesPreview is how many bytes Inspect shows.
+const bytesPreview = 16
+
+func (b *Bytes) Type() ObjectType { return BYTES_OBJ }
+
+// Inspect shows the length and the first bytes in hex: <3 bytes: 61 62 63>.
+func (b *Bytes) Inspect() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "<%d bytes", len(b.Value))
+	for i, c := range b.Value {
+		if i == bytesPreview {
+			out.WriteString(" ...")
+			break
+		}
+		if i == 0 {
+			out.WriteString(":")
+		}
+		fmt.Fprintf(&out, " %02x", c)
+	}
+	out.WriteString(">")
+	return out.String()
+}
+
 // BUILTIN
 
 type BuiltinFunction func(args ...Object) Object
 type Builtin struct {
 	Fn BuiltinFunction
+	// Name and Spec describe a builtin made by NewBuiltin, for help.
+	Name string
+	Spec *ArgSpec
+	// Allocates is set for builtins that return a new string or array, which
+	// counts against an engine's memory limit.
+	Allocates bool
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
-func (b *Builtin) Inspect() string  { return "builting function" }
+func (b *Builtin) Inspect() string  { return "builtin function" }
 
 // ARRAY
 
 type Array struct {
 	Elements []Object
+	// Frozen arrays can't be modified; see Freeze.
+	Frozen bool
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
-	var out bytes.Buffer
-
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
-}
+func (ao *Array) Inspect() string  { return InspectWith(ao, InspectOptions{}) }
 
 // HASH
 
@@ -174,10 +404,24 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey hashes the bit pattern of the value, so 1.0 and 1 are distinct keys.
+// -0.0 is folded into 0.0. NaN is matched by bit pattern too: a NaN key can be
+// stored, but a NaN produced by a different computation may not find it again.
+func (f *Float) HashKey() HashKey {
+	value := f.Value
+	if value == 0 {
+		value = 0
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(value)}
+}
+
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	s.hashOnce.Do(func() {
+		h := fnv.New64a()
+		h.Write([]byte(s.Value))
+		s.hashKey = HashKey{Type: s.Type(), Value: h.Sum64()}
+	})
+	return s.hashKey
 }
 
 type HashPair struct {
@@ -185,52 +429,103 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash keeps its pairs in the order their keys were first set. Setting a key
+// that is already there keeps its place; deleting a key and setting it again
+// moves it to the end. The zero Hash is empty and ready to use.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+	// Frozen hashes can't be modified; see Freeze.
+	Frozen bool
 }
 
-func (h *Hash) Type() ObjectType { return HASH_OBJ }
+// NewHash returns an empty hash with room for size pairs.
+func NewHash(size int) *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair, size), keys: make([]HashKey, 0, size)}
+}
 
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
+// Len returns the number of pairs in h.
+func (h *Hash) Len() int { return len(h.keys) }
+
+// Get returns the value stored under key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
 
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+// Set stores value under key, adding key at the end if it is new.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashed := key.HashKey()
+	if h.pairs == nil {
+		h.pairs = make(map[HashKey]HashPair)
 	}
+	if _, ok := h.pairs[hashed]; !ok {
+		h.keys = append(h.keys, hashed)
+	}
+	h.pairs[hashed] = HashPair{Key: key, Value: value}
+}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+// Delete removes key from h and reports whether it was there. It takes time
+// proportional to the number of pairs.
+func (h *Hash) Delete(key Hashable) bool {
+	hashed := key.HashKey()
+	if _, ok := h.pairs[hashed]; !ok {
+		return false
+	}
+	delete(h.pairs, hashed)
+	for i, k := range h.keys {
+		if k == hashed {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
 
-	return out.String()
+// Pairs returns h's pairs in order. Whatever enumerates a hash, such as
+// keys, values, merge and Inspect, goes through Pairs so that they all agree
+// on the order, in either engine.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.keys))
+	for i, key := range h.keys {
+		pairs[i] = h.pairs[key]
+	}
+	return pairs
 }
 
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return InspectWith(h, InspectOptions{}) }
+
 // COMPILED FUNCTIONS
 
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Parameters    []string // names, for Inspect
+	Name          string   // the name it was let to, if any
+	Doc           string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+
+// Inspect is fn(a, b) {...}: the body's source isn't kept after compiling.
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return signature(cf.Parameters) + " {...}"
 }
 
 // CLOSURE
 
+// Closure is the VM's function value. It reports itself as a FUNCTION, as
+// the tree walker's functions do, so errors and type() read the same in
+// both engines.
 type Closure struct {
 	Fn   *CompiledFunction
 	Free []Object
 }
 
-func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
-func (c *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", c)
-}
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string  { return c.Fn.Inspect() }
 
 // UTILS
 
@@ -241,6 +536,147 @@ func NativeToBooleanObject(input bool) *Boolean {
 	return FALSE
 }
 
-func ErrorPair(msg error) (*Error, error) {
-	return &Error{Message: msg}, msg
+// Equals reports whether a and b are deeply equal. Integers and floats compare
+// numerically, arrays and hashes compare element by element, and any other
+// object is only equal to itself. Arrays and hashes that contain themselves
+// are compared without recursing forever: a pair already being compared
+// further up is taken as equal.
+func Equals(a, b Object) bool {
+	return equals(a, b, nil)
+}
+
+// comparing is a pair of containers whose comparison is in progress.
+type comparing struct{ a, b Object }
+
+func equals(a, b Object, seen map[comparing]bool) bool {
+	switch a.(type) {
+	case *Array, *Hash:
+		pair := comparing{a, b}
+		if seen[pair] {
+			return true
+		}
+		if seen == nil {
+			seen = map[comparing]bool{}
+		}
+		seen[pair] = true
+		defer delete(seen, pair)
+	}
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return float64(a.Value) == b.Value
+		}
+		return false
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == float64(b.Value)
+		case *Float:
+			return a.Value == b.Value
+		}
+		return false
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Bytes:
+		b, ok := b.(*Bytes)
+		return ok && bytes.Equal(a.Value, b.Value)
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !equals(a.Elements[i], b.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		for key, pair := range a.pairs {
+			other, ok := b.pairs[key]
+			if !ok || !equals(pair.Value, other.Value, seen) {
+				return false
+			}
+		}
+		return true
+	case *BigInteger:
+		b, ok := b.(*BigInteger)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *Range:
+		// Ranges are equal when they have the same elements.
+		b, ok := b.(*Range)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		n := a.Len()
+		return n == 0 || a.Start == b.Start && (n == 1 || a.Step == b.Step)
+	default:
+		return a == b
+	}
+}
+
+// IsTruthy is the single truthiness rule shared by both engines. null, false,
+// the integer 0, and empty strings, bytes, arrays, hashes and ranges are falsy;
+// everything else is truthy.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	case *Integer:
+		return obj.Value != 0
+	case *Float:
+		return obj.Value != 0
+	case *String:
+		return obj.Value != ""
+	case *Bytes:
+		return len(obj.Value) > 0
+	case *Array:
+		return len(obj.Elements) > 0
+	case *Hash:
+		return obj.Len() > 0
+	case *Range:
+		return obj.Len() > 0
+	case *BigInteger:
+		return obj.Value.Sign() != 0
+	default:
+		return true
+	}
+}
+
+// ElementSize is what each array element or hash entry counts towards a
+// memory limit.
+const ElementSize = 16
+
+// SizeOf approximates the bytes a new value holds for memory limits: a
+// string's or bytes' length, and ElementSize per array element or hash key
+// and value. Other values count as zero.
+func SizeOf(obj Object) int {
+	switch obj := obj.(type) {
+	case *String:
+		return len(obj.Value)
+	case *Bytes:
+		return len(obj.Value)
+	case *Array:
+		return len(obj.Elements) * ElementSize
+	case *Hash:
+		return obj.Len() * 2 * ElementSize
+	default:
+		return 0
+	}
 }
@@ -0,0 +1,378 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"monkey/ast"
+)
+
+func TestGetInteger(t *testing.T) {
+	for _, v := range []int64{-128, -1, 0, 1, 1024} {
+		a, b := GetInteger(v), GetInteger(v)
+		if a != b {
+			t.Errorf("GetInteger(%d) not shared", v)
+		}
+		if a.Value != v {
+			t.Errorf("GetInteger(%d) has wrong value %d", v, a.Value)
+		}
+	}
+
+	for _, v := range []int64{-129, 1025, 1 << 40} {
+		a, b := GetInteger(v), GetInteger(v)
+		if a == b {
+			t.Errorf("GetInteger(%d) shared outside the cached range", v)
+		}
+		if a.Value != v {
+			t.Errorf("GetInteger(%d) has wrong value %d", v, a.Value)
+		}
+	}
+}
+
+func BenchmarkGetInteger(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GetInteger(int64(i % 1000))
+	}
+}
+
+func TestEquals(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable), pairs[i+1])
+		}
+		return h
+	}
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Float{Value: 1}, true},
+		{&Integer{Value: 1}, &String{Value: "1"}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{NULL, NULL, true},
+		{NULL, FALSE, false},
+		{TRUE, TRUE, true},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}},
+			&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, true},
+		{&Array{Elements: []Object{&Integer{Value: 1}}},
+			&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}, false},
+		{&Bytes{Value: []byte{0, 255}}, &Bytes{Value: []byte{0, 255}}, true},
+		{&Bytes{Value: []byte("a")}, &String{Value: "a"}, false},
+		{hash(&String{Value: "a"}, &Array{Elements: []Object{TRUE}}),
+			hash(&String{Value: "a"}, &Array{Elements: []Object{TRUE}}), true},
+		{hash(&String{Value: "a"}, &Integer{Value: 1}),
+			hash(&String{Value: "a"}, &Integer{Value: 2}), false},
+		{hash(&String{Value: "a"}, &Integer{Value: 1}),
+			hash(&String{Value: "b"}, &Integer{Value: 1}), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equals(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equals(%s, %s) wrong. want=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestEqualsCyclic(t *testing.T) {
+	a := &Array{Elements: []Object{NULL}}
+	a.Elements[0] = a
+	b := &Array{Elements: []Object{NULL}}
+	b.Elements[0] = b
+	c := &Array{Elements: []Object{&Array{Elements: []Object{TRUE}}}}
+
+	key := &String{Value: "self"}
+	h := NewHash(1)
+	h.Set(key, h)
+	g := NewHash(1)
+	g.Set(key, g)
+	other := NewHash(1)
+	other.Set(key, TRUE)
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{a, a, true},
+		{a, b, true},
+		{a, c, false},
+		{h, h, true},
+		{h, g, true},
+		{h, other, false},
+		{&Array{Elements: []Object{a, h}}, &Array{Elements: []Object{b, g}}, true},
+	}
+
+	for i, tt := range tests {
+		if got := Equals(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d] wrong. want=%t, got=%t", i, tt.expected, got)
+		}
+	}
+}
+
+func TestCyclicElementBuiltins(t *testing.T) {
+	a := &Array{Elements: []Object{NULL}}
+	a.Elements[0] = a
+	b := &Array{Elements: []Object{NULL}}
+	b.Elements[0] = b
+	h := NewHash(1)
+	h.Set(&String{Value: "self"}, h)
+
+	unique := GetBuiltinByName("unique").Fn(&Array{Elements: []Object{a, b, h, h}})
+	if arr, ok := unique.(*Array); !ok || len(arr.Elements) != 2 || arr.Elements[0] != a || arr.Elements[1] != h {
+		t.Errorf("unique([a, b, h, h]) = %s, want [a, h]", unique.Inspect())
+	}
+
+	contains := GetBuiltinByName("contains")
+	if got := contains.Fn(&Array{Elements: []Object{a}}, b); got != TRUE {
+		t.Errorf("contains([a], b) = %s, want true", got.Inspect())
+	}
+	if got := contains.Fn(&Array{Elements: []Object{a}}, h); got != FALSE {
+		t.Errorf("contains([a], h) = %s, want false", got.Inspect())
+	}
+}
+
+func TestIsTruthy(t *testing.T) {
+	nonEmpty := NewHash(1)
+	nonEmpty.Set(TRUE, NULL)
+
+	tests := []struct {
+		obj      Object
+		expected bool
+	}{
+		{NULL, false},
+		{TRUE, true},
+		{FALSE, false},
+		{&Integer{Value: 0}, false},
+		{&Integer{Value: 1}, true},
+		{&Integer{Value: -1}, true},
+		{&Float{Value: 0}, false},
+		{&Float{Value: 0.5}, true},
+		{&String{Value: ""}, false},
+		{&String{Value: "0"}, true},
+		{&Bytes{Value: []byte{}}, false},
+		{&Bytes{Value: []byte{0}}, true},
+		{&Array{Elements: []Object{}}, false},
+		{&Array{Elements: []Object{NULL}}, true},
+		{&Hash{}, false},
+		{nonEmpty, true},
+		{&Function{Body: &ast.BlockStatement{}}, true},
+		{&Builtin{}, true},
+		{&CompiledFunction{}, true},
+		{&Closure{}, true},
+	}
+
+	for _, tt := range tests {
+		if got := IsTruthy(tt.obj); got != tt.expected {
+			t.Errorf("IsTruthy(%s %s) wrong. got=%t, want=%t", tt.obj.Type(), tt.obj.Inspect(), got, tt.expected)
+		}
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff := &String{Value: "My name is johnny"}
+
+	// Call twice so the second comparison uses the cached keys.
+	for i := 0; i < 2; i++ {
+		if hello1.HashKey() != hello2.HashKey() {
+			t.Errorf("strings with same content have different hash keys")
+		}
+		if hello1.HashKey() == diff.HashKey() {
+			t.Errorf("strings with different content have same hash keys")
+		}
+	}
+
+	var wg sync.WaitGroup
+	shared := &String{Value: "shared"}
+	want := (&String{Value: "shared"}).HashKey()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if shared.HashKey() != want {
+				t.Errorf("concurrent HashKey returned a different key")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkStringHashKey(b *testing.B) {
+	key := &String{Value: strings.Repeat("k", 1024)}
+	hash := NewHash(1)
+	hash.Set(key, TRUE)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = hash.Get(key)
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	one := &Float{Value: 1.0}
+	alsoOne := &Float{Value: 1.0}
+	half := &Float{Value: 0.5}
+	intOne := &Integer{Value: 1}
+
+	if one.HashKey() != alsoOne.HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if one.HashKey() == half.HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+	if one.HashKey() == intOne.HashKey() {
+		t.Errorf("1.0 and 1 have the same hash key")
+	}
+	if (&Float{Value: 0}).HashKey() != (&Float{Value: math.Copysign(0, -1)}).HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1, "1.0"},
+		{1.5, "1.5"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect wrong. got=%q, want=%q", got, tt.expected)
+		}
+	}
+}
+
+func TestEnvCanBeTurnedOff(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+	env := GetBuiltinByName("env")
+
+	if got := env.Fn(&String{Value: "MONKEY_TEST_VAR"}); got.Inspect() != "banana" {
+		t.Errorf("wrong value. want=banana, got=%s", got.Inspect())
+	}
+
+	if got := EnvFrom(nil).Fn(&String{Value: "MONKEY_TEST_VAR"}); got != NULL {
+		t.Errorf("with a nil lookup, expected null, got %s", got.Inspect())
+	}
+	lookup := func(name string) (string, bool) { return "apple", name == "MONKEY_TEST_VAR" }
+	if got := EnvFrom(lookup).Fn(&String{Value: "MONKEY_TEST_VAR"}); got.Inspect() != "apple" {
+		t.Errorf("wrong value from the lookup. want=apple, got=%s", got.Inspect())
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	exit := &ExitError{Code: 1}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{NewError(KindDivisionByZero, "division by zero"), KindDivisionByZero},
+		{&Error{Message: exit}, KindError},
+		{fmt.Errorf("wrapped: %w", NewError(KindArgument, "bad")), KindArgument},
+		{exit, KindExit},
+		{errors.New("plain"), KindError},
+	}
+	for _, tt := range tests {
+		if got := ErrorKind(tt.err); got != tt.want {
+			t.Errorf("ErrorKind(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	var target *ExitError
+	if !errors.As(&Error{Message: exit, Kind: KindExit}, &target) || target != exit {
+		t.Error("the ExitError inside an Error is not reachable")
+	}
+}
+
+func TestErrorValuesAreNotRaised(t *testing.T) {
+	value := GetBuiltinByName("error").Fn(&String{Value: "bad"}, &String{Value: "custom"})
+	errObj, ok := value.(*Error)
+	if !ok || !errObj.Value {
+		t.Fatalf("error() = %#v, want an error value", value)
+	}
+	if got := GetBuiltinByName("error_kind").Fn(errObj).Inspect(); got != "custom" {
+		t.Errorf("error_kind = %s, want custom", got)
+	}
+	if got := GetBuiltinByName("first").Fn(&Array{Elements: []Object{errObj}}); got != errObj {
+		t.Errorf("first returned %s, want the error value", got.Inspect())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	invalid := "a\xffb"
+	b := GetBuiltinByName("bytes").Fn(&String{Value: invalid})
+	if got := GetBuiltinByName("to_string").Fn(b).(*String).Value; got != invalid {
+		t.Errorf("round trip gave %q, want %q", got, invalid)
+	}
+
+	long := &Bytes{Value: make([]byte, 20)}
+	want := "<20 bytes:" + strings.Repeat(" 00", 16) + " ...>"
+	if got := long.Inspect(); got != want {
+		t.Errorf("Inspect = %s, want %s", got, want)
+	}
+}
+
+func TestReadFileBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, []byte{1, 2, 0xff}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	read := GetBuiltinByName("read_file_bytes")
+
+	if got := read.Fn(&String{Value: path}).Inspect(); got != "<3 bytes: 01 02 ff>" {
+		t.Errorf("read_file_bytes = %s", got)
+	}
+	if got, ok := read.Fn(&String{Value: path + ".missing"}).(*Error); !ok || !errors.Is(got, os.ErrNotExist) {
+		t.Errorf("missing file gave %#v, want an error wrapping os.ErrNotExist", got)
+	}
+
+	defer func(readFile func(string) ([]byte, error)) { ReadFile = readFile }(ReadFile)
+	ReadFile = nil
+	if _, ok := read.Fn(&String{Value: path}).(*Error); !ok {
+		t.Error("with ReadFile nil, expected an error")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	a, b, c := &String{Value: "a"}, &String{Value: "b"}, &String{Value: "c"}
+	h := NewHash(0)
+	h.Set(c, GetInteger(1))
+	h.Set(a, GetInteger(2))
+	h.Set(b, GetInteger(3))
+	h.Set(c, GetInteger(4)) // an existing key keeps its place
+
+	if got := h.Inspect(); got != `{"c": 4, "a": 2, "b": 3}` {
+		t.Errorf("after setting, got %s", got)
+	}
+
+	if !h.Delete(a) || h.Delete(a) {
+		t.Error("Delete should report a only the first time")
+	}
+	h.Set(a, GetInteger(5))
+	if got := h.Inspect(); got != `{"c": 4, "b": 3, "a": 5}` {
+		t.Errorf("after deleting and re-adding a, got %s", got)
+	}
+	if v, ok := h.Get(a); !ok || v.Inspect() != "5" {
+		t.Errorf("Get(a) = %v, %t", v, ok)
+	}
+	if h.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", h.Len())
+	}
+}
@@ -0,0 +1,22 @@
+package object
+
+// OperatorError is the error for a binary operator that doesn't apply to its
+// operands, worded the same way by both engines:
+//
+//   - with a null operand, the operator cannot operate with the two types;
+//   - between two strings or two bytes, the operator is unknown;
+//   - between two different types, the types mismatch;
+//   - otherwise the operator cannot operate with the two types.
+func OperatorError(op string, left, right Object) *Error {
+	lt, rt := left.Type(), right.Type()
+	switch {
+	case lt == NULL_OBJ || rt == NULL_OBJ:
+		return NewError(KindTypeMismatch, "operator %s cannot operate with a %s and %s", op, lt, rt)
+	case lt == rt && (lt == STRING_OBJ || lt == BYTES_OBJ):
+		return NewError(KindTypeMismatch, "unknown operator: %s %s %s", lt, op, rt)
+	case lt != rt:
+		return NewError(KindTypeMismatch, "type mismatch: %s %s %s", lt, op, rt)
+	default:
+		return NewError(KindTypeMismatch, "operator %s cannot operate with a %s and %s", op, lt, rt)
+	}
+}
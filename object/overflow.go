@@ -0,0 +1,107 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Overflow is what integer arithmetic does when a result doesn't fit in an
+// Integer. Both engines honor it for +, -, *, /, << and negation.
+type Overflow int
+
+const (
+	// OverflowError fails with "integer overflow: 9223372036854775807 + 1".
+	// It is the zero value, so engines default to it.
+	OverflowError Overflow = iota
+	// OverflowWrap wraps around, as Go's int64 arithmetic does.
+	OverflowWrap
+	// OverflowBig promotes the result to a BigInteger.
+	OverflowBig
+)
+
+var overflowNames = []string{"error", "wrap", "bigint"}
+
+func (o Overflow) String() string {
+	if o < 0 || int(o) >= len(overflowNames) {
+		return fmt.Sprintf("Overflow(%d)", int(o))
+	}
+	return overflowNames[o]
+}
+
+// ParseOverflow reads a policy by name: error, wrap or bigint.
+func ParseOverflow(s string) (Overflow, error) {
+	for i, name := range overflowNames {
+		if s == name {
+			return Overflow(i), nil
+		}
+	}
+	return OverflowError, fmt.Errorf("unknown overflow policy %q, want error, wrap or bigint", s)
+}
+
+// AddInt returns a + b and whether it fit in an int64.
+func AddInt(a, b int64) (int64, bool) {
+	sum := a + b
+	return sum, (a >= 0) != (b >= 0) || (sum >= 0) == (a >= 0)
+}
+
+// SubInt returns a - b and whether it fit in an int64.
+func SubInt(a, b int64) (int64, bool) {
+	diff := a - b
+	return diff, (a >= 0) == (b >= 0) || (diff >= 0) == (a >= 0)
+}
+
+// MulInt returns a * b and whether it fit in an int64.
+func MulInt(a, b int64) (int64, bool) {
+	product := a * b
+	if a == 0 || b == 0 {
+		return product, true
+	}
+	if a == -1 || b == -1 {
+		// -1 * MinInt64 is the one product of -1 that overflows.
+		return product, a != math.MinInt64 && b != math.MinInt64
+	}
+	return product, product/b == a
+}
+
+// DivInt returns a / b, for b not zero, and whether it fit in an int64.
+func DivInt(a, b int64) (int64, bool) {
+	return a / b, a != math.MinInt64 || b != -1
+}
+
+// ShlInt returns a << n, for n not negative, and whether it fit in an int64.
+func ShlInt(a, n int64) (int64, bool) {
+	if a == 0 {
+		return 0, true
+	}
+	if n >= 64 {
+		return 0, false
+	}
+	shifted := a << n
+	// Shifting back loses nothing only if every bit shifted out was a copy
+	// of the sign bit.
+	return shifted, shifted>>n == a
+}
+
+// NegInt returns -a and whether it fit in an int64.
+func NegInt(a int64) (int64, bool) {
+	return -a, a != math.MinInt64
+}
+
+// Overflowed is the result under overflow of l op r, whose int64 result
+// didn't fit: an error, or for OverflowBig the BigInteger result. Callers
+// with OverflowWrap use the wrapped result instead.
+func Overflowed(overflow Overflow, op string, l, r int64) (Object, *Error) {
+	if overflow != OverflowBig {
+		return nil, NewError(KindOverflow, "integer overflow: %d %s %d", l, op, r)
+	}
+	return BigOp(op, big.NewInt(l), big.NewInt(r))
+}
+
+// OverflowedNeg is Overflowed for -a.
+func OverflowedNeg(overflow Overflow, a int64) (Object, *Error) {
+	if overflow != OverflowBig {
+		return nil, NewError(KindOverflow, "integer overflow: -(%d)", a)
+	}
+	return NewBigInteger(new(big.Int).Neg(big.NewInt(a))), nil
+}
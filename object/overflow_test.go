@@ -0,0 +1,50 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCheckedIntegerOps(t *testing.T) {
+	tests := []struct {
+		name string
+		got  func() (int64, bool)
+		want int64
+		ok   bool
+	}{
+		{"max + 1", func() (int64, bool) { return AddInt(math.MaxInt64, 1) }, math.MinInt64, false},
+		{"min + -1", func() (int64, bool) { return AddInt(math.MinInt64, -1) }, math.MaxInt64, false},
+		{"max + min", func() (int64, bool) { return AddInt(math.MaxInt64, math.MinInt64) }, -1, true},
+		{"min - 1", func() (int64, bool) { return SubInt(math.MinInt64, 1) }, math.MaxInt64, false},
+		{"-1 - min", func() (int64, bool) { return SubInt(-1, math.MinInt64) }, math.MaxInt64, true},
+		{"0 - min", func() (int64, bool) { return SubInt(0, math.MinInt64) }, math.MinInt64, false},
+		{"min * -1", func() (int64, bool) { return MulInt(math.MinInt64, -1) }, math.MinInt64, false},
+		{"2^32 * 2^31", func() (int64, bool) { return MulInt(1<<32, 1<<31) }, math.MinInt64, false},
+		{"-2^32 * 2^31", func() (int64, bool) { return MulInt(-1<<32, 1<<31) }, math.MinInt64, true},
+		{"min / -1", func() (int64, bool) { return DivInt(math.MinInt64, -1) }, math.MinInt64, false},
+		{"1 << 62", func() (int64, bool) { return ShlInt(1, 62) }, 1 << 62, true},
+		{"1 << 63", func() (int64, bool) { return ShlInt(1, 63) }, math.MinInt64, false},
+		{"-1 << 63", func() (int64, bool) { return ShlInt(-1, 63) }, math.MinInt64, true},
+		{"1 << 64", func() (int64, bool) { return ShlInt(1, 64) }, 0, false},
+		{"0 << 100", func() (int64, bool) { return ShlInt(0, 100) }, 0, true},
+		{"-min", func() (int64, bool) { return NegInt(math.MinInt64) }, math.MinInt64, false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.got()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %d, %t, want %d, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseOverflow(t *testing.T) {
+	for _, o := range []Overflow{OverflowError, OverflowWrap, OverflowBig} {
+		got, err := ParseOverflow(o.String())
+		if err != nil || got != o {
+			t.Errorf("ParseOverflow(%q) = %s, %v", o.String(), got, err)
+		}
+	}
+	if _, err := ParseOverflow("saturate"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,73 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// Range is the integers from Start up to but not including End, Step apart,
+// counting down when Step is negative. It is lazy: its elements are worked
+// out as they are asked for, so a range of millions costs no more than one
+// of ten. Ranges can't be modified.
+type Range struct {
+	Start, End, Step int64
+}
+
+// NewRange returns the range from start to end in steps of step, failing for
+// a step of zero or a range with more elements than an integer can count.
+func NewRange(start, end, step int64) (*Range, *Error) {
+	if step == 0 {
+		return nil, NewError(KindArgument, "range: step must not be zero")
+	}
+	r := &Range{Start: start, End: end, Step: step}
+	if r.length() > math.MaxInt64 {
+		return nil, NewError(KindArgument, "range: too many elements from %d to %d", start, end)
+	}
+	return r, nil
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+
+// Inspect prints a range as start..end, with the step after it unless it is 1.
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("%d..%d", r.Start, r.End)
+	}
+	return fmt.Sprintf("%d..%d step %d", r.Start, r.End, r.Step)
+}
+
+// Len returns the number of elements in r, which is zero when End is on the
+// wrong side of Start for the direction of Step.
+func (r *Range) Len() int64 {
+	return int64(r.length())
+}
+
+// length is Len in unsigned arithmetic, which can't overflow even for a range
+// spanning every integer.
+func (r *Range) length() uint64 {
+	switch {
+	case r.Step > 0 && r.Start < r.End:
+		return (uint64(r.End-r.Start)-1)/uint64(r.Step) + 1
+	case r.Step < 0 && r.Start > r.End:
+		return (uint64(r.Start-r.End)-1)/uint64(-r.Step) + 1
+	}
+	return 0
+}
+
+// At returns element i of r, which must be less than Len.
+func (r *Range) At(i int64) int64 {
+	// Wrapping arithmetic gives the right answer for any element in range,
+	// even when i*Step alone overflows.
+	return r.Start + i*r.Step
+}
+
+// Contains reports whether n is an element of r.
+func (r *Range) Contains(n int64) bool {
+	switch {
+	case r.Step > 0 && n >= r.Start && n < r.End:
+		return uint64(n-r.Start)%uint64(r.Step) == 0
+	case r.Step < 0 && n <= r.Start && n > r.End:
+		return uint64(r.Start-n)%uint64(-r.Step) == 0
+	}
+	return false
+}
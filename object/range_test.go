@@ -0,0 +1,77 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRangeLen(t *testing.T) {
+	tests := []struct {
+		start, end, step int64
+		want             int64
+	}{
+		{0, 10, 1, 10},
+		{1, 10, 3, 3},
+		{1, 11, 5, 2},
+		{5, 5, 1, 0},
+		{10, 0, 1, 0},
+		{10, 0, -1, 10},
+		{10, 0, -4, 3},
+		{0, 10, -1, 0},
+		{math.MinInt64, math.MaxInt64, 3, 6148914691236517205},
+		{math.MaxInt64, math.MinInt64, math.MinInt64, 2},
+	}
+	for _, tt := range tests {
+		r, err := NewRange(tt.start, tt.end, tt.step)
+		if err != nil {
+			t.Fatalf("NewRange(%d, %d, %d): %s", tt.start, tt.end, tt.step, err)
+		}
+		if got := r.Len(); got != tt.want {
+			t.Errorf("len(%s) = %d, want %d", r.Inspect(), got, tt.want)
+		}
+		if n := r.Len(); n > 0 && !r.Contains(r.At(n-1)) {
+			t.Errorf("%s doesn't contain its last element %d", r.Inspect(), r.At(n-1))
+		}
+	}
+
+	if _, err := NewRange(0, 1, 0); err == nil {
+		t.Error("expected an error for a step of zero")
+	}
+	if _, err := NewRange(math.MinInt64, math.MaxInt64, 1); err == nil {
+		t.Error("expected an error for a range too long to count")
+	}
+}
+
+func TestRangeContains(t *testing.T) {
+	up, _ := NewRange(1, 10, 3)
+	down, _ := NewRange(10, 0, -4)
+	for _, tt := range []struct {
+		r    *Range
+		n    int64
+		want bool
+	}{
+		{up, 1, true}, {up, 7, true}, {up, 10, false}, {up, 5, false}, {up, -2, false},
+		{down, 10, true}, {down, 2, true}, {down, 0, false}, {down, 6, true}, {down, 14, false},
+	} {
+		if got := tt.r.Contains(tt.n); got != tt.want {
+			t.Errorf("%s contains %d = %t, want %t", tt.r.Inspect(), tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestRangeIsLazy(t *testing.T) {
+	r, _ := NewRange(1, 10_000_001, 1)
+	var sum int64
+	allocs := testing.AllocsPerRun(1, func() {
+		sum = 0
+		for i := int64(0); i < r.Len(); i++ {
+			sum += r.At(i)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("iterating a range allocated %v times", allocs)
+	}
+	if sum != 50_000_005_000_000 {
+		t.Errorf("sum = %d", sum)
+	}
+}
@@ -0,0 +1,29 @@
+package object
+
+// Shift applies << or >> to operands that aren't both integers, for both
+// engines. The operators mean:
+//
+//   - INTEGER << INTEGER and >> shift, which the engines do themselves
+//     under their overflow policy; a negative count is an error.
+//   - STRING << STRING concatenates, as + does.
+//   - ARRAY << x returns a new array with x appended as one element, as
+//     push does; x may be an array.
+//
+// Everything else is an error, including every >> on a non-integer: an
+// array has no one obvious end for >> to take an element from.
+func Shift(op string, left, right Object) (Object, *Error) {
+	if op == "<<" {
+		switch left := left.(type) {
+		case *String:
+			if right, ok := right.(*String); ok {
+				return &String{Value: left.Value + right.Value}, nil
+			}
+		case *Array:
+			elements := make([]Object, len(left.Elements)+1)
+			copy(elements, left.Elements)
+			elements[len(left.Elements)] = right
+			return &Array{Elements: elements}, nil
+		}
+	}
+	return nil, NewError(KindTypeMismatch, "operator %s cannot operate with a %s and %s", op, left.Type(), right.Type())
+}
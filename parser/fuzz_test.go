@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"monkey/lexer"
+	"testing"
+)
+
+// seeds are drawn from the parser's other tests, plus inputs that once
+// panicked.
+var seeds = []string{
+	"let x = 5; let y = true; let foobar = y;",
+	"return 5; return; return fn(x) { x };",
+	"-a * b + !c / d % e",
+	"a + add(b * c, [1, 2][0]) + d.e",
+	"if (x < y) { x } else { y }",
+	"while (i < 10) { i += 1; if (i == 5) { break } else { continue } }",
+	`switch (x) { case 1 if y: { "one" } default: { "other" } }`,
+	"let f = fn(a, b, c) { a |> b |> c };",
+	`{"one": 1, two: 2, 3: [4.5, null]}["one"]`,
+	"a = b[0] = c ^= 1 << 2 >> 3 | 4 & 5",
+	"let = 1; let x = ; )",
+	"(((1 + 2",
+	"return",
+	"}",
+	"a[1",
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		program, err := New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("got a %T, want a *ParseError: %v", err, err)
+			}
+		} else {
+			_ = program.String()
+		}
+
+		program, _ = New(lexer.New(input)).ParseAll()
+		_ = program.String()
+	})
+}
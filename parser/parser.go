@@ -6,13 +6,18 @@ import (
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = +=
+	PIPELINE    // |>
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
-	LESSGREATER // > <
+	LESSGREATER // > < >= <=
 	SUM         // + -
 	PRODUCT     // / * %
 	PREFIX      // -, !
@@ -22,10 +27,24 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:    ASSIGN,
+	token.PLUS_EQ:   ASSIGN,
+	token.MIN_EQ:    ASSIGN,
+	token.MUL_EQ:    ASSIGN,
+	token.DIV_EQ:    ASSIGN,
+	token.PERC_EQ:   ASSIGN,
+	token.XOR_EQ:    ASSIGN,
+	token.OR_EQ:     ASSIGN,
+	token.AND_EQ:    ASSIGN,
+	token.PIPELINE:  PIPELINE,
+	token.OR:        OR,
+	token.AND:       AND,
 	token.EQ:        EQUALS,
 	token.NEQ:       EQUALS,
 	token.LANG:      LESSGREATER,
 	token.RANG:      LESSGREATER,
+	token.GEQ:       LESSGREATER,
+	token.LEQ:       LESSGREATER,
 	token.PLUS:      SUM,
 	token.MINUS:     SUM,
 	token.SLASH:     PRODUCT,
@@ -38,11 +57,17 @@ var precedences = map[token.TokenType]int{
 	token.SHOVR:     SPECIAL,
 	token.LPAREN:    CALL,
 	token.LBRACKET:  INDEX,
+	token.DOT:       INDEX,
 }
 
+// MaxNesting is how deeply expressions may nest, so that hostile input
+// can't exhaust the stack of the parser or of whatever walks the tree.
+const MaxNesting = 1000
+
 // Error
 
 type ParseError struct {
+	Pos token.Position // where the parser gave up
 	msg string
 }
 
@@ -50,8 +75,8 @@ func (e *ParseError) Error() string {
 	return e.msg
 }
 
-func createParseError(message string, args ...any) *ParseError {
-	return &ParseError{msg: fmt.Sprintf(message, args...)}
+func createParseError(pos token.Position, message string, args ...any) *ParseError {
+	return &ParseError{Pos: pos, msg: fmt.Sprintf(message, args...)}
 }
 
 // Parser Functions
@@ -70,27 +95,67 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// valueDepth counts the expressions around the current token whose
+	// value is still being built, so break and continue can't abandon one.
+	// Function and loop bodies start again from zero. atStatement is set
+	// while the first expression of a statement is being parsed.
+	valueDepth  int
+	atStatement bool
+
+	nesting int // expressions being parsed, up to MaxNesting
+
+	// open holds the (, [ and { read so far that aren't closed yet,
+	// innermost last. closed is the one curToken closed, if it did.
+	open   []token.Token
+	closed token.Token
+
+	mode Mode
 }
 
+// Mode changes what the parser keeps.
+type Mode uint
+
+const (
+	// ParseComments attaches the // comments on the lines just above a let
+	// of a function literal to the function as its Doc.
+	ParseComments Mode = 1 << iota
+)
+
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, prefixParseFns: make(map[token.TokenType]prefixParseFn), infixParseFns: make(map[token.TokenType]infixParseFn)}
+	return NewWithMode(l, 0)
+}
+
+// NewWithMode returns a parser for l that works in mode.
+func NewWithMode(l *lexer.Lexer, mode Mode) *Parser {
+	p := &Parser{l: l, mode: mode, prefixParseFns: make(map[token.TokenType]prefixParseFn), infixParseFns: make(map[token.TokenType]infixParseFn)}
 	p.registerPrefix(token.IDENT, p.parseIdent)
 	p.registerPrefix(token.INT, p.parseInt)
+	p.registerPrefix(token.FLOAT, p.parseFloat)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.LPAREN, p.parseGrouped)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.SWITCH, p.parseSwitchExpression)
+	p.registerPrefix(token.WHILE, p.parseWhileExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
-	for k := range precedences {
-		p.registerInfix(k, p.parseInfixExpression)
+	for k, precedence := range precedences {
+		if precedence == ASSIGN {
+			p.registerInfix(k, p.parseAssignExpression)
+		} else {
+			p.registerInfix(k, p.parseInfixExpression)
+		}
 	}
+	p.registerInfix(token.PIPELINE, p.parsePipeExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	// Set both tokens
 	p.nextToken()
@@ -102,6 +167,28 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.trackDelimiter()
+}
+
+var openers = map[token.TokenType]token.TokenType{
+	token.RPAREN:   token.LPAREN,
+	token.RBRACKET: token.LBRACKET,
+	token.RBRACE:   token.LBRACE,
+}
+
+// trackDelimiter keeps open up to date with curToken. A closer only closes
+// the innermost opener, and only if it's the matching one.
+func (p *Parser) trackDelimiter() {
+	p.closed = token.Token{}
+	switch p.curToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		p.open = append(p.open, p.curToken)
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		if n := len(p.open); n > 0 && p.open[n-1].Type == openers[p.curToken.Type] {
+			p.closed = p.open[n-1]
+			p.open = p.open[:n-1]
+		}
+	}
 }
 
 func (p *Parser) ParseProgram() (*ast.Program, error) {
@@ -120,6 +207,64 @@ func (p *Parser) ParseProgram() (*ast.Program, error) {
 	return program, nil
 }
 
+// ParseAll parses the whole program, carrying on after an error from the
+// next statement, and returns every error found in source order. The
+// program holds the statements that parsed.
+func (p *Parser) ParseAll() (*ast.Program, []*ParseError) {
+	program := &ast.Program{}
+	program.Statements = []ast.Statement{}
+	var errs []*ParseError
+
+	for p.curToken.Type != token.EOF {
+		// A stray closing brace or semicolon after an error most likely
+		// ends a block the error was in.
+		if len(errs) > 0 && (p.curTokenIs(token.RBRACE) || p.curTokenIs(token.SEMICOLON)) {
+			p.nextToken()
+			continue
+		}
+
+		start := p.curToken.Pos
+		stmt, err := p.parseStatement()
+		if err == nil {
+			program.Statements = append(program.Statements, stmt)
+			p.nextToken()
+			continue
+		}
+
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			parseErr = createParseError(p.curToken.Pos, "%s", err)
+		}
+		if len(errs) == 0 || errs[len(errs)-1].Pos != parseErr.Pos {
+			errs = append(errs, parseErr)
+		}
+		p.synchronize(start)
+		// Whatever the failed statement left open is abandoned with it.
+		p.open = p.open[:0]
+		p.trackDelimiter()
+	}
+
+	return program, errs
+}
+
+// synchronize skips the rest of a statement, starting at start, that failed
+// to parse: up to the next semicolon or let.
+func (p *Parser) synchronize(start token.Position) {
+	p.valueDepth = 0
+	p.atStatement = false
+
+	for !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.SEMICOLON):
+			p.nextToken()
+			return
+		case p.curTokenIs(token.LET) && p.curToken.Pos != start:
+			return
+		}
+		p.nextToken()
+	}
+}
+
 // Statements
 
 func (p *Parser) parseStatement() (ast.Statement, error) {
@@ -128,6 +273,24 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.BREAK:
+		if p.valueDepth > 0 {
+			return nil, createParseError(p.curToken.Pos, "break inside an expression at %s", p.curToken.Pos)
+		}
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt, nil
+	case token.CONTINUE:
+		if p.valueDepth > 0 {
+			return nil, createParseError(p.curToken.Pos, "continue inside an expression at %s", p.curToken.Pos)
+		}
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt, nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -135,6 +298,10 @@ func (p *Parser) parseStatement() (ast.Statement, error) {
 
 func (p *Parser) parseLetStatement() (*ast.LetStatement, error) {
 	stmt := &ast.LetStatement{Token: p.curToken}
+	var doc string
+	if p.mode&ParseComments != 0 {
+		doc = p.docAbove(p.curToken.Pos.Line)
+	}
 
 	if res, err := p.expect(token.IDENT); !res {
 		return nil, err
@@ -156,6 +323,7 @@ func (p *Parser) parseLetStatement() (*ast.LetStatement, error) {
 
 	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
 		fl.Name = stmt.Name.Value
+		fl.Doc = doc
 	}
 
 	if p.peekTokenIs(token.SEMICOLON) { // FIXME: This
@@ -165,9 +333,38 @@ func (p *Parser) parseLetStatement() (*ast.LetStatement, error) {
 	return stmt, nil
 }
 
+// docAbove returns the text of the comments on the lines just above line,
+// each on a line of its own, one line of text per comment with a space after
+// the // dropped.
+func (p *Parser) docAbove(line int) string {
+	comments := p.l.Comments()
+	end := len(comments)
+	for end > 0 && comments[end-1].Pos.Line >= line {
+		end--
+	}
+	start := end
+	for start > 0 && !comments[start-1].Trailing && comments[start-1].Pos.Line == line-(end-start)-1 {
+		start--
+	}
+
+	lines := make([]string, 0, end-start)
+	for _, c := range comments[start:end] {
+		text := strings.TrimSuffix(c.Text, "\r")
+		lines = append(lines, strings.TrimPrefix(text, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) { // Bare return
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt, nil
+	}
+
 	p.nextToken()
 
 	if exp, err := p.parseExpression(LOWEST); err == nil {
@@ -184,6 +381,7 @@ func (p *Parser) parseReturnStatement() (*ast.ReturnStatement, error) {
 func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
+	p.atStatement = true
 	if exp, err := p.parseExpression(LOWEST); err == nil {
 		stmt.Expression = exp
 	} else {
@@ -192,6 +390,7 @@ func (p *Parser) parseExpressionStatement() (*ast.ExpressionStatement, error) {
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+		stmt.Semicolon = true
 	}
 
 	return stmt, nil
@@ -215,13 +414,37 @@ func (p *Parser) parseBlockStatement() (*ast.BlockStatement, error) {
 	return block, nil
 }
 
+// parseBody parses the block of a loop or function, whose statements hold
+// no enclosing values.
+func (p *Parser) parseBody() (*ast.BlockStatement, error) {
+	outer := p.valueDepth
+	p.valueDepth = 0
+	defer func() { p.valueDepth = outer }()
+
+	return p.parseBlockStatement()
+}
+
 // Expressions
 
 func (p *Parser) parseExpression(precedence int) (ast.Expression, error) {
+	if p.nesting >= MaxNesting {
+		return nil, createParseError(p.curToken.Pos, "expression nested more than %d deep", MaxNesting)
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	// Only an if that starts a statement lets its blocks break or continue;
+	// it has nothing on the stack yet when they run.
+	if !p.atStatement || !p.curTokenIs(token.IF) {
+		p.valueDepth++
+		defer func() { p.valueDepth-- }()
+	}
+	p.atStatement = false
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 
 	if prefix == nil {
-		return nil, createParseError("No prefix expression found for %q (%q).", p.curToken.Type, p.curToken.Literal)
+		return nil, p.noPrefixError()
 	}
 
 	lhs, err := prefix()
@@ -256,12 +479,46 @@ func (p *Parser) parseInt() (ast.Expression, error) {
 	if value, err := strconv.ParseInt(p.curToken.Literal, 0, 64); err == nil {
 		lit.Value = value
 	} else {
-		return nil, createParseError("Expected integer literal, got unparseable %q instead", p.curToken.Literal)
+		return nil, createParseError(p.curToken.Pos, "Expected integer literal, got unparseable %q instead", p.curToken.Literal)
 	}
 
 	return lit, nil
 }
 
+func (p *Parser) parseFloat() (ast.Expression, error) {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	if value, err := strconv.ParseFloat(p.curToken.Literal, 64); err == nil {
+		lit.Value = value
+	} else {
+		return nil, createParseError(p.curToken.Pos, "Expected float literal, got unparseable %q instead", p.curToken.Literal)
+	}
+
+	return lit, nil
+}
+
+// noPrefixError explains why curToken can't start an expression, with a
+// hint for the tokens people most often put there by mistake.
+func (p *Parser) noPrefixError() error {
+	tok := p.curToken
+	switch tok.Type {
+	case token.ELSE:
+		return createParseError(tok.Pos, "unexpected else: else must follow an if block")
+	case token.ASSIGN:
+		return createParseError(tok.Pos, "unexpected \"=\": did you mean let or ==?")
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		if p.closed.Type != "" {
+			return createParseError(tok.Pos, "expected an expression before %q closing the %q at %s", tok.Literal, p.closed.Literal, p.closed.Pos)
+		}
+		if n := len(p.open); n > 0 {
+			innermost := p.open[n-1]
+			return createParseError(tok.Pos, "unmatched %q: the nearest unclosed delimiter is the %q at %s", tok.Literal, innermost.Literal, innermost.Pos)
+		}
+		return createParseError(tok.Pos, "unmatched %q: nothing is open for it to close", tok.Literal)
+	}
+	return createParseError(tok.Pos, "No prefix expression found for %q (%q).", tok.Type, tok.Literal)
+}
+
 func (p *Parser) parsePrefixExpression() (ast.Expression, error) {
 	expr := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -298,10 +555,54 @@ func (p *Parser) parseInfixExpression(left ast.Expression) (ast.Expression, erro
 	return expression, nil
 }
 
+// parseAssignExpression is right associative, so `a = b = 1` assigns b first.
+func (p *Parser) parseAssignExpression(target ast.Expression) (ast.Expression, error) {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		return nil, createParseError(ast.Pos(target), "cannot assign to %s", target.String())
+	}
+
+	p.nextToken()
+
+	value, err := p.parseExpression(ASSIGN - 1)
+	if err != nil {
+		return nil, err
+	}
+	expression.Value = value
+
+	return expression, nil
+}
+
+func (p *Parser) parsePipeExpression(left ast.Expression) (ast.Expression, error) {
+	expression := &ast.PipeExpression{Token: p.curToken, Left: left}
+
+	precedence := p.curPrecedence()
+	p.nextToken()
+
+	if rhs, err := p.parseExpression(precedence); err == nil {
+		expression.Right = rhs
+	} else {
+		return nil, err
+	}
+
+	return expression, nil
+}
+
 func (p *Parser) parseBoolean() (ast.Expression, error) {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}, nil
 }
 
+func (p *Parser) parseNull() (ast.Expression, error) {
+	return &ast.Null{Token: p.curToken}, nil
+}
+
 func (p *Parser) parseGrouped() (ast.Expression, error) {
 	p.nextToken()
 
@@ -311,7 +612,7 @@ func (p *Parser) parseGrouped() (ast.Expression, error) {
 	}
 
 	if ok, _ := p.expect(token.RPAREN); !ok {
-		return nil, createParseError("Expected closing parenthesis.")
+		return nil, createParseError(p.peekToken.Pos, "Expected closing parenthesis.")
 	}
 
 	return exp, nil
@@ -361,6 +662,223 @@ func (p *Parser) parseIfExpression() (ast.Expression, error) {
 	return expression, nil
 }
 
+func (p *Parser) parseWhileExpression() (ast.Expression, error) {
+	expression := &ast.WhileExpression{Token: p.curToken}
+
+	if ok, err := p.expect(token.LPAREN); !ok {
+		return nil, err
+	}
+
+	p.nextToken()
+	cond, err := p.parseExpression(LOWEST)
+	if err != nil {
+		return nil, err
+	}
+	expression.Condition = cond
+
+	if ok, err := p.expect(token.RPAREN); !ok {
+		return nil, err
+	}
+	if ok, err := p.expect(token.LBRACE); !ok {
+		return nil, err
+	}
+
+	body, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	expression.Body = body
+
+	return expression, nil
+}
+
+func (p *Parser) parseSwitchExpression() (ast.Expression, error) {
+	expression := &ast.SwitchExpression{Token: p.curToken}
+
+	if ok, err := p.expect(token.LPAREN); !ok {
+		return nil, err
+	}
+
+	p.nextToken()
+	if subject, err := p.parseExpression(LOWEST); err == nil {
+		expression.Subject = subject
+	} else {
+		return nil, err
+	}
+
+	if ok, err := p.expect(token.RPAREN); !ok {
+		return nil, err
+	}
+	if ok, err := p.expect(token.LBRACE); !ok {
+		return nil, err
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm, err := p.parseSwitchCase()
+		if err != nil {
+			return nil, err
+		}
+		expression.Cases = append(expression.Cases, arm)
+	}
+	p.nextToken()
+
+	return expression, nil
+}
+
+func (p *Parser) parseSwitchCase() (*ast.SwitchCase, error) {
+	arm := &ast.SwitchCase{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.CASE:
+		p.nextToken()
+		if p.curTokenIs(token.LET) {
+			p.nextToken()
+			pattern, err := p.parsePattern(map[string]bool{})
+			if err != nil {
+				return nil, err
+			}
+			arm.Pattern = pattern
+		} else if value, err := p.parseExpression(LOWEST); err == nil {
+			arm.Value = value
+		} else {
+			return nil, err
+		}
+	case token.DEFAULT:
+	default:
+		return nil, createParseError(p.curToken.Pos, "Expected %q or %q in switch, got %q instead", token.CASE, token.DEFAULT, p.curToken.Type)
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		if guard, err := p.parseExpression(LOWEST); err == nil {
+			arm.Guard = guard
+		} else {
+			return nil, err
+		}
+	}
+
+	if ok, err := p.expect(token.COLON); !ok {
+		return nil, err
+	}
+	if ok, err := p.expect(token.LBRACE); !ok {
+		return nil, err
+	}
+
+	if body, err := p.parseBlockStatement(); err == nil {
+		arm.Body = body
+	} else {
+		return nil, err
+	}
+
+	return arm, nil
+}
+
+// parsePattern parses the pattern of a `case let` arm. bound holds the
+// names the pattern has bound so far, since each may be bound only once.
+func (p *Parser) parsePattern(bound map[string]bool) (ast.Pattern, error) {
+	if p.nesting >= MaxNesting {
+		return nil, createParseError(p.curToken.Pos, "pattern nested more than %d deep", MaxNesting)
+	}
+	p.nesting++
+	defer func() { p.nesting-- }()
+
+	switch p.curToken.Type {
+	case token.IDENT:
+		name := p.curToken.Literal
+		if name == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}, nil
+		}
+		if bound[name] {
+			return nil, createParseError(p.curToken.Pos, "%s is bound more than once in the pattern", name)
+		}
+		bound[name] = true
+		return &ast.BindingPattern{Name: &ast.Identifier{Token: p.curToken, Value: name}}, nil
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		value, err := p.prefixParseFns[p.curToken.Type]()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.LiteralPattern{Value: value}, nil
+	case token.MINUS:
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			break
+		}
+		value, err := p.parsePrefixExpression()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.LiteralPattern{Value: value}, nil
+	case token.LBRACKET:
+		return p.parseArrayPattern(bound)
+	case token.LBRACE:
+		return p.parseHashPattern(bound)
+	}
+	return nil, createParseError(p.curToken.Pos, "Expected a pattern, got %q instead", p.curToken.Literal)
+}
+
+func (p *Parser) parseArrayPattern(bound map[string]bool) (ast.Pattern, error) {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		element, err := p.parsePattern(bound)
+		if err != nil {
+			return nil, err
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) {
+			if ok, err := p.expect(token.COMMA); !ok {
+				return nil, err
+			}
+		}
+	}
+	p.nextToken()
+
+	return pattern, nil
+}
+
+func (p *Parser) parseHashPattern(bound map[string]bool) (ast.Pattern, error) {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		switch p.curToken.Type {
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+		default:
+			return nil, createParseError(p.curToken.Pos, "Expected a string, integer or boolean key in a hash pattern, got %q instead", p.curToken.Literal)
+		}
+		key, err := p.prefixParseFns[p.curToken.Type]()
+		if err != nil {
+			return nil, err
+		}
+
+		if ok, err := p.expect(token.COLON); !ok {
+			return nil, err
+		}
+
+		p.nextToken()
+		value, err := p.parsePattern(bound)
+		if err != nil {
+			return nil, err
+		}
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) {
+			if ok, err := p.expect(token.COMMA); !ok {
+				return nil, err
+			}
+		}
+	}
+	p.nextToken()
+
+	return pattern, nil
+}
+
 func (p *Parser) parseFunctionLiteral() (ast.Expression, error) {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -378,7 +896,7 @@ func (p *Parser) parseFunctionLiteral() (ast.Expression, error) {
 		return nil, err
 	}
 
-	if body, err := p.parseBlockStatement(); err == nil {
+	if body, err := p.parseBody(); err == nil {
 		lit.Body = body
 	} else {
 		return nil, err
@@ -395,18 +913,18 @@ func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, error) {
 		return ids, nil
 	}
 
-	p.nextToken()
-
-	// First ident
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	ids = append(ids, ident)
+	if ok, err := p.expect(token.IDENT); !ok {
+		return nil, err
+	}
+	ids = append(ids, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
 
-		id := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		ids = append(ids, id)
+		if ok, err := p.expect(token.IDENT); !ok {
+			return nil, err
+		}
+		ids = append(ids, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 	}
 
 	if ok, err := p.expect(token.RPAREN); !ok {
@@ -524,6 +1042,17 @@ func (p *Parser) parseIndexExpression(left ast.Expression) (ast.Expression, erro
 	return exp, nil
 }
 
+func (p *Parser) parseMemberExpression(left ast.Expression) (ast.Expression, error) {
+	exp := &ast.MemberExpression{Token: p.curToken, Left: left}
+
+	if ok, err := p.expect(token.IDENT); !ok {
+		return nil, err
+	}
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp, nil
+}
+
 func (p *Parser) parseHashLiteral() (ast.Expression, error) {
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -568,7 +1097,7 @@ func (p *Parser) expect(t token.TokenType) (bool, error) {
 		p.nextToken()
 		return true, nil
 	} else {
-		return false, createParseError("Expected token type %q, got %q instead", t, p.peekToken.Type)
+		return false, createParseError(p.peekToken.Pos, "Expected token type %q, got %q instead", t, p.peekToken.Type)
 	}
 }
 
@@ -584,6 +1113,16 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// Precedence returns how tightly the infix operator t binds, or LOWEST if t
+// is not one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
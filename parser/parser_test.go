@@ -2,8 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"maps"
 	"monkey/ast"
 	"monkey/lexer"
+	"strings"
 	"testing"
 )
 
@@ -257,6 +259,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"-a * b",
 			"((-a) * b)",
 		},
+		{
+			"m.f(a) + m.b.c",
+			"((m.f)(a) + ((m.b).c))",
+		},
+		{
+			"a |> f |> g(b)",
+			"((a |> f) |> g(b))",
+		},
+		{
+			"a + b |> f(c == d)",
+			"((a + b) |> f((c == d)))",
+		},
 		{
 			"!-a",
 			"(!(-a))",
@@ -297,6 +311,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"x += a |> f",
+			"(x += (a |> f))",
+		},
+		{
+			"a[i + 1] -= b[0] * 2",
+			"((a[(i + 1)]) -= ((b[0]) * 2))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || c",
+			"((a && b) || c)",
+		},
+		{
+			"5 <= 4 == 3 >= 4",
+			"((5 <= 4) == (3 >= 4))",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -442,6 +480,8 @@ func testLiteralExpression(
 		return testIntegerLiteral(t, exp, v)
 	case string:
 		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
 	}
 	t.Errorf("type of exp not handled. got=%T", exp)
 	return false
@@ -489,6 +529,70 @@ func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
 	return true
 }
 
+func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
+	bo, ok := exp.(*ast.Boolean)
+	if !ok {
+		t.Errorf("exp not *ast.Boolean. got=%T", exp)
+		return false
+	}
+
+	if bo.Value != value {
+		t.Errorf("bo.Value not %t. got=%t", value, bo.Value)
+		return false
+	}
+
+	if bo.TokenLiteral() != fmt.Sprintf("%t", value) {
+		t.Errorf("bo.TokenLiteral not %t. got=%s", value, bo.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func TestNullLiteralExpression(t *testing.T) {
+	program, err := New(lexer.New("x == null;")).ParseProgram()
+	if err != nil {
+		t.Fatalf("Error: %q", err.Error())
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	infix, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.InfixExpression. got=%T", stmt.Expression)
+	}
+	if _, ok := infix.Right.(*ast.Null); !ok {
+		t.Fatalf("right not *ast.Null. got=%T", infix.Right)
+	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	for _, input := range []string{"return;", "return", "fn() { return }"} {
+		program, err := New(lexer.New(input)).ParseProgram()
+		if err != nil {
+			t.Fatalf("Error for %q: %q", input, err.Error())
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: wrong number of statements. got=%d", input, len(program.Statements))
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	program, err := New(lexer.New("1.25;")).ParseProgram()
+	if err != nil {
+		t.Fatalf("Error: %q", err.Error())
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 1.25 {
+		t.Errorf("literal.Value not %f. got=%f", 1.25, literal.Value)
+	}
+}
+
 func TestBooleanLiteralExpression(t *testing.T) {
 	input := "true;"
 
@@ -522,6 +626,48 @@ func TestBooleanLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < y) { x }`
+
+	program, err := New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatalf("Error: %q", err.Error())
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n", len(exp.Body.Statements))
+	}
+
+	body, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Body.Statements[0])
+	}
+
+	testIdentifier(t, body.Expression, "x")
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `if (x < y) { x }`
 
@@ -573,6 +719,106 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestSwitchExpression(t *testing.T) {
+	input := `switch (x) {
+  case 1: { a }
+  case y if y > 3: { b }
+  default: { c }
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("Error: %q", err.Error())
+	}
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.SwitchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.SwitchExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	if len(exp.Cases) != 3 {
+		t.Fatalf("switch does not have 3 cases. got=%d", len(exp.Cases))
+	}
+
+	testLiteralExpression(t, exp.Cases[0].Value, 1)
+	if exp.Cases[0].Guard != nil {
+		t.Errorf("case 0 has a guard. got=%s", exp.Cases[0].Guard)
+	}
+
+	testIdentifier(t, exp.Cases[1].Value, "y")
+	testInfixExpression(t, exp.Cases[1].Guard, "y", ">", 3)
+
+	if exp.Cases[2].Value != nil || exp.Cases[2].Guard != nil {
+		t.Errorf("default case has a value or guard")
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		body := exp.Cases[i].Body.Statements[0].(*ast.ExpressionStatement)
+		testIdentifier(t, body.Expression, name)
+	}
+
+	if _, err := New(lexer.New(`switch (x) { 1: { a } }`)).ParseProgram(); err == nil {
+		t.Errorf("expected an error for an arm without case")
+	}
+}
+
+func TestSwitchPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`switch (p) { case let [x, y]: { x } }`, "[x, y]"},
+		{`switch (p) { case let {"type": "circle", "r": r}: { r } }`, "{type:circle, r:r}"},
+		{`switch (p) { case let [_, -1, [a, {1: b, true: _}]]: { a } }`, "[_, (-1), [a, {1:b, true:_}]]"},
+		{`switch (p) { case let []: { 0 } }`, "[]"},
+		{`switch (p) { case let n: { n } }`, "n"},
+	}
+
+	for _, tt := range tests {
+		program, err := New(lexer.New(tt.input)).ParseProgram()
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		arm := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SwitchExpression).Cases[0]
+		if arm.Value != nil || arm.Pattern == nil {
+			t.Fatalf("%q: expected a pattern arm, got value %v", tt.input, arm.Value)
+		}
+		if arm.Pattern.String() != tt.expected {
+			t.Errorf("%q: wrong pattern. want=%s, got=%s", tt.input, tt.expected, arm.Pattern)
+		}
+	}
+
+	errors := []struct {
+		input   string
+		message string
+	}{
+		{`switch (p) { case let [x, x]: { x } }`, "x is bound more than once in the pattern"},
+		{`switch (p) { case let [x + 1]: { x } }`, `Expected token type ",", got "+" instead`},
+		{`switch (p) { case let {k: v}: { v } }`, `Expected a string, integer or boolean key in a hash pattern, got "k" instead`},
+		{`switch (p) { case let -x: { x } }`, `Expected a pattern, got "-" instead`},
+		{`switch (p) { case let f(x): { x } }`, `Expected token type ":", got "(" instead`},
+	}
+	for _, tt := range errors {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		if err == nil || err.Error() != tt.message {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.message, err)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -905,3 +1151,246 @@ func TestFunctionLiteralWithName(t *testing.T) {
 			function.Name)
 	}
 }
+
+func TestAssignmentTargetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2", "cannot assign to 1"},
+		{"f() = 2", "cannot assign to f()"},
+		{"a + b = 2", "cannot assign to (a + b)"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestLoopJumpsInsideExpressions(t *testing.T) {
+	rejected := []struct {
+		input    string
+		expected string
+	}{
+		{"while (true) { [1, if (true) { continue }] }", "continue inside an expression at 1:32"},
+		{"while (true) { let y = 1 + if (true) { continue } }", "continue inside an expression at 1:40"},
+		{"while (true) { let x = if (true) { break } }", "break inside an expression at 1:36"},
+		{"while (true) { f(if (true) { break }) }", "break inside an expression at 1:30"},
+		{"while (true) { return if (true) { break } }", "break inside an expression at 1:35"},
+		{"while (if (true) { break }) { 1 }", "break inside an expression at 1:20"},
+		{"while (true) { x = [if (true) { if (true) { break } }] }", "break inside an expression at 1:45"},
+	}
+	for _, tt := range rejected {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	accepted := []string{
+		"while (true) { if (true) { break } }",
+		"while (true) { if (true) { 1 } else { if (true) { continue } } }",
+		"[1, while (true) { break }]",
+		"let f = fn() { while (true) { break } }; [f, fn() { while (true) { continue } }]",
+		"break; continue",
+	}
+	for _, input := range accepted {
+		if _, err := New(lexer.New(input)).ParseProgram(); err != nil {
+			t.Errorf("%q: %s", input, err)
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1", "1:5"},
+		{"1 +", "1:4"},
+		{"(1 + 2", "1:7"},
+		{"let x = 1;\n  a + 1 = 2", "2:3"},
+		{"switch (x) { 1 }", "1:14"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("%q: expected a *ParseError, got %T (%v)", tt.input, err, err)
+		}
+		if parseErr.Pos.String() != tt.expected {
+			t.Errorf("%q: wrong position. want=%s, got=%s", tt.input, tt.expected, parseErr.Pos)
+		}
+	}
+}
+
+func TestNoPrefixErrorHints(t *testing.T) {
+	tests := []struct {
+		input   string
+		pos     string
+		message string
+	}{
+		{"else { 1 }", "1:1", "unexpected else: else must follow an if block"},
+		{"if (x) { 1 };\nelse { 2 }", "2:1", "unexpected else: else must follow an if block"},
+		{"= 5", "1:1", `unexpected "=": did you mean let or ==?`},
+		{"let x = 1;\nx = = 2", "2:5", `unexpected "=": did you mean let or ==?`},
+		{"let x = 1;\n}", "2:1", `unmatched "}": nothing is open for it to close`},
+		{"1 + )", "1:5", `unmatched ")": nothing is open for it to close`},
+		{"let f = fn() {\n  [1, }", "2:7", `unmatched "}": the nearest unclosed delimiter is the "[" at 2:3`},
+		{"foo([1, (2 + ])", "1:14", `unmatched "]": the nearest unclosed delimiter is the "(" at 1:9`},
+		{"foo(1, )", "1:8", `expected an expression before ")" closing the "(" at 1:4`},
+		{"[(1), ]", "1:7", `expected an expression before "]" closing the "[" at 1:1`},
+		{"1 + ;", "1:5", `No prefix expression found for ";" (";").`},
+	}
+
+	for _, tt := range tests {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("%q: expected a *ParseError, got %T (%v)", tt.input, err, err)
+		}
+		if parseErr.Pos.String() != tt.pos {
+			t.Errorf("%q: wrong position. want=%s, got=%s", tt.input, tt.pos, parseErr.Pos)
+		}
+		if parseErr.Error() != tt.message {
+			t.Errorf("%q: wrong message.\nwant=%s\ngot= %s", tt.input, tt.message, parseErr.Error())
+		}
+	}
+}
+
+func TestParseAllCollectsErrors(t *testing.T) {
+	input := `let = 1;
+let x = 2;
+let f = fn(a) {
+  let y = ;
+  a
+};
+let z = x +
+let w = 3;
+)`
+
+	program, errs := New(lexer.New(input)).ParseAll()
+
+	expected := []string{"1:5", "4:11", "8:1", "9:1"}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d: %v", len(expected), len(errs), errs)
+	}
+	for i, want := range expected {
+		if errs[i].Pos.String() != want {
+			t.Errorf("error %d: wrong position. want=%s, got=%s (%s)", i, want, errs[i].Pos, errs[i])
+		}
+	}
+
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	if strings.Join(names, " ") != "x w" {
+		t.Errorf("wrong statements kept. want=%q, got=%q", "x w", names)
+	}
+}
+
+func TestExpressionStatementSemicolon(t *testing.T) {
+	program, err := New(lexer.New("1; 2\nlet x = 3;")).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []bool{true, false} {
+		stmt := program.Statements[i].(*ast.ExpressionStatement)
+		if stmt.Semicolon != want {
+			t.Errorf("statement %d: wrong Semicolon. want=%t, got=%t", i, want, stmt.Semicolon)
+		}
+	}
+}
+
+// TestHostileInput covers inputs that once hung or crashed the parser: each
+// must end in a program or a ParseError.
+func TestHostileInput(t *testing.T) {
+	tests := []struct {
+		input string
+		fails bool
+	}{
+		{"1 é 2", true}, // the lexer never moved past the é
+		{"let x = 1;\x00let y = 2;", true},
+		{strings.Repeat("(", 100000), true},
+		{strings.Repeat("-", 100000) + "1", true},
+		{strings.Repeat("[", 100000), true},
+		{strings.Repeat("fn() {", 100000), true},
+		{strings.Repeat("(", MaxNesting-1) + "1" + strings.Repeat(")", MaxNesting-1), false},
+		{"fn(1) { 1 }", true},
+		{"fn(a, ;) { a }", true},
+		{"return", false},
+		{"}", true},
+		{"a[1", true},
+		{`"unterminated`, false},
+	}
+
+	for _, tt := range tests {
+		name := tt.input
+		if len(name) > 20 {
+			name = name[:20] + "..."
+		}
+
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		if _, ok := err.(*ParseError); err != nil && !ok {
+			t.Errorf("%q: got a %T, want a *ParseError", name, err)
+		}
+		if (err != nil) != tt.fails {
+			t.Errorf("%q: wrong outcome. want fail=%t, got err=%v", name, tt.fails, err)
+		}
+
+		_, errs := New(lexer.New(tt.input)).ParseAll()
+		if (len(errs) > 0) != tt.fails {
+			t.Errorf("%q: ParseAll: wrong outcome. want fail=%t, got %v", name, tt.fails, errs)
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := `// Adds a and b.
+//
+//   Both must be numbers.
+let add = fn(a, b) { a + b };
+let x = 1; // not a doc
+let undocumented = fn() { 1 };
+// separated by a blank line
+
+let alsoUndocumented = fn() { 2 };
+// documented, but not a function
+let y = 2;`
+
+	program, err := NewWithMode(lexer.New(input), ParseComments).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := map[string]string{}
+	for _, stmt := range program.Statements {
+		let := stmt.(*ast.LetStatement)
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			docs[let.Name.Value] = fn.Doc
+		}
+	}
+	expected := map[string]string{
+		"add":              "Adds a and b.\n\n  Both must be numbers.",
+		"undocumented":     "",
+		"alsoUndocumented": "",
+	}
+	if !maps.Equal(docs, expected) {
+		t.Errorf("wrong docs.\nwant=%q\ngot= %q", expected, docs)
+	}
+
+	program, err = New(lexer.New(input)).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Doc; doc != "" {
+		t.Errorf("docs kept without ParseComments: %q", doc)
+	}
+}
@@ -0,0 +1,103 @@
+// Package render colors what the REPL and the command line print. Coloring
+// stays out of object.Inspect, so programs embedding Monkey get plain text.
+package render
+
+import (
+	"fmt"
+	"monkey/object"
+	"os"
+	"strings"
+)
+
+const (
+	reset     = "\x1b[0m"
+	bold      = "\x1b[1m"
+	dim       = "\x1b[2m"
+	normal    = "\x1b[22m" // neither bold nor dim
+	red       = "\x1b[31m"
+	green     = "\x1b[32m"
+	cyan      = "\x1b[36m"
+	defaultFg = "\x1b[39m"
+)
+
+// Mode says when to use color.
+type Mode int
+
+const (
+	// Auto colors output to a terminal unless NO_COLOR is set.
+	Auto Mode = iota
+	Always
+	Never
+)
+
+// ParseMode reads a mode as given to --color: auto, always or never.
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "auto":
+		return Auto, nil
+	case "always":
+		return Always, nil
+	case "never":
+		return Never, nil
+	}
+	return Auto, fmt.Errorf("unknown color mode %q, want auto, always or never", s)
+}
+
+// Colors returns the colors to use under mode for output that goes to a
+// terminal or not.
+func (m Mode) Colors(terminal bool) Colors {
+	switch m {
+	case Always:
+		return Colors{On: true}
+	case Never:
+		return Colors{}
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return Colors{}
+	}
+	return Colors{On: terminal}
+}
+
+// Colors marks text up with ANSI escapes when On, and leaves it alone
+// otherwise.
+type Colors struct {
+	On bool
+}
+
+// Error renders an error message in red, with each mention of pos, such as
+// "1:9", in bold.
+func (c Colors) Error(msg, pos string) string {
+	if !c.On {
+		return msg
+	}
+	if pos != "" {
+		msg = strings.ReplaceAll(msg, pos, bold+pos+normal)
+	}
+	return red + msg + reset
+}
+
+// Caret highlights the line with the caret that points into source.
+func (c Colors) Caret(line string) string {
+	if !c.On {
+		return line
+	}
+	return bold + red + line + reset
+}
+
+// Value renders obj as object.InspectWith does under opts, dimmed, with
+// strings in green and numbers in cyan.
+func (c Colors) Value(obj object.Object, opts object.InspectOptions) string {
+	if !c.On {
+		return object.InspectWith(obj, opts)
+	}
+	opts.Decorate = func(obj object.Object, text string) string {
+		switch obj.(type) {
+		case *object.String:
+			return green + text + defaultFg
+		case *object.Integer, *object.Float:
+			return cyan + text + defaultFg
+		}
+		return text
+	}
+	return dim + object.InspectWith(obj, opts) + reset
+}
@@ -0,0 +1,70 @@
+package render
+
+import (
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestColorsOff(t *testing.T) {
+	var c Colors
+	arr := &object.Array{Elements: []object.Object{object.GetInteger(1), &object.String{Value: "a"}}}
+
+	outputs := []string{
+		c.Value(arr, object.InspectOptions{}),
+		c.Error("parse error at 1:9: oops", "1:9"),
+		c.Caret("   ^"),
+	}
+	want := []string{`[1, "a"]`, "parse error at 1:9: oops", "   ^"}
+	for i, got := range outputs {
+		if got != want[i] {
+			t.Errorf("got %q, want %q", got, want[i])
+		}
+	}
+}
+
+func TestColorsOn(t *testing.T) {
+	c := Colors{On: true}
+	arr := &object.Array{Elements: []object.Object{object.GetInteger(1), &object.String{Value: "a"}, object.TRUE}}
+
+	want := dim + "[" + cyan + "1" + defaultFg + ", " + green + `"a"` + defaultFg + ", true]" + reset
+	if got := c.Value(arr, object.InspectOptions{}); got != want {
+		t.Errorf("Value = %q, want %q", got, want)
+	}
+	want = red + "error at " + bold + "1:9" + normal + ": oops" + reset
+	if got := c.Error("error at 1:9: oops", "1:9"); got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+	if got := c.Caret("  ^"); !strings.Contains(got, "\x1b[") {
+		t.Errorf("Caret = %q, want it highlighted", got)
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		terminal bool
+		noColor  string
+		want     bool
+	}{
+		{"auto", true, "", true},
+		{"auto", false, "", false},
+		{"auto", true, "1", false},
+		{"always", false, "1", true},
+		{"never", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		mode, err := ParseMode(tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mode.Colors(tt.terminal).On; got != tt.want {
+			t.Errorf("%s, terminal %t, NO_COLOR=%q: got %t, want %t", tt.mode, tt.terminal, tt.noColor, got, tt.want)
+		}
+	}
+
+	if _, err := ParseMode("sometimes"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
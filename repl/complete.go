@@ -0,0 +1,51 @@
+package repl
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// completions returns the names that start with prefix, those that match its
+// case first and then those that only match ignoring case, each sorted.
+// Duplicates are dropped.
+func completions(prefix string, names []string) []string {
+	var exact, folded []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] || name == prefix {
+			continue
+		}
+		seen[name] = true
+		switch {
+		case strings.HasPrefix(name, prefix):
+			exact = append(exact, name)
+		case len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix):
+			folded = append(folded, name)
+		}
+	}
+	sort.Strings(exact)
+	sort.Strings(folded)
+	return append(exact, folded...)
+}
+
+// complete finds what a word typed in the session could be: one of its
+// bindings, a builtin or a keyword.
+func (s *session) complete(prefix string) []string {
+	var names []string
+	if b, ok := s.eng.(interface {
+		Bindings() map[string]object.Object
+	}); ok {
+		for name := range b.Bindings() {
+			names = append(names, name)
+		}
+	}
+	for _, builtin := range object.Builtins {
+		names = append(names, builtin.Name)
+	}
+	names = append(names, evaluator.BuiltinNames()...)
+	names = append(names, token.Keywords()...)
+	return completions(prefix, names)
+}
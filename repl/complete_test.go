@@ -0,0 +1,92 @@
+package repl
+
+import (
+	"monkey/engine"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletions(t *testing.T) {
+	names := []string{"first", "filter", "Fill", "fn", "len", "first", "f"}
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"fi", []string{"filter", "first", "Fill"}},
+		{"F", []string{"Fill", "f", "filter", "first", "fn"}},
+		{"fir", []string{"first"}},
+		{"first", nil},
+		{"x", nil},
+		{"", []string{"Fill", "f", "filter", "first", "fn", "len"}},
+	}
+
+	for _, tt := range tests {
+		if got := completions(tt.prefix, names); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: want=%q, got=%q", tt.prefix, tt.expected, got)
+		}
+	}
+}
+
+func TestSessionCompletesBindingsBuiltinsAndKeywords(t *testing.T) {
+	for _, name := range engine.Names {
+		eng, _ := engine.New(name)
+		s := &session{out: &strings.Builder{}, eng: eng}
+		s.run("let counter = 1; let count_words = fn(s) { s };")
+
+		tests := map[string][]string{
+			"coun":  {"count_words", "counter"},
+			"le":    {"len", "let"},
+			"whi":   {"while"},
+			"conti": {"continue"},
+		}
+		for prefix, want := range tests {
+			if got := s.complete(prefix); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q: want=%q, got=%q", name, prefix, want, got)
+			}
+		}
+	}
+}
+
+func TestEditorTabCompletion(t *testing.T) {
+	names := []string{"counter", "count_words", "len"}
+	complete := func(prefix string) []string { return completions(prefix, names) }
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"le\t(x)\r", "len (x)"},
+		{"co\t\r", "count"},
+		{"co\twords\r", "countwords"},
+		{"x + \t\r", "x + "},
+		{"(l\t)\r", "(len )"},
+		{"zz\t\r", "zz"},
+	}
+
+	for _, tt := range tests {
+		e, _ := fakeTerminal(tt.input)
+		e.complete = complete
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. want=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorListsAmbiguousCompletions(t *testing.T) {
+	var out strings.Builder
+	e := newEditor(strings.NewReader("count\t\r"), &out, func() (func(), error) { return func() {}, nil })
+	e.complete = func(prefix string) []string { return completions(prefix, []string{"counter", "count_words"}) }
+
+	if _, err := e.ReadLine(PROMPT); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "\r\ncount_words  counter\r\n") {
+		t.Errorf("candidates not listed. got=%q", out.String())
+	}
+}
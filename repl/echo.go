@@ -0,0 +1,23 @@
+package repl
+
+import (
+	"monkey/object"
+	"monkey/render"
+)
+
+// DefaultEchoLimit is how many elements of an array or pairs of a hash are
+// echoed when Options.EchoLimit is zero.
+const DefaultEchoLimit = 100
+
+// echo renders a result the way the REPL shows it: as Inspect does, except
+// that a string on its own is quoted too, so "5" and 5 look different, and
+// arrays and hashes stop after limit elements. colors marks it up.
+func echo(result object.Object, limit int, colors render.Colors) string {
+	if limit == 0 {
+		limit = DefaultEchoLimit
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return colors.Value(result, object.InspectOptions{Limit: limit, Quote: true})
+}
@@ -0,0 +1,322 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by ReadLine when Ctrl-C discards the line.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads one line of input after showing prompt. It returns io.EOF
+// once there is no more input.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader edits lines in place when in and out are a terminal, and
+// otherwise reads plain lines, so piped input behaves as it always has.
+// complete finds the completions of a word for the Tab key.
+func newLineReader(in io.Reader, out io.Writer, complete func(prefix string) []string) lineReader {
+	inFile, inOK := in.(*os.File)
+	outFile, outOK := out.(*os.File)
+	if inOK && outOK && isTerminal(inFile.Fd()) && isTerminal(outFile.Fd()) {
+		editor := newEditor(inFile, out, func() (func(), error) { return makeRaw(inFile.Fd()) })
+		editor.historyPath = HistoryPath
+		editor.historySize = HistorySize
+		editor.history, _ = loadHistory(HistoryPath, HistorySize)
+		editor.complete = complete
+		return editor
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// IsTerminal reports whether f is a terminal, where the REPL can edit lines.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f.Fd())
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editor reads lines from a terminal in raw mode, with cursor movement,
+// Emacs-style editing keys and history.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	makeRaw func() (restore func(), err error)
+
+	// complete returns the candidates for completing a word; nil turns Tab
+	// off.
+	complete func(prefix string) []string
+
+	history     []string
+	historyPath string // where history is saved after each line; "" to not save
+	historySize int
+
+	line   []rune
+	cursor int
+	prompt string
+}
+
+func newEditor(in io.Reader, out io.Writer, makeRaw func() (func(), error)) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, makeRaw: makeRaw}
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := e.makeRaw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.line = e.line[:0]
+	e.cursor = 0
+	e.prompt = prompt
+	// Browsing history starts past the newest entry, at the line being typed.
+	entry := len(e.history)
+	typed := ""
+	e.redraw()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			e.remember(line)
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.cursor)
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.line)
+		case keyCtrlB:
+			e.move(-1)
+		case keyCtrlF:
+			e.move(1)
+		case keyCtrlH, keyBackspace:
+			if e.cursor > 0 {
+				e.cursor--
+				e.deleteAt(e.cursor)
+			}
+		case keyCtrlK:
+			e.line = e.line[:e.cursor]
+		case keyCtrlU:
+			e.line = append(e.line[:0], e.line[e.cursor:]...)
+			e.cursor = 0
+		case keyCtrlW:
+			e.deleteWord()
+		case keyTab:
+			e.completeWord()
+		case keyCtrlP:
+			entry, typed = e.browse(entry, entry-1, typed)
+		case keyCtrlN:
+			entry, typed = e.browse(entry, entry+1, typed)
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				entry, typed = e.browse(entry, entry-1, typed)
+			case 'B':
+				entry, typed = e.browse(entry, entry+1, typed)
+			case 'C':
+				e.move(1)
+			case 'D':
+				e.move(-1)
+			case 'H':
+				e.cursor = 0
+			case 'F':
+				e.cursor = len(e.line)
+			case '3':
+				e.deleteAt(e.cursor)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.line = append(e.line[:e.cursor], append([]rune{r}, e.line[e.cursor:]...)...)
+				e.cursor++
+			}
+		}
+		e.redraw()
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns the byte that
+// identifies the key, or 0 for sequences it doesn't know.
+func (e *editor) readEscape() byte {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return 0
+	}
+	if b >= '0' && b <= '9' {
+		// Keys like Delete are ESC [ 3 ~.
+		if next, err := e.in.ReadByte(); err != nil || next != '~' {
+			return 0
+		}
+	}
+	return b
+}
+
+func (e *editor) move(by int) {
+	e.cursor += by
+	if e.cursor < 0 {
+		e.cursor = 0
+	}
+	if e.cursor > len(e.line) {
+		e.cursor = len(e.line)
+	}
+}
+
+func (e *editor) deleteAt(i int) {
+	if i < len(e.line) {
+		e.line = append(e.line[:i], e.line[i+1:]...)
+	}
+}
+
+// deleteWord deletes back to the start of the word before the cursor.
+func (e *editor) deleteWord() {
+	start := e.cursor
+	for start > 0 && unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	e.line = append(e.line[:start], e.line[e.cursor:]...)
+	e.cursor = start
+}
+
+// completeWord extends the word before the cursor as far as its completions
+// agree, listing them when that doesn't get any further.
+func (e *editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start := e.cursor
+	for start > 0 && isWordRune(e.line[start-1]) {
+		start--
+	}
+	prefix := string(e.line[start:e.cursor])
+
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+	common := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		common = commonPrefix(common, []rune(candidate))
+	}
+	if len(candidates) == 1 {
+		common = append(common, ' ')
+	}
+
+	// Candidates may differ from the word in case, so the word is replaced
+	// rather than added to.
+	if len(common) > e.cursor-start {
+		e.line = append(e.line[:start], append(common, e.line[e.cursor:]...)...)
+		e.cursor = start + len(common)
+		return
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '?' || r == '!'
+}
+
+func commonPrefix(a, b []rune) []rune {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+// browse moves from history entry from to entry to, keeping what was typed
+// before browsing so that moving past the newest entry brings it back.
+func (e *editor) browse(from, to int, typed string) (int, string) {
+	if to < 0 || to > len(e.history) {
+		return from, typed
+	}
+	if from == len(e.history) {
+		typed = string(e.line)
+	}
+	if to == len(e.history) {
+		e.line = []rune(typed)
+	} else {
+		e.line = []rune(e.history[to])
+	}
+	e.cursor = len(e.line)
+	return to, typed
+}
+
+func (e *editor) remember(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = lastLines(append(e.history, line), e.historySize)
+	if e.historyPath != "" {
+		saveHistory(e.historyPath, e.history, e.historySize)
+	}
+}
+
+// redraw rewrites the prompt and line and puts the terminal cursor back where
+// the editor's cursor is.
+func (e *editor) redraw() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.line))
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -0,0 +1,174 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fakeTerminal(input string) (*editor, *int) {
+	restored := 0
+	e := newEditor(strings.NewReader(input), io.Discard, func() (func(), error) {
+		return func() { restored++ }, nil
+	})
+	return e, &restored
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"ab\x01c\r", "cab"},
+		{"ab\x01\x05c\r", "abc"},
+		{"abc\x7f\x7fd\r", "ad"},
+		{"let x = 1\x17y\r", "let x = y"},
+		{"let x = 1  \x17\r", "let x = "},
+		{"abc\x02\x02\x0b\r", "a"},
+		{"abc\x02\x15\r", "c"},
+		{"ac\x1b[Db\r", "abc"},
+		{"ab\x1b[H\x1b[3~\x1b[F!\r", "b!"},
+		{"héllo\x02\x02\x02\x7f\r", "hllo"},
+	}
+
+	for _, tt := range tests {
+		e, restored := fakeTerminal(tt.input)
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %s", tt.input, err)
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. want=%q, got=%q", tt.input, tt.expected, line)
+		}
+		if *restored != 1 {
+			t.Errorf("%q: terminal restored %d times", tt.input, *restored)
+		}
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e, _ := fakeTerminal("one\rtwo\rtwo\r\r\x1b[A\x1b[A\r\x10\x10\x10\x0e\r" + "new\x1b[A\x1b[B\r")
+
+	expected := []string{"one", "two", "two", "", "one", "two", "new"}
+	for _, want := range expected {
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if line != want {
+			t.Errorf("wrong line. want=%q, got=%q", want, line)
+		}
+	}
+
+	if want := []string{"one", "two", "one", "two", "new"}; !reflect.DeepEqual(e.history, want) {
+		t.Errorf("wrong history. want=%q, got=%q", want, e.history)
+	}
+}
+
+func TestEditorEndsAndInterrupts(t *testing.T) {
+	e, _ := fakeTerminal("abc\x03ab\x04\x01\x04\r\x04")
+
+	if _, err := e.ReadLine(PROMPT); err != errInterrupted {
+		t.Fatalf("expected interrupt, got %v", err)
+	}
+	// Ctrl-D deletes under the cursor unless the line is empty.
+	if line, err := e.ReadLine(PROMPT); err != nil || line != "b" {
+		t.Fatalf("wrong line. got=%q (%v)", line, err)
+	}
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestHistoryFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	lines, err := loadHistory(path, 3)
+	if err != nil || len(lines) != 0 {
+		t.Fatalf("missing file should be empty history, got %q (%v)", lines, err)
+	}
+
+	if err := saveHistory(path, []string{"a", "b", "c", "d"}, 3); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("wrong permissions. want=0600, got=%o", perm)
+	}
+
+	lines, err = loadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "c", "d"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("wrong history. want=%q, got=%q", want, lines)
+	}
+
+	lines, _ = loadHistory(path, 2)
+	if want := []string{"c", "d"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("wrong truncated history. want=%q, got=%q", want, lines)
+	}
+}
+
+func TestEditorSavesHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	e, _ := fakeTerminal("1 + 1\r2 + 2\r3 + 3\r")
+	e.historyPath = path
+	e.historySize = 2
+
+	for i := 0; i < 3; i++ {
+		if _, err := e.ReadLine(PROMPT); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2 + 2\n3 + 3\n"; string(data) != want {
+		t.Errorf("wrong history file. want=%q, got=%q", want, data)
+	}
+}
+
+func TestNonTerminalInputIsNotEdited(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	go func() {
+		w.WriteString("ab\x01c\n")
+		w.Close()
+	}()
+
+	reader := newLineReader(r, os.Stdout, nil)
+	if _, ok := reader.(*scannerReader); !ok {
+		t.Fatalf("a pipe should be read without editing, got %T", reader)
+	}
+
+	var out bytes.Buffer
+	reader = newLineReader(r, &out, nil)
+	line, err := reader.ReadLine(PROMPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "ab\x01c" {
+		t.Errorf("wrong line. want=%q, got=%q", "ab\x01c", line)
+	}
+	if out.String() != PROMPT {
+		t.Errorf("wrong output. want=%q, got=%q", PROMPT, out.String())
+	}
+	if _, err := reader.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HistoryPath is where interactive sessions keep their line history. Empty
+// turns saving off.
+var HistoryPath = defaultHistoryPath()
+
+// HistorySize is how many lines of history are kept.
+var HistorySize = 1000
+
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory reads up to the last max lines of the history file at path. A
+// missing file is an empty history.
+func loadHistory(path string, max int) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	return lastLines(lines, max), nil
+}
+
+// saveHistory writes the last max lines to path, readable only by the user.
+func saveHistory(path string, lines []string, max int) error {
+	lines = lastLines(lines, max)
+	data := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		data += "\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already exists.
+	return os.Chmod(path, 0o600)
+}
+
+func lastLines(lines []string, max int) []string {
+	if max > 0 && len(lines) > max {
+		return lines[len(lines)-max:]
+	}
+	return lines
+}
@@ -1,62 +1,793 @@
 package repl
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"monkey/analysis"
+	"monkey/ast"
 	"monkey/compiler"
+	"monkey/engine"
+	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
-	"monkey/vm"
+	"monkey/render"
+	"monkey/token"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 const PROMPT = "==> "
 
+// CONTINUATION_PROMPT asks for the rest of an input left with brackets open.
+const CONTINUATION_PROMPT = "... "
+
+// Options configures a REPL.
+type Options struct {
+	// Prompt starts each input, and ContinuationPrompt each further line of
+	// an input left with brackets open. Empty means PROMPT and
+	// CONTINUATION_PROMPT.
+	Prompt             string
+	ContinuationPrompt string
+
+	// Banner is printed once before the first prompt.
+	Banner string
+
+	// Out receives prompts and results, and Err receives errors and
+	// warnings. A nil Err means Out.
+	Out io.Writer
+	Err io.Writer
+
+	// EchoResults prints the value of each input. Output a program prints
+	// itself, such as with puts, is shown either way.
+	EchoResults bool
+
+	// EchoLimit is how many elements of an array or pairs of a hash are
+	// echoed before the rest are summed up. Zero means DefaultEchoLimit and
+	// a negative limit echoes everything.
+	EchoLimit int
+
+	// Engine names the engine that evaluates lines, as accepted by
+	// engine.New. Empty means the VM, which can't run switch or spawn.
+	Engine string
+
+	// SlowEval makes the REPL report how long a line took when it takes
+	// longer than this. Zero never reports.
+	SlowEval time.Duration
+
+	// Color colors errors and echoed results. render.Mode.Colors decides it
+	// from a --color flag and the terminal.
+	Color bool
+}
+
+// Start runs the REPL on the VM, echoing results.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GLOBALSSIZE)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
-	}
-
-	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+	StartWithOptions(in, Options{Out: out, EchoResults: true})
+}
+
+// StartWithOptions runs the REPL configured by opts.
+func StartWithOptions(in io.Reader, opts Options) {
+	name := opts.Engine
+	if name == "" {
+		name = "vm"
+	}
+	s := &session{
+		out:          opts.Out,
+		errOut:       opts.Err,
+		prompt:       opts.Prompt,
+		continuation: opts.ContinuationPrompt,
+		quiet:        !opts.EchoResults,
+		echoLimit:    opts.EchoLimit,
+		engineName:   name,
+		slowEval:     opts.SlowEval,
+		colors:       render.Colors{On: opts.Color},
+	}
+	eng, err := newEngine(name)
+	if err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	s.eng = eng
+
+	io.WriteString(s.out, opts.Banner)
+	start(in, s)
+}
+
+// StartWithEngine runs the REPL, evaluating each line with eng.
+func StartWithEngine(in io.Reader, out io.Writer, eng engine.Engine) {
+	name := "vm"
+	if _, ok := eng.(*engine.TreeWalkerEngine); ok {
+		name = "eval"
+	}
+	engine.DefineArgs(eng, nil)
+	start(in, &session{out: out, eng: eng, engineName: name})
+}
+
+// newEngine returns a fresh engine by name, with args defined as it is for a
+// script run without arguments, so scripts can be pasted in unchanged.
+func newEngine(name string) (engine.Engine, error) {
+	eng, err := engine.New(name)
+	if err != nil {
+		return nil, err
+	}
+	engine.DefineArgs(eng, nil)
+	return eng, nil
+}
+
+func start(in io.Reader, s *session) {
+	serve(newLineReader(in, s.out, s.complete), s)
+}
+
+// serve runs the inputs read from reader until input ends or the session is
+// done.
+func serve(reader lineReader, s *session) {
+	if s.prompt == "" {
+		s.prompt = PROMPT
+	}
+	if s.continuation == "" {
+		s.continuation = CONTINUATION_PROMPT
+	}
+
+	interrupted := false
+	for !s.done {
+		input, err := readInput(reader, s.prompt, s.continuation)
+		if err == errInterrupted {
+			// Ctrl-C discards the input; a second one in a row quits.
+			if interrupted {
+				return
+			}
+			interrupted = true
+			fmt.Fprintln(s.out, "(press Ctrl-C again to quit)")
+			continue
+		}
+		interrupted = false
+		if err != nil && input == "" {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		if strings.HasPrefix(input, ":") {
+			s.command(input)
+		} else if t, ok := s.run(input); ok && s.slowEval > 0 && t.total() > s.slowEval {
+			fmt.Fprintf(s.out, "(took %s)\n", roundDuration(t.total()))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
 
-		program, err := p.ParseProgram()
+// readInput reads one input, which goes on over further lines while it has
+// brackets open or is only comments, which may document what comes next. An
+// empty line ends it regardless, so a stray bracket can't trap the user. When
+// input ends partway, the lines read so far are returned with the error.
+func readInput(reader lineReader, prompt, continuation string) (string, error) {
+	input, err := reader.ReadLine(prompt)
+	if err != nil || strings.HasPrefix(input, ":") {
+		return input, err
+	}
+	for openBrackets(input) || onlyComments(input) {
+		line, err := reader.ReadLine(continuation)
+		if err == errInterrupted {
+			return "", err
+		}
 		if err != nil {
-			fmt.Fprintf(out, "Whoops: Parser error: %s\n", err.Error())
+			return input, err
 		}
+		if line == "" {
+			break
+		}
+		input += "\n" + line
+	}
+	return input, nil
+}
+
+// openBrackets reports whether source opens more brackets than it closes.
+func openBrackets(source string) bool {
+	depth := 0
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// onlyComments reports whether source has comments and nothing else.
+func onlyComments(source string) bool {
+	l := lexer.New(source)
+	return l.NextToken().Type == token.EOF && len(l.Comments()) > 0
+}
+
+// session is the state of one REPL: where output goes, the engine that
+// evaluates lines and the modes meta-commands have toggled.
+type session struct {
+	out        io.Writer
+	errOut     io.Writer // nil means out
+	eng        engine.Engine
+	engineName string
+	done       bool
+
+	prompt, continuation string
+	quiet                bool // don't echo results
+	echoLimit            int  // see Options.EchoLimit
+
+	showAST      bool
+	showBytecode bool
+	showWarnings bool
+
+	colors render.Colors
 
-		comp := compiler.NewWithState(symbolTable, constants)
+	// inputs are the inputs that ran successfully, for :save.
+	inputs []string
+
+	// checkpoint is the state :checkpoint saved, nil before one, and
+	// checkpointInputs how many inputs had run then.
+	checkpoint       *engine.State
+	checkpointInputs int
+
+	slowEval time.Duration
+	now      func() time.Time // the clock lines are timed with; nil is time.Now
+
+	// interruptible returns the context evaluations run under, which is
+	// cancelled when evaluation should stop, and a function to call once it
+	// is over. Nil means cancelling on SIGINT.
+	interruptible func() (context.Context, context.CancelFunc)
+}
+
+func (s *session) errors() io.Writer {
+	if s.errOut != nil {
+		return s.errOut
+	}
+	return s.out
+}
+
+// commands are the meta-commands, typed as ":name args". Each handler gets
+// the rest of the line after the name.
+var commands = map[string]func(s *session, args string){
+	"ast":        (*session).astCommand,
+	"bytecode":   (*session).bytecodeCommand,
+	"engine":     (*session).engineCommand,
+	"env":        (*session).envCommand,
+	"doc":        (*session).docCommand,
+	"time":       (*session).timeCommand,
+	"load":       (*session).loadCommand,
+	"save":       (*session).saveCommand,
+	"reset":      (*session).resetCommand,
+	"checkpoint": (*session).checkpointCommand,
+	"rollback":   (*session).rollbackCommand,
+	"clear":      (*session).clearCommand,
+	"warnings":   (*session).warningsCommand,
+}
+
+func (s *session) command(line string) {
+	name, args, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	handler, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.errors(), "Unknown command :%s\n", name)
+		return
+	}
+	handler(s, strings.TrimSpace(args))
+}
+
+// astCommand prints the parse tree of its argument, or with no argument toggles
+// printing the tree of every line before it runs.
+func (s *session) astCommand(args string) {
+	if args == "" {
+		s.showAST = !s.showAST
+		fmt.Fprintf(s.out, "AST display %s\n", onOff(s.showAST))
+		return
+	}
+	if program, ok := s.parse(args); ok {
+		s.printAST(program)
+	}
+}
+
+func (s *session) printAST(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		fmt.Fprintf(s.out, "%s\n", stmt.String())
+	}
+}
+
+// warningsCommand prints what analysis finds in its argument without
+// running it, or with no argument toggles printing it for every line before
+// it runs.
+func (s *session) warningsCommand(args string) {
+	if args == "" {
+		s.showWarnings = !s.showWarnings
+		fmt.Fprintf(s.out, "Warnings %s\n", onOff(s.showWarnings))
+		return
+	}
+	if program, ok := s.parse(args); ok {
+		s.printWarnings(program)
+	}
+}
+
+func (s *session) printWarnings(program *ast.Program) {
+	for _, warning := range analysis.Program(program) {
+		fmt.Fprintf(s.errors(), "%s\n", warning)
+	}
+}
+
+// bytecodeCommand prints the compiled instructions and constants of its
+// argument without running it, or with no argument toggles printing them for
+// every line before it runs.
+func (s *session) bytecodeCommand(args string) {
+	if args == "" {
+		s.showBytecode = !s.showBytecode
+		fmt.Fprintf(s.out, "Bytecode display %s\n", onOff(s.showBytecode))
+		return
+	}
+	if program, ok := s.parse(args); ok {
+		s.printBytecode(program, args)
+	}
+}
+
+// printBytecode compiles against the VM engine's globals so the listing shows
+// the slots the line really uses. Other engines have no compiled state, so
+// their lines are compiled on their own. It reports whether the engine would
+// fail to compile the line too.
+func (s *session) printBytecode(program *ast.Program, source string) (failed bool) {
+	var bytecode *compiler.Bytecode
+	var symbols *compiler.SymbolTable
+	var err error
+	c, compiles := s.eng.(interface {
+		Compile(*ast.Program) (*compiler.Bytecode, *compiler.SymbolTable, error)
+	})
+	if compiles {
+		bytecode, symbols, err = c.Compile(program)
+	} else {
+		comp := compiler.New()
 		err = comp.Compile(program)
-		if err != nil {
-			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
-			continue
+		bytecode, symbols = comp.Bytecode(), comp.SymbolTable()
+	}
+	if err != nil {
+		s.fail("Compilation", err, source, "")
+		return compiles
+	}
+	io.WriteString(s.out, bytecode.DisassembleWith(symbols))
+	return false
+}
+
+// engineCommand switches to the named engine, or with no argument names the
+// current one. Engines don't share state, so switching starts a fresh session
+// and, as :reset does, forgets the inputs :save would write.
+func (s *session) engineCommand(args string) {
+	if args == "" {
+		fmt.Fprintf(s.out, "Using the %s engine\n", s.engineName)
+		return
+	}
+	eng, err := newEngine(args)
+	if err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	s.eng, s.engineName = eng, args
+	s.inputs = nil
+	s.checkpoint = nil
+	fmt.Fprintf(s.out, "Switched to the %s engine; earlier bindings are gone\n", args)
+}
+
+// envValueWidth is how much of each value :env shows in its listing.
+const envValueWidth = 40
+
+// envCommand lists the session's bindings with their types and values, sorted
+// by name. "--all" adds the builtins, and a name shows that binding in full.
+func (s *session) envCommand(args string) {
+	var bindings map[string]object.Object
+	if b, ok := s.eng.(interface {
+		Bindings() map[string]object.Object
+	}); ok {
+		bindings = b.Bindings()
+	}
+
+	if args != "" && args != "--all" {
+		value, ok := bindings[args]
+		if !ok {
+			fmt.Fprintf(s.errors(), "%s is not defined\n", args)
+			return
 		}
+		fmt.Fprintf(s.out, "%s: %s\n%s\n", args, value.Type(), object.InspectVerbose(value))
+		if closure, ok := value.(*object.Closure); ok {
+			fmt.Fprintf(s.out, "parameters: %d\n", closure.Fn.NumParameters)
+		}
+		return
+	}
+
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		code := comp.Bytecode()
-		constants = code.Constants
+	w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		value := bindings[name]
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, value.Type(), truncate(value.Inspect(), envValueWidth))
+	}
+	w.Flush()
 
-		machine := vm.NewWithGlobalsStore(code, globals)
-		err = machine.Run()
-		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+	if args == "--all" {
+		fmt.Fprintln(s.out, "builtins:")
+		for _, builtin := range object.Builtins {
+			fmt.Fprintf(s.out, "  %s\n", builtin.Name)
+		}
+	}
+}
+
+// docCommand prints what help would for the binding or builtin name.
+func (s *session) docCommand(name string) {
+	if name == "" {
+		fmt.Fprintln(s.errors(), "usage: :doc <name>")
+		return
+	}
+	var value object.Object
+	if b, ok := s.eng.(interface {
+		Bindings() map[string]object.Object
+	}); ok {
+		value = b.Bindings()[name]
+	}
+	if value == nil {
+		if builtin := object.GetBuiltinByName(name); builtin != nil {
+			value = builtin
+		}
+	}
+	if value == nil {
+		fmt.Fprintf(s.errors(), "%s is not defined\n", name)
+		return
+	}
+	fmt.Fprintln(s.out, object.Help(value))
+}
+
+// truncate fits text on one line of at most width characters.
+func truncate(text string, width int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > width {
+		return string(runes[:width-3]) + "..."
+	}
+	return text
+}
+
+// loadCommand runs a file in the session as though it had been typed in,
+// defining its functions and variables in the session.
+func (s *session) loadCommand(path string) {
+	if path == "" {
+		fmt.Fprintln(s.errors(), "usage: :load <file>")
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	source := string(data)
+
+	program, err := parser.NewWithMode(lexer.New(source), parser.ParseComments).ParseProgram()
+	if err != nil {
+		s.fail("Parsing", err, source, path)
+		return
+	}
+	ctx, stop := s.evalContext()
+	_, err = s.eng.RunContext(ctx, program)
+	stop()
+	if s.report(nil, err, source, path) {
+		s.inputs = append(s.inputs, strings.TrimRight(source, "\n"))
+		fmt.Fprintf(s.out, "Loaded %s\n", path)
+	}
+}
+
+// saveCommand writes the inputs that have run successfully so far to a file,
+// one after another, so that running it rebuilds the session.
+func (s *session) saveCommand(path string) {
+	if path == "" {
+		fmt.Fprintln(s.errors(), "usage: :save <file>")
+		return
+	}
+	var source strings.Builder
+	for _, input := range s.inputs {
+		source.WriteString(input)
+		source.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(source.String()), 0o644); err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "Saved %d inputs to %s\n", len(s.inputs), path)
+}
+
+// resetCommand starts the session over with a fresh engine of the same kind,
+// dropping every binding along with the engine's counters, and forgets the
+// inputs :save would write.
+func (s *session) resetCommand(string) {
+	eng, err := newEngine(s.engineName)
+	if err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	s.eng = eng
+	s.inputs = nil
+	s.checkpoint = nil
+	fmt.Fprintln(s.out, "Session reset; earlier bindings are gone")
+}
+
+// checkpointCommand saves the session's bindings for :rollback, replacing
+// any earlier checkpoint.
+func (s *session) checkpointCommand(string) {
+	snapshotter, ok := s.eng.(engine.Snapshotter)
+	if !ok {
+		fmt.Fprintf(s.errors(), "The %s engine can't checkpoint\n", s.engineName)
+		return
+	}
+	state, err := snapshotter.Snapshot()
+	if err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	s.checkpoint, s.checkpointInputs = state, len(s.inputs)
+	fmt.Fprintln(s.out, "Checkpoint saved")
+}
+
+// rollbackCommand puts the session's bindings back as they were at the last
+// :checkpoint, which stays for rolling back to again.
+func (s *session) rollbackCommand(string) {
+	if s.checkpoint == nil {
+		fmt.Fprintln(s.errors(), "No checkpoint to roll back to")
+		return
+	}
+	if err := s.eng.(engine.Snapshotter).Restore(s.checkpoint); err != nil {
+		fmt.Fprintf(s.errors(), "%s\n", err)
+		return
+	}
+	s.inputs = s.inputs[:s.checkpointInputs]
+	fmt.Fprintln(s.out, "Rolled back to the checkpoint")
+}
+
+// clearCommand clears the terminal, leaving the session as it was.
+func (s *session) clearCommand(string) {
+	io.WriteString(s.out, "\x1b[H\x1b[2J")
+}
+
+func (s *session) parse(line string) (*ast.Program, bool) {
+	p := parser.NewWithMode(lexer.New(line), parser.ParseComments)
+	program, err := p.ParseProgram()
+	if err != nil {
+		s.fail("Parsing", err, line, "")
+		return nil, false
+	}
+	return program, true
+}
+
+// timing is how long each stage of running a line took.
+type timing struct {
+	parse, eval time.Duration
+	steps       int // nodes evaluated, when counted is set
+	counted     bool
+}
+
+func (t timing) total() time.Duration {
+	return t.parse + t.eval
+}
+
+func (s *session) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func (s *session) evalContext() (context.Context, context.CancelFunc) {
+	if s.interruptible != nil {
+		return s.interruptible()
+	}
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// run parses and runs line, printing its result or error, and reports how
+// long that took. It reports false if the line didn't parse.
+func (s *session) run(line string) (timing, bool) {
+	var t timing
+	start := s.clock()
+	program, ok := s.parse(line)
+	t.parse = s.clock().Sub(start)
+	if !ok {
+		return t, false
+	}
+	if s.showAST {
+		s.printAST(program)
+	}
+	if s.showWarnings {
+		s.printWarnings(program)
+	}
+	if s.showBytecode && s.printBytecode(program, line) {
+		return t, true
+	}
+
+	counter, counted := s.eng.(interface{ Steps() int })
+	var steps int
+	if counted {
+		steps = counter.Steps()
+	}
+	ctx, stop := s.evalContext()
+	start = s.clock()
+	result, err := s.eng.RunContext(ctx, program)
+	t.eval = s.clock().Sub(start)
+	stop()
+	if counted {
+		t.steps, t.counted = counter.Steps()-steps, true
+	}
+
+	if !echoes(program) {
+		result = nil
+	}
+	if s.report(result, err, line, "") {
+		s.inputs = append(s.inputs, line)
+	}
+	return t, true
+}
+
+// echoes reports whether the result of program is worth echoing: not if it
+// ends with a let, or with a semicolon that says the value isn't wanted.
+func echoes(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return true
+	}
+	switch stmt := program.Statements[len(program.Statements)-1].(type) {
+	case *ast.LetStatement:
+		return false
+	case *ast.ExpressionStatement:
+		return !stmt.Semicolon
+	}
+	return true
+}
+
+// report prints what running source produced, naming the file it came from
+// in errors if it has a name, and reports whether it ran successfully. A nil
+// or null result isn't printed.
+func (s *session) report(result object.Object, err error, source, name string) bool {
+	if w, ok := s.eng.(interface {
+		Warnings() []*compiler.CompileWarning
+	}); ok {
+		for _, warning := range w.Warnings() {
+			fmt.Fprintf(s.errors(), "%s\n", warning)
+		}
+	}
+	var exit *object.ExitError
+	if errors.As(err, &exit) {
+		s.done = true
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(s.errors(), "interrupted")
+		return false
+	}
+	var compileErr *compiler.CompileError
+	if errors.As(err, &compileErr) {
+		s.fail("Compilation", compileErr, source, name)
+		return false
+	}
+	if err != nil {
+		s.fail("Executing", err, source, name)
+		return false
+	}
+
+	if !s.quiet && result != nil && result != object.NULL {
+		io.WriteString(s.out, echo(result, s.echoLimit, s.colors))
+		io.WriteString(s.out, "\n")
+	}
+	return true
+}
+
+// timeCommand runs its argument like any line and then prints how long parsing
+// and evaluating it took, with the evaluation steps if the engine counts them.
+func (s *session) timeCommand(args string) {
+	t, ok := s.run(args)
+	if !ok || s.done {
+		return
+	}
+	fmt.Fprintf(s.out, "parse: %s, eval: %s, total: %s", roundDuration(t.parse), roundDuration(t.eval), roundDuration(t.total()))
+	if t.counted {
+		fmt.Fprintf(s.out, ", steps: %d", t.steps)
+	}
+	io.WriteString(s.out, "\n")
+}
+
+// roundDuration keeps three significant digits, which is all a one-off timing
+// is good for.
+func roundDuration(d time.Duration) time.Duration {
+	unit := time.Nanosecond
+	for d >= 1000*unit && unit < time.Hour {
+		unit *= 10
+	}
+	return d.Round(unit)
+}
+
+// fail reports an error from a stage of running source, prefixed with the
+// name of its file if it has one. Errors that know where they happened show
+// that line of source with a caret under the spot.
+func (s *session) fail(stage string, err error, source, name string) {
+	msg := fmt.Sprintf("Woops! %s failed:\n %s", stage, err)
+	if name != "" {
+		msg = fmt.Sprintf("Woops! %s failed:\n %s: %s", stage, name, err)
+	}
+	pos, ok := errorPos(err)
+	if ok {
+		msg = s.colors.Error(msg, pos.String())
+	} else {
+		msg = s.colors.Error(msg, "")
+	}
+	fmt.Fprintf(s.errors(), "%s\n", msg)
+	if ok {
+		text, marker := caret(source, pos)
+		if text != "" {
+			fmt.Fprintf(s.errors(), "%s\n%s\n", text, s.colors.Caret(marker))
+		}
+	}
+}
+
+func errorPos(err error) (token.Position, bool) {
+	var parseErr *parser.ParseError
+	var compileErr *compiler.CompileError
+	var evalErr *evaluator.EvalError
+	var pos token.Position
+	switch {
+	case errors.As(err, &parseErr):
+		pos = parseErr.Pos
+	case errors.As(err, &compileErr):
+		pos = compileErr.Pos
+	case errors.As(err, &evalErr):
+		pos = evalErr.Pos
+	}
+	return pos, pos.Line > 0
+}
+
+// tabWidth is the tab stop used to line carets up under source with tabs.
+const tabWidth = 4
+
+// caret renders line pos.Line of source, with tabs expanded, and a line with
+// a ^ under column pos.Column. It renders nothing for a line source doesn't
+// have.
+func caret(source string, pos token.Position) (text, marker string) {
+	lines := strings.Split(source, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return "", ""
+	}
+
+	var line strings.Builder
+	offset := -1
+	width := 0
+	for i, r := range []rune(lines[pos.Line-1]) {
+		if i == pos.Column-1 {
+			offset = width
+		}
+		if r == '\t' {
+			n := tabWidth - width%tabWidth
+			line.WriteString(strings.Repeat(" ", n))
+			width += n
 			continue
 		}
+		line.WriteRune(r)
+		width++
+	}
+	if offset < 0 {
+		// Errors at the end of input point just past the last character.
+		offset = width
+	}
+
+	return " " + line.String(), " " + strings.Repeat(" ", offset) + "^"
+}
 
-		lastPopped := machine.LastPoppedStackElem()
-		io.WriteString(out, lastPopped.Inspect())
-		io.WriteString(out, "\n")
+func onOff(on bool) string {
+	if on {
+		return "on"
 	}
+	return "off"
 }
@@ -0,0 +1,628 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"monkey/engine"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmptyArrayBuiltins(t *testing.T) {
+	in := strings.NewReader("[first([]), last([]), rest([])]\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "[null, null, null]\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestStartWithEngine(t *testing.T) {
+	in := strings.NewReader("let x = 2;\nx * 3\nmissing\n")
+	var out bytes.Buffer
+
+	StartWithEngine(in, &out, engine.NewTreeWalkerEngine(nil))
+
+	expected := PROMPT + PROMPT + "6\n" + PROMPT +
+		"Woops! Executing failed:\n identifier not found: missing\n missing\n ^\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	in := strings.NewReader("let length = 3;\nlenght + 1\nlength\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + PROMPT +
+		"Woops! Compilation failed:\n compile error at 1:1: undefined variable \"lenght\", did you mean \"length\"?\n lenght + 1\n ^\n" +
+		PROMPT + "3\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	in := strings.NewReader("let = 1\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "Woops! Parsing failed:\n Expected token type \"IDENT\", got \"=\" instead\n let = 1\n     ^\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestExitEndsTheSession(t *testing.T) {
+	in := strings.NewReader("1\nexit()\n2\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "1\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestCompileWarnings(t *testing.T) {
+	in := strings.NewReader("let len = 1;\nlen\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "warning at 1:5: \"len\" shadows a builtin\n" + PROMPT + "1\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestASTCommand(t *testing.T) {
+	in := strings.NewReader(":ast 1 + 2 * 3\n:ast let = 1\n:ast\n-1 * 2\n:ast\n4\n:nope\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "(1 + (2 * 3))\n" +
+		PROMPT + "Woops! Parsing failed:\n Expected token type \"IDENT\", got \"=\" instead\n let = 1\n     ^\n" +
+		PROMPT + "AST display on\n" +
+		PROMPT + "((-1) * 2)\n-2\n" +
+		PROMPT + "AST display off\n" +
+		PROMPT + "4\n" +
+		PROMPT + "Unknown command :nope\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestWarningsCommand(t *testing.T) {
+	in := strings.NewReader(":warnings fn(x) { 1 }\n:warnings\nif (true) { 1 }\n:warnings\nif (true) { 2 }\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT + "warning at 1:4: parameter \"x\" is never used\n" +
+		PROMPT + "Warnings on\n" +
+		PROMPT + "warning at 1:5: if condition is always true\n1\n" +
+		PROMPT + "Warnings off\n" +
+		PROMPT + "2\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestBytecodeCommand(t *testing.T) {
+	in := strings.NewReader(":bytecode 1 + 2\n:bytecode missing\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	for _, want := range []string{"0000 OpConstant 0", "0003 OpConstant 1", "0006 OpAdd", "0007 OpPop",
+		"== constants ==", "0000 INTEGER 1", "0001 INTEGER 2",
+		"Woops! Compilation failed:\n compile error at 1:1: undefined variable \"missing\"\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q. got=%q", want, out.String())
+		}
+	}
+}
+
+func TestBytecodeModeUsesSessionGlobals(t *testing.T) {
+	in := strings.NewReader("let a = 1;\n:bytecode\na\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	if !strings.Contains(out.String(), "0000 OpGetGlobal 1        ; a\n") {
+		t.Errorf("listing doesn't use the session's globals. got=%q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "1\n"+PROMPT) {
+		t.Errorf("line wasn't run after its listing. got=%q", out.String())
+	}
+}
+
+func TestRunawayRecursionKeepsTheSession(t *testing.T) {
+	for _, name := range engine.Names {
+		in := strings.NewReader("let a = 1;\nlet f = fn(n) { f(n + 1) + 1 }; f(0)\na\n")
+		var out, errOut bytes.Buffer
+
+		StartWithOptions(in, Options{Out: &out, Err: &errOut, Engine: name, EchoResults: true})
+
+		if !strings.HasSuffix(out.String(), "1\n"+PROMPT) {
+			t.Errorf("%s: session lost after runaway recursion. got=%q", name, out.String())
+		}
+		if errOut.Len() == 0 {
+			t.Errorf("%s: runaway recursion not reported", name)
+		}
+	}
+}
+
+func TestEnginesGiveTheSameSession(t *testing.T) {
+	session := "let a = 1;\na + 1\nlet f = fn(x) { x * a }; f(5)\n"
+	var outputs []string
+
+	for _, name := range engine.Names {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(session), Options{Out: &out, Engine: name, EchoResults: true})
+		outputs = append(outputs, out.String())
+	}
+
+	expected := PROMPT + PROMPT + "2\n" + PROMPT + "5\n" + PROMPT
+	for i, got := range outputs {
+		if got != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine.Names[i], expected, got)
+		}
+	}
+}
+
+func TestEngineCommand(t *testing.T) {
+	in := strings.NewReader("let a = 1;\n:engine\n:engine eval\n:engine\na\n:engine lisp\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	expected := PROMPT +
+		PROMPT + "Using the vm engine\n" +
+		PROMPT + "Switched to the eval engine; earlier bindings are gone\n" +
+		PROMPT + "Using the eval engine\n" +
+		PROMPT + "Woops! Executing failed:\n identifier not found: a\n a\n ^\n" +
+		PROMPT + "unknown engine \"lisp\", expected one of eval, vm\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestEnvCommand(t *testing.T) {
+	for _, name := range engine.Names {
+		in := strings.NewReader("let zeta = [1, 2];\nlet alpha = \"" + strings.Repeat("a", 50) + "\";\nlet mid = 3;\n:env\n:env mid\n:env nope\n")
+		var out bytes.Buffer
+
+		StartWithOptions(in, Options{Out: &out, Engine: name, EchoResults: true})
+
+		expected := PROMPT + "alpha  STRING   " + strings.Repeat("a", 37) + "...\n" +
+			"args   ARRAY    []\n" +
+			"mid    INTEGER  3\n" +
+			"zeta   ARRAY    [1, 2]\n" +
+			PROMPT + "mid: INTEGER\n3\n" +
+			PROMPT + "nope is not defined\n" + PROMPT
+		// Skip the echoes of the definitions.
+		got := out.String()
+		got = got[strings.Index(got, PROMPT+"alpha"):]
+		if got != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", name, expected, got)
+		}
+	}
+}
+
+func TestDocCommand(t *testing.T) {
+	input := "// Doubles x.\nlet double = fn(x) { x * 2 }\nlet plain = fn() { 1 }\n:doc double\n:doc plain\n:doc len\n:doc nope\n"
+	for _, name := range []string{"vm", "eval"} {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(input), Options{Out: &out, Engine: name})
+
+		for _, want := range []string{"fn(x)\nDoubles x.\n", "fn()\nno documentation\n", "len(STRING|ARRAY|BYTES|RANGE)\n", "nope is not defined\n"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: output lacks %q. got=%q", name, want, out.String())
+			}
+		}
+	}
+}
+
+func TestEnvCommandListsBuiltinsWithAll(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":env\n:env --all\n"), &out)
+
+	if strings.Count(out.String(), "builtins:") != 1 || !strings.Contains(out.String(), "\n  len\n") {
+		t.Errorf("builtins should only be listed by --all. got=%q", out.String())
+	}
+}
+
+func TestErrorCarets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + (2 * 3\n", " 1 + (2 * 3\n           ^\n"},
+		{"let x = 1; let y = x + nope;", " let x = 1; let y = x + nope;\n                        ^\n"},
+		{"\tlet = 2", "     let = 2\n         ^\n"},
+		{"1\t+\tmissing", " 1   +   missing\n         ^\n"},
+		{"{fn(x) { x }: 1}", " {fn(x) { x }: 1}\n  ^\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartWithEngine(strings.NewReader(tt.input+"\n"), &out, engine.NewTreeWalkerEngine(nil))
+
+		if !strings.HasSuffix(out.String(), tt.expected+PROMPT) {
+			t.Errorf("%q: wrong caret. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestCaretPicksTheErrorLine(t *testing.T) {
+	text, marker := caret("let a = 1;\nlet b = ;", token.Position{Line: 2, Column: 9})
+	if want := " let b = ;\n         ^"; text+"\n"+marker != want {
+		t.Errorf("wrong caret. want=%q, got=%q", want, text+"\n"+marker)
+	}
+	if text, marker := caret("x", token.Position{Line: 3, Column: 1}); text != "" || marker != "" {
+		t.Errorf("expected no caret outside the source, got %q and %q", text, marker)
+	}
+}
+
+// tickingClock returns a clock that moves on by step each time it is read.
+func tickingClock(step time.Duration) func() time.Time {
+	now := time.Unix(0, 0)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	var out bytes.Buffer
+	s := &session{out: &out, eng: engine.NewTreeWalkerEngine(nil), now: tickingClock(1500 * time.Microsecond)}
+
+	start(strings.NewReader(":time 1 + 2\n:time let = 1\n"), s)
+
+	expected := PROMPT + "3\nparse: 1.5ms, eval: 1.5ms, total: 3ms, steps: 5\n" +
+		PROMPT + "Woops! Parsing failed:\n Expected token type \"IDENT\", got \"=\" instead\n let = 1\n     ^\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestTimeCommandWithoutSteps(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader(":time 1 + 2\n"), &out)
+
+	got := out.String()
+	for _, field := range []string{"3\n", "parse: ", ", eval: ", ", total: "} {
+		if !strings.Contains(got, field) {
+			t.Errorf("output is missing %q. got=%q", field, got)
+		}
+	}
+	if strings.Contains(got, "steps") {
+		t.Errorf("the vm doesn't count steps. got=%q", got)
+	}
+}
+
+func TestSlowEvalReport(t *testing.T) {
+	var out bytes.Buffer
+	s := &session{out: &out, eng: engine.NewVMEngine(nil, nil, nil), now: tickingClock(time.Second / 2), slowEval: time.Second / 2}
+
+	start(strings.NewReader("1\n"), s)
+
+	if expected := PROMPT + "1\n(took 1s)\n" + PROMPT; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	s.slowEval = 2 * time.Second
+	start(strings.NewReader("1\n"), s)
+	if expected := PROMPT + "1\n" + PROMPT; out.String() != expected {
+		t.Errorf("fast lines shouldn't report. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestRoundDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		1300234561 * time.Nanosecond: "1.3s",
+		52134 * time.Nanosecond:      "52.1µs",
+		999 * time.Nanosecond:        "999ns",
+		90 * time.Minute:             "1h30m0s",
+	}
+	for d, want := range tests {
+		if got := roundDuration(d).String(); got != want {
+			t.Errorf("roundDuration(%d) = %s, want %s", d, got, want)
+		}
+	}
+}
+
+func TestInterruptStopsEvaluation(t *testing.T) {
+	for _, name := range engine.Names {
+		eng, _ := engine.New(name)
+		var out bytes.Buffer
+		s := &session{out: &out, eng: eng, interruptible: func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}}
+
+		start(strings.NewReader("let x = 0;\nwhile (true) { x += 1 }\nx > 0\nlet y = 2; y * 3\n"), s)
+
+		expected := PROMPT + PROMPT + "interrupted\n" + PROMPT + "true\n" + PROMPT + "6\n" + PROMPT
+		if out.String() != expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", name, expected, out.String())
+		}
+	}
+}
+
+func TestSecondInterruptAtThePromptQuits(t *testing.T) {
+	var out bytes.Buffer
+	s := &session{out: &out, eng: engine.NewVMEngine(nil, nil, nil)}
+	e, _ := fakeTerminal("1\r\x03\x032\r")
+	e.out = &out
+
+	serve(e, s)
+
+	if strings.Contains(out.String(), "2") || strings.Count(out.String(), "(press Ctrl-C again to quit)") != 1 {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	in := strings.NewReader("let f = fn(x) {\nx * 2\n}\nf(2)\nmissing\n")
+	var out, errOut bytes.Buffer
+
+	StartWithOptions(in, Options{
+		Prompt:             "> ",
+		ContinuationPrompt: ". ",
+		Banner:             "hello\n",
+		Out:                &out,
+		Err:                &errOut,
+		EchoResults:        false,
+	})
+
+	if expected := "hello\n> . . > > > "; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+	expected := "Woops! Compilation failed:\n compile error at 1:1: undefined variable \"missing\"\n missing\n ^\n"
+	if errOut.String() != expected {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, errOut.String())
+	}
+}
+
+func TestColor(t *testing.T) {
+	for _, color := range []bool{false, true} {
+		var out, errOut bytes.Buffer
+		StartWithOptions(strings.NewReader("[1, \"a\"]\n1 + nope\n"), Options{
+			Out: &out, Err: &errOut, EchoResults: true, Color: color,
+		})
+
+		for name, got := range map[string]string{"results": out.String(), "errors": errOut.String()} {
+			if strings.Contains(got, "\x1b[") != color {
+				t.Errorf("with Color %t, %s were %q", color, name, got)
+			}
+		}
+		if color && !strings.Contains(out.String(), "\x1b[32m\"a\"") {
+			t.Errorf("string not in green: %q", out.String())
+		}
+	}
+}
+
+func TestContinuationLines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1,\n2,\n3]\n", PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "[1, 2, 3]\n" + PROMPT},
+		{"\"(\"\n", PROMPT + "\"(\"\n" + PROMPT},
+		{"[1,\n\n2]\n", PROMPT + CONTINUATION_PROMPT + "Woops! Parsing failed:\n"},
+		{"len([\n", PROMPT + CONTINUATION_PROMPT},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	broken := filepath.Join(dir, "broken.mk")
+	os.WriteFile(lib, []byte("let square = fn(x) {\n  x * x\n};\n"), 0o644)
+	os.WriteFile(broken, []byte("let a = 1;\nlet b = nope;\n"), 0o644)
+
+	for _, name := range engine.Names {
+		in := strings.NewReader(":load " + lib + "\nsquare(7)\n:load " + broken + "\n:load " + filepath.Join(dir, "missing.mk") + "\nsquare(2)\n")
+		var out bytes.Buffer
+
+		StartWithOptions(in, Options{Out: &out, Engine: name, EchoResults: true})
+
+		got := out.String()
+		for _, want := range []string{
+			PROMPT + "Loaded " + lib + "\n" + PROMPT + "49\n",
+			PROMPT + "Woops! ",
+			" failed:\n " + broken + ": ",
+			"\n let b = nope;\n         ^\n",
+			"missing.mk: no such file or directory\n",
+			PROMPT + "4\n" + PROMPT,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output is missing %q. got=%q", name, want, got)
+			}
+		}
+	}
+}
+
+func TestSaveCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mk")
+	in := strings.NewReader("let a = 1;\nnope\nlet f = fn(x) {\n  x + a\n};\n:env\nf(2)\n:save " + path + "\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	if !strings.Contains(out.String(), "Saved 3 inputs to "+path+"\n") {
+		t.Errorf("save not confirmed. got=%q", out.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "let a = 1;\nlet f = fn(x) {\n  x + a\n};\nf(2)\n"; string(data) != want {
+		t.Errorf("wrong file. want=%q, got=%q", want, data)
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load "+path+"\nf(10)\n"), &out)
+	if !strings.Contains(out.String(), "11\n") {
+		t.Errorf("saved session doesn't load. got=%q", out.String())
+	}
+}
+
+func TestSaveAfterEngineSwitch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.mk")
+	in := strings.NewReader("let a = 1;\n:engine eval\nlet b = 2;\n:save " + path + "\n")
+	var out bytes.Buffer
+
+	Start(in, &out)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "let b = 2;\n"; string(data) != want {
+		t.Errorf("inputs from before the switch were saved. want=%q, got=%q", want, data)
+	}
+}
+
+func TestResetCommand(t *testing.T) {
+	for _, name := range engine.Names {
+		in := strings.NewReader("let x = 5;\n:reset\nx\nlet x = 1; x\n")
+		var out bytes.Buffer
+
+		StartWithOptions(in, Options{Out: &out, Engine: name, EchoResults: true})
+
+		got := out.String()
+		if !strings.Contains(got, PROMPT+"Session reset; earlier bindings are gone\n") {
+			t.Errorf("%s: reset not confirmed. got=%q", name, got)
+		}
+		if !strings.Contains(got, "x\n ^\n") || !strings.HasSuffix(got, PROMPT+"1\n"+PROMPT) {
+			t.Errorf("%s: x survived the reset. got=%q", name, got)
+		}
+	}
+
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = 5;\n:reset\nx\n"), &out)
+	if !strings.Contains(out.String(), "undefined variable \"x\"") {
+		t.Errorf("vm symbols survived the reset. got=%q", out.String())
+	}
+	out.Reset()
+	StartWithOptions(strings.NewReader("let x = 5;\n:reset\nx\n"), Options{Out: &out, Engine: "eval"})
+	if !strings.Contains(out.String(), "identifier not found: x") {
+		t.Errorf("environment survived the reset. got=%q", out.String())
+	}
+}
+
+func TestCheckpointCommand(t *testing.T) {
+	input := ":rollback\nlet a = [1, 2];\n:checkpoint\na[0] = 9; let b = 3;\n:rollback\na\nb\n:rollback\n"
+	for _, name := range engine.Names {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(input), Options{Out: &out, Engine: name, EchoResults: true})
+
+		got := out.String()
+		for _, want := range []string{
+			PROMPT + "No checkpoint to roll back to\n",
+			PROMPT + "Checkpoint saved\n",
+			PROMPT + "Rolled back to the checkpoint\n" + PROMPT + "[1, 2]\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: output lacks %q. got=%q", name, want, got)
+			}
+		}
+		if strings.Count(got, "Rolled back") != 2 || !strings.Contains(got, " b\n ^\n") {
+			t.Errorf("%s: b survived the rollback. got=%q", name, got)
+		}
+	}
+}
+
+func TestClearCommand(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = 5;\n:clear\nx\n"), &out)
+
+	if expected := PROMPT + PROMPT + "\x1b[H\x1b[2J" + PROMPT + "5\n" + PROMPT; out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestArgsIsEmptyInTheRepl(t *testing.T) {
+	for _, name := range engine.Names {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader("len(args)\n"), Options{Out: &out, Engine: name, EchoResults: true})
+
+		if want := PROMPT + "0\n" + PROMPT; out.String() != want {
+			t.Errorf("%s: wrong output. want=%q, got=%q", name, want, out.String())
+		}
+	}
+}
+
+func TestEchoRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (false) { 1 }\n", PROMPT},
+		{"let x = 5\n", PROMPT},
+		{"1 + 1;\n", PROMPT},
+		{"let x = 5; x\n", PROMPT + "5\n"},
+		{"\"5\"\n", PROMPT + "\"5\"\n"},
+		{"5\n", PROMPT + "5\n"},
+		{"[\"a\", 1, [\"b\"]]\n", PROMPT + "[\"a\", 1, [\"b\"]]\n"},
+		{"{\"k\": \"v\"}\n", PROMPT + "{\"k\": \"v\"}\n"},
+		{"[1, 2, 3, 4, 5]\n", PROMPT + "[1, 2, 3, ... (2 more elements)]\n"},
+		{"[[1, 2, 3, 4], 2, 3]\n", PROMPT + "[[1, 2, 3, ... (1 more elements)], 2, 3]\n"},
+	}
+
+	for _, name := range engine.Names {
+		for _, tt := range tests {
+			var out bytes.Buffer
+			StartWithOptions(strings.NewReader(tt.input), Options{Out: &out, Engine: name, EchoResults: true, EchoLimit: 3})
+
+			if want := tt.expected + PROMPT; out.String() != want {
+				t.Errorf("%s: %q: wrong output. want=%q, got=%q", name, tt.input, want, out.String())
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("{1: 2, 3: 4, 5: 6, 7: 8}\n"), Options{Out: &out, EchoResults: true, EchoLimit: 3})
+	if !strings.HasSuffix(out.String(), ", ... (1 more pairs)}\n"+PROMPT) {
+		t.Errorf("long hash wasn't cut short. got=%q", out.String())
+	}
+
+	out.Reset()
+	long := "[" + strings.Repeat("0, ", DefaultEchoLimit+2) + "0]\n"
+	StartWithOptions(strings.NewReader(long), Options{Out: &out, EchoResults: true})
+	if !strings.HasSuffix(out.String(), ", ... (3 more elements)]\n"+PROMPT) {
+		t.Errorf("default limit not applied. got=%q", out.String())
+	}
+
+	out.Reset()
+	StartWithOptions(strings.NewReader(long), Options{Out: &out, EchoResults: true, EchoLimit: -1})
+	if strings.Contains(out.String(), "more elements") {
+		t.Errorf("a negative limit should show everything. got=%q", out.String())
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Line editing is only implemented on Linux; elsewhere the REPL reads plain
+// lines.
+func isTerminal(fd uintptr) bool { return false }
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+)
+
+// Compile compiles a script for the run command, with args defined as
+// global 0 for the caller to fill in.
+func Compile(source string) (*compiler.Bytecode, error) {
+	program, err := parser.NewWithMode(lexer.New(source), parser.ParseComments).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	comp.SymbolTable().Define("args")
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
+
+// Cache keeps the bytecode Compile makes in Dir, as <key>.mkc, so running an
+// unchanged script again skips parsing and compiling. The key is a sha256 of
+// the source, BytecodeVersion and the names of the builtins in order, so a
+// binary with a different builtin table doesn't reuse bytecode that indexes
+// the old one. An entry that doesn't decode is compiled again and replaced.
+type Cache struct {
+	Dir string
+
+	// Hits counts the scripts loaded from the cache and Misses those
+	// compiled.
+	Hits, Misses int
+}
+
+// Compile returns source's bytecode from the cache, or compiles it and
+// stores it there. The cache only saves time: failing to write an entry
+// isn't an error.
+func (c *Cache) Compile(source string) (*compiler.Bytecode, error) {
+	path := filepath.Join(c.Dir, cacheKey(source, compiler.BytecodeVersion, builtinNames())+".mkc")
+
+	if data, err := os.ReadFile(path); err == nil {
+		if bytecode, err := compiler.DecodeBytecode(bytes.NewReader(data)); err == nil {
+			c.Hits++
+			return bytecode, nil
+		}
+	}
+
+	c.Misses++
+	bytecode, err := Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	c.store(path, bytecode)
+	return bytecode, nil
+}
+
+// cacheKey is the hex sha256 of everything compiled bytecode depends on.
+func cacheKey(source string, version uint16, builtins []string) string {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, version)
+	for _, name := range builtins {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(source))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func builtinNames() []string {
+	names := make([]string, len(object.Builtins))
+	for i, def := range object.Builtins {
+		names[i] = def.Name
+	}
+	return names
+}
+
+// store writes bytecode to a temporary file and renames it into place, so
+// a concurrent run reads either the whole entry or none of it.
+func (c *Cache) store(path string, bytecode *compiler.Bytecode) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(c.Dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+	if err := bytecode.Encode(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+	}
+}
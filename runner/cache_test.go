@@ -0,0 +1,189 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	cache := &Cache{Dir: filepath.Join(t.TempDir(), "cache")}
+	source := `let x = 1 + 2; puts(x)`
+
+	first, err := cache.Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := filepath.Glob(filepath.Join(cache.Dir, "*"))
+	if len(entries) != 1 || filepath.Ext(entries[0]) != ".mkc" {
+		t.Fatalf("expected one .mkc entry and no temporary files, got %v", entries)
+	}
+	entry := entries[0]
+
+	second, err := cache.Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Hits != 1 || cache.Misses != 1 {
+		t.Errorf("want 1 hit and 1 miss, got %d and %d", cache.Hits, cache.Misses)
+	}
+	if !bytes.Equal(first.Instructions, second.Instructions) {
+		t.Errorf("the cached bytecode differs from the compiled")
+	}
+
+	// An entry is used as it is, without looking at the source again.
+	other, err := Compile(`"other"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeEntry(t, entry, other)
+	loaded, err := cache.Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Instructions, other.Instructions) {
+		t.Errorf("expected the bytecode from the cache entry")
+	}
+
+	// A different source is a different entry.
+	if _, err := cache.Compile(source + ";"); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Hits != 2 || cache.Misses != 2 {
+		t.Errorf("want 2 hits and 2 misses, got %d and %d", cache.Hits, cache.Misses)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	source := `puts(len("abc"))`
+	builtins := builtinNames()
+	key := cacheKey(source, compiler.BytecodeVersion, builtins)
+
+	if other := cacheKey(source+" ", compiler.BytecodeVersion, builtins); other == key {
+		t.Errorf("a different source has the same key")
+	}
+	if other := cacheKey(source, compiler.BytecodeVersion+1, builtins); other == key {
+		t.Errorf("a different bytecode version has the same key")
+	}
+	swapped := append([]string{}, builtins...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	if other := cacheKey(source, compiler.BytecodeVersion, swapped); other == key {
+		t.Errorf("a different builtin order has the same key")
+	}
+	if other := cacheKey(source, compiler.BytecodeVersion, append(builtins, "new")); other == key {
+		t.Errorf("an added builtin gives the same key")
+	}
+}
+
+func TestCacheDiscardsBadEntries(t *testing.T) {
+	source := `[1, 2, 3]`
+	compiled, err := Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	if err := compiled.Encode(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	stale := bytes.Clone(encoded.Bytes())
+	binary.BigEndian.PutUint16(stale[len(compiler.BytecodeMagic):], compiler.BytecodeVersion-1)
+
+	tests := map[string][]byte{
+		"stale version": stale,
+		"truncated":     encoded.Bytes()[:encoded.Len()/2],
+		"garbage":       []byte("not bytecode"),
+	}
+	for name, data := range tests {
+		cache := &Cache{Dir: t.TempDir()}
+		if _, err := cache.Compile(source); err != nil {
+			t.Fatal(err)
+		}
+		entries, _ := filepath.Glob(filepath.Join(cache.Dir, "*.mkc"))
+		if err := os.WriteFile(entries[0], data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		bytecode, err := cache.Compile(source)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if cache.Misses != 2 || !bytes.Equal(bytecode.Instructions, compiled.Instructions) {
+			t.Errorf("%s: expected the entry to be compiled again, got %d misses", name, cache.Misses)
+		}
+
+		// The entry was replaced with a good one.
+		if _, err := cache.Compile(source); err != nil || cache.Hits != 1 {
+			t.Errorf("%s: expected a hit after recompiling, got %d hits (%v)", name, cache.Hits, err)
+		}
+	}
+}
+
+func TestCacheConcurrentRuns(t *testing.T) {
+	dir := t.TempDir()
+	source := `let f = fn(x) { x * 2 }; f(21)`
+	compiled, err := Compile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each run has its own Cache, as separate processes would.
+			cache := &Cache{Dir: dir}
+			for j := 0; j < 20; j++ {
+				bytecode, err := cache.Compile(source)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(bytecode.Instructions, compiled.Instructions) {
+					errs <- fmt.Errorf("run %d got different bytecode", j)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(entries) != 1 {
+		t.Errorf("expected one entry and no temporary files, got %v", entries)
+	}
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	if _, err := cache.Compile(`let x = ;`); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if _, err := cache.Compile(`undefinedName`); err == nil {
+		t.Fatal("expected a compile error")
+	}
+	if entries, _ := filepath.Glob(filepath.Join(cache.Dir, "*")); len(entries) != 0 {
+		t.Errorf("failed compiles left entries: %v", entries)
+	}
+}
+
+func writeEntry(t *testing.T, path string, bytecode *compiler.Bytecode) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := bytecode.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package runner runs Monkey source files and one-line programs outside the
+// REPL.
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/engine"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+)
+
+// Files runs each file in order on eng, so later files see the globals
+// earlier ones defined. It stops at the first file that fails, returning its
+// error prefixed with the file name.
+func Files(eng engine.Engine, paths []string) error {
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := Source(eng, path, string(source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Source runs one program on eng. Errors are prefixed with name.
+func Source(eng engine.Engine, name, source string) (object.Object, error) {
+	program, err := parser.NewWithMode(lexer.New(source), parser.ParseComments).ParseProgram()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	result, err := eng.Run(program)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return result, nil
+}
+
+// Reader runs everything read from in as one program on eng, as when a
+// program is piped to the monkey command, so statements may span lines. With
+// echo set, a result other than null is written to out.
+func Reader(eng engine.Engine, name string, in io.Reader, out io.Writer, echo bool) error {
+	source, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	result, err := Source(eng, name, string(source))
+	if err != nil {
+		return err
+	}
+	if echo && result != object.NULL {
+		fmt.Fprintln(out, result.Inspect())
+	}
+	return nil
+}
+
+// ExitCode is the status to exit the process with after err: the code given
+// to the exit builtin, 0 for no error, and 1 for any other error.
+func ExitCode(err error) int {
+	var exit *object.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exit):
+		return exit.Code
+	default:
+		return 1
+	}
+}
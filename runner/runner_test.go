@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"monkey/engine"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScripts(t *testing.T, scripts ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+
+	var paths []string
+	for i, script := range scripts {
+		path := filepath.Join(dir, string(rune('a'+i))+".mk")
+		if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestFilesShareGlobals(t *testing.T) {
+	paths := writeScripts(t,
+		`let double = fn(x) { x * 2 };`,
+		`let answer = double(21);`,
+		`if (answer != 42) { exit(3) }`,
+	)
+
+	for name, eng := range map[string]engine.Engine{
+		"tree walker": engine.NewTreeWalkerEngine(nil),
+		"vm":          engine.NewVMEngine(nil, nil, nil),
+	} {
+		if err := Files(eng, paths); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestFilesStopAtTheFirstError(t *testing.T) {
+	paths := writeScripts(t, `let x = 1;`, `x / 0`, `exit(5)`)
+
+	err := Files(engine.NewVMEngine(nil, nil, nil), paths)
+	if err == nil || err.Error() != paths[1]+": division by zero: 1 / 0" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	if code := ExitCode(err); code != 1 {
+		t.Errorf("wrong exit code. want=1, got=%d", code)
+	}
+}
+
+func TestParseErrorsNameTheFile(t *testing.T) {
+	paths := writeScripts(t, `let = 1;`)
+
+	err := Files(engine.NewVMEngine(nil, nil, nil), paths)
+	if err == nil || err.Error() != paths[0]+`: Expected token type "IDENT", got "=" instead` {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{`1`, 0},
+		{`exit()`, 0},
+		{`exit(7)`, 7},
+		{`let f = fn() { exit(2); 1 }; f() + 1`, 2},
+		{`missing`, 1},
+		{`exit("no")`, 1},
+	}
+
+	for _, tt := range tests {
+		for name, eng := range map[string]engine.Engine{
+			"tree walker": engine.NewTreeWalkerEngine(nil),
+			"vm":          engine.NewVMEngine(nil, nil, nil),
+		} {
+			_, err := Source(eng, "-e", tt.input)
+			if code := ExitCode(err); code != tt.expected {
+				t.Errorf("%s: %q: want=%d, got=%d (%v)", name, tt.input, tt.expected, code, err)
+			}
+		}
+	}
+
+	if ExitCode(errors.New("boom")) != 1 {
+		t.Errorf("plain errors should exit with 1")
+	}
+}
+
+func TestReaderRunsOneProgram(t *testing.T) {
+	in := bytes.NewBufferString("let add = fn(a, b) {\n  a + b\n};\nadd(1,\n  2)\n")
+
+	var out bytes.Buffer
+	if err := Reader(engine.NewVMEngine(nil, nil, nil), "<stdin>", in, &out, false); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("result echoed without asking. got=%q", out.String())
+	}
+
+	in = bytes.NewBufferString("let x = 1;\nx + 1\n")
+	if err := Reader(engine.NewVMEngine(nil, nil, nil), "<stdin>", in, &out, true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "2\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "2\n", out.String())
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	var out bytes.Buffer
+	err := Reader(engine.NewVMEngine(nil, nil, nil), "<stdin>", bytes.NewBufferString("1;\nexit(4)\n"), &out, true)
+	if code := ExitCode(err); code != 4 {
+		t.Errorf("wrong exit code. want=4, got=%d (%v)", code, err)
+	}
+
+	err = Reader(engine.NewVMEngine(nil, nil, nil), "<stdin>", bytes.NewBufferString("let = 1"), &out, true)
+	if err == nil || ExitCode(err) != 1 || !strings.HasPrefix(err.Error(), "<stdin>: ") {
+		t.Errorf("expected a parse error naming stdin, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("failed programs shouldn't print. got=%q", out.String())
+	}
+}
+
+func TestScriptArgsAndEnv(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+	paths := writeScripts(t, `
+if (len(args) != 3) { exit(2) }
+if (args[0] != "one" || args[2] != "three") { exit(3) }
+if (env("MONKEY_TEST_VAR") != "banana") { exit(4) }
+if (!is_null(env("MONKEY_TEST_UNSET_VAR"))) { exit(5) }
+`)
+
+	for _, name := range engine.Names {
+		eng, _ := engine.New(name)
+		engine.DefineArgs(eng, []string{"one", "two", "three"})
+		if err := Files(eng, paths); err != nil {
+			t.Errorf("%s: %s (exit code %d)", name, err, ExitCode(err))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package suggest finds near matches for misspelled names.
+package suggest
+
+// Distance returns the Levenshtein edit distance between a and b, counted in runes.
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// Closest returns the candidate nearest to name within maxDistance edits.
+// Ties go to the earliest candidate.
+func Closest(name string, candidates []string, maxDistance int) (string, bool) {
+	best, bestDistance := "", maxDistance+1
+
+	for _, candidate := range candidates {
+		if d := Distance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	return best, bestDistance <= maxDistance
+}
@@ -0,0 +1,39 @@
+package suggest
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"abc", "abc", 0},
+		{"", "abc", 3},
+		{"floor", "flor", 1},
+		{"floor", "floorr", 1},
+		{"floor", "fl0or", 1},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Distance(%q, %q) wrong. want=%d, got=%d", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"floor", "ceil", "sqrt"}
+
+	if got, ok := Closest("flor", candidates, 1); !ok || got != "floor" {
+		t.Errorf("Closest(flor) wrong. got=%q, %t", got, ok)
+	}
+	if _, ok := Closest("flo", candidates, 1); ok {
+		t.Errorf("Closest(flo) found a match beyond the distance limit")
+	}
+	if _, ok := Closest("x", nil, 1); ok {
+		t.Errorf("Closest found a match with no candidates")
+	}
+}
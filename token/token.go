@@ -1,11 +1,17 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
 	ASSIGN    = "="
@@ -21,26 +27,28 @@ const (
 	RANG      = ">"
 	PERCENT   = "%"
 
-	EQ      = "=="
-	NEQ     = "!="
-	GEQ     = ">="
-	LEQ     = "<="
-	XOR_EQ  = "^="
-	OR_EQ   = "|="
-	AND_EQ  = "&="
-	PLUS_EQ = "+="
-	MIN_EQ  = "-="
-	MUL_EQ  = "*="
-	DIV_EQ  = "/="
-	PERC_EQ = "%="
-	AND     = "&&"
-	OR      = "||"
-	SHOVL   = "<<"
-	SHOVR   = ">>"
+	EQ       = "=="
+	NEQ      = "!="
+	GEQ      = ">="
+	LEQ      = "<="
+	XOR_EQ   = "^="
+	OR_EQ    = "|="
+	AND_EQ   = "&="
+	PLUS_EQ  = "+="
+	MIN_EQ   = "-="
+	MUL_EQ   = "*="
+	DIV_EQ   = "/="
+	PERC_EQ  = "%="
+	AND      = "&&"
+	OR       = "||"
+	SHOVL    = "<<"
+	SHOVR    = ">>"
+	PIPELINE = "|>"
 
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -56,13 +64,64 @@ const (
 	RETURN   = "RETURN"
 	IF       = "IF"
 	ELSE     = "ELSE"
+	NULL     = "NULL"
+	SWITCH   = "SWITCH"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	WHILE    = "WHILE"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 type TokenType string
 
+var keywords = map[string]TokenType{
+	"fn":       FUNCTION,
+	"let":      LET,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"switch":   SWITCH,
+	"case":     CASE,
+	"default":  DEFAULT,
+	"while":    WHILE,
+	"break":    BREAK,
+	"continue": CONTINUE,
+}
+
+// LookupKeyword returns the token type of a keyword.
+func LookupKeyword(word string) (TokenType, bool) {
+	t, ok := keywords[word]
+	return t, ok
+}
+
+// Keywords returns the language's keywords, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Position is a 1-based line and column (in runes) into the source.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
 }
 
 func New(t TokenType, v string) Token {
@@ -0,0 +1,312 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+// instructionShape is what the VM checks about an opcode before running it.
+type instructionShape struct {
+	defined bool
+	name    string
+	width   int // total operand bytes
+	pops    int // values consumed, for opcodes whose count isn't an operand
+	pushes  int // values left behind
+}
+
+var shapes [256]instructionShape
+
+var stackInputs = map[code.Opcode]int{
+	code.OpPop:           1,
+	code.OpJumpNotTruthy: 1,
+	code.OpJumpTruthy:    1,
+	code.OpDup:           1,
+	code.OpDup2:          2,
+	code.OpReturnValue:   1,
+	code.OpEqual:         2,
+	code.OpNotEqual:      2,
+	code.OpGreaterThan:   2,
+	code.OpGreaterEqual:  2,
+	code.OpLessThan:      2,
+	code.OpLessEqual:     2,
+	code.OpMinus:         1,
+	code.OpBang:          1,
+	code.OpAdd:           2,
+	code.OpSub:           2,
+	code.OpMul:           2,
+	code.OpDiv:           2,
+	code.OpMod:           2,
+	code.OpBitOr:         2,
+	code.OpBitAnd:        2,
+	code.OpBitXor:        2,
+	code.OpShiftLeft:     2,
+	code.OpShiftRight:    2,
+	code.OpSetGlobal:     1,
+	code.OpSetLocal:      1,
+	code.OpSetFree:       1,
+	code.OpIndex:         2,
+	code.OpSetIndex:      3,
+	code.OpMember:        1,
+}
+
+// stackOutputs lists the opcodes that don't leave exactly one value.
+var stackOutputs = map[code.Opcode]int{
+	code.OpPop:           0,
+	code.OpJump:          0,
+	code.OpJumpNotTruthy: 0,
+	code.OpJumpTruthy:    0,
+	code.OpSetGlobal:     0,
+	code.OpSetLocal:      0,
+	code.OpSetFree:       0,
+	code.OpReturn:        0,
+	code.OpReturnValue:   0,
+	code.OpDup:           2,
+	code.OpDup2:          4,
+}
+
+func init() {
+	for op := 0; op < len(shapes); op++ {
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			continue
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		pushes, ok := stackOutputs[code.Opcode(op)]
+		if !ok {
+			pushes = 1
+		}
+		shapes[op] = instructionShape{
+			defined: true,
+			name:    def.Name,
+			width:   width,
+			pops:    stackInputs[code.Opcode(op)],
+			pushes:  pushes,
+		}
+	}
+}
+
+// verify checks the main program and every function constant once, before
+// anything runs, so that executing them can't panic: each instruction is
+// known and complete, its operands are in range, jumps land on instructions,
+// and no path pops below the locals of its frame.
+func (vm *VM) verify() error {
+	main := vm.frames[0].Instructions()
+	free := closureFreeCounts(main, vm.constants)
+
+	if err := vm.verifyInstructions(main, 0, 0); err != nil {
+		return err
+	}
+	for i, constant := range vm.constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if err := vm.verifyInstructions(fn.Instructions, fn.NumLocals, free[i]); err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// closureFreeCounts maps each function constant to the fewest free variables
+// any OpClosure gives it. Bytecode it can't read is left to verify.
+func closureFreeCounts(main code.Instructions, constants []object.Object) map[int]int {
+	free := map[int]int{}
+	scan := func(ins code.Instructions) {
+		for ip := 0; ip < len(ins); ip += 1 + shapes[ins[ip]].width {
+			shape := &shapes[ins[ip]]
+			if !shape.defined || ip+shape.width >= len(ins) {
+				return
+			}
+			if code.Opcode(ins[ip]) != code.OpClosure {
+				continue
+			}
+			index := int(code.ReadUint16(ins[ip+1:]))
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			if n, ok := free[index]; !ok || numFree < n {
+				free[index] = numFree
+			}
+		}
+	}
+
+	scan(main)
+	for _, constant := range constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			scan(fn.Instructions)
+		}
+	}
+	return free
+}
+
+// verifyInstructions checks one body of code whose frame has numLocals locals
+// and numFree free variables.
+func (vm *VM) verifyInstructions(ins code.Instructions, numLocals, numFree int) error {
+	// starts marks where each instruction begins, for checking jump targets.
+	starts := make([]bool, len(ins)+1)
+	starts[len(ins)] = true
+
+	for ip := 0; ip < len(ins); ip += 1 + shapes[ins[ip]].width {
+		op := code.Opcode(ins[ip])
+		shape := &shapes[op]
+		if !shape.defined {
+			return fmt.Errorf("unknown opcode 0x%02X at ip=%04d", byte(op), ip)
+		}
+		if ip+shape.width >= len(ins) {
+			return malformed(ip, op, "truncated instruction")
+		}
+		starts[ip] = true
+
+		if err := vm.checkOperands(ins, ip, numLocals, numFree); err != nil {
+			return err
+		}
+	}
+
+	for ip := 0; ip < len(ins); ip += 1 + shapes[ins[ip]].width {
+		switch op := code.Opcode(ins[ip]); op {
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpTruthy:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			if target >= len(starts) || !starts[target] {
+				return malformed(ip, op, "jump to %04d is not an instruction", target)
+			}
+		}
+	}
+
+	return checkStackDepths(ins)
+}
+
+func (vm *VM) checkOperands(ins code.Instructions, ip, numLocals, numFree int) error {
+	op := code.Opcode(ins[ip])
+	switch op {
+	case code.OpConstant:
+		index := int(code.ReadUint16(ins[ip+1:]))
+		if index >= len(vm.constants) {
+			return malformed(ip, op, "constant %d out of range", index)
+		}
+	case code.OpClosure:
+		index := int(code.ReadUint16(ins[ip+1:]))
+		if index >= len(vm.constants) {
+			return malformed(ip, op, "constant %d out of range", index)
+		}
+		if _, ok := vm.constants[index].(*object.CompiledFunction); !ok {
+			return malformed(ip, op, "constant %d is not a function", index)
+		}
+	case code.OpMember, code.OpCallMethod:
+		index := int(code.ReadUint16(ins[ip+1:]))
+		if index >= len(vm.constants) {
+			return malformed(ip, op, "constant %d out of range", index)
+		}
+		if _, ok := vm.constants[index].(*object.String); !ok {
+			return malformed(ip, op, "constant %d is not a name", index)
+		}
+	case code.OpGetGlobal, code.OpSetGlobal:
+		index := int(code.ReadUint16(ins[ip+1:]))
+		if index >= len(vm.globals) {
+			return malformed(ip, op, "global %d out of range", index)
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetLocalRef:
+		index := int(code.ReadUint8(ins[ip+1:]))
+		if index >= numLocals {
+			return malformed(ip, op, "local %d out of range", index)
+		}
+	case code.OpGetBuiltin:
+		index := int(code.ReadUint8(ins[ip+1:]))
+		if index >= len(object.Builtins) {
+			return malformed(ip, op, "builtin %d out of range", index)
+		}
+	case code.OpGetFree, code.OpGetFreeRef, code.OpSetFree:
+		index := int(code.ReadUint8(ins[ip+1:]))
+		if index >= numFree {
+			return malformed(ip, op, "free variable %d out of range", index)
+		}
+	case code.OpHash:
+		count := int(code.ReadUint16(ins[ip+1:]))
+		if count%2 != 0 {
+			return malformed(ip, op, "odd number of hash elements %d", count)
+		}
+	}
+	return nil
+}
+
+// checkStackDepths follows every path through ins, which must already be
+// well formed, tracking how many values are on the frame's stack. A path may
+// not pop more than it has, and paths that meet must agree on the depth.
+func checkStackDepths(ins code.Instructions) error {
+	depths := make([]int, len(ins))
+	for i := range depths {
+		depths[i] = -1
+	}
+
+	pending := []int{}
+	reach := func(from, ip, depth int) error {
+		if ip == len(ins) {
+			return nil
+		}
+		switch depths[ip] {
+		case -1:
+			depths[ip] = depth
+			pending = append(pending, ip)
+		case depth:
+		default:
+			return malformed(from, code.Opcode(ins[from]), "stack depth %d at %04d, %d on another path", depth, ip, depths[ip])
+		}
+		return nil
+	}
+
+	if len(ins) > 0 {
+		depths[0] = 0
+		pending = append(pending, 0)
+	}
+	for len(pending) > 0 {
+		ip := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		op := code.Opcode(ins[ip])
+		shape := &shapes[op]
+		pops := shape.pops
+		pushes := shape.pushes
+		switch op {
+		case code.OpArray, code.OpHash:
+			pops = int(code.ReadUint16(ins[ip+1:]))
+		case code.OpCall:
+			pops = int(code.ReadUint8(ins[ip+1:])) + 1
+		case code.OpCallMethod:
+			pops = int(code.ReadUint8(ins[ip+3:])) + 2
+		case code.OpClosure:
+			pops = int(code.ReadUint8(ins[ip+3:]))
+		}
+
+		depth := depths[ip]
+		if depth < pops {
+			return malformed(ip, op, "stack underflow")
+		}
+		depth += pushes - pops
+
+		switch op {
+		case code.OpReturn, code.OpReturnValue:
+			continue
+		case code.OpJump:
+			if err := reach(ip, int(code.ReadUint16(ins[ip+1:])), depth); err != nil {
+				return err
+			}
+			continue
+		case code.OpJumpNotTruthy, code.OpJumpTruthy:
+			if err := reach(ip, int(code.ReadUint16(ins[ip+1:])), depth); err != nil {
+				return err
+			}
+		}
+		if err := reach(ip, ip+1+shape.width, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// malformed reports bytecode that can't be executed as written.
+func malformed(ip int, op code.Opcode, format string, a ...interface{}) error {
+	return fmt.Errorf("%s at ip=%04d executing %s", fmt.Sprintf(format, a...), ip, shapes[op].name)
+}
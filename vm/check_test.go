@@ -0,0 +1,324 @@
+package vm
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestMalformedBytecode(t *testing.T) {
+	tests := []struct {
+		name         string
+		instructions []code.Instructions
+		constants    []object.Object
+		expected     string
+	}{
+		{
+			name: "add with one operand",
+			instructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+			},
+			constants: []object.Object{&object.Integer{Value: 1}},
+			expected:  "stack underflow at ip=0003 executing OpAdd",
+		},
+		{
+			name:         "pop on an empty stack",
+			instructions: []code.Instructions{code.Make(code.OpPop)},
+			expected:     "stack underflow at ip=0000 executing OpPop",
+		},
+		{
+			name:         "array larger than the stack",
+			instructions: []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpArray, 2)},
+			expected:     "stack underflow at ip=0001 executing OpArray",
+		},
+		{
+			name:         "call without a callee",
+			instructions: []code.Instructions{code.Make(code.OpCall, 0)},
+			expected:     "stack underflow at ip=0000 executing OpCall",
+		},
+		{
+			name:         "operand cut off",
+			instructions: []code.Instructions{code.Make(code.OpConstant, 0)[:2]},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expected:     "truncated instruction at ip=0000 executing OpConstant",
+		},
+		{
+			name:         "unknown opcode",
+			instructions: []code.Instructions{{250}},
+			expected:     "unknown opcode 0xFA at ip=0000",
+		},
+		{
+			name:         "constant out of range",
+			instructions: []code.Instructions{code.Make(code.OpConstant, 3)},
+			expected:     "constant 3 out of range at ip=0000 executing OpConstant",
+		},
+		{
+			name:         "member named by a non-string",
+			instructions: []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpMember, 0)},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expected:     "constant 0 is not a name at ip=0001 executing OpMember",
+		},
+		{
+			name: "method call without a receiver",
+			instructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpCallMethod, 0, 0),
+			},
+			constants: []object.Object{&object.String{Value: "len"}},
+			expected:  "stack underflow at ip=0001 executing OpCallMethod",
+		},
+		{
+			name:         "builtin out of range",
+			instructions: []code.Instructions{code.Make(code.OpGetBuiltin, 255)},
+			expected:     "builtin 255 out of range at ip=0000 executing OpGetBuiltin",
+		},
+		{
+			name:         "local in the main program",
+			instructions: []code.Instructions{code.Make(code.OpGetLocal, 0)},
+			expected:     "local 0 out of range at ip=0000 executing OpGetLocal",
+		},
+		{
+			name:         "free variable outside a closure",
+			instructions: []code.Instructions{code.Make(code.OpGetFree, 0)},
+			expected:     "free variable 0 out of range at ip=0000 executing OpGetFree",
+		},
+		{
+			name:         "global never set",
+			instructions: []code.Instructions{code.Make(code.OpGetGlobal, 4)},
+			expected:     "identifier not found: global 4",
+		},
+		{
+			name:         "odd hash",
+			instructions: []code.Instructions{code.Make(code.OpTrue), code.Make(code.OpHash, 1)},
+			expected:     "odd number of hash elements 1 at ip=0001 executing OpHash",
+		},
+		{
+			name: "function body pops below its locals",
+			instructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpCall, 0),
+			},
+			constants: []object.Object{&object.CompiledFunction{
+				Instructions: concat(code.Make(code.OpAdd), code.Make(code.OpReturnValue)),
+			}},
+			expected: "constant 0: stack underflow at ip=0000 executing OpAdd",
+		},
+		{
+			name: "free variable the closure does not capture",
+			instructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+			constants: []object.Object{&object.CompiledFunction{
+				Instructions: concat(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)),
+			}},
+			expected: "constant 0: free variable 0 out of range at ip=0000 executing OpGetFree",
+		},
+		{
+			name:         "closure over a non-function",
+			instructions: []code.Instructions{code.Make(code.OpClosure, 0, 0)},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expected:     "constant 0 is not a function at ip=0000 executing OpClosure",
+		},
+		{
+			name:         "jump into an operand",
+			instructions: []code.Instructions{code.Make(code.OpJump, 4), code.Make(code.OpConstant, 0)},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expected:     "jump to 0004 is not an instruction at ip=0000 executing OpJump",
+		},
+		{
+			name: "paths meeting at different depths",
+			instructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpTruthy, 6),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+			expected: "stack depth 2 at 0006, 1 on another path at ip=0005 executing OpNull",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := &compiler.Bytecode{Instructions: concat(tt.instructions...), Constants: tt.constants}
+		err := New(bytecode).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestVerifiedBeforeRunning(t *testing.T) {
+	bad := &compiler.Bytecode{
+		Instructions: concat(code.Make(code.OpTrue), code.Make(code.OpSetGlobal, 0), code.Make(code.OpConstant, 9)),
+	}
+
+	vm := New(bad)
+	if err := vm.Run(); err == nil || err.Error() != "constant 9 out of range at ip=0004 executing OpConstant" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+	if vm.Globals()[0] != nil {
+		t.Errorf("malformed program ran before failing. global 0=%v", vm.Globals()[0])
+	}
+
+	vm.Reset(compileForTest(t, "1 + 2"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error after Reset: %s", err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElem())
+
+	vm.Reset(bad)
+	if _, err := vm.Step(); err == nil {
+		t.Errorf("Step ran bytecode that failed verification")
+	}
+}
+
+func TestEveryOpcodeIsHandled(t *testing.T) {
+	for op := 0; op < 256; op++ {
+		def, err := code.Lookup(byte(op))
+		if err != nil {
+			continue
+		}
+
+		operands := make([]int, len(def.OperandWidths))
+		bytecode := &compiler.Bytecode{
+			Instructions: code.Make(code.Opcode(op), operands...),
+			Constants:    []object.Object{&object.Integer{Value: 1}},
+		}
+		got, panicked := stepUnverified(bytecode)
+		if panicked {
+			t.Errorf("%s panicked in the VM: %s", def.Name, got)
+		} else if strings.HasPrefix(got, "unknown opcode") {
+			t.Errorf("%s has no case in the VM: %s", def.Name, got)
+		}
+	}
+
+	got, _ := stepUnverified(&compiler.Bytecode{Instructions: code.Instructions{0xFA}})
+	if got != "unknown opcode 0xFA at ip=0000" {
+		t.Errorf("wrong error for an undefined opcode. got=%q", got)
+	}
+}
+
+// stepUnverified runs the first instruction of bytecode with a few integers on
+// the stack and in the main closure's free variables, skipping verification,
+// and returns the error it gives, if any, or the value it panicked with.
+func stepUnverified(bytecode *compiler.Bytecode) (message string, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			message, panicked = fmt.Sprint(r), true
+		}
+	}()
+
+	vm := New(bytecode)
+	vm.invalid = nil
+	for i := 0; i < 4; i++ {
+		vm.push(&object.Integer{Value: 1})
+		vm.currentFrame().cl.Free = append(vm.currentFrame().cl.Free, &object.Integer{Value: 1})
+	}
+	if _, err := vm.Step(); err != nil {
+		return err.Error(), false
+	}
+	return "", false
+}
+
+// TestTruncatedProgramsDoNotPanic runs every prefix of some real programs and
+// of their function bodies. Errors are expected; panics are not.
+func TestTruncatedProgramsDoNotPanic(t *testing.T) {
+	inputs := []string{
+		`let add = fn(a, b) { a + b }; add(1, 2) * 3`,
+		`let a = [1, 2, 3]; a[0] = {"k": a[1]}; a[0]["k"]`,
+		`let counter = fn(x) { fn() { x + 1 } }; counter(1)()`,
+		`let i = 0; while (i < 3) { if (i == 1) { break }; i += 1 }; len("abc") - i`,
+		`let h = {"f": fn(x) { x }}; [1].push(2).len() |> h.f`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		bytecode := comp.Bytecode()
+
+		for n := 0; n <= len(bytecode.Instructions); n++ {
+			runWithoutPanic(t, &compiler.Bytecode{Instructions: bytecode.Instructions[:n], Constants: bytecode.Constants})
+		}
+
+		for i, constant := range bytecode.Constants {
+			fn, ok := constant.(*object.CompiledFunction)
+			if !ok {
+				continue
+			}
+			for n := 0; n < len(fn.Instructions); n++ {
+				constants := append([]object.Object{}, bytecode.Constants...)
+				constants[i] = &object.CompiledFunction{
+					Instructions:  fn.Instructions[:n],
+					NumLocals:     fn.NumLocals,
+					NumParameters: fn.NumParameters,
+				}
+				runWithoutPanic(t, &compiler.Bytecode{Instructions: bytecode.Instructions, Constants: constants})
+			}
+		}
+	}
+}
+
+// TestGarbageBytecodeDoesNotPanic runs random instruction streams. Jumps are
+// left out so that no stream can loop forever.
+func TestGarbageBytecodeDoesNotPanic(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	constants := []object.Object{
+		&object.Integer{Value: 2},
+		&object.String{Value: "s"},
+		&object.CompiledFunction{
+			Instructions:  concat(code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)),
+			NumLocals:     1,
+			NumParameters: 1,
+		},
+	}
+
+	for i := 0; i < 5000; i++ {
+		ins := make(code.Instructions, 1+r.Intn(48))
+		for j := range ins {
+			b := byte(r.Intn(int(code.OpSetIndex) + 8))
+			switch code.Opcode(b) {
+			case code.OpJump, code.OpJumpNotTruthy, code.OpJumpTruthy:
+				b = byte(code.OpNull)
+			}
+			ins[j] = b
+		}
+		runWithoutPanic(t, &compiler.Bytecode{Instructions: ins, Constants: constants})
+	}
+}
+
+func runWithoutPanic(t *testing.T, bytecode *compiler.Bytecode) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("vm panicked: %v\ninstructions: %v\n%s", r, []byte(bytecode.Instructions), formatConstants(bytecode.Constants))
+		}
+	}()
+
+	vm := New(bytecode)
+	vm.Run()
+	vm.LastPoppedStackElem()
+}
+
+func formatConstants(constants []object.Object) string {
+	out := ""
+	for i, c := range constants {
+		out += fmt.Sprintf("%d: %s\n", i, c.Inspect())
+	}
+	return out
+}
+
+func concat(ins ...code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
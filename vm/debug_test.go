@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStep(t *testing.T) {
+	vm := New(compileForTest(t, "-(1 + 2)"))
+
+	steps := []struct {
+		ip    int
+		stack []int
+	}{
+		{3, []int{1}},    // OpConstant 0
+		{6, []int{1, 2}}, // OpConstant 1
+		{7, []int{3}},    // OpAdd
+		{8, []int{-3}},   // OpMinus
+		{9, []int{}},     // OpPop
+	}
+
+	for i, step := range steps {
+		done, err := vm.Step()
+		if err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		if done != (i == len(steps)-1) {
+			t.Fatalf("step %d: wrong done. got=%t", i, done)
+		}
+		if vm.IP() != step.ip {
+			t.Errorf("step %d: wrong ip. want=%d, got=%d", i, step.ip, vm.IP())
+		}
+
+		stack := vm.StackSlice()
+		if len(stack) != len(step.stack) {
+			t.Fatalf("step %d: wrong stack size. want=%d, got=%d", i, len(step.stack), len(stack))
+		}
+		for j, want := range step.stack {
+			testExpectedObject(t, want, stack[j])
+		}
+	}
+
+	testExpectedObject(t, -3, vm.LastPoppedStackElem())
+
+	if _, err := vm.Step(); err == nil {
+		t.Errorf("expected an error stepping a finished program")
+	}
+}
+
+func TestStepIntoFunctions(t *testing.T) {
+	vm := New(compileForTest(t, "let f = fn(x) { x * 2 }; f(4) + 1"))
+
+	steps := 0
+	for {
+		done, err := vm.Step()
+		if err != nil {
+			t.Fatalf("step %d: %s", steps, err)
+		}
+		steps++
+		if done {
+			break
+		}
+	}
+
+	// Main: closure, set, get, constant, call, constant, add, pop.
+	// Body: get local, constant, mul, return.
+	if steps != 12 {
+		t.Errorf("wrong number of steps. want=12, got=%d", steps)
+	}
+	testExpectedObject(t, 9, vm.LastPoppedStackElem())
+}
+
+func TestBreakpoint(t *testing.T) {
+	setup := "let double = fn(x) { x * 2 }; let i = 0; let total = 0;"
+	bytecode := compileForTest(t, setup+"while (i < 5) { total += double(i); i += 1 }; total")
+
+	uninterrupted := New(bytecode)
+	if err := uninterrupted.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Stop on the loop's condition check, which starts right after the
+	// definitions.
+	offset := len(compileForTest(t, setup).Instructions)
+
+	vm := New(bytecode)
+	vm.SetBreakpoint(offset)
+
+	hits := 0
+	for {
+		err := vm.Run()
+		if errors.Is(err, ErrBreakpoint) {
+			hits++
+			if vm.IP() != offset {
+				t.Fatalf("stopped at %d, want %d", vm.IP(), offset)
+			}
+			if hits > 10 {
+				t.Fatalf("breakpoint hit too many times")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		break
+	}
+
+	// Five condition checks that enter the loop, one that exits.
+	if hits != 6 {
+		t.Errorf("wrong number of breakpoint hits. want=6, got=%d", hits)
+	}
+	if vm.LastPoppedStackElem().Inspect() != uninterrupted.LastPoppedStackElem().Inspect() {
+		t.Errorf("results differ. interrupted=%s, uninterrupted=%s",
+			vm.LastPoppedStackElem().Inspect(), uninterrupted.LastPoppedStackElem().Inspect())
+	}
+	testExpectedObject(t, 20, vm.LastPoppedStackElem())
+}
+
+func TestClearBreakpoint(t *testing.T) {
+	vm := New(compileForTest(t, "1; 2; 3"))
+	vm.SetBreakpoint(4)
+	vm.SetBreakpoint(8)
+
+	if err := vm.Run(); !errors.Is(err, ErrBreakpoint) || vm.IP() != 4 {
+		t.Fatalf("expected breakpoint at 4, got err=%v ip=%d", err, vm.IP())
+	}
+	vm.ClearBreakpoint(8)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElem())
+
+	if stack := vm.StackSlice(); len(stack) != 0 {
+		t.Errorf("stack not empty after run. got=%d", len(stack))
+	}
+}
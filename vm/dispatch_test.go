@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"testing"
+)
+
+// BenchmarkDispatch runs an arithmetic loop through a switch, as run does,
+// and through a [256]func table of handlers, to back the choice of the
+// switch. Both support only the opcodes the loop uses, with the same bodies,
+// so the difference is the dispatch alone.
+func BenchmarkDispatch(b *testing.B) {
+	bytecode := compileForTest(b, "let i = 0; let sum = 0; while (i <= 100000) { sum += i; i += 1 }; sum")
+
+	for _, bm := range []struct {
+		name string
+		run  func(vm *VM) error
+	}{
+		{"switch", dispatchSwitch},
+		{"table", dispatchTable},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				vm := New(bytecode)
+				if err := bm.run(vm); err != nil {
+					b.Fatal(err)
+				}
+				if got := vm.LastPoppedStackElem().Inspect(); got != "5000050000" {
+					b.Fatalf("wrong result %s", got)
+				}
+			}
+		})
+	}
+}
+
+func dispatchSwitch(vm *VM) error {
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+	for frame.ip < len(ins)-1 {
+		frame.ip++
+		ip := frame.ip
+		switch op := code.Opcode(ins[ip]); op {
+		case code.OpConstant:
+			frame.ip += 2
+			if err := vm.push(vm.constants[code.ReadUint16(ins[ip+1:])]); err != nil {
+				return err
+			}
+		case code.OpGetGlobal:
+			frame.ip += 2
+			if err := vm.push(vm.globals[code.ReadUint16(ins[ip+1:])]); err != nil {
+				return err
+			}
+		case code.OpSetGlobal:
+			frame.ip += 2
+			vm.globals[code.ReadUint16(ins[ip+1:])] = vm.pop()
+		case code.OpAdd:
+			if err := vm.executeBinOp(op); err != nil {
+				return err
+			}
+		case code.OpLessEqual:
+			if err := vm.executeComparison(op); err != nil {
+				return err
+			}
+		case code.OpJumpNotTruthy:
+			frame.ip += 2
+			if !object.IsTruthy(vm.pop()) {
+				frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+			}
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+		case code.OpNull:
+			if err := vm.push(object.NULL); err != nil {
+				return err
+			}
+		case code.OpPop:
+			vm.pop()
+		default:
+			return fmt.Errorf("unknown opcode 0x%02X at ip=%04d", byte(op), ip)
+		}
+	}
+	return nil
+}
+
+type handler func(vm *VM, frame *Frame, ins code.Instructions, ip int) error
+
+var handlers = [256]handler{
+	code.OpConstant: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		frame.ip += 2
+		return vm.push(vm.constants[code.ReadUint16(ins[ip+1:])])
+	},
+	code.OpGetGlobal: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		frame.ip += 2
+		return vm.push(vm.globals[code.ReadUint16(ins[ip+1:])])
+	},
+	code.OpSetGlobal: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		frame.ip += 2
+		vm.globals[code.ReadUint16(ins[ip+1:])] = vm.pop()
+		return nil
+	},
+	code.OpAdd: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		return vm.executeBinOp(code.OpAdd)
+	},
+	code.OpLessEqual: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		return vm.executeComparison(code.OpLessEqual)
+	},
+	code.OpJumpNotTruthy: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		frame.ip += 2
+		if !object.IsTruthy(vm.pop()) {
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+		}
+		return nil
+	},
+	code.OpJump: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+		return nil
+	},
+	code.OpNull: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		return vm.push(object.NULL)
+	},
+	code.OpPop: func(vm *VM, frame *Frame, ins code.Instructions, ip int) error {
+		vm.pop()
+		return nil
+	},
+}
+
+func dispatchTable(vm *VM) error {
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+	for frame.ip < len(ins)-1 {
+		frame.ip++
+		ip := frame.ip
+		h := handlers[ins[ip]]
+		if h == nil {
+			return fmt.Errorf("unknown opcode 0x%02X at ip=%04d", ins[ip], ip)
+		}
+		if err := h(vm, frame, ins, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
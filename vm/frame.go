@@ -9,8 +9,30 @@ type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+
+	// memos are the memoized calls waiting for this frame's return value.
+	memos []pendingMemo
+}
+
+// pendingMemo is a memoized call whose result is stored under key once the
+// frame running it returns.
+type pendingMemo struct {
+	fn  *object.Memoized
+	key string
 }
 
+// cell holds a local that a closure has captured, shared by the frame that
+// defined it and every closure capturing it, so an assignment on either side
+// is seen by the other, as the tree walker's shared environments do. Locals
+// are put in a cell when first captured; OpGetLocal, OpSetLocal and OpGetFree
+// see through it, so scripts never see a cell.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
 	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
 }
@@ -0,0 +1,277 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/compiler"
+	"strings"
+	"testing"
+	"time"
+)
+
+func compileForTest(t testing.TB, input string) *compiler.Bytecode {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+	return comp.Bytecode()
+}
+
+func TestStackGrowsAcrossCalls(t *testing.T) {
+	vm := New(compileForTest(t, "let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(300)")).WithStackSize(8)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 45150, vm.LastPoppedStackElem())
+
+	if len(vm.stack) <= 8 {
+		t.Errorf("stack did not grow. len=%d", len(vm.stack))
+	}
+}
+
+func TestStackBeyondInitialSize(t *testing.T) {
+	// Four slots a frame over 1000 frames needs more than STACKSIZE.
+	runVmTests(t, []vmTestCase{
+		{"let f = fn(a, b, c) { if (a == 0) { b + c } else { f(a - 1, b, c) } }; f(1000, 1, 2)", 3},
+	})
+}
+
+func TestStackOverflowLimit(t *testing.T) {
+	vm := New(compileForTest(t, "let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(300)")).WithMaxStackSize(100)
+
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected a stack overflow")
+	}
+	if !strings.HasPrefix(err.Error(), "stack overflow: depth ") || !strings.HasSuffix(err.Error(), " exceeds limit 100") {
+		t.Errorf("wrong error. got=%q", err)
+	}
+	if len(vm.stack) != 100 {
+		t.Errorf("stack should grow to exactly the limit. len=%d", len(vm.stack))
+	}
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	vm := New(compileForTest(t, "while (true) { }"))
+	err := vm.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got=%v", err)
+	}
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm := New(compileForTest(t, "let i = 0; while (true) { i += 1 }"))
+	vm.CheckInterval = 1
+	if err := vm.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got=%v", err)
+	}
+}
+
+func TestMaxInstructions(t *testing.T) {
+	tests := []struct {
+		input         string
+		max, interval int
+		expected      string
+	}{
+		{"while (true) { }", 1000, 0, "instruction budget exceeded after 1000 instructions"},
+		{"while (true) { }", 1000, 7, "instruction budget exceeded after 1000 instructions"},
+		{"let f = fn() { f() }; f()", 50, 0, "instruction budget exceeded after 50 instructions"},
+		// OpConstant, OpConstant, OpAdd, OpPop
+		{"1 + 2", 4, 0, ""},
+		{"1 + 2", 3, 0, "instruction budget exceeded after 3 instructions"},
+		{"1 + 2", 3, 2, "instruction budget exceeded after 3 instructions"},
+	}
+
+	for _, tt := range tests {
+		vm := New(compileForTest(t, tt.input))
+		vm.MaxInstructions = tt.max
+		vm.CheckInterval = tt.interval
+
+		err := vm.Run()
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q with budget %d: unexpected error: %s", tt.input, tt.max, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q with budget %d: want=%q, got=%v", tt.input, tt.max, tt.expected, err)
+		}
+	}
+}
+
+func TestGenerousBudgetUnaffected(t *testing.T) {
+	vm := New(compileForTest(t, "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)"))
+	vm.MaxInstructions = 1000000
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := vm.RunContext(ctx); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 610, vm.LastPoppedStackElem())
+}
+
+func TestResetRestoresBudget(t *testing.T) {
+	bytecode := compileForTest(t, "let i = 0; while (i < 10) { i += 1 }; i")
+
+	vm := New(bytecode)
+	vm.MaxInstructions = 200
+	for run := 0; run < 3; run++ {
+		if err := vm.Run(); err != nil {
+			t.Fatalf("run %d: %s", run, err)
+		}
+		vm.Reset(bytecode)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	const limit = 10 * 1024 * 1024
+	tests := []string{
+		`let s = "x"; while (true) { s = s + s }`,
+		`let a = []; while (true) { a = push(a, 1) }`,
+		`let a = []; while (true) { a = a << [a] }`,
+		`let h = {}; let i = 0; while (true) { h = {"a": h, "b": [i, i, i]}; i += 1 }`,
+	}
+
+	for _, input := range tests {
+		vm := New(compileForTest(t, input))
+		vm.MaxBytes = limit
+
+		err := vm.Run()
+		if err == nil || err.Error() != "memory limit exceeded (limit 10485760 bytes)" {
+			t.Errorf("%q: wrong error. got=%v", input, err)
+			continue
+		}
+		if vm.bytes > 2*limit {
+			t.Errorf("%q: limit caught too late. bytes=%d", input, vm.bytes)
+		}
+	}
+}
+
+func TestMemoryLimitCountsHashGrowth(t *testing.T) {
+	vm := New(compileForTest(t, `let h = {}; let i = 0; while (i < 2000000) { h[i] = i; i += 1 }`))
+	vm.MaxBytes = 1024 * 1024
+
+	err := vm.Run()
+	if err == nil || err.Error() != "memory limit exceeded (limit 1048576 bytes)" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestMemoryLimitSkipsExistingValues(t *testing.T) {
+	input := `let a = ["` + strings.Repeat("x", 60) + `"]; first(a); last(a); len(first(a))`
+	vm := New(compileForTest(t, input))
+	vm.MaxBytes = 100
+
+	if err := vm.Run(); err != nil {
+		t.Fatalf("first and last were charged for existing values: %s", err)
+	}
+}
+
+func TestMemoryLimitDisabledByDefault(t *testing.T) {
+	vm := New(compileForTest(t, `let s = "x"; let i = 0; while (i < 10) { s = s + s; i += 1 }; len(s)`))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 1024, vm.LastPoppedStackElem())
+	if vm.bytes != 0 {
+		t.Errorf("bytes counted without a limit. got=%d", vm.bytes)
+	}
+}
+
+func TestResetClearsMemoryCount(t *testing.T) {
+	bytecode := compileForTest(t, `let a = []; let i = 0; while (i < 50) { a = push(a, i); i += 1 }`)
+
+	vm := New(bytecode)
+	vm.MaxBytes = 50 * 51 / 2 * 16 * 2
+	for run := 0; run < 3; run++ {
+		if err := vm.Run(); err != nil {
+			t.Fatalf("run %d: %s", run, err)
+		}
+		vm.Reset(bytecode)
+	}
+}
+
+const loopBenchmark = "let i = 0; while (i < 100000) { i += 1 }"
+
+func BenchmarkLoop(b *testing.B) {
+	bytecode := compileForTest(b, loopBenchmark)
+	for i := 0; i < b.N; i++ {
+		if err := New(bytecode).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSumLoop(b *testing.B) {
+	bytecode := compileForTest(b, "let i = 0; let sum = 0; while (i <= 1000000) { sum += i; i += 1 }; sum")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := New(bytecode).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSmallIntegerArithmeticDoesNotAllocate(t *testing.T) {
+	allocs := func(n int) float64 {
+		bytecode := compileForTest(t, fmt.Sprintf("let i = 0; let j = 0; while (i < %d) { i += 1; j = i * 2 - i; i > j }", n))
+		return testing.AllocsPerRun(10, func() {
+			if err := New(bytecode).Run(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if short, long := allocs(10), allocs(500); long != short {
+		t.Errorf("arithmetic on cached integers allocated. 10 iterations=%v, 500 iterations=%v", short, long)
+	}
+}
+
+// BenchmarkIntegerArithmetic runs the same loop on integers inside and
+// outside object.GetInteger's cache. The uncached run allocates a result per
+// operation, which is what every integer result cost before the cache.
+func BenchmarkIntegerArithmetic(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		base int64
+	}{
+		{"cached", 0},
+		{"uncached", 1 << 40},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			bytecode := compileForTest(b, fmt.Sprintf("let i = %d; let j = 0; while (i < %d) { i += 1; j = i * 2 - i; i > j }", bm.base, bm.base+500))
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoopWithLimits(b *testing.B) {
+	bytecode := compileForTest(b, loopBenchmark)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < b.N; i++ {
+		vm := New(bytecode)
+		vm.MaxInstructions = 1 << 30
+		if err := vm.RunContext(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/code"
+	"sort"
+	"time"
+)
+
+// OpStats is how many times an opcode ran and the total time spent in it.
+type OpStats struct {
+	Count int
+	Nanos int64
+}
+
+// OpProfile holds the OpStats of every opcode that ran.
+type OpProfile map[code.Opcode]OpStats
+
+// String lists the opcodes by total time, most expensive first.
+func (p OpProfile) String() string {
+	ops := make([]code.Opcode, 0, len(p))
+	for op := range p {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		a, b := p[ops[i]], p[ops[j]]
+		if a.Nanos != b.Nanos {
+			return a.Nanos > b.Nanos
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return ops[i] < ops[j]
+	})
+
+	var out bytes.Buffer
+	for _, op := range ops {
+		name := fmt.Sprintf("Op(%d)", op)
+		if def, err := code.Lookup(byte(op)); err == nil {
+			name = def.Name
+		}
+		stats := p[op]
+		fmt.Fprintf(&out, "%-18s %10d %12s\n", name, stats.Count, time.Duration(stats.Nanos))
+	}
+	return out.String()
+}
+
+// WithProfile makes the VM count and time every instruction it executes.
+// The profile carries over Reset, so it can cover several runs.
+func (vm *VM) WithProfile() *VM {
+	vm.profile = &[256]OpStats{}
+	return vm
+}
+
+// Profile returns the stats collected since WithProfile, or nil if
+// profiling is off.
+func (vm *VM) Profile() OpProfile {
+	if vm.profile == nil {
+		return nil
+	}
+
+	p := OpProfile{}
+	for op, stats := range vm.profile {
+		if stats.Count > 0 {
+			p[code.Opcode(op)] = stats
+		}
+	}
+	return p
+}
+
+// record charges one execution taking d to op.
+func (vm *VM) record(op byte, d time.Duration) {
+	stats := &vm.profile[op]
+	stats.Count++
+	stats.Nanos += d.Nanoseconds()
+}
@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+const profileProgram = `
+let i = 0;
+let odd = 0;
+while (i < 1000) {
+	if (i % 2 == 1) { odd += 1 }
+	i += 1
+}
+odd`
+
+func TestProfile(t *testing.T) {
+	vm := New(compileForTest(t, profileProgram)).WithProfile()
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 500, vm.LastPoppedStackElem())
+
+	profile := vm.Profile()
+	if got := profile[code.OpLessThan].Count; got != 1001 {
+		t.Errorf("OpLessThan ran %d times, want=1001", got)
+	}
+	if got := profile[code.OpEqual].Count; got != 1000 {
+		t.Errorf("OpEqual ran %d times, want=1000", got)
+	}
+
+	control := map[code.Opcode]bool{
+		code.OpJump: true, code.OpJumpNotTruthy: true,
+		code.OpEqual: true, code.OpNotEqual: true, code.OpLessThan: true,
+	}
+	controlCount := 0
+	for op := range control {
+		controlCount += profile[op].Count
+	}
+	for op, stats := range profile {
+		if !control[op] && stats.Count >= controlCount {
+			t.Errorf("op %d ran %d times, more than all jumps and comparisons (%d)", op, stats.Count, controlCount)
+		}
+	}
+
+	out := profile.String()
+	if !strings.Contains(out, "OpJumpNotTruthy") || !strings.Contains(out, "OpLessThan") {
+		t.Errorf("profile does not name its opcodes:\n%s", out)
+	}
+}
+
+func TestProfileSortedByTime(t *testing.T) {
+	profile := OpProfile{
+		code.OpAdd:  {Count: 1, Nanos: 10},
+		code.OpJump: {Count: 5, Nanos: 30},
+		code.OpPop:  {Count: 9, Nanos: 20},
+	}
+
+	lines := strings.Split(strings.TrimSpace(profile.String()), "\n")
+	want := []string{"OpJump", "OpPop", "OpAdd"}
+	if len(lines) != len(want) {
+		t.Fatalf("wrong number of lines. got=%q", lines)
+	}
+	for i, name := range want {
+		if !strings.HasPrefix(lines[i], name+" ") {
+			t.Errorf("line %d: want %s, got=%q", i, name, lines[i])
+		}
+	}
+}
+
+func TestProfileDisabled(t *testing.T) {
+	vm := New(compileForTest(t, "1 + 2"))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if vm.Profile() != nil {
+		t.Errorf("profile collected without WithProfile")
+	}
+}
+
+func BenchmarkLoopWithProfile(b *testing.B) {
+	bytecode := compileForTest(b, loopBenchmark)
+	for i := 0; i < b.N; i++ {
+		if err := New(bytecode).WithProfile().Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestProfileWithInstructionBudget(t *testing.T) {
+	bytecode := compileForTest(t, profileProgram)
+
+	plain := New(bytecode)
+	if err := plain.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	budget := plain.executed
+
+	var stats object.Stats
+	vm := New(bytecode).WithProfile()
+	vm.MaxInstructions = budget
+	vm.Hooks = &object.EvalHooks{OnComplete: func(s object.Stats) { stats = s }}
+	if err := vm.Run(); err != nil {
+		t.Fatalf("profiling used up a budget of %d instructions: %s", budget, err)
+	}
+	if stats.Steps != budget {
+		t.Errorf("Stats.Steps=%d with profiling, want=%d", stats.Steps, budget)
+	}
+	counted := 0
+	for _, op := range vm.Profile() {
+		counted += op.Count
+	}
+	if counted != budget {
+		t.Errorf("profile counted %d instructions, want=%d", counted, budget)
+	}
+
+	vm = New(bytecode).WithProfile()
+	vm.MaxInstructions = budget - 1
+	want := fmt.Sprintf("instruction budget exceeded after %d instructions", budget-1)
+	if err := vm.Run(); err == nil || err.Error() != want {
+		t.Errorf("want=%q, got=%v", want, err)
+	}
+}
@@ -1,70 +1,222 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
+	"monkey/token"
+	"time"
 )
 
 const (
 	STACKSIZE   = 2048
 	GLOBALSSIZE = 65536
 	MAXFRAMES   = 1024
-)
 
-var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	// MAXSTACKSIZE is how far the stack may grow by default.
+	MAXSTACKSIZE = 65536
+
+	// DefaultCheckInterval is how many instructions RunContext executes
+	// between looking at its context.
+	DefaultCheckInterval = 10000
 )
 
+// ErrBreakpoint is returned by Run when it stops at a breakpoint.
+var ErrBreakpoint = errors.New("breakpoint")
+
+var errFinished = errors.New("vm already ran; call Reset before running again")
+
 type VM struct {
 	constants []object.Object
 
-	stack []object.Object
-	sp    int
+	// stack starts at STACKSIZE slots and grows as needed up to maxStack.
+	stack    []object.Object
+	sp       int
+	maxStack int
 
 	frames      []*Frame
 	framesIndex int
 
+	// MaxFrames bounds the call depth, main frame included. New sets it to
+	// MAXFRAMES.
+	MaxFrames int
+
+	// MaxInstructions stops a run after that many instructions; zero means
+	// no limit.
+	MaxInstructions int
+
+	// CheckInterval is how often, in instructions, RunContext checks its
+	// context. Zero means DefaultCheckInterval.
+	CheckInterval int
+
+	// executed counts instructions run so far, updated at each check.
+	executed int
+
+	// MaxBytes caps the approximate memory, by object.SizeOf, of the
+	// strings, arrays and hashes a run creates; zero means no limit.
+	MaxBytes int
+	bytes    int
+
+	// Overflow is what integer arithmetic does when a result doesn't fit in
+	// an Integer. The zero value fails with an error.
+	Overflow object.Overflow
+
+	// Hooks, if set, are told of calls, the error a run fails with and the
+	// run's statistics. Bytecode carries no source positions, so OnError
+	// always gets a zero token.Position.
+	Hooks *object.EvalHooks
+
+	// GlobalName names a global slot for errors about it. Nil, or an empty
+	// name, reports the slot by its index.
+	GlobalName func(index int) string
+
+	// AllowBuiltin reports whether a method call may fall back to the
+	// builtin of that name. Nil allows every builtin.
+	AllowBuiltin func(name string) bool
+
+	// deepest is the most frames the run has had.
+	deepest int
+
 	globals []object.Object
+
+	// finished is set once the program completes or fails; Reset clears it
+	// for the next program. paused means Run stopped at a breakpoint.
+	finished bool
+	paused   bool
+
+	breakpoints map[int]bool
+
+	// invalid is why the loaded bytecode failed verification, if it did.
+	invalid error
+
+	// profile is indexed by opcode; nil unless WithProfile was called.
+	profile *[256]OpStats
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GLOBALSSIZE))
+}
+
+// NewWithGlobalsStore runs bytecode against an existing globals slice, which
+// must be GLOBALSSIZE long. The VM writes to it in place, so the caller keeps
+// the same slice to carry globals over to the next run.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MAXFRAMES)
-	frames[0] = mainFrame
+	// Frames are allocated as calls get deeper, so raising MaxFrames costs
+	// nothing until it is used.
+	frames := []*Frame{mainFrame}
 
-	return &VM{
+	vm := &VM{
 		constants: bytecode.Constants,
 
-		stack: make([]object.Object, STACKSIZE),
-		sp:    0,
+		stack:    make([]object.Object, STACKSIZE),
+		sp:       0,
+		maxStack: MAXSTACKSIZE,
 
-		globals: make([]object.Object, GLOBALSSIZE),
+		globals: s,
 
 		frames:      frames,
 		framesIndex: 1,
+		MaxFrames:   MAXFRAMES,
+		deepest:     1,
 	}
+	vm.invalid = vm.verify()
+	return vm
 }
 
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = s
+// WithStackSize replaces the initial stack with one of n slots, raising the
+// maximum to n if needed. Call it before Run.
+func (vm *VM) WithStackSize(n int) *VM {
+	vm.stack = make([]object.Object, n)
+	if vm.maxStack < n {
+		vm.maxStack = n
+	}
 	return vm
 }
 
+// WithMaxStackSize limits how far the stack may grow before pushing fails
+// with a stack overflow, shrinking it if it is already larger. Call it before
+// Run.
+func (vm *VM) WithMaxStackSize(n int) *VM {
+	vm.maxStack = n
+	if len(vm.stack) > n {
+		vm.stack = make([]object.Object, n)
+	}
+	return vm
+}
+
+// Globals returns the globals store the VM reads and writes.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Reset prepares the VM to run new bytecode against the same globals, reusing
+// the stack and frames instead of allocating them again.
+func (vm *VM) Reset(bytecode *compiler.Bytecode) {
+	// Drop references from the last run so they can be collected.
+	clear(vm.stack)
+	clear(vm.frames)
+	vm.sp = 0
+
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	vm.frames[0] = NewFrame(&object.Closure{Fn: mainFn}, 0)
+	vm.framesIndex = 1
+
+	vm.constants = bytecode.Constants
+	vm.invalid = vm.verify()
+	vm.executed = 0
+	vm.bytes = 0
+	vm.deepest = 1
+	vm.finished = false
+	vm.paused = false
+}
+
+// nextChunk is how many instructions may run before the next check, ending
+// the chunk early so MaxInstructions is enforced exactly.
+func (vm *VM) nextChunk(interval int) int {
+	if vm.MaxInstructions > 0 && vm.MaxInstructions-vm.executed < interval {
+		return vm.MaxInstructions - vm.executed
+	}
+	return interval
+}
+
+func (vm *VM) checkLimits(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("vm stopped: %w", err)
+	}
+	if vm.MaxInstructions > 0 && vm.executed >= vm.MaxInstructions {
+		return object.NewError(object.KindLimitExceeded, "instruction budget exceeded after %d instructions", vm.executed)
+	}
+	return nil
+}
+
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
-	vm.frames[vm.framesIndex] = f
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= vm.MaxFrames {
+		return object.NewError(object.KindLimitExceeded, "call stack exhausted")
+	}
+
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
 	vm.framesIndex++
+	if vm.framesIndex > vm.deepest {
+		vm.deepest = vm.framesIndex
+	}
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -80,14 +232,169 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Run executes the bytecode once. Running again requires a Reset first.
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is Run, stopping early with an error wrapping ctx.Err() once ctx
+// is done. The context is checked every CheckInterval instructions.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if vm.finished {
+		return errFinished
+	}
+	if vm.invalid != nil {
+		vm.finished = true
+		return vm.invalid
+	}
+
+	if vm.Hooks != nil {
+		return vm.runWithHooks(ctx)
+	}
+	done, err := vm.run(ctx, false)
+	if done || (err != nil && err != ErrBreakpoint) {
+		vm.finished = true
+	}
+	return err
+}
+
+// runWithHooks is RunContext, reporting to vm.Hooks as the program fails and
+// completes. A run that stops at a breakpoint reports when it is resumed to
+// the end.
+func (vm *VM) runWithHooks(ctx context.Context) error {
+	start := time.Now()
+	_, err := vm.run(ctx, false)
+	if err == ErrBreakpoint {
+		return err
+	}
+	vm.finished = true
+
+	if err != nil && vm.Hooks.OnError != nil {
+		vm.Hooks.OnError(err, token.Position{})
+	}
+	if vm.Hooks.OnComplete != nil {
+		vm.Hooks.OnComplete(object.Stats{
+			Steps:    vm.executed,
+			MaxDepth: vm.deepest - 1,
+			Bytes:    vm.bytes,
+			Duration: time.Since(start),
+		})
+	}
+	return err
+}
+
+// Step executes exactly one instruction, ignoring breakpoints and limits, and
+// reports whether the program has finished.
+func (vm *VM) Step() (done bool, err error) {
+	if vm.finished {
+		return true, errFinished
+	}
+	if vm.invalid != nil {
+		vm.finished = true
+		return true, vm.invalid
+	}
+
+	done, err = vm.run(context.Background(), true)
+	if err != nil || done {
+		vm.finished = true
+		return true, err
+	}
+	return false, nil
+}
+
+// IP is the offset of the next instruction to execute in the current frame.
+func (vm *VM) IP() int {
+	return vm.currentFrame().ip + 1
+}
+
+// StackSlice returns a copy of the values on the stack, bottom first.
+func (vm *VM) StackSlice() []object.Object {
+	return append([]object.Object{}, vm.stack[:vm.sp]...)
+}
+
+// SetBreakpoint makes Run return ErrBreakpoint before executing the
+// instruction at offset in the main program. Offsets inside functions are not
+// supported. Calling Run again resumes from there.
+func (vm *VM) SetBreakpoint(offset int) {
+	if vm.breakpoints == nil {
+		vm.breakpoints = map[int]bool{}
+	}
+	vm.breakpoints[offset] = true
+}
+
+// ClearBreakpoint removes a breakpoint set with SetBreakpoint.
+func (vm *VM) ClearBreakpoint(offset int) {
+	delete(vm.breakpoints, offset)
+}
+
+func (vm *VM) atEnd() bool {
+	frame := vm.currentFrame()
+	return frame.ip >= len(frame.Instructions())-1
+}
+
+// run executes instructions until the program ends, fails, or stops at a
+// breakpoint or limit, reporting whether it ended. With step set it runs a
+// single instruction instead, ignoring breakpoints and limits. The dispatch
+// switch stays in this loop: a call per instruction, whether to a method or
+// through a table of handlers, is measurably slower, as BenchmarkDispatch
+// shows.
+func (vm *VM) run(ctx context.Context, step bool) (bool, error) {
 	var (
 		ip  int
 		ins code.Instructions
 		op  code.Opcode
 	)
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	// Resuming from a breakpoint runs the instruction it stopped at.
+	resuming := vm.paused || step
+	vm.paused = false
+
+	interval := vm.CheckInterval
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	// Counting down a chunk keeps the per-instruction cost to a decrement.
+	chunk := 1
+	if !step {
+		chunk = vm.nextChunk(interval)
+	}
+	left := chunk
+
+	// With profiling on, each instruction is timed until the next one starts
+	// or the run returns.
+	var (
+		profiledOp byte
+		started    time.Time
+	)
+	// However the run returns, count what it executed of the current chunk.
+	defer func() {
+		vm.executed += chunk - left
+		if !started.IsZero() {
+			vm.record(profiledOp, time.Since(started))
+		}
+	}()
+
+	for !vm.atEnd() {
+		if left == 0 {
+			if step {
+				return false, nil
+			}
+			vm.executed += chunk
+			chunk = 0
+			if err := vm.checkLimits(ctx); err != nil {
+				return true, err
+			}
+			chunk = vm.nextChunk(interval)
+			left = chunk
+		}
+
+		if len(vm.breakpoints) > 0 && !resuming && vm.framesIndex == 1 && vm.breakpoints[vm.IP()] {
+			vm.paused = true
+			return false, ErrBreakpoint
+		}
+		resuming = false
+		left--
+
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
@@ -95,39 +402,48 @@ func (vm *VM) Run() error {
 
 		op = code.Opcode(ins[ip])
 
+		if vm.profile != nil {
+			now := time.Now()
+			if !started.IsZero() {
+				vm.record(profiledOp, now.Sub(started))
+			}
+			profiledOp, started = byte(op), now
+		}
+
 		switch op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
 			if err := vm.push(vm.constants[constIndex]); err != nil {
-				return err
+				return false, err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitOr, code.OpBitAnd, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			if err := vm.executeBinOp(op); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpPop:
 			vm.pop()
 		case code.OpTrue:
-			if err := vm.push(True); err != nil {
-				return err
+			if err := vm.push(object.TRUE); err != nil {
+				return false, err
 			}
 		case code.OpFalse:
-			if err := vm.push(False); err != nil {
-				return err
+			if err := vm.push(object.FALSE); err != nil {
+				return false, err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
 			if err := vm.executeComparison(op); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpBang:
 			if err := vm.executeBangOp(); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpMinus:
 			if err := vm.executeMinusOperator(); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
@@ -137,12 +453,31 @@ func (vm *VM) Run() error {
 			vm.currentFrame().ip += 2
 
 			condition := vm.pop()
-			if !isTruthy(condition) {
+			if !object.IsTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpJumpTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if object.IsTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpDup:
+			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+				return false, err
+			}
+		case code.OpDup2:
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return false, err
+			}
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return false, err
+			}
 		case code.OpNull:
-			if err := vm.push(Null); err != nil {
-				return err
+			if err := vm.push(object.NULL); err != nil {
+				return false, err
 			}
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
@@ -153,8 +488,12 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
+			// Unset when the program that defines it failed before storing.
+			if vm.globals[globalIndex] == nil {
+				return false, vm.unsetGlobal(int(globalIndex))
+			}
 			if err := vm.push(vm.globals[globalIndex]); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
@@ -163,8 +502,8 @@ func (vm *VM) Run() error {
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp -= numElements
 
-			if err := vm.push(array); err != nil {
-				return err
+			if err := vm.pushAllocated(array); err != nil {
+				return false, err
 			}
 		case code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
@@ -172,87 +511,195 @@ func (vm *VM) Run() error {
 
 			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
 			if err != nil {
-				return err
+				return false, err
 			}
 			vm.sp = vm.sp - numElements
 
-			err = vm.push(hash)
+			err = vm.pushAllocated(hash)
 			if err != nil {
-				return err
+				return false, err
 			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
 
-			if err := vm.executeIndexEpression(left, index); err != nil {
-				return err
+			result, err := object.Index(left, index)
+			if err != nil {
+				return false, err
+			}
+			if err := vm.push(result); err != nil {
+				return false, err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			// A new hash key grows the hash in place.
+			size := object.SizeOf(left)
+			if err := object.SetIndex(left, index, value); err != nil {
+				return false, err
+			}
+			if err := vm.charge(object.SizeOf(left) - size); err != nil {
+				return false, err
+			}
+			if err := vm.push(value); err != nil {
+				return false, err
 			}
 		case code.OpCall:
-			numArgs := code.ReadUint8(ins[ip+1:])
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
 			vm.currentFrame().ip += 1
 
-			if err := vm.executeCall(int(numArgs)); err != nil {
-				return err
+			// A function whose result is returned straight away runs in the
+			// caller's frame, so tail recursion doesn't use up MaxFrames.
+			if vm.framesIndex > 1 && ip+2 < len(ins) && code.Opcode(ins[ip+2]) == code.OpReturnValue {
+				if cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure); ok {
+					if err := vm.tailCall(cl, numArgs); err != nil {
+						return false, err
+					}
+					break
+				}
+			}
+			if err := vm.executeCall(numArgs); err != nil {
+				return false, err
+			}
+		case code.OpMember:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name, err := vm.memberName(int(constIndex))
+			if err != nil {
+				return false, err
+			}
+			value, err := member(vm.pop(), name)
+			if err != nil {
+				return false, err
+			}
+			if err := vm.push(value); err != nil {
+				return false, err
+			}
+		case code.OpCallMethod:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numArgs := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+			name, err := vm.memberName(int(constIndex))
+			if err != nil {
+				return false, err
+			}
+			if err := vm.callMethod(name, numArgs); err != nil {
+				return false, err
 			}
 		case code.OpReturnValue:
+			if vm.framesIndex == 1 {
+				return false, vm.returnFromMain(ip)
+			}
 			returnValue := vm.pop()
 
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1 // also gets rid of constant
+			for _, memo := range frame.memos {
+				memo.fn.Store(memo.key, returnValue)
+			}
 
 			if err := vm.push(returnValue); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return false, vm.returnFromMain(ip)
+			}
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
+			for _, memo := range frame.memos {
+				memo.fn.Store(memo.key, object.NULL)
+			}
 
-			if err := vm.push(Null); err != nil {
-				return err
+			if err := vm.push(object.NULL); err != nil {
+				return false, err
 			}
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := (*slot).(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
-				return err
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if c, ok := value.(*cell); ok {
+				value = c.value
+			}
+			if err := vm.push(value); err != nil {
+				return false, err
+			}
+		case code.OpGetLocalRef:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if _, ok := (*slot).(*cell); !ok {
+				*slot = &cell{value: *slot}
+			}
+			if err := vm.push(*slot); err != nil {
+				return false, err
 			}
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			definition := object.Builtins[builtinIndex]
 			if err := vm.push(definition.Builtin); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpClosure:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			numFree := code.ReadUint8(ins[ip+3:])
 			vm.currentFrame().ip += 3
 			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
-				return err
+				return false, err
 			}
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			currentClosure := vm.currentFrame().cl
-			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
-				return err
+			value := vm.currentFrame().cl.Free[freeIndex]
+			if c, ok := value.(*cell); ok {
+				value = c.value
+			}
+			if err := vm.push(value); err != nil {
+				return false, err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			c, ok := vm.currentFrame().cl.Free[freeIndex].(*cell)
+			if !ok {
+				return false, object.NewError(object.KindInternal, "free variable %d is not assignable", freeIndex)
+			}
+			c.value = vm.pop()
+		case code.OpGetFreeRef:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return false, err
 			}
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			if err := vm.push(currentClosure); err != nil {
-				return err
+				return false, err
 			}
+		default:
+			return false, object.NewError(object.KindInternal, "unknown opcode 0x%02X at ip=%04d", byte(op), ip)
 		}
 	}
 
-	return nil
+	return true, nil
 }
 
 func (vm *VM) executeCall(numArgs int) error {
@@ -262,19 +709,89 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callClosure(callee, numArgs)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
+	case *object.Memoized:
+		return vm.callMemoized(callee, numArgs)
 	default:
-		return fmt.Errorf("calling non-function and non-built in")
+		return object.NewError(object.KindNotCallable, "not a function: %s", callee.Type())
 	}
 }
 
+// callMemoized answers a call from the function's cache, or calls the
+// wrapped function. A builtin's result is stored straight away; a closure's
+// is stored when its frame returns.
+func (vm *VM) callMemoized(m *object.Memoized, numArgs int) error {
+	key, cacheable := m.CacheKey(vm.stack[vm.sp-numArgs : vm.sp])
+	if cacheable {
+		if result, ok := m.Lookup(key); ok {
+			vm.sp -= numArgs + 1
+			return vm.push(result)
+		}
+	}
+
+	depth := vm.framesIndex
+	vm.stack[vm.sp-1-numArgs] = m.Fn
+	if err := vm.executeCall(numArgs); err != nil {
+		return err
+	}
+	if !cacheable {
+		return nil
+	}
+	if vm.framesIndex > depth {
+		frame := vm.currentFrame()
+		frame.memos = append(frame.memos, pendingMemo{fn: m, key: key})
+		return nil
+	}
+	m.Store(key, vm.stack[vm.sp-1])
+	return nil
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+		return object.NewError(object.KindArgument, "wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+	if vm.Hooks != nil && vm.Hooks.OnCall != nil {
+		vm.Hooks.OnCall(cl.Fn.Name, numArgs)
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	if err := vm.ensureStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	// Clear the non-parameter locals so nothing from an earlier call on the
+	// same stack slots can be read back.
+	for i := frame.basePointer + numArgs; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = object.NULL
+	}
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+// tailCall replaces the current frame with a call to cl, moving the callee and
+// its arguments down to where the current function and its arguments were.
+func (vm *VM) tailCall(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return object.NewError(object.KindArgument, "wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+	if vm.Hooks != nil && vm.Hooks.OnCall != nil {
+		vm.Hooks.OnCall(cl.Fn.Name, numArgs)
+	}
+
+	frame := vm.currentFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	frame.cl = cl
+	frame.ip = -1
 
+	if err := vm.ensureStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	for i := frame.basePointer + numArgs; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = object.NULL
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
 	return nil
@@ -282,72 +799,121 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
+	if vm.Hooks != nil && vm.Hooks.OnCall != nil {
+		vm.Hooks.OnCall(builtin.Name, numArgs)
+	}
 
 	result := builtin.Fn(args...)
 	vm.sp = vm.sp - numArgs - 1
 
-	if result != nil {
-		vm.push(result)
-	} else {
-		vm.push(Null)
+	if errObj, ok := result.(*object.Error); ok && !errObj.Value {
+		return errObj
 	}
 
-	return nil
+	if result == nil {
+		return vm.push(object.NULL)
+	}
+	if builtin.Allocates {
+		return vm.pushAllocated(result)
+	}
+	return vm.push(result)
 }
 
-func (vm *VM) pushClosure(constIndex int, numFree int) error {
-	constant := vm.constants[constIndex]
-	function, ok := constant.(*object.CompiledFunction)
+// memberName returns the name an OpMember or OpCallMethod refers to.
+func (vm *VM) memberName(constIndex int) (string, error) {
+	name, ok := vm.constants[constIndex].(*object.String)
 	if !ok {
-		return fmt.Errorf("not a function: %+v", constant)
+		return "", object.NewError(object.KindInternal, "not a member name: %+v", vm.constants[constIndex])
 	}
+	return name.Value, nil
+}
 
-	free := make([]object.Object, numFree)
-	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+// member reads name from a module, or from a hash holding it as a string
+// key. Other values have no members.
+func member(left object.Object, name string) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Module:
+		return left.Member(name)
+	case *object.Hash:
+		if value, ok := left.Get(&object.String{Value: name}); ok {
+			return value, nil
+		}
+		return nil, object.NewError(object.KindTypeMismatch, "hash has no member %q", name)
 	}
-	vm.sp -= numFree
-
-	closure := &object.Closure{Fn: function, Free: free}
-	return vm.push(closure)
+	return nil, object.NewError(object.KindTypeMismatch, "%s has no members", left.Type())
 }
 
-func (vm *VM) executeIndexEpression(left, index object.Object) error {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		l, _ := left.(*object.Array)
-		i, _ := index.(*object.Integer)
-		return vm.executeArrayIndex(l, i)
-	case left.Type() == object.HASH_OBJ:
-		return vm.executeHashIndex(left, index)
-	default:
-		return fmt.Errorf("index operator not supported: %s", left.Type())
+// callMethod calls receiver.name(args) with the stack holding the function
+// name resolved to in scope, or null, then the receiver and the arguments. A
+// module's member, or a hash's member if it has one, is called with the
+// arguments as they are. Otherwise the function in scope, if it is one, or
+// else the builtin called name is called with the receiver first.
+func (vm *VM) callMethod(name string, numArgs int) error {
+	base := vm.sp - 2 - numArgs
+	receiver := vm.stack[base+1]
+
+	var function object.Object
+	switch receiver := receiver.(type) {
+	case *object.Module:
+		var err error
+		if function, err = receiver.Member(name); err != nil {
+			return err
+		}
+	case *object.Hash:
+		function, _ = receiver.Get(&object.String{Value: name})
+	}
+	if function != nil {
+		copy(vm.stack[base:], vm.stack[base+1:vm.sp])
+		vm.sp--
+		vm.stack[base] = function
+		return vm.executeCall(numArgs)
 	}
-}
 
-func (vm *VM) executeArrayIndex(left *object.Array, index *object.Integer) error {
-	max := int64(len(left.Elements) - 1)
-	if index.Value < 0 || index.Value > max {
-		return vm.push(Null)
+	switch vm.stack[base].(type) {
+	case *object.Closure, *object.Builtin:
+		return vm.executeCall(numArgs + 1)
+	}
+	if builtin := object.GetBuiltinByName(name); builtin != nil && (vm.AllowBuiltin == nil || vm.AllowBuiltin(name)) {
+		vm.stack[base] = builtin
+		return vm.executeCall(numArgs + 1)
 	}
+	return object.NewError(object.KindUndefinedIdentifier, "no function %q applicable to %s", name, receiver.Type())
+}
 
-	return vm.push(left.Elements[index.Value])
+// returnFromMain reports a return in the main program, which has no caller
+// to return to.
+func (vm *VM) returnFromMain(ip int) error {
+	return object.NewError(object.KindInvalidOperation, "return outside a function at ip=%04d", ip)
 }
 
-func (vm *VM) executeHashIndex(left, index object.Object) error {
-	hashObj := left.(*object.Hash)
+// unsetGlobal reports reading a global that was never stored, which happens
+// when the program defining it failed first.
+func (vm *VM) unsetGlobal(index int) error {
+	name := ""
+	if vm.GlobalName != nil {
+		name = vm.GlobalName(index)
+	}
+	if name == "" {
+		name = fmt.Sprintf("global %d", index)
+	}
+	return object.NewError(object.KindUndefinedIdentifier, "identifier not found: %s", name)
+}
 
-	key, ok := index.(object.Hashable)
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
 	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+		return object.NewError(object.KindInternal, "not a function: %+v", constant)
 	}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
-	if !ok {
-		return vm.push(Null)
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
 	}
+	vm.sp -= numFree
 
-	return vm.push(pair.Value)
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
@@ -361,23 +927,21 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash((endIndex - startIndex) / 2)
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
-
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return nil, object.NewError(object.KindUnhashable, "unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) executeBinOp(op code.Opcode) error {
@@ -390,11 +954,23 @@ func (vm *VM) executeBinOp(op code.Opcode) error {
 	switch {
 	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
 		return vm.executeBinaryIntegerOp(op, l, r)
+	case object.IsBigOperation(l, r):
+		return vm.executeBigOp(op, l, r)
+	case op == code.OpShiftLeft || op == code.OpShiftRight:
+		shifted, err := object.Shift(binaryOperators[op], l, r)
+		if err != nil {
+			return err
+		}
+		return vm.pushAllocated(shifted)
+	case isNumber(l) && isNumber(r):
+		return vm.executeBinaryFloatOp(op, l, r)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeStringOperation(op, l, r)
+	case leftType == object.BYTES_OBJ && rightType == object.BYTES_OBJ && op == code.OpAdd:
+		joined := append(bytes.Clone(l.(*object.Bytes).Value), r.(*object.Bytes).Value...)
+		return vm.pushAllocated(&object.Bytes{Value: joined})
 	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s",
-			leftType, rightType)
+		return object.OperatorError(binaryOperators[op], l, r)
 	}
 }
 
@@ -403,23 +979,61 @@ func (vm *VM) executeBinaryIntegerOp(op code.Opcode, l, r object.Object) error {
 	rv := r.(*object.Integer).Value
 
 	var result int64
+	ok := true
 
 	switch op {
 	case code.OpAdd:
-		result = lv + rv
+		result, ok = object.AddInt(lv, rv)
 	case code.OpSub:
-		result = lv - rv
+		result, ok = object.SubInt(lv, rv)
 	case code.OpMul:
-		result = lv * rv
-	case code.OpDiv:
-		result = lv / rv
-	case code.OpMod:
-		result = lv % rv
+		result, ok = object.MulInt(lv, rv)
+	case code.OpDiv, code.OpMod:
+		if rv == 0 {
+			return object.NewError(object.KindDivisionByZero, "division by zero: %d %s 0", lv, binaryOperators[op])
+		}
+		if op == code.OpDiv {
+			result, ok = object.DivInt(lv, rv)
+		} else {
+			result = lv % rv
+		}
+	case code.OpBitOr:
+		result = lv | rv
+	case code.OpBitAnd:
+		result = lv & rv
+	case code.OpBitXor:
+		result = lv ^ rv
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rv < 0 {
+			return object.NewError(object.KindInvalidOperation, "negative shift count: %d", rv)
+		}
+		if op == code.OpShiftLeft {
+			result, ok = object.ShlInt(lv, rv)
+		} else {
+			result = lv >> rv
+		}
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return object.NewError(object.KindInternal, "unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	if !ok && vm.Overflow != object.OverflowWrap {
+		overflowed, err := object.Overflowed(vm.Overflow, binaryOperators[op], lv, rv)
+		if err != nil {
+			return err
+		}
+		return vm.push(overflowed)
+	}
+	return vm.push(object.GetInteger(result))
+}
+
+// executeBigOp applies op to integers at least one of which is a
+// BigInteger, pushing the result.
+func (vm *VM) executeBigOp(op code.Opcode, l, r object.Object) error {
+	result, err := object.BigInfix(binaryOperators[op], l, r)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
@@ -429,15 +1043,25 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	switch {
 	case l.Type() == object.INTEGER_OBJ && r.Type() == object.INTEGER_OBJ:
 		return vm.executeIntegerComparison(op, l, r)
+	case object.IsBigOperation(l, r):
+		return vm.executeBigOp(op, l, r)
+	case isNumber(l) && isNumber(r):
+		return vm.executeFloatComparison(op, l, r)
+	case l.Type() == object.STRING_OBJ && r.Type() == object.STRING_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		equal := l.(*object.String).Value == r.(*object.String).Value
+		return vm.push(object.NativeToBooleanObject(equal == (op == code.OpEqual)))
+	case l.Type() == object.BYTES_OBJ && r.Type() == object.BYTES_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		equal := bytes.Equal(l.(*object.Bytes).Value, r.(*object.Bytes).Value)
+		return vm.push(object.NativeToBooleanObject(equal == (op == code.OpEqual)))
 	}
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(r == l))
+		return vm.push(object.NativeToBooleanObject(r == l))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(r != l))
+		return vm.push(object.NativeToBooleanObject(r != l))
 	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, l.Type(), r.Type())
+		return object.OperatorError(binaryOperators[op], l, r)
 	}
 }
 
@@ -447,56 +1071,143 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, l, r object.Object) error
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(lv == rv))
+		return vm.push(object.NativeToBooleanObject(lv == rv))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(lv != rv))
+		return vm.push(object.NativeToBooleanObject(lv != rv))
 	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(lv > rv))
+		return vm.push(object.NativeToBooleanObject(lv > rv))
+	case code.OpGreaterEqual:
+		return vm.push(object.NativeToBooleanObject(lv >= rv))
+	case code.OpLessThan:
+		return vm.push(object.NativeToBooleanObject(lv < rv))
+	case code.OpLessEqual:
+		return vm.push(object.NativeToBooleanObject(lv <= rv))
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return object.NewError(object.KindInternal, "unknown integer operator: %d", op)
 	}
 }
 
+func (vm *VM) executeFloatComparison(op code.Opcode, l, r object.Object) error {
+	lv := toFloat(l)
+	rv := toFloat(r)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(object.NativeToBooleanObject(lv == rv))
+	case code.OpNotEqual:
+		return vm.push(object.NativeToBooleanObject(lv != rv))
+	case code.OpGreaterThan:
+		return vm.push(object.NativeToBooleanObject(lv > rv))
+	case code.OpGreaterEqual:
+		return vm.push(object.NativeToBooleanObject(lv >= rv))
+	case code.OpLessThan:
+		return vm.push(object.NativeToBooleanObject(lv < rv))
+	case code.OpLessEqual:
+		return vm.push(object.NativeToBooleanObject(lv <= rv))
+	default:
+		return object.NewError(object.KindInternal, "unknown float operator: %d", op)
+	}
+}
+
+// executeBinaryFloatOp handles arithmetic where at least one operand is a
+// Float; an Integer operand is promoted.
+func (vm *VM) executeBinaryFloatOp(op code.Opcode, l, r object.Object) error {
+	lv := toFloat(l)
+	rv := toFloat(r)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = lv + rv
+	case code.OpSub:
+		result = lv - rv
+	case code.OpMul:
+		result = lv * rv
+	case code.OpDiv:
+		result = lv / rv
+	default:
+		return object.NewError(object.KindTypeMismatch, "operator %s cannot operate with a %s and %s", binaryOperators[op], l.Type(), r.Type())
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+// binaryOperators maps binary opcodes back to their source operators for
+// error messages.
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpBitOr:        "|",
+	code.OpBitAnd:       "&",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+	code.OpLessThan:     "<",
+	code.OpLessEqual:    "<=",
+}
+
 func (vm *VM) executeStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
+		return object.OperatorError(binaryOperators[op], left, right)
 	}
 
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.pushAllocated(&object.String{Value: leftValue + rightValue})
 }
 
 func (vm *VM) executeBangOp() error {
 	operand := vm.pop()
 
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
-		return vm.push(True)
-	default:
-		return vm.push(False)
-	}
+	return vm.push(object.NativeToBooleanObject(!object.IsTruthy(operand)))
 }
 
 func (vm *VM) executeMinusOperator() error {
-	operand := vm.pop()
-
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	switch operand := vm.pop().(type) {
+	case *object.Integer:
+		negated, ok := object.NegInt(operand.Value)
+		if ok || vm.Overflow == object.OverflowWrap {
+			return vm.push(object.GetInteger(negated))
+		}
+		result, err := object.OverflowedNeg(vm.Overflow, operand.Value)
+		if err != nil {
+			return err
+		}
+		return vm.push(result)
+	case *object.BigInteger:
+		return vm.push(object.NewBigInteger(new(big.Int).Neg(operand.Value)))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return object.NewError(object.KindTypeMismatch, "unsupported type for negation: %s", operand.Type())
 	}
-
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= STACKSIZE {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		if err := vm.ensureStack(vm.sp + 1); err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = o
@@ -504,30 +1215,65 @@ func (vm *VM) push(o object.Object) error {
 	return nil
 }
 
-func (vm *VM) pop() object.Object {
-	o := vm.stack[vm.sp-1]
-	vm.sp--
-	return o
+// pushAllocated pushes a newly created value after charging it against
+// MaxBytes.
+func (vm *VM) pushAllocated(obj object.Object) error {
+	if err := vm.charge(object.SizeOf(obj)); err != nil {
+		return err
+	}
+	return vm.push(obj)
 }
 
-func (vm *VM) LastPoppedStackElem() object.Object {
-	return vm.stack[vm.sp]
+// charge counts n more bytes against MaxBytes. Without a limit bytes are
+// only counted for the hooks' statistics.
+func (vm *VM) charge(n int) error {
+	if vm.MaxBytes > 0 {
+		vm.bytes += n
+		if vm.bytes > vm.MaxBytes {
+			return object.NewError(object.KindLimitExceeded, "memory limit exceeded (limit %d bytes)", vm.MaxBytes)
+		}
+	} else if vm.Hooks != nil {
+		vm.bytes += n
+	}
+	return nil
 }
 
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return True
+// ensureStack grows the stack to hold at least n slots. Frames refer to the
+// stack by index, so they stay valid when it is reallocated.
+func (vm *VM) ensureStack(n int) error {
+	if n <= len(vm.stack) {
+		return nil
+	}
+	if n > vm.maxStack {
+		return object.NewError(object.KindLimitExceeded, "stack overflow: depth %d exceeds limit %d", n, vm.maxStack)
+	}
+
+	size := 2 * len(vm.stack)
+	if size < n {
+		size = n
 	}
-	return False
+	if size > vm.maxStack {
+		size = vm.maxStack
+	}
+
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj := obj.(type) {
-	case *object.Boolean:
-		return obj.Value
-	case *object.Null:
-		return false
-	default:
-		return true
+// pop leaves the value in its slot rather than clearing it: that is where
+// LastPoppedStackElem finds the program's result, and the next push
+// overwrites it. Only values above the stack pointer are kept alive this way.
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
 	}
+	return vm.stack[vm.sp]
 }
@@ -85,8 +85,13 @@ func testExpectedObject(
 			t.Errorf("testBooleanObject failed: %s", err)
 		}
 	case *object.Null:
-		if actual != Null {
-			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		if actual != object.NULL {
+			t.Errorf("object is not NULL: %T (%+v)", actual, actual)
+		}
+	case float64:
+		float, ok := actual.(*object.Float)
+		if !ok || float.Value != expected {
+			t.Errorf("object is not Float %g: %T (%+v)", expected, actual, actual)
 		}
 	case string:
 		err := testStringObject(expected, actual)
@@ -112,6 +117,22 @@ func testExpectedObject(
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case []interface{}:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.Elements[i])
+		}
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {
@@ -119,14 +140,18 @@ func testExpectedObject(
 			return
 		}
 
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 			return
 		}
 
+		pairs := map[object.HashKey]object.HashPair{}
+		for _, pair := range hash.Pairs() {
+			pairs[pair.Key.(object.Hashable).HashKey()] = pair
+		}
 		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+			pair, ok := pairs[expectedKey]
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
 			}
@@ -187,6 +212,24 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 > 1", true},
+		{"2 >= 2.0", true},
+		{"1 < 0.5", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -195,6 +238,11 @@ func TestBooleanExpressions(t *testing.T) {
 		{"1 > 2", false},
 		{"1 < 1", false},
 		{"1 > 1", false},
+		{"1 >= 1", true},
+		{"1 <= 1", true},
+		{"2 >= 1", true},
+		{"2 <= 1", false},
+		{"(1 <= 2) == true", true},
 		{"1 == 1", true},
 		{"1 != 1", false},
 		{"1 == 2", false},
@@ -215,11 +263,29 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!false", false},
 		{"!!5", true},
 		{"!(if (false) { 5; })", true},
+		{"!0", true},
+		{`!""`, true},
+		{"![]", true},
+		{"!{}", true},
+		{"![0]", false},
+		{`!"a"`, false},
+		{"!null", true},
+		{"!-5", false},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestPrefixErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"-true", "unsupported type for negation: BOOLEAN"},
+		{`-"a"`, "unsupported type for negation: STRING"},
+		{"-null", "unsupported type for negation: NULL"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func testBooleanObject(expected bool, actual object.Object) error {
 	result, ok := actual.(*object.Boolean)
 	if !ok {
@@ -235,6 +301,120 @@ func testBooleanObject(expected bool, actual object.Object) error {
 	return nil
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 0; y = x = 3; x + y", 6},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let x = 7; x %= 4", 3},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let i = 0; let sum = 0; while (i < 5) { i += 1; sum += i; }; sum", 15},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 1; let f = fn(x) { x = 5; x }; f(0) + x", 6},
+		{"let f = fn() { let a = 1; a += 1; let b = a * 10; b }; f()", 20},
+		// Assignments used as statements must not leave values behind.
+		{"let x = 0; x = 1; x = 2; x = 3; [x, x + 1]", []int{3, 4}},
+		{"let f = fn() { let n = 0; n = 1; n = 2; n }; f() + f()", 4},
+		{"let x = 0; [x = 1, x += 1, x]", []int{1, 2, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 10; a", []int{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[2] = a[0] + a[1]; a", []int{1, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] = 5", 5},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1]", 7},
+		{"let a = [[1], [2]]; a[1][0] = 9; a[1][0]", 9},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] *= 10; h["a"]`, 10},
+		{"let h = {}; h[true] = 1; h[1] = 2; h[true] + h[1]", 3},
+		{"let a = [0, 0]; let f = fn(arr) { arr[0] = 1 }; f(a); a[0]", 1},
+		{"let a = [0, 0, 0]; let i = 0; while (i < 3) { a[i] = i * i; i += 1; }; a[2]", 4},
+		// The assigned value replaces container and index on the stack.
+		{"let a = [0, 0]; a[0] = 1; a[1] = 2; 1 + 1; a[0] + a[1]", 3},
+		{"let a = [0]; let f = fn() { a[0] = 1; a[0] = 2; 7 }; f() + a[0]", 9},
+		{"let a = [0, 0]; [a[0] = 5, a[1] += 6, a[0]]", []int{5, 6, 5}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	runVmErrorTests(t, []vmTestCase{
+		{"let a = [1]; a[1] = 2", "ARRAY index 1 out of range for length 1"},
+		{"let a = [1]; a[-1] = 2", "ARRAY index -1 out of range for length 1"},
+		{`let a = [1]; a["x"] = 2`, "index assignment not supported: ARRAY[STRING]"},
+		{"let h = {}; h[[1]] = 2", "unusable as HASH key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING[INTEGER]"},
+		{"let a = [1]; a[3] += 1", "index 3 out of range for length 1"},
+	})
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { let i = i + 1; }; i", 10},
+		{"let i = 0; let sum = 0; while (i < 5) { let i = i + 1; let sum = sum + i; }; sum", 15},
+		{"let i = 0; while (false) { let i = i + 1; }; i", 0},
+		{"while (false) { 1 }", object.NULL},
+		{"let count = fn(n) { let i = 0; while (i < n) { let i = i + 1; }; i }; count(7)", 7},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i; }; let i = i + 1; } }; f()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (true) { if (i == 5) { break }; i += 1 }; i", 5},
+		{"let i = 0; let sum = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue }; sum += i }; sum", 25},
+		{"let i = 0; while (i < 3) { i += 1; break; i = 100 }; i", 1},
+		{"while (true) { break }", object.NULL},
+		{`let i = 0; let pairs = 0;
+		  while (i < 4) {
+		    let j = 0;
+		    while (true) {
+		      if (j >= i) { break }
+		      j += 1;
+		      if (j == 2) { continue }
+		      pairs += 1;
+		    }
+		    i += 1;
+		  };
+		  pairs`, 4},
+		{"let f = fn(n) { let i = 0; while (true) { if (i == n) { break }; i += 1 }; i * 10 }; f(3) + f(4)", 70},
+		{"let i = 0; while (i < 5) { i += 1; let f = fn() { i }; if (f() == 2) { break } }; i", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", 2},
+		{"0 && 2", 0},
+		{"0 || 2", 2},
+		{`"" || "default"`, "default"},
+		{"null || 3", 3},
+		{"1 < 2 && 2 < 3", true},
+		{"false || 1 > 2 || 3 > 2", true},
+		// The right operand would fail if it ran.
+		{"false && first(1)", false},
+		{"true || first(1)", true},
+		{"let check = fn(x) { x > 0 && x < 10 }; [check(5), check(50)]", []interface{}{true, false}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -244,24 +424,297 @@ func TestConditionals(t *testing.T) {
 		{"if (1 < 2) { 10 }", 10},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 > 2) { 10 }", Null},
-		{"if (false) { 10 }", Null},
+		{"if (1 > 2) { 10 }", object.NULL},
+		{"if (false) { 10 }", object.NULL},
 		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"null", object.NULL},
+		{"fn() { return; }()", object.NULL},
+		{"if (null) { 10 } else { 20 }", 20},
+		{"if (0) { 10 } else { 20 }", 20},
+		{`if ("") { 10 } else { 20 }`, 20},
+		{"if ([]) { 10 } else { 20 }", 20},
+		{"if ({}) { 10 } else { 20 }", 20},
+		{"if ([0]) { 10 } else { 20 }", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNullPropagation(t *testing.T) {
+	tests := []vmTestCase{
+		{"!(if (false) { 5 })", true},
+		{"!!(if (false) { 5 })", false},
+		{"null == null", true},
+		{"(if (false) { 5 }) == null", true},
+		{"null == 0", false},
+		{"null == false", false},
+		{"null != false", true},
+		{`null != ""`, true},
+		{"let f = fn() { if (false) { 1 } }; f() == null", true},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestBuiltinBooleansMatchVMBooleans(t *testing.T) {
+	tests := []vmTestCase{
+		{"is_null(null) == (1 < 2)", true},
+		{"is_null(1) == (1 > 2)", true},
+		{"is_null(null) != !false", false},
+		{"let t = is_null(null); let u = 2 >= 1; t == u", true},
+	}
+
+	runVmTests(t, tests)
+
+	// The same object, not just an equal one, so identity-based == holds.
+	for _, input := range []string{"is_null(null)", "1 < 2", "!false"} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", input, err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", input, err)
+		}
+		if vm.LastPoppedStackElem() != object.TRUE {
+			t.Errorf("%q: result is not object.TRUE", input)
+		}
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"5 | 2", 7},
+		{"5 & 4", 4},
+		{"5 ^ 1", 4},
+		{"3 << 2", 12},
+		{"-8 >> 1", -4},
+		{`"a" << "b"`, "ab"},
+	})
+
+	runVmErrorTests(t, []vmTestCase{
+		{"1 << -3", "negative shift count: -3"},
+		{"7 / (3 - 3)", "division by zero: 7 / 0"},
+		{"7 % 0", "division by zero: 7 % 0"},
+		{`"a" ^ "b"`, "unknown operator: STRING ^ STRING"},
+		{"true | false", "operator | cannot operate with a BOOLEAN and BOOLEAN"},
+	})
+}
+
+func TestNullOperatorErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"null + 1", "operator + cannot operate with a NULL and INTEGER"},
+		{"1 - (if (false) { 1 })", "operator - cannot operate with a INTEGER and NULL"},
+		{"null > 1", "operator > cannot operate with a NULL and INTEGER"},
+		{"null >= null", "operator >= cannot operate with a NULL and NULL"},
+		{"true > false", "operator > cannot operate with a BOOLEAN and BOOLEAN"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestStringOperatorErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{`"a" * "b"`, "unknown operator: STRING * STRING"},
+		{`"a" / "b"`, "unknown operator: STRING / STRING"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []vmTestCase{
 		{"let one = 1; one", 1},
 		{"let one = 1; let two = 2; one + two", 3},
 		{"let one = 1; let two = one + one; one + two", 3},
+		{"let x = 5; x + 1", 6},
+		{"let a = 1; let b = a * 2; let c = b * 2; let d = c * 2; d", 8},
+		{"let x = 1; if (true) { let x = x + 1; }; x", 2},
+		{"if (true) { let y = 1; }", object.NULL},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestGlobalsStorePersists(t *testing.T) {
+	globals := make([]object.Object, GLOBALSSIZE)
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+
+	var result object.Object
+	for _, line := range []string{"let x = 5;", "let y = x * 2;", "x + y"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(line)); err != nil {
+			t.Fatalf("%q: compiler error: %s", line, err)
+		}
+		constants = comp.Bytecode().Constants
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", line, err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	testExpectedObject(t, 15, result)
+}
+
+func TestResetKeepsGlobals(t *testing.T) {
+	globals := make([]object.Object, GLOBALSSIZE)
+	comp := compiler.New()
+
+	var machine *VM
+	for i, tt := range []vmTestCase{
+		{"let total = 1;", nil},
+		{"let total = total + 10; total", 11},
+		{"total * 2", 22},
+	} {
+		comp = compiler.NewWithState(comp.SymbolTable(), comp.Constants())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		if machine == nil {
+			machine = NewWithGlobalsStore(comp.Bytecode(), globals)
+		} else {
+			machine.Reset(comp.Bytecode())
+		}
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+		if i > 0 {
+			testExpectedObject(t, tt.expected, machine.LastPoppedStackElem())
+		}
+	}
+
+	if &machine.Globals()[0] != &globals[0] {
+		t.Errorf("Globals does not return the store passed in")
+	}
+}
+
+func TestResetClearsStackAndFrames(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let f = fn(x) { if (x == 0) { 1 + [] } else { f(x - 1) } }; f(5)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err == nil {
+		t.Fatalf("expected VM error but resulted in none")
+	}
+	if machine.framesIndex == 1 || machine.sp == 0 {
+		t.Fatalf("error should leave frames and stack in use. frames=%d, sp=%d", machine.framesIndex, machine.sp)
+	}
+
+	comp = compiler.NewWithState(comp.SymbolTable(), comp.Constants())
+	if err := comp.Compile(parse("2 + 3")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine.Reset(comp.Bytecode())
+
+	if machine.framesIndex != 1 {
+		t.Errorf("Reset left frames. want=1, got=%d", machine.framesIndex)
+	}
+	if machine.sp != 0 {
+		t.Errorf("Reset left the stack pointer at %d", machine.sp)
+	}
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error after Reset: %s", err)
+	}
+	testExpectedObject(t, 5, machine.LastPoppedStackElem())
+}
+
+func TestRunTwiceWithoutReset(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("1")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	err := machine.Run()
+	if err == nil || err.Error() != "vm already ran; call Reset before running again" {
+		t.Errorf("wrong error on second Run. got=%v", err)
+	}
+}
+
+func benchmarkSnippets(b *testing.B) []*compiler.Bytecode {
+	comp := compiler.New()
+	var snippets []*compiler.Bytecode
+	for _, line := range []string{"let x = 1;", "let y = x + 1;", "x * y"} {
+		comp = compiler.NewWithState(comp.SymbolTable(), comp.Constants())
+		if err := comp.Compile(parse(line)); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		snippets = append(snippets, comp.Bytecode())
+	}
+	return snippets
+}
+
+func BenchmarkFreshVMPerSnippet(b *testing.B) {
+	snippets := benchmarkSnippets(b)
+	globals := make([]object.Object, GLOBALSSIZE)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, bytecode := range snippets {
+			if err := NewWithGlobalsStore(bytecode, globals).Run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkResetVMPerSnippet(b *testing.B) {
+	snippets := benchmarkSnippets(b)
+	machine := NewWithGlobalsStore(snippets[0], make([]object.Object, GLOBALSSIZE))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, bytecode := range snippets {
+			machine.Reset(bytecode)
+			if err := machine.Run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestIncrementalCompilation(t *testing.T) {
+	globals := make([]object.Object, GLOBALSSIZE)
+	comp := compiler.New()
+
+	var result object.Object
+	for _, line := range []string{"let a = 1;", "let b = a + 1;", "a + b"} {
+		comp = compiler.NewWithState(comp.SymbolTable(), comp.Constants())
+		if err := comp.Compile(parse(line)); err != nil {
+			t.Fatalf("%q: compiler error: %s", line, err)
+		}
+
+		machine := NewWithGlobalsStore(comp.Bytecode(), globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", line, err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+
+	testExpectedObject(t, 3, result)
+
+	if symbol, ok := comp.SymbolTable().Resolve("b"); !ok || symbol.Index != 1 {
+		t.Errorf("b not kept in the symbol table. got=%+v", symbol)
+	}
+	if n := len(comp.Constants()); n != 1 {
+		t.Errorf("wrong number of constants. want=1, got=%d", n)
+	}
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
@@ -277,6 +730,9 @@ func TestArrayLiterals(t *testing.T) {
 		{"[]", []int{}},
 		{"[1, 2, 3]", []int{1, 2, 3}},
 		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+		{"[1 + 1, 2 * 2]", []int{2, 4}},
+		{"[[], [1, [2]], 3]", []interface{}{[]int{}, []interface{}{1, []int{2}}, 3}},
+		{`[[1, "a"], true]`, []interface{}{[]interface{}{1, "a"}, true}},
 	}
 
 	runVmTests(t, tests)
@@ -301,9 +757,21 @@ func TestHashLiterals(t *testing.T) {
 				(&object.Integer{Value: 6}).HashKey(): 16,
 			},
 		},
+		{
+			`{1: 2 + 2, "a" + "b": 3}`,
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey():   4,
+				(&object.String{Value: "ab"}).HashKey(): 3,
+			},
+		},
 	}
 
 	runVmTests(t, tests)
+
+	runVmErrorTests(t, []vmTestCase{
+		{`{fn() { 1 }: 2}`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+	})
 }
 
 func TestIndexExpressions(t *testing.T) {
@@ -311,16 +779,26 @@ func TestIndexExpressions(t *testing.T) {
 		{"[1, 2, 3][1]", 2},
 		{"[1, 2, 3][0 + 2]", 3},
 		{"[[1, 1, 1]][0][0]", 1},
-		{"[][0]", Null},
-		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"let a = [1, 2, 3]; let i = a[0]; a[i]", 2},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
-		{"{1: 1}[0]", Null},
-		{"{}[0]", Null},
+		{`{"foo": 5}["foo"]`, 5},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{"{true: 5}[true]", 5},
+		{"{1: 1}[0]", object.NULL},
+		{"{}[0]", object.NULL},
 	}
 
 	runVmTests(t, tests)
+
+	runVmErrorTests(t, []vmTestCase{
+		{"[][0]", "index 0 out of range for length 0"},
+		{"[1, 2, 3][99]", "index 99 out of range for length 3"},
+		{"[1][-1]", "index -1 out of range for length 1"},
+		{`[1]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{`1["a"]`, "index operator not supported: INTEGER[STRING]"},
+		{`{}[fn(x) { x }]`, "unusable as hash key: FUNCTION"},
+	})
 }
 
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
@@ -349,11 +827,44 @@ func TestCallingFunctionsWithoutArguments(t *testing.T) {
         `,
 			expected: 3,
 		},
+		{
+			input:    `let fifteen = fn() { 5 + 10 }(); fifteen`,
+			expected: 15,
+		},
+		{
+			input: `
+        let apply = fn(f, x) { f(x) };
+        let double = fn(x) { x * 2 };
+        apply(double, 21)
+        `,
+			expected: 42,
+		},
+		{
+			input: `
+        let fns = [fn() { 1 }, fn() { 2 }];
+        fns[0]() + fns[1]()
+        `,
+			expected: 3,
+		},
+		{
+			input:    `fn() { }()`,
+			expected: object.NULL,
+		},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestCallingNonFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"5()", "not a function: INTEGER"},
+		{`let s = "a"; s(1)`, "not a function: STRING"},
+		{"[1, 2](0)", "not a function: ARRAY"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestFunctionsWithReturnStatement(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -382,7 +893,7 @@ func TestFunctionsWithoutReturnValue(t *testing.T) {
         let noReturn = fn() { };
         noReturn();
         `,
-			expected: Null,
+			expected: object.NULL,
 		},
 		{
 			input: `
@@ -391,7 +902,7 @@ func TestFunctionsWithoutReturnValue(t *testing.T) {
         noReturn();
         noReturnTwo();
         `,
-			expected: Null,
+			expected: object.NULL,
 		},
 	}
 
@@ -445,6 +956,30 @@ func TestCallingFunctionsWithBindings(t *testing.T) {
         `,
 			expected: 97,
 		},
+		{
+			input: `
+        let x = 1;
+        let shadow = fn() { let x = 2; x };
+        shadow() + x
+        `,
+			expected: 3,
+		},
+		{
+			input: `
+        let x = 1;
+        let param = fn(x) { x * 10 };
+        param(5) + x
+        `,
+			expected: 51,
+		},
+		{
+			input: `
+        let add = fn(a, b) { let sum = a + b; sum };
+        let mul = fn(a, b) { let product = a * b; product };
+        add(1, 2) + mul(3, 4) + add(5, 6)
+        `,
+			expected: 26,
+		},
 	}
 
 	runVmTests(t, tests)
@@ -488,6 +1023,32 @@ func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// runVmErrorTests expects each input to compile and then fail in the VM with
+// the error message held in expected.
+func runVmErrorTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("%q: expected VM error but resulted in none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -529,48 +1090,38 @@ func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
 		{`len("four")`, 4},
+		{`len("hello")`, 5},
 		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: fmt.Errorf("argument to `len` not supported, got INTEGER"),
-			},
-		},
-		{`len("one", "two")`,
-			&object.Error{
-				Message: fmt.Errorf("wrong number of arguments. got=2, want=1"),
-			},
-		},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
-		{`puts("hello", "world!")`, Null},
+		{`puts("hello", "world!")`, object.NULL},
 		{`first([1, 2, 3])`, 1},
-		{`first([])`, Null},
-		{`first(1)`,
-			&object.Error{
-				Message: fmt.Errorf("argument to `first` must be ARRAY, got INTEGER"),
-			},
-		},
+		{`first([])`, object.NULL},
 		{`last([1, 2, 3])`, 3},
-		{`last([])`, Null},
-		{`last(1)`,
-			&object.Error{
-				Message: fmt.Errorf("argument to `last` must be ARRAY, got INTEGER"),
-			},
-		},
+		{`last([])`, object.NULL},
 		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, Null},
+		{`rest([])`, object.NULL},
 		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`,
-			&object.Error{
-				Message: fmt.Errorf("argument to `push` must be ARRAY, got INTEGER"),
-			},
-		},
+		{`push([1], 2)`, []int{1, 2}},
+		{`let f = fn(arr) { len(arr) }; f([1, 2])`, 2},
+		{`let len = fn(x) { 42 }; len("hello")`, 42},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestBuiltinFunctionErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(1)`, "len: argument 1 must be STRING, ARRAY, BYTES or RANGE, got INTEGER"},
+		{`len("one", "two")`, "len: expected 1 argument, got 2"},
+		{`first(1)`, "first: argument 1 must be ARRAY or STRING, got INTEGER"},
+		{`last(1)`, "last: argument 1 must be ARRAY or STRING, got INTEGER"},
+		{`push(1, 1)`, "push: argument 1 must be ARRAY or STRING, got INTEGER"},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -604,6 +1155,65 @@ func TestClosures(t *testing.T) {
         `,
 			expected: 11,
 		},
+		{
+			input: `
+        let add = fn(a) { fn(b) { a + b } };
+        let addTwo = add(2);
+        let addTen = add(10);
+        addTwo(1) + addTen(1)
+        `,
+			expected: 14,
+		},
+		{
+			input: `
+        let counter = fn(start) {
+            fn(step) { fn() { start + step } }
+        };
+        let fromFive = counter(5);
+        fromFive(1)() + fromFive(2)()
+        `,
+			expected: 13,
+		},
+		{
+			input: `
+        let wrapper = fn() {
+            let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+            countDown(5);
+        };
+        wrapper();
+        `,
+			expected: 0,
+		},
+		{
+			input: `
+        let sumTo = fn(n) {
+            let go = fn(x, acc) {
+                if (x == 0) { acc } else { go(x - 1, acc + x) }
+            };
+            go(n, 0);
+        };
+        sumTo(100);
+        `,
+			expected: 5050,
+		},
+		{
+			input: `
+        let outer = fn(start) {
+            let rec = fn(x) { if (x == 0) { start } else { rec(x - 1) } };
+            rec(3);
+        };
+        outer(7);
+        `,
+			expected: 7,
+		},
+		{
+			// A parameter with the function's own name hides the function.
+			input: `
+        let f = fn(f) { f * 2 };
+        f(21);
+        `,
+			expected: 42,
+		},
 	}
 
 	runVmTests(t, tests)
@@ -668,3 +1278,155 @@ func TestRecursiveFibonacci(t *testing.T) {
 
 	runVmTests(t, tests)
 }
+
+func TestMemo(t *testing.T) {
+	vm := New(compileForTest(t, `
+let fib = memo(fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+});
+fib(30);
+`))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 832040, vm.LastPoppedStackElem())
+
+	memoized, ok := vm.Globals()[0].(*object.Memoized)
+	if !ok {
+		t.Fatalf("fib is not Memoized. got=%T", vm.Globals()[0])
+	}
+	if hits, misses := memoized.Stats(); misses != 31 || hits != 28 {
+		t.Errorf("wrong cache use. misses=%d, want=31, hits=%d, want=28", misses, hits)
+	}
+
+	runVmTests(t, []vmTestCase{
+		{`let double = memo(fn(x) { x * 2 }); let triple = memo(fn(x) { x * 3 }); [double(2), triple(2), double(2), triple(2)]`, []int{4, 6, 4, 6}},
+		{`let calls = [0]; let f = memo(fn(x) { calls[0] += 1; x }); f(1); f(1); f(2); calls[0]`, 2},
+		{`let calls = [0]; let f = memo(fn(x) { calls[0] += 1 }); [f(1), f(1), calls[0]]`, []int{1, 1, 1}},
+		{`let calls = [0]; let f = memo(fn(x) { calls[0] += 1; null }); f(1); f(1); calls[0]`, 1},
+		{`let calls = [0]; let g = fn(x) { calls[0] += 1; x * 10 }; let f = memo(fn(x) { g(x) }); [f(3), f(3), calls[0]]`, []int{30, 30, 1}},
+		{`let calls = [0]; let f = memo(memo(fn(x) { calls[0] += 1; x })); [f(1), f(1), calls[0]]`, []int{1, 1, 1}},
+		{`let total = memo(fn(arr) { len(arr) }); [total([1, 2]), total([1, 2, 3]), total([1, 2])]`, []int{2, 3, 2}},
+		{`let size = memo(len); [size("abc"), size("abc"), size([1])]`, []int{3, 3, 1}},
+	})
+}
+
+func TestCallStackExhausted(t *testing.T) {
+	runVmErrorTests(t, []vmTestCase{
+		{"let f = fn() { f(); 1 }; f()", "call stack exhausted"},
+		{"let f = fn() { 1 + f() }; f()", "call stack exhausted"},
+	})
+
+	runVmTests(t, []vmTestCase{
+		{"let down = fn(x) { if (x == 0) { 0 } else { 0 + down(x - 1) } }; down(500)", 0},
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"let loop = fn(n, acc) { if (n == 0) { return acc; } return loop(n - 1, acc + 1); }; loop(1000000, 0)", 1000000},
+		{"let loop = fn(n) { if (n == 0) { \"done\" } else { loop(n - 1) } }; loop(1000000)", "done"},
+		{"let big = fn(n) { let a = 1; let b = 2; a + b + n }; let small = fn(n) { big(n) }; small(1)", 4},
+		{"let pick = fn(n) { if (n == 0) { true } else { let m = n - 1; pick(m) } }; [pick(10), pick(0)]", []interface{}{true, true}},
+		{"let outer = fn(x) { let inner = fn(y) { x + y }; inner(1) }; outer(41)", 42},
+		{"let count = fn(xs) { return len(xs); }; count([1, 2, 3])", 3},
+	})
+
+	runVmErrorTests(t, []vmTestCase{
+		{"let f = fn(a) { a }; let g = fn() { f(1, 2) }; g()", "wrong number of arguments: want=1, got=2"},
+	})
+}
+
+func TestMaxFrames(t *testing.T) {
+	tests := []struct {
+		depth  string
+		failed bool
+	}{
+		// The main frame counts, so ten frames fit down(8).
+		{"8", false},
+		{"9", true},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		input := "let down = fn(x) { if (x == 0) { 0 } else { 0 + down(x - 1) } }; down(" + tt.depth + ")"
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.MaxFrames = 10
+		err := vm.Run()
+		if tt.failed && (err == nil || err.Error() != "call stack exhausted") {
+			t.Errorf("down(%s): expected call stack exhausted, got=%v", tt.depth, err)
+		}
+		if !tt.failed && err != nil {
+			t.Errorf("down(%s): unexpected error: %s", tt.depth, err)
+		}
+	}
+}
+
+func TestFramesRestoredAfterCalls(t *testing.T) {
+	input := `
+	let inner = fn(x) { x * 2 };
+	let middle = fn(x) { inner(x) + inner(x + 1) };
+	let outer = fn() { middle(1) + middle(2) };
+	outer() + inner(100)
+	`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if vm.framesIndex != 1 {
+		t.Errorf("frames left on the stack. want=1, got=%d", vm.framesIndex)
+	}
+	if ip := vm.currentFrame().ip; ip != len(bytecode.Instructions)-1 {
+		t.Errorf("main frame ip wrong. want=%d, got=%d", len(bytecode.Instructions)-1, ip)
+	}
+	if vm.sp != 0 {
+		t.Errorf("stack not empty. sp=%d", vm.sp)
+	}
+	testExpectedObject(t, 216, vm.LastPoppedStackElem())
+}
+
+func TestPeepholeOptimizedPrograms(t *testing.T) {
+	tests := []vmTestCase{
+		{"1; 2; 3", 3},
+		{"!true", false},
+		{"if (!false) { 10 } else { 20 }", 10},
+		{"let f = fn() { 1; 2; !true }; f()", false},
+		{"let i = 0; while (i < 3) { 5; let i = i + 1; }; i", 3},
+		{"false || 1; true && !true", false},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.Peephole = true
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestReturnOutsideFunction(t *testing.T) {
+	runVmErrorTests(t, []vmTestCase{
+		{input: "return 5; 6", expected: "return outside a function at ip=0003"},
+		{input: "let x = 3; if (x > 2) { return x * 2; }; 0", expected: "return outside a function at ip=0023"},
+	})
+}